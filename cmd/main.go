@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/pressly/goose/v3"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"song-library-test-task/internal/external"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	_ "github.com/lib/pq"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"song-library-test-task/internal/config"
+	grpctransport "song-library-test-task/internal/handler/grpc"
 	httptransport "song-library-test-task/internal/handler/http"
 	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
 	"song-library-test-task/internal/models"
 	"song-library-test-task/internal/repository/postgres"
 	"song-library-test-task/internal/service"
@@ -21,38 +30,54 @@ import (
 
 // @title           Song Library API
 // @version         1.0
-// @description     This is an example service for managing songs.
+// @description     This is an example service for managing songs. Every route accepts a "tz" query parameter (an IANA zone such as Europe/Moscow) in which song timestamps are rendered; the default is UTC.
 // @host            localhost:8080
 // @BasePath        /
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("[WARN] no .env file found")
-	}
+	cfg := config.MustLoadConfig()
 
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPass := getEnv("DB_PASS", "")
-	dbName := getEnv("DB_NAME", "songsdb")
-	extAPI := getEnv("EXTERNAL_API_BASE_URL", "http://localhost:3000")
+	logLevel, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("[ERROR] LOG_LEVEL: %v", err)
+	}
+	appLogger := logger.NewStdLogger(logLevel)
 
 	// Connect to DB
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPass, dbName,
+		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName,
 	)
+	if param := postgres.SearchPathParam(cfg.DBSchema); param != "" {
+		dsn += " " + param
+	}
+	if param := postgres.StatementTimeoutParam(cfg.DBStatementTimeout); param != "" {
+		dsn += " " + param
+	}
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		log.Fatalf("[ERROR] Could not open DB: %v", err)
 	}
 	defer db.Close()
+	cfg.ApplyPool(db)
 
-	if err := db.Ping(); err != nil {
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 5*time.Second)
+	err = db.PingContext(pingCtx)
+	cancelPing()
+	if err != nil {
 		log.Fatalf("[ERROR] Could not connect to DB: %v", err)
 	}
 	log.Println("[INFO] Connected to Postgres")
 
+	if err := postgres.EnsureSchema(context.Background(), db, cfg.DBSchema); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
 	goose.SetBaseFS(nil)
-	migrationsDir := "./db/migrations"
+	migrationsDir := cfg.MigrationsDir
+	if cfg.RequireMigrations {
+		if err := postgres.CheckMigrations(os.DirFS(migrationsDir), "."); err != nil {
+			log.Fatalf("[ERROR] %s: %v", migrationsDir, err)
+		}
+	}
 
 	// 2. Run the migrations
 	if err := goose.Up(db, migrationsDir); err != nil {
@@ -60,32 +85,195 @@ func main() {
 	}
 
 	log.Println("[INFO] Migrations applied successfully")
+
+	if err := postgres.CheckCollation(context.Background(), db, cfg.SortCollation); err != nil {
+		log.Fatalf("[ERROR] SORT_COLLATION: %v", err)
+	}
+
 	// Initialize repository
-	var repo models.SongRepository = postgres.NewSongRepository(db)
+	var repo models.SongRepository = postgres.NewSongRepository(db,
+		postgres.WithSortCollation(cfg.SortCollation),
+		postgres.WithLogger(appLogger),
+		postgres.WithSlowQueryThreshold(cfg.DBSlowQueryThreshold),
+	)
 
 	// Initialize external client
-	externalClient := external.NewMusicInfoClient(extAPI, 5*time.Second)
+	externalClient := external.NewMusicInfoClient(cfg.ExternalAPIBaseURL, 5*time.Second,
+		external.WithTransport(cfg.ExternalTransport),
+		external.WithFieldMapping(cfg.ExternalFields),
+		external.WithRetry(cfg.ExternalMaxAttempts, cfg.ExternalRetryBackoff),
+		external.WithCircuitBreaker(cfg.ExternalBreaker),
+	)
+
+	// Initialize metrics
+	enrichments := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "song_library",
+		Subsystem: "enrichment",
+		Name:      "results_total",
+		Help:      "Number of external enrichment attempts by outcome.",
+	}, []string{"outcome"})
+	historyPurged := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "song_library",
+		Subsystem: "history",
+		Name:      "purged_total",
+		Help:      "Number of song history entries removed by the retention job.",
+	}, []string{})
 
 	// Initialize service
-	svc := service.NewSongService(repo, externalClient)
+	svc := service.NewSongService(repo, externalClient,
+		service.WithLogger(appLogger),
+		service.WithEnrichmentCounter(enrichments),
+		service.WithLyricsNormalization(cfg.NormalizeLyrics),
+		service.WithTitleCase(cfg.TitleCaseNames),
+		service.WithMaxPageSize(cfg.MaxPageSize),
+		service.WithExportMaxRows(cfg.ExportMaxRows),
+		service.WithImportMaxRows(cfg.ImportMaxRows),
+		service.WithFieldPrecedence(cfg.FieldPrecedence),
+		service.WithRequireListFilter(cfg.RequireListFilter),
+		service.WithAllowPartialEnrichment(cfg.AllowPartialEnrichment),
+		service.WithRequireLyrics(cfg.RequireLyricsOnCreate),
+		service.WithItemEnrichTimeout(cfg.BatchEnrichTimeout),
+		service.WithIdempotencyStore(postgres.NewIdempotencyStore(db)),
+		service.WithHistoryRetention(cfg.HistoryRetention),
+		service.WithHistoryPurgeCounter(historyPurged),
+	)
+
+	// Forget expired idempotency keys in the background until shutdown.
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if _, err := svc.PurgeIdempotencyKeys(cleanupCtx); err != nil && cleanupCtx.Err() == nil {
+				log.Printf("[WARN] %v", err)
+			}
+			select {
+			case <-cleanupCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Purge song history past its retention, when enabled, until shutdown.
+	if cfg.HistoryRetentionEnabled && cfg.HistoryPurgeInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.HistoryPurgeInterval)
+			defer ticker.Stop()
+			for {
+				if _, err := svc.PurgeHistory(cleanupCtx); err != nil && cleanupCtx.Err() == nil {
+					log.Printf("[WARN] %v", err)
+				}
+				select {
+				case <-cleanupCtx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
 
 	// Build endpoints
-	eps := endpoints.MakeSongEndpoints(*svc)
+	eps := endpoints.MakeSongEndpoints(*svc,
+		endpoints.WithNullEmptyLyrics(cfg.NullEmptyLyrics),
+		endpoints.WithTextPreviewLength(cfg.TextPreviewLength),
+		endpoints.WithMiddleware(middleware.NewMetricsMiddleware(cfg.MetricsNamespace)),
+		endpoints.WithMiddleware(middleware.NewLoggingMiddleware(appLogger, cfg.MetricsNamespace, cfg.SlowRequestThreshold)),
+	)
 
-	// Create HTTP handler
-	handler := httptransport.NewHTTPHandler(eps)
+	// Create HTTP handler. The middleware options wrap in the order given,
+	// the first outermost.
+	var handlerOpts []httptransport.HandlerOption
+	if cfg.HSTSEnabled() {
+		handlerOpts = append(handlerOpts, httptransport.WithMiddleware(middleware.HSTS(cfg.HSTSMaxAge, cfg.HSTSIncludeSubDomains)))
+	}
+	handlerOpts = append(handlerOpts,
+		httptransport.WithTraceID(),
+		httptransport.WithMetrics(stdprometheus.WrapRegistererWithPrefix(cfg.MetricsNamespace+"_", stdprometheus.DefaultRegisterer)),
+	)
+	switch cfg.RateLimitMode {
+	case middleware.RateLimitModeGlobal:
+		handlerOpts = append(handlerOpts, httptransport.WithRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst))
+	case middleware.RateLimitModeIP:
+		handlerOpts = append(handlerOpts, httptransport.WithPerIPRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst))
+	default:
+		log.Fatalf("[ERROR] RATE_LIMIT_MODE must be %q or %q, got %q", middleware.RateLimitModeGlobal, middleware.RateLimitModeIP, cfg.RateLimitMode)
+	}
+	handlerOpts = append(handlerOpts,
+		httptransport.WithMiddleware(
+			middleware.APIKey(cfg.TrustedAPIKeys),
+			middleware.Timeout(cfg.RequestTimeout, cfg.RequestTimeoutMax),
+		),
+		httptransport.WithCORSOrigins(cfg.CORSAllowedOrigins),
+		httptransport.WithMaxBodyBytes(cfg.RequestMaxBodyBytes),
+	)
+	if cfg.StrictQueryParams {
+		handlerOpts = append(handlerOpts, httptransport.WithStrictQueryParams())
+	}
+	handler := httptransport.NewHTTPHandler(eps, httptransport.ServerDependencies{
+		DB:         db,
+		Migrations: postgres.Migrations{DB: db, Dir: migrationsDir},
+		Logger:     appLogger,
+	}, handlerOpts...)
 
 	// Start server
-	addr := ":8080"
-	log.Printf("[INFO] Listening on %s", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	srv := &http.Server{
+		Addr:         ":8080",
+		Handler:      handler,
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
+		IdleTimeout:  cfg.ServerIdleTimeout,
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		if cfg.TLSEnabled() {
+			log.Printf("[INFO] Listening on %s (TLS)", srv.Addr)
+			serveErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Printf("[INFO] Listening on %s", srv.Addr)
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	// The gRPC transport serves the same endpoints on its own port.
+	grpcSrv := grpctransport.NewGRPCServer(eps, grpctransport.WithAPIKeys(cfg.TrustedAPIKeys))
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		log.Fatalf("[ERROR] Could not listen for gRPC: %v", err)
+	}
+	go func() {
+		log.Printf("[INFO] gRPC listening on %s", grpcListener.Addr())
+		serveErr <- grpcSrv.Serve(grpcListener)
+	}()
+
+	// Wait for a shutdown signal, then let in-flight requests finish.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
 		log.Fatalf("[ERROR] %v", err)
+	case sig := <-stop:
+		log.Printf("[INFO] Received %s, shutting down", sig)
 	}
-}
 
-func getEnv(key, fallback string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ServerShutdownTimeout)
+	defer cancel()
+	// Both transports drain concurrently; gRPC calls still running when the
+	// shutdown timeout expires are cut off.
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(grpcStopped)
+	}()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[ERROR] Graceful shutdown failed: %v", err)
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcSrv.Stop()
 	}
-	return fallback
+	log.Println("[INFO] Server stopped")
 }
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE songs
+    ALTER COLUMN group_name TYPE VARCHAR(512),
+    ALTER COLUMN title TYPE VARCHAR(512);
+
+-- +goose Down
+ALTER TABLE songs
+    ALTER COLUMN group_name TYPE TEXT,
+    ALTER COLUMN title TYPE TEXT;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE;
+-- Songs stored before visibility existed were readable by everyone, so they
+-- stay public; only songs created from now on default to private.
+UPDATE songs SET is_public = TRUE;
+
+-- +goose Down
+ALTER TABLE songs DROP COLUMN is_public;
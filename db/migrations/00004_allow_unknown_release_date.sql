@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE songs ALTER COLUMN release_date DROP NOT NULL;
+
+-- +goose Down
+ALTER TABLE songs ALTER COLUMN release_date SET NOT NULL;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_songs_release_date ON songs (release_date);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_songs_release_date;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN enriched_at TIMESTAMPTZ NULL;
+
+-- Songs stored before this column existed count as enriched if the external
+-- API supplied anything for them.
+UPDATE songs SET enriched_at = created_at
+WHERE release_date IS NOT NULL OR link <> '' OR text <> '';
+
+-- +goose Down
+ALTER TABLE songs DROP COLUMN enriched_at;
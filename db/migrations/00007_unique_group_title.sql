@@ -0,0 +1,31 @@
+-- +goose Up
+-- The constraint cannot be added while duplicates exist, and dropping them
+-- would lose data, so the migration fails listing every duplicate
+-- (group_name, title) pair instead. Merge or delete the extra copies by hand,
+-- then run the migration again.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('(%L, %L): %s songs', group_name, title, n), ', ' ORDER BY group_name, title)
+    INTO duplicates
+    FROM (
+        SELECT group_name, title, COUNT(*) AS n
+        FROM songs
+        GROUP BY group_name, title
+        HAVING COUNT(*) > 1
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'songs has duplicate (group_name, title) pairs: %', duplicates
+            USING HINT = 'Merge or delete the duplicate songs, then rerun the migration.';
+    END IF;
+END;
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE songs ADD CONSTRAINT songs_group_name_title_key UNIQUE (group_name, title);
+
+-- +goose Down
+ALTER TABLE songs DROP CONSTRAINT songs_group_name_title_key;
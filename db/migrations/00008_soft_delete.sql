@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+-- Deleted songs keep their row, so only live songs must have a unique
+-- (group_name, title); a deleted song's key can be reused.
+ALTER TABLE songs DROP CONSTRAINT songs_group_name_title_key;
+CREATE UNIQUE INDEX songs_group_name_title_live_key ON songs (group_name, title) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DELETE FROM songs WHERE deleted_at IS NOT NULL;
+DROP INDEX songs_group_name_title_live_key;
+ALTER TABLE songs ADD CONSTRAINT songs_group_name_title_key UNIQUE (group_name, title);
+ALTER TABLE songs DROP COLUMN deleted_at;
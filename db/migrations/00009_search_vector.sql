@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN search_vector TSVECTOR;
+
+-- +goose StatementBegin
+CREATE FUNCTION songs_search_vector_update() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := to_tsvector('english',
+        coalesce(NEW.group_name, '') || ' ' || coalesce(NEW.title, '') || ' ' || coalesce(NEW.text, ''));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER songs_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF group_name, title, text ON songs
+    FOR EACH ROW EXECUTE FUNCTION songs_search_vector_update();
+
+UPDATE songs SET search_vector = to_tsvector('english',
+    coalesce(group_name, '') || ' ' || coalesce(title, '') || ' ' || coalesce(text, ''));
+
+CREATE INDEX songs_search_vector_idx ON songs USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX songs_search_vector_idx;
+DROP TRIGGER songs_search_vector_trigger ON songs;
+DROP FUNCTION songs_search_vector_update();
+ALTER TABLE songs DROP COLUMN search_vector;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- song_id is NULL while the request holding the key is in flight.
+CREATE TABLE idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    song_id    BIGINT NULL REFERENCES songs (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +goose Down
+DROP TABLE idempotency_keys;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TYPE song_history_operation AS ENUM ('create', 'update', 'delete');
+
+-- song_id has no foreign key, so the history outlives hard deletes.
+CREATE TABLE song_history (
+    id          BIGSERIAL PRIMARY KEY,
+    song_id     BIGINT NOT NULL,
+    operation   song_history_operation NOT NULL,
+    snapshot    JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX song_history_song_id_idx ON song_history (song_id, id);
+
+-- +goose Down
+DROP TABLE song_history;
+DROP TYPE song_history_operation;
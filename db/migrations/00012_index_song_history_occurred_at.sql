@@ -0,0 +1,6 @@
+-- +goose Up
+-- Serves the retention job, which deletes by age.
+CREATE INDEX IF NOT EXISTS idx_song_history_occurred_at ON song_history (occurred_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_song_history_occurred_at;
@@ -4,17 +4,131 @@ import (
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"song-library-test-task/internal/external"
+	"song-library-test-task/internal/service"
 )
 
+// Config is the complete service configuration, read from the environment
+// (and an optional .env file) by LoadConfig.
 type Config struct {
-	DBHost             string
-	DBPort             string
-	DBUser             string
-	DBPass             string
-	DBName             string
-	ExternalAPIBaseURL string
+	DBHost   string
+	DBPort   string
+	DBUser   string
+	DBPass   string
+	DBName   string
+	DBSchema string
+	// SortCollation is the collation used when ordering by group name;
+	// empty uses the database default.
+	SortCollation string
+	// Connection pool limits. Keep DBMaxOpenConns times the number of
+	// replicas below the server's max_connections (100 by default); in
+	// production 25 open / 5 idle per replica with a 5 minute lifetime works
+	// well, and the lifetime lets connections rebalance after a failover.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// DBStatementTimeout bounds every statement server-side, independent of
+	// request deadlines; zero disables it.
+	DBStatementTimeout time.Duration
+	// DBSlowQueryThreshold is the duration above which queries are logged
+	// as slow; zero disables the check.
+	DBSlowQueryThreshold time.Duration
+	// MigrationsDir holds the goose migrations applied at startup.
+	MigrationsDir string
+	// RequireMigrations makes startup fail when MigrationsDir is missing or
+	// lacks the base migration, instead of starting without a schema.
+	RequireMigrations bool
+
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string
+	// MetricsNamespace prefixes the request metrics.
+	MetricsNamespace string
+	// SlowRequestThreshold is the duration above which requests are logged
+	// and counted as slow; zero disables the check.
+	SlowRequestThreshold time.Duration
+
+	ExternalAPIBaseURL     string
+	ExternalMaxAttempts    int
+	ExternalRetryBackoff   time.Duration
+	ExternalBreaker        external.CircuitBreakerSettings
+	ExternalTransport      external.TransportSettings
+	ExternalFields         external.FieldMapping
+	TrustedAPIKeys         []string
+	RequestTimeout         time.Duration
+	RequestTimeoutMax      time.Duration
+	StrictQueryParams      bool
+	NormalizeLyrics        bool
+	TitleCaseNames         bool
+	MaxPageSize            int
+	RequireListFilter      bool
+	FieldPrecedence        string
+	AllowPartialEnrichment bool
+	RequireLyricsOnCreate  bool
+	BatchEnrichTimeout     time.Duration
+	NullEmptyLyrics        bool
+	TextPreviewLength      int
+	ExportMaxRows          int
+	ImportMaxRows          int
+	RateLimitRPS           float64
+	RateLimitBurst         int
+	RateLimitMode          string
+	CORSAllowedOrigins     []string
+	// RequestMaxBodyBytes caps request bodies other than file uploads;
+	// zero disables the cap.
+	RequestMaxBodyBytes int64
+
+	// HistoryRetentionEnabled starts the job purging song history older
+	// than HistoryRetention every HistoryPurgeInterval.
+	HistoryRetentionEnabled bool
+	HistoryRetention        time.Duration
+	HistoryPurgeInterval    time.Duration
+
+	TLSCertFile           string
+	TLSKeyFile            string
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubDomains bool
+
+	ServerReadTimeout time.Duration
+	// ServerWriteTimeout bounds writing a whole response, so it should stay
+	// above RequestTimeoutMax.
+	ServerWriteTimeout time.Duration
+	ServerIdleTimeout  time.Duration
+	// ServerShutdownTimeout is how long in-flight requests get to finish
+	// after SIGINT/SIGTERM.
+	ServerShutdownTimeout time.Duration
+
+	// GRPCPort is the port the gRPC transport listens on.
+	GRPCPort string
+}
+
+// requiredEnv lists the variables MustLoadConfig refuses to default.
+var requiredEnv = []string{"DB_USER", "DB_NAME"}
+
+// MustLoadConfig is LoadConfig for startup: it exits with a fatal log when
+// any of the required variables is set neither in the environment nor in
+// .env, instead of falling back to its default.
+func MustLoadConfig() *Config {
+	cfg := LoadConfig()
+
+	var missing []string
+	for _, key := range requiredEnv {
+		if os.Getenv(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		log.Fatalf("[ERROR] Missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	return cfg
 }
 
+// LoadConfig reads the configuration from the environment, after loading an
+// optional .env file into it. It is the only place .env is loaded; variables
+// already set in the environment take precedence over the file.
 func LoadConfig() *Config {
 	// load .env file
 	if err := godotenv.Load(); err != nil {
@@ -22,15 +136,114 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		DBHost:             getEnv("DB_HOST", "localhost"),
-		DBPort:             getEnv("DB_PORT", "5432"),
-		DBUser:             getEnv("DB_USER", "postgres"),
-		DBPass:             getEnv("DB_PASS", ""),
-		DBName:             getEnv("DB_NAME", "songsdb"),
-		ExternalAPIBaseURL: getEnv("EXTERNAL_API_BASE_URL", "http://localhost:3000"),
+		DBHost:        getEnv("DB_HOST", "localhost"),
+		DBPort:        getEnv("DB_PORT", "5432"),
+		DBUser:        getEnv("DB_USER", "postgres"),
+		DBPass:        getEnv("DB_PASS", ""),
+		DBName:        getEnv("DB_NAME", "songsdb"),
+		DBSchema:      getEnv("DB_SCHEMA", ""),
+		SortCollation: getEnv("SORT_COLLATION", ""),
+
+		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+
+		DBStatementTimeout: getEnvDuration("DB_STATEMENT_TIMEOUT", 30*time.Second),
+
+		DBSlowQueryThreshold: getEnvDuration("DB_SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
+
+		MigrationsDir:     getEnv("MIGRATIONS_DIR", "./db/migrations"),
+		RequireMigrations: getEnvBool("REQUIRE_MIGRATIONS", true),
+
+		LogLevel:         getEnv("LOG_LEVEL", "debug"),
+		MetricsNamespace: getEnv("METRICS_NAMESPACE", "song_library"),
+
+		SlowRequestThreshold: time.Duration(getEnvInt("SLOW_REQUEST_MS", 1000)) * time.Millisecond,
+
+		ExternalAPIBaseURL:   getEnv("EXTERNAL_API_BASE_URL", "http://localhost:3000"),
+		ExternalMaxAttempts:  getEnvInt("EXTERNAL_MAX_ATTEMPTS", 1),
+		ExternalRetryBackoff: getEnvDuration("EXTERNAL_RETRY_BACKOFF", 200*time.Millisecond),
+		ExternalBreaker: external.CircuitBreakerSettings{
+			Threshold:   uint32(getEnvInt("EXTERNAL_BREAKER_THRESHOLD", 0)),
+			Timeout:     getEnvDuration("EXTERNAL_BREAKER_TIMEOUT", 30*time.Second),
+			MaxRequests: uint32(getEnvInt("EXTERNAL_BREAKER_HALF_OPEN_REQUESTS", 1)),
+		},
+		ExternalTransport: external.TransportSettings{
+			DialTimeout: getEnvDuration("EXTERNAL_DIAL_TIMEOUT", external.DefaultTransportSettings.DialTimeout),
+			KeepAlive:   getEnvDuration("EXTERNAL_KEEP_ALIVE", external.DefaultTransportSettings.KeepAlive),
+			DialRetries: getEnvInt("EXTERNAL_DIAL_RETRIES", external.DefaultTransportSettings.DialRetries),
+			DialBackoff: getEnvDuration("EXTERNAL_DIAL_BACKOFF", external.DefaultTransportSettings.DialBackoff),
+		},
+		ExternalFields: external.FieldMapping{
+			ReleaseDate: getEnv("EXTERNAL_FIELD_RELEASE_DATE", external.DefaultFieldMapping.ReleaseDate),
+			Text:        getEnv("EXTERNAL_FIELD_TEXT", external.DefaultFieldMapping.Text),
+			Link:        getEnv("EXTERNAL_FIELD_LINK", external.DefaultFieldMapping.Link),
+		},
+		TrustedAPIKeys:         splitList(getEnv("TRUSTED_API_KEYS", "")),
+		RequestTimeout:         getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+		RequestTimeoutMax:      getEnvDuration("REQUEST_TIMEOUT_MAX", 2*time.Minute),
+		StrictQueryParams:      getEnvBool("STRICT_QUERY_PARAMS", false),
+		NormalizeLyrics:        getEnvBool("NORMALIZE_LYRICS", true),
+		TitleCaseNames:         getEnvBool("TITLE_CASE_NAMES", false),
+		MaxPageSize:            getEnvInt("MAX_PAGE_SIZE", 200),
+		RequireListFilter:      getEnvBool("REQUIRE_LIST_FILTER", false),
+		FieldPrecedence:        getEnv("FIELD_PRECEDENCE", service.PrecedenceClient),
+		AllowPartialEnrichment: getEnvBool("ALLOW_PARTIAL_ENRICHMENT", false),
+		RequireLyricsOnCreate:  getEnvBool("REQUIRE_LYRICS_ON_CREATE", false),
+		BatchEnrichTimeout:     getEnvDuration("BATCH_ENRICH_TIMEOUT", 5*time.Second),
+		NullEmptyLyrics:        getEnvBool("NULL_EMPTY_LYRICS", false),
+		TextPreviewLength:      getEnvInt("TEXT_PREVIEW_LENGTH", 0),
+		ExportMaxRows:          getEnvInt("EXPORT_MAX_ROWS", 100000),
+		ImportMaxRows:          getEnvInt("IMPORT_MAX_ROWS", 10000),
+		RateLimitRPS:           getEnvFloat("RATE_LIMIT_RPS", 100),
+		RateLimitBurst:         getEnvInt("RATE_LIMIT_BURST", 50),
+		RateLimitMode:          getEnv("RATE_LIMIT_MODE", "global"),
+		CORSAllowedOrigins:     splitList(getEnv("CORS_ALLOWED_ORIGINS", "*")),
+		RequestMaxBodyBytes:    int64(getEnvInt("REQUEST_MAX_BODY_BYTES", 1<<20)),
+
+		HistoryRetentionEnabled: getEnvBool("HISTORY_RETENTION_ENABLED", false),
+		HistoryRetention:        getEnvDuration("HISTORY_RETENTION", 90*24*time.Hour),
+		HistoryPurgeInterval:    getEnvDuration("HISTORY_PURGE_INTERVAL", time.Hour),
+
+		TLSCertFile:           getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:            getEnv("TLS_KEY_FILE", ""),
+		HSTSMaxAge:            getEnvDuration("HSTS_MAX_AGE", 0),
+		HSTSIncludeSubDomains: getEnvBool("HSTS_INCLUDE_SUBDOMAINS", false),
+
+		ServerReadTimeout:     getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		ServerWriteTimeout:    getEnvDuration("SERVER_WRITE_TIMEOUT", 150*time.Second),
+		ServerIdleTimeout:     getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		ServerShutdownTimeout: getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		GRPCPort: getEnv("GRPC_PORT", "9090"),
 	}
 }
 
+// TLSEnabled reports whether both a certificate and a key are configured.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// HSTSEnabled reports whether responses carry a Strict-Transport-Security
+// header: only when the server terminates TLS and HSTS_MAX_AGE is set.
+func (c *Config) HSTSEnabled() bool {
+	return c.TLSEnabled() && c.HSTSMaxAge > 0
+}
+
+// ConnPool is the part of *sql.DB configured by ApplyPool.
+type ConnPool interface {
+	SetMaxOpenConns(n int)
+	SetMaxIdleConns(n int)
+	SetConnMaxLifetime(d time.Duration)
+}
+
+// ApplyPool sets the connection pool limits of db.
+func (c *Config) ApplyPool(db ConnPool) {
+	db.SetMaxOpenConns(c.DBMaxOpenConns)
+	db.SetMaxIdleConns(c.DBMaxIdleConns)
+	db.SetConnMaxLifetime(c.DBConnMaxLifetime)
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -38,3 +251,46 @@ func getEnv(key, fallback string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, fallback int) int {
+	n, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	f, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+	return f
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	b, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+// splitList parses a comma-separated list, dropping empty items.
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,368 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"song-library-test-task/internal/external"
+)
+
+func TestLoadConfigSchema(t *testing.T) {
+	t.Setenv("DB_SCHEMA", "")
+	if cfg := LoadConfig(); cfg.DBSchema != "" {
+		t.Errorf("default schema = %q, want the server's search_path", cfg.DBSchema)
+	}
+
+	t.Setenv("DB_SCHEMA", "tenant_a")
+	if cfg := LoadConfig(); cfg.DBSchema != "tenant_a" {
+		t.Errorf("schema = %q, want tenant_a", cfg.DBSchema)
+	}
+}
+
+func TestLoadConfigHistoryRetention(t *testing.T) {
+	t.Setenv("HISTORY_RETENTION_ENABLED", "")
+	t.Setenv("HISTORY_RETENTION", "")
+	if cfg := LoadConfig(); cfg.HistoryRetentionEnabled || cfg.HistoryRetention != 90*24*time.Hour {
+		t.Errorf("defaults: enabled = %v, retention = %v; want disabled, 90 days", cfg.HistoryRetentionEnabled, cfg.HistoryRetention)
+	}
+
+	t.Setenv("HISTORY_RETENTION_ENABLED", "true")
+	t.Setenv("HISTORY_RETENTION", "720h")
+	t.Setenv("HISTORY_PURGE_INTERVAL", "10m")
+	cfg := LoadConfig()
+	if !cfg.HistoryRetentionEnabled || cfg.HistoryRetention != 720*time.Hour || cfg.HistoryPurgeInterval != 10*time.Minute {
+		t.Errorf("got enabled = %v, retention = %v, interval = %v", cfg.HistoryRetentionEnabled, cfg.HistoryRetention, cfg.HistoryPurgeInterval)
+	}
+}
+
+func TestHSTSEnabled(t *testing.T) {
+	tests := []struct {
+		name           string
+		cert, key, age string
+		want           bool
+	}{
+		{"TLS and max-age", "cert.pem", "key.pem", "24h", true},
+		{"TLS without max-age", "cert.pem", "key.pem", "", false},
+		{"max-age without TLS", "", "", "24h", false},
+		{"incomplete TLS", "cert.pem", "", "24h", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TLS_CERT_FILE", tt.cert)
+			t.Setenv("TLS_KEY_FILE", tt.key)
+			t.Setenv("HSTS_MAX_AGE", tt.age)
+			if got := LoadConfig().HSTSEnabled(); got != tt.want {
+				t.Errorf("HSTSEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigServerTimeouts(t *testing.T) {
+	for _, key := range []string{"SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT", "SERVER_SHUTDOWN_TIMEOUT"} {
+		t.Setenv(key, "")
+	}
+	cfg := LoadConfig()
+	if cfg.ServerReadTimeout != 15*time.Second || cfg.ServerWriteTimeout != 150*time.Second ||
+		cfg.ServerIdleTimeout != 60*time.Second || cfg.ServerShutdownTimeout != 30*time.Second {
+		t.Errorf("defaults: read = %v, write = %v, idle = %v, shutdown = %v",
+			cfg.ServerReadTimeout, cfg.ServerWriteTimeout, cfg.ServerIdleTimeout, cfg.ServerShutdownTimeout)
+	}
+
+	t.Setenv("SERVER_READ_TIMEOUT", "5s")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "2m")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "90s")
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "10s")
+	cfg = LoadConfig()
+	if cfg.ServerReadTimeout != 5*time.Second || cfg.ServerWriteTimeout != 2*time.Minute ||
+		cfg.ServerIdleTimeout != 90*time.Second || cfg.ServerShutdownTimeout != 10*time.Second {
+		t.Errorf("overrides: read = %v, write = %v, idle = %v, shutdown = %v",
+			cfg.ServerReadTimeout, cfg.ServerWriteTimeout, cfg.ServerIdleTimeout, cfg.ServerShutdownTimeout)
+	}
+
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "thirty seconds")
+	if cfg := LoadConfig(); cfg.ServerShutdownTimeout != 30*time.Second {
+		t.Errorf("unparsable shutdown timeout = %v, want the 30s default", cfg.ServerShutdownTimeout)
+	}
+}
+
+func TestLoadConfigRequireLyrics(t *testing.T) {
+	t.Setenv("REQUIRE_LYRICS_ON_CREATE", "")
+	if LoadConfig().RequireLyricsOnCreate {
+		t.Error("lyrics required by default")
+	}
+	t.Setenv("REQUIRE_LYRICS_ON_CREATE", "true")
+	if !LoadConfig().RequireLyricsOnCreate {
+		t.Error("REQUIRE_LYRICS_ON_CREATE=true not applied")
+	}
+}
+
+// poolRecorder records the limits applied to a connection pool.
+type poolRecorder struct {
+	maxOpen, maxIdle int
+	lifetime         time.Duration
+}
+
+func (p *poolRecorder) SetMaxOpenConns(n int)              { p.maxOpen = n }
+func (p *poolRecorder) SetMaxIdleConns(n int)              { p.maxIdle = n }
+func (p *poolRecorder) SetConnMaxLifetime(d time.Duration) { p.lifetime = d }
+
+func TestApplyPool(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "")
+	cfg := LoadConfig()
+	var pool poolRecorder
+	cfg.ApplyPool(&pool)
+	if want := (poolRecorder{maxOpen: 25, maxIdle: 5, lifetime: 5 * time.Minute}); pool != want {
+		t.Errorf("defaults: applied %+v, want %+v", pool, want)
+	}
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_MAX_IDLE_CONNS", "10")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "30m")
+	cfg = LoadConfig()
+	pool = poolRecorder{}
+	cfg.ApplyPool(&pool)
+	if want := (poolRecorder{maxOpen: 50, maxIdle: 10, lifetime: 30 * time.Minute}); pool != want {
+		t.Errorf("overrides: applied %+v, want %+v", pool, want)
+	}
+}
+
+func TestLoadConfigCORSOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	if got := LoadConfig().CORSAllowedOrigins; len(got) != 1 || got[0] != "*" {
+		t.Errorf("default origins = %q, want [*]", got)
+	}
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, ,https://b.example.com")
+	if got := LoadConfig().CORSAllowedOrigins; len(got) != 2 || got[0] != "https://a.example.com" || got[1] != "https://b.example.com" {
+		t.Errorf("origins = %q", got)
+	}
+}
+
+func TestLoadConfigStatementTimeout(t *testing.T) {
+	t.Setenv("DB_STATEMENT_TIMEOUT", "")
+	if got := LoadConfig().DBStatementTimeout; got != 30*time.Second {
+		t.Errorf("default statement timeout = %v, want 30s", got)
+	}
+	t.Setenv("DB_STATEMENT_TIMEOUT", "0")
+	if got := LoadConfig().DBStatementTimeout; got != 0 {
+		t.Errorf("statement timeout = %v, want it disabled", got)
+	}
+}
+
+func TestLoadConfigAllowPartialEnrichment(t *testing.T) {
+	t.Setenv("ALLOW_PARTIAL_ENRICHMENT", "")
+	if LoadConfig().AllowPartialEnrichment {
+		t.Error("degraded creation enabled by default")
+	}
+	t.Setenv("ALLOW_PARTIAL_ENRICHMENT", "true")
+	if !LoadConfig().AllowPartialEnrichment {
+		t.Error("ALLOW_PARTIAL_ENRICHMENT=true not applied")
+	}
+}
+
+func TestLoadConfigExternalFields(t *testing.T) {
+	t.Setenv("EXTERNAL_FIELD_RELEASE_DATE", "date")
+	t.Setenv("EXTERNAL_FIELD_TEXT", "")
+	t.Setenv("EXTERNAL_FIELD_LINK", "url")
+	got := LoadConfig().ExternalFields
+	if got.ReleaseDate != "date" || got.Text != "text" || got.Link != "url" {
+		t.Errorf("fields = %+v, want date, the default text and url", got)
+	}
+}
+
+func TestLoadConfigRowCaps(t *testing.T) {
+	t.Setenv("IMPORT_MAX_ROWS", "")
+	t.Setenv("EXPORT_MAX_ROWS", "")
+	if cfg := LoadConfig(); cfg.ImportMaxRows != 10000 || cfg.ExportMaxRows != 100000 {
+		t.Errorf("defaults: import %d, export %d; want 10000 and 100000", cfg.ImportMaxRows, cfg.ExportMaxRows)
+	}
+	t.Setenv("IMPORT_MAX_ROWS", "50")
+	t.Setenv("EXPORT_MAX_ROWS", "500")
+	if cfg := LoadConfig(); cfg.ImportMaxRows != 50 || cfg.ExportMaxRows != 500 {
+		t.Errorf("overrides: import %d, export %d", cfg.ImportMaxRows, cfg.ExportMaxRows)
+	}
+}
+
+func TestLoadConfigRequireMigrations(t *testing.T) {
+	t.Setenv("REQUIRE_MIGRATIONS", "")
+	if cfg := LoadConfig(); !cfg.RequireMigrations {
+		t.Error("migrations are not required by default")
+	}
+	t.Setenv("REQUIRE_MIGRATIONS", "false")
+	if cfg := LoadConfig(); cfg.RequireMigrations {
+		t.Error("REQUIRE_MIGRATIONS=false is ignored")
+	}
+}
+
+func TestLoadConfigSlowRequestThreshold(t *testing.T) {
+	t.Setenv("SLOW_REQUEST_MS", "")
+	if cfg := LoadConfig(); cfg.SlowRequestThreshold != time.Second {
+		t.Errorf("default = %v, want 1s", cfg.SlowRequestThreshold)
+	}
+	t.Setenv("SLOW_REQUEST_MS", "250")
+	if cfg := LoadConfig(); cfg.SlowRequestThreshold != 250*time.Millisecond {
+		t.Errorf("SLOW_REQUEST_MS=250: %v", cfg.SlowRequestThreshold)
+	}
+	t.Setenv("SLOW_REQUEST_MS", "0")
+	if cfg := LoadConfig(); cfg.SlowRequestThreshold != 0 {
+		t.Errorf("SLOW_REQUEST_MS=0: %v, want the check disabled", cfg.SlowRequestThreshold)
+	}
+}
+
+func TestLoadConfigGRPCPort(t *testing.T) {
+	t.Setenv("GRPC_PORT", "")
+	if cfg := LoadConfig(); cfg.GRPCPort != "9090" {
+		t.Errorf("default = %q, want 9090", cfg.GRPCPort)
+	}
+	t.Setenv("GRPC_PORT", "50051")
+	if cfg := LoadConfig(); cfg.GRPCPort != "50051" {
+		t.Errorf("GRPC_PORT=50051: %q", cfg.GRPCPort)
+	}
+}
+
+func TestLoadConfigTitleCaseNames(t *testing.T) {
+	t.Setenv("TITLE_CASE_NAMES", "")
+	if cfg := LoadConfig(); cfg.TitleCaseNames {
+		t.Error("names are title-cased by default")
+	}
+	t.Setenv("TITLE_CASE_NAMES", "true")
+	if cfg := LoadConfig(); !cfg.TitleCaseNames {
+		t.Error("TITLE_CASE_NAMES=true is ignored")
+	}
+}
+
+func TestLoadConfigRequestMaxBodyBytes(t *testing.T) {
+	t.Setenv("REQUEST_MAX_BODY_BYTES", "")
+	if cfg := LoadConfig(); cfg.RequestMaxBodyBytes != 1<<20 {
+		t.Errorf("RequestMaxBodyBytes = %d, want 1 MiB by default", cfg.RequestMaxBodyBytes)
+	}
+	t.Setenv("REQUEST_MAX_BODY_BYTES", "4096")
+	if cfg := LoadConfig(); cfg.RequestMaxBodyBytes != 4096 {
+		t.Errorf("RequestMaxBodyBytes = %d, want 4096", cfg.RequestMaxBodyBytes)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"DB_HOST": "db.internal", "DB_PORT": "6432", "DB_USER": "songs", "DB_PASS": "secret",
+		"DB_NAME": "library", "DB_SCHEMA": "tenant_a", "SORT_COLLATION": "und-x-icu",
+		"DB_MAX_OPEN_CONNS": "40", "DB_MAX_IDLE_CONNS": "8", "DB_CONN_MAX_LIFETIME": "10m",
+		"DB_STATEMENT_TIMEOUT": "5s", "DB_SLOW_QUERY_THRESHOLD": "250ms",
+		"MIGRATIONS_DIR": "/migrations", "REQUIRE_MIGRATIONS": "false",
+		"LOG_LEVEL": "warn", "METRICS_NAMESPACE": "songs", "SLOW_REQUEST_MS": "750",
+		"EXTERNAL_API_BASE_URL": "https://music.example.com", "EXTERNAL_MAX_ATTEMPTS": "3",
+		"EXTERNAL_RETRY_BACKOFF": "1s", "EXTERNAL_BREAKER_THRESHOLD": "5", "EXTERNAL_BREAKER_TIMEOUT": "1m",
+		"EXTERNAL_BREAKER_HALF_OPEN_REQUESTS": "2", "EXTERNAL_DIAL_TIMEOUT": "2s", "EXTERNAL_KEEP_ALIVE": "45s",
+		"EXTERNAL_DIAL_RETRIES": "4", "EXTERNAL_DIAL_BACKOFF": "300ms",
+		"EXTERNAL_FIELD_RELEASE_DATE": "released", "EXTERNAL_FIELD_TEXT": "lyrics", "EXTERNAL_FIELD_LINK": "url",
+		"TRUSTED_API_KEYS": "k1, k2", "REQUEST_TIMEOUT": "20s", "REQUEST_TIMEOUT_MAX": "3m",
+		"STRICT_QUERY_PARAMS": "true", "NORMALIZE_LYRICS": "false", "TITLE_CASE_NAMES": "true",
+		"MAX_PAGE_SIZE": "50", "REQUIRE_LIST_FILTER": "true", "FIELD_PRECEDENCE": "external",
+		"ALLOW_PARTIAL_ENRICHMENT": "true", "REQUIRE_LYRICS_ON_CREATE": "true", "BATCH_ENRICH_TIMEOUT": "2s",
+		"NULL_EMPTY_LYRICS": "true", "TEXT_PREVIEW_LENGTH": "80", "EXPORT_MAX_ROWS": "500", "IMPORT_MAX_ROWS": "600",
+		"RATE_LIMIT_RPS": "2.5", "RATE_LIMIT_BURST": "5", "RATE_LIMIT_MODE": "ip",
+		"CORS_ALLOWED_ORIGINS": "https://app.example.com", "REQUEST_MAX_BODY_BYTES": "2048",
+		"HISTORY_RETENTION_ENABLED": "true", "HISTORY_RETENTION": "48h", "HISTORY_PURGE_INTERVAL": "30m",
+		"TLS_CERT_FILE": "/tls/cert.pem", "TLS_KEY_FILE": "/tls/key.pem", "HSTS_MAX_AGE": "24h",
+		"HSTS_INCLUDE_SUBDOMAINS": "true", "SERVER_READ_TIMEOUT": "1s", "SERVER_WRITE_TIMEOUT": "2s",
+		"SERVER_IDLE_TIMEOUT": "3s", "SERVER_SHUTDOWN_TIMEOUT": "4s", "GRPC_PORT": "9191",
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	want := &Config{
+		DBHost: "db.internal", DBPort: "6432", DBUser: "songs", DBPass: "secret",
+		DBName: "library", DBSchema: "tenant_a", SortCollation: "und-x-icu",
+		DBMaxOpenConns: 40, DBMaxIdleConns: 8, DBConnMaxLifetime: 10 * time.Minute,
+		DBStatementTimeout: 5 * time.Second, DBSlowQueryThreshold: 250 * time.Millisecond,
+		MigrationsDir: "/migrations", RequireMigrations: false,
+		LogLevel: "warn", MetricsNamespace: "songs", SlowRequestThreshold: 750 * time.Millisecond,
+		ExternalAPIBaseURL: "https://music.example.com", ExternalMaxAttempts: 3, ExternalRetryBackoff: time.Second,
+		ExternalBreaker: external.CircuitBreakerSettings{Threshold: 5, Timeout: time.Minute, MaxRequests: 2},
+		ExternalTransport: external.TransportSettings{
+			DialTimeout: 2 * time.Second, KeepAlive: 45 * time.Second, DialRetries: 4, DialBackoff: 300 * time.Millisecond,
+		},
+		ExternalFields: external.FieldMapping{ReleaseDate: "released", Text: "lyrics", Link: "url"},
+		TrustedAPIKeys: []string{"k1", "k2"},
+		RequestTimeout: 20 * time.Second, RequestTimeoutMax: 3 * time.Minute,
+		StrictQueryParams: true, NormalizeLyrics: false, TitleCaseNames: true,
+		MaxPageSize: 50, RequireListFilter: true, FieldPrecedence: "external",
+		AllowPartialEnrichment: true, RequireLyricsOnCreate: true, BatchEnrichTimeout: 2 * time.Second,
+		NullEmptyLyrics: true, TextPreviewLength: 80, ExportMaxRows: 500, ImportMaxRows: 600,
+		RateLimitRPS: 2.5, RateLimitBurst: 5, RateLimitMode: "ip",
+		CORSAllowedOrigins: []string{"https://app.example.com"}, RequestMaxBodyBytes: 2048,
+		HistoryRetentionEnabled: true, HistoryRetention: 48 * time.Hour, HistoryPurgeInterval: 30 * time.Minute,
+		TLSCertFile: "/tls/cert.pem", TLSKeyFile: "/tls/key.pem", HSTSMaxAge: 24 * time.Hour,
+		HSTSIncludeSubDomains: true, ServerReadTimeout: time.Second, ServerWriteTimeout: 2 * time.Second,
+		ServerIdleTimeout: 3 * time.Second, ServerShutdownTimeout: 4 * time.Second, GRPCPort: "9191",
+	}
+	if got := LoadConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadConfig() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestLoadConfigDotEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("DB_NAME=from_dotenv\nDB_USER=from_dotenv\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("DB_USER", "from_env")
+	t.Setenv("DB_NAME", "")
+	os.Unsetenv("DB_NAME")
+	cfg := LoadConfig()
+	if cfg.DBName != "from_dotenv" {
+		t.Errorf("DBName = %q, want it read from .env", cfg.DBName)
+	}
+	if cfg.DBUser != "from_env" {
+		t.Errorf("DBUser = %q, want the environment to win over .env", cfg.DBUser)
+	}
+}
+
+func TestMustLoadConfigMissing(t *testing.T) {
+	if os.Getenv("MUST_LOAD_CONFIG_CHILD") == "1" {
+		MustLoadConfig()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMustLoadConfigMissing$")
+	cmd.Env = append(os.Environ(), "MUST_LOAD_CONFIG_CHILD=1", "DB_USER=", "DB_NAME=")
+	out, err := cmd.CombinedOutput()
+	if _, exited := err.(*exec.ExitError); !exited {
+		t.Fatalf("err = %v, want MustLoadConfig to exit; output:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "Missing required environment variables: DB_USER, DB_NAME") {
+		t.Errorf("output = %s, want the missing variables named", out)
+	}
+
+	t.Setenv("DB_USER", "songs")
+	t.Setenv("DB_NAME", "library")
+	if cfg := MustLoadConfig(); cfg.DBUser != "songs" || cfg.DBName != "library" {
+		t.Errorf("MustLoadConfig() = %+v", cfg)
+	}
+}
+
+func TestLoadConfigRateLimitDefaults(t *testing.T) {
+	for _, key := range []string{"RATE_LIMIT_RPS", "RATE_LIMIT_BURST", "RATE_LIMIT_MODE"} {
+		t.Setenv(key, "")
+	}
+	cfg := LoadConfig()
+	if cfg.RateLimitRPS != 100 || cfg.RateLimitBurst != 50 || cfg.RateLimitMode != "global" {
+		t.Errorf("rate limit = %v rps, burst %d, mode %q; want 100, 50, global", cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitMode)
+	}
+}
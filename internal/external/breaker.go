@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sony/gobreaker"
+
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/service"
+)
+
+// CircuitBreakerSettings configures the circuit breaker around the client.
+type CircuitBreakerSettings struct {
+	// Threshold is the number of consecutive failures that opens the circuit.
+	Threshold uint32
+	// Timeout is how long the circuit stays open before letting trial
+	// requests through (half-open).
+	Timeout time.Duration
+	// MaxRequests is the number of trial requests allowed while half-open.
+	MaxRequests uint32
+}
+
+// breakerClient fails fast with models.ErrCircuitOpen while the external API
+// is considered down, instead of letting every call wait for its timeout.
+type breakerClient struct {
+	next service.ExternalClient
+	cb   *gobreaker.CircuitBreaker
+}
+
+// NewBreakerClient wraps next in a circuit breaker. Only network errors and
+// 5xx responses count as failures; a 4xx still proves the API is up.
+func NewBreakerClient(next service.ExternalClient, s CircuitBreakerSettings) service.ExternalClient {
+	return &breakerClient{
+		next: next,
+		cb: gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:        "music-info",
+			MaxRequests: s.MaxRequests,
+			Timeout:     s.Timeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= s.Threshold
+			},
+			IsSuccessful: func(err error) bool {
+				var statusErr *StatusError
+				if errors.As(err, &statusErr) {
+					return statusErr.StatusCode < 500
+				}
+				return err == nil
+			},
+		}),
+	}
+}
+
+func (c *breakerClient) FetchSongInfo(ctx context.Context, groupName, songTitle string) (*service.SongInfo, error) {
+	info, err := c.cb.Execute(func() (interface{}, error) {
+		return c.next.FetchSongInfo(ctx, groupName, songTitle)
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return nil, fmt.Errorf("%w: %v", models.ErrCircuitOpen, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info.(*service.SongInfo), nil
+}
@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	srv := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			respond(http.StatusServiceUnavailable, `{}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, `{"text":"t"}`)(w, r)
+	})
+	client := NewMusicInfoClient(srv.URL, time.Second,
+		WithCircuitBreaker(CircuitBreakerSettings{Threshold: 2, Timeout: 100 * time.Millisecond, MaxRequests: 1}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var statusErr *StatusError
+		if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); !errors.As(err, &statusErr) {
+			t.Fatalf("call %d: err = %v, want the upstream 503", i+1, err)
+		}
+	}
+	start := time.Now()
+	if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); !errors.Is(err, models.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("open circuit took %s to fail", elapsed)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("%d upstream calls, want the open circuit to make none", n)
+	}
+
+	t.Run("half-open", func(t *testing.T) {
+		healthy.Store(true)
+		time.Sleep(150 * time.Millisecond)
+		if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); err != nil {
+			t.Fatalf("trial call: %v", err)
+		}
+		if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); err != nil {
+			t.Errorf("call after recovery: %v, want the circuit closed", err)
+		}
+	})
+
+	t.Run("4xx does not trip", func(t *testing.T) {
+		srv := newUpstream(t, respond(http.StatusNotFound, `{}`))
+		client := NewMusicInfoClient(srv.URL, time.Second,
+			WithCircuitBreaker(CircuitBreakerSettings{Threshold: 1, Timeout: time.Minute}))
+		for i := 0; i < 3; i++ {
+			if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); errors.Is(err, models.ErrCircuitOpen) {
+				t.Fatalf("call %d: circuit opened on 404s", i+1)
+			}
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package external
+
+import "fmt"
+
+// FieldMapping names the upstream JSON keys holding each SongInfo field, so
+// upstreams calling the release date "release_date" or "date" can be used
+// without code changes. Empty names fall back to DefaultFieldMapping.
+type FieldMapping struct {
+	ReleaseDate string
+	Text        string
+	Link        string
+}
+
+// DefaultFieldMapping matches the reference music info API.
+var DefaultFieldMapping = FieldMapping{
+	ReleaseDate: "releaseDate",
+	Text:        "text",
+	Link:        "link",
+}
+
+// withDefaults fills the empty names of m from DefaultFieldMapping.
+func (m FieldMapping) withDefaults() FieldMapping {
+	if m.ReleaseDate == "" {
+		m.ReleaseDate = DefaultFieldMapping.ReleaseDate
+	}
+	if m.Text == "" {
+		m.Text = DefaultFieldMapping.Text
+	}
+	if m.Link == "" {
+		m.Link = DefaultFieldMapping.Link
+	}
+	return m
+}
+
+// stringField returns the string stored under key in data. A missing or null
+// key yields "", any other non-string value is an error.
+func stringField(data map[string]interface{}, key string) (string, error) {
+	switch v := data[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("field %q: expected a string, got %T", key, v)
+	}
+}
@@ -9,21 +9,85 @@ import (
 	"net/url"
 	"time"
 
+	"song-library-test-task/internal/models"
 	"song-library-test-task/internal/service" // to use service.SongInfo
 )
 
 type musicInfoClient struct {
 	baseURL    string
 	httpClient *http.Client
+	fields     FieldMapping
 }
 
-func NewMusicInfoClient(baseURL string, timeout time.Duration) service.ExternalClient {
-	return &musicInfoClient{
+// ClientOption configures optional musicInfoClient behaviour.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	transport   TransportSettings
+	maxAttempts int
+	backoff     time.Duration
+	breaker     *CircuitBreakerSettings
+	fields      FieldMapping
+}
+
+// WithTransport sets the dial and keep-alive settings of the HTTP transport.
+func WithTransport(s TransportSettings) ClientOption {
+	return func(c *clientConfig) {
+		c.transport = s
+	}
+}
+
+// WithRetry retries calls failing with a network error or a 5xx response,
+// making at most maxAttempts calls with exponential backoff starting at
+// backoff (see NewRetryingClient). Without it every call is made once.
+func WithRetry(maxAttempts int, backoff time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.maxAttempts = maxAttempts
+		c.backoff = backoff
+	}
+}
+
+// WithCircuitBreaker opens a circuit after s.Threshold consecutive failures
+// (retries included), making further calls fail fast with
+// models.ErrCircuitOpen until s.Timeout has passed. A zero threshold disables
+// the breaker.
+func WithCircuitBreaker(s CircuitBreakerSettings) ClientOption {
+	return func(c *clientConfig) {
+		if s.Threshold > 0 {
+			c.breaker = &s
+		}
+	}
+}
+
+// WithFieldMapping reads the SongInfo fields from the upstream JSON keys named
+// in m instead of DefaultFieldMapping.
+func WithFieldMapping(m FieldMapping) ClientOption {
+	return func(c *clientConfig) {
+		c.fields = m
+	}
+}
+
+func NewMusicInfoClient(baseURL string, timeout time.Duration, opts ...ClientOption) service.ExternalClient {
+	cfg := clientConfig{transport: DefaultTransportSettings}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var client service.ExternalClient = &musicInfoClient{
 		baseURL: baseURL,
+		fields:  cfg.fields.withDefaults(),
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: newTransport(cfg.transport),
 		},
 	}
+	if cfg.maxAttempts > 1 {
+		client = NewRetryingClient(client, cfg.maxAttempts, cfg.backoff)
+	}
+	if cfg.breaker != nil {
+		client = NewBreakerClient(client, *cfg.breaker)
+	}
+	return client
 }
 
 func (c *musicInfoClient) FetchSongInfo(ctx context.Context, groupName, songTitle string) (*service.SongInfo, error) {
@@ -49,21 +113,40 @@ func (c *musicInfoClient) FetchSongInfo(ctx context.Context, groupName, songTitl
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("expected 200, got %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
-	var data struct {
-		ReleaseDate string `json:"releaseDate"`
-		Text        string `json:"text"`
-		Link        string `json:"link"`
-	}
+	// Decode generically so the keys can be picked by the field mapping.
+	var data map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return nil, err
 	}
 
+	rawDate, err := stringField(data, c.fields.ReleaseDate)
+	if err != nil {
+		return nil, err
+	}
+	text, err := stringField(data, c.fields.Text)
+	if err != nil {
+		return nil, err
+	}
+	link, err := stringField(data, c.fields.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	var releaseDate time.Time
+	if rawDate != "" {
+		t, ok := models.ParseReleaseDate(rawDate)
+		if !ok {
+			return nil, fmt.Errorf("unrecognised release date %q", rawDate)
+		}
+		releaseDate = t
+	}
+
 	return &service.SongInfo{
-		ReleaseDate: data.ReleaseDate,
-		Text:        data.Text,
-		Link:        data.Link,
+		ReleaseDate: releaseDate,
+		Text:        text,
+		Link:        link,
 	}, nil
 }
@@ -0,0 +1,89 @@
+package external
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUpstream starts a fake music info API answering every request with
+// handler, closed when the test ends.
+func newUpstream(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// respond returns a handler writing body with status.
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestFetchSongInfoReleaseDate(t *testing.T) {
+	want := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	for _, date := range []string{"2009-07-16", "16.07.2009", "2009-07-16T10:00:00Z"} {
+		srv := newUpstream(t, respond(http.StatusOK, `{"releaseDate":"`+date+`","text":"t","link":"l"}`))
+		info, err := NewMusicInfoClient(srv.URL, time.Second).FetchSongInfo(context.Background(), "Muse", "Uprising")
+		if err != nil {
+			t.Fatalf("%s: %v", date, err)
+		}
+		if !info.ReleaseDate.Equal(want) || info.Text != "t" || info.Link != "l" {
+			t.Errorf("%s: info = %+v", date, info)
+		}
+	}
+
+	t.Run("missing date", func(t *testing.T) {
+		srv := newUpstream(t, respond(http.StatusOK, `{"releaseDate":null,"text":"t"}`))
+		info, err := NewMusicInfoClient(srv.URL, time.Second).FetchSongInfo(context.Background(), "Muse", "Uprising")
+		if err != nil || !info.ReleaseDate.IsZero() {
+			t.Errorf("info = %+v, err = %v; want an unknown date", info, err)
+		}
+	})
+	t.Run("unrecognised date", func(t *testing.T) {
+		srv := newUpstream(t, respond(http.StatusOK, `{"releaseDate":"July 2009"}`))
+		if _, err := NewMusicInfoClient(srv.URL, time.Second).FetchSongInfo(context.Background(), "Muse", "Uprising"); err == nil {
+			t.Error("want an error for an unrecognised date")
+		}
+	})
+}
+
+func TestFieldMapping(t *testing.T) {
+	body := `{"date":"2009-07-16","lyrics":"Paranoia is in bloom","url":"https://example.com/uprising","releaseDate":"1999-01-01","text":"wrong"}`
+	srv := newUpstream(t, respond(http.StatusOK, body))
+	client := NewMusicInfoClient(srv.URL, time.Second, WithFieldMapping(FieldMapping{ReleaseDate: "date", Text: "lyrics", Link: "url"}))
+
+	info, err := client.FetchSongInfo(context.Background(), "Muse", "Uprising")
+	if err != nil {
+		t.Fatalf("FetchSongInfo: %v", err)
+	}
+	want := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	if !info.ReleaseDate.Equal(want) || info.Text != "Paranoia is in bloom" || info.Link != "https://example.com/uprising" {
+		t.Errorf("info = %+v, want the mapped keys read", info)
+	}
+
+	t.Run("partial mapping", func(t *testing.T) {
+		srv := newUpstream(t, respond(http.StatusOK, `{"release_date":"2009-07-16","text":"t","link":"l"}`))
+		info, err := NewMusicInfoClient(srv.URL, time.Second, WithFieldMapping(FieldMapping{ReleaseDate: "release_date"})).
+			FetchSongInfo(context.Background(), "Muse", "Uprising")
+		if err != nil || !info.ReleaseDate.Equal(want) || info.Text != "t" || info.Link != "l" {
+			t.Errorf("info = %+v, err = %v; want the unmapped fields read from the default keys", info, err)
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		srv := newUpstream(t, respond(http.StatusOK, `{"lyrics":["verse"]}`))
+		_, err := NewMusicInfoClient(srv.URL, time.Second, WithFieldMapping(FieldMapping{Text: "lyrics"})).
+			FetchSongInfo(context.Background(), "Muse", "Uprising")
+		if err == nil || !strings.Contains(err.Error(), `"lyrics"`) {
+			t.Errorf("err = %v, want the mapped key named", err)
+		}
+	})
+}
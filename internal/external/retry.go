@@ -0,0 +1,88 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"song-library-test-task/internal/service"
+)
+
+// StatusError is returned when the external API answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("expected 200, got %d", e.StatusCode)
+}
+
+// retryingClient retries the calls of an ExternalClient that fail with a
+// transient error: a network error or a 5xx response.
+type retryingClient struct {
+	next        service.ExternalClient
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewRetryingClient wraps next so that transient failures are retried up to
+// maxAttempts calls in total, waiting backoff (doubled after every attempt,
+// plus up to 50% jitter) in between. Cancelling the context stops retrying.
+func NewRetryingClient(next service.ExternalClient, maxAttempts int, backoff time.Duration) service.ExternalClient {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &retryingClient{next: next, maxAttempts: maxAttempts, backoff: backoff}
+}
+
+func (c *retryingClient) FetchSongInfo(ctx context.Context, groupName, songTitle string) (*service.SongInfo, error) {
+	var info *service.SongInfo
+	err := retry(ctx, c.maxAttempts, c.backoff, func() error {
+		var err error
+		info, err = c.next.FetchSongInfo(ctx, groupName, songTitle)
+		return err
+	})
+	return info, err
+}
+
+// retry calls fn until it succeeds, fails with a permanent error, ctx is done
+// or maxAttempts calls have been made, and returns fn's last error.
+func retry(ctx context.Context, maxAttempts int, backoff time.Duration, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !isTransient(ctx, err) {
+			return err
+		}
+
+		wait := backoff
+		if wait > 0 {
+			wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		}
+		log.Printf("[DEBUG] external call failed (attempt %d/%d), retrying in %s: %v", attempt, maxAttempts, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err is worth retrying: 5xx responses and
+// network errors, but not failures caused by ctx itself ending.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,95 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failFirst returns a handler answering the first n requests with status and
+// the rest with body, counting every request in calls.
+func failFirst(n int32, status int, body string, calls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= n {
+			respond(status, `{}`)(w, r)
+			return
+		}
+		respond(http.StatusOK, body)(w, r)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	var calls int32
+	srv := newUpstream(t, failFirst(2, http.StatusServiceUnavailable, `{"releaseDate":"16.07.2009","text":"Paranoia is in bloom","link":"https://example.com/uprising"}`, &calls))
+
+	client := NewMusicInfoClient(srv.URL, time.Second, WithRetry(3, time.Millisecond))
+	info, err := client.FetchSongInfo(context.Background(), "Muse", "Uprising")
+	if err != nil {
+		t.Fatalf("FetchSongInfo: %v", err)
+	}
+	want := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	if !info.ReleaseDate.Equal(want) || info.Text != "Paranoia is in bloom" || info.Link != "https://example.com/uprising" {
+		t.Errorf("info = %+v", info)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+
+	t.Run("gives up", func(t *testing.T) {
+		var calls int32
+		srv := newUpstream(t, failFirst(5, http.StatusBadGateway, `{}`, &calls))
+		_, err := NewMusicInfoClient(srv.URL, time.Second, WithRetry(3, time.Millisecond)).
+			FetchSongInfo(context.Background(), "Muse", "Uprising")
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+			t.Errorf("err = %v, want the last 502", err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 3 {
+			t.Errorf("%d calls, want 3", n)
+		}
+	})
+
+	t.Run("4xx is not retried", func(t *testing.T) {
+		var calls int32
+		srv := newUpstream(t, failFirst(5, http.StatusNotFound, `{}`, &calls))
+		if _, err := NewMusicInfoClient(srv.URL, time.Second, WithRetry(3, time.Millisecond)).
+			FetchSongInfo(context.Background(), "Muse", "Uprising"); err == nil {
+			t.Error("want the 404 returned")
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("%d calls, want 1", n)
+		}
+	})
+
+	t.Run("without the option", func(t *testing.T) {
+		var calls int32
+		srv := newUpstream(t, failFirst(1, http.StatusServiceUnavailable, `{}`, &calls))
+		if _, err := NewMusicInfoClient(srv.URL, time.Second).FetchSongInfo(context.Background(), "Muse", "Uprising"); err == nil {
+			t.Error("want the 503 returned")
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("%d calls, want 1", n)
+		}
+	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		var calls int32
+		srv := newUpstream(t, failFirst(5, http.StatusServiceUnavailable, `{}`, &calls))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := NewMusicInfoClient(srv.URL, time.Second, WithRetry(5, time.Hour)).
+			FetchSongInfo(ctx, "Muse", "Uprising"); err == nil {
+			t.Error("want an error")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("returned after %s, want the backoff cut short", elapsed)
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("%d calls, want 1", n)
+		}
+	})
+}
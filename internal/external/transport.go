@@ -0,0 +1,59 @@
+package external
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportSettings configures the connection handling of the HTTP client.
+type TransportSettings struct {
+	// DialTimeout bounds establishing a single TCP connection.
+	DialTimeout time.Duration
+	// KeepAlive is the TCP keep-alive period of open connections.
+	KeepAlive time.Duration
+	// DialRetries is how many times a failed dial (connection refused, DNS
+	// failure, ...) is retried before giving up. Nothing has been sent at that
+	// point, so retrying is always safe.
+	DialRetries int
+	// DialBackoff is the delay before the first retry; it doubles each time.
+	DialBackoff time.Duration
+}
+
+// DefaultTransportSettings are used unless WithTransport is given.
+var DefaultTransportSettings = TransportSettings{
+	DialTimeout: 2 * time.Second,
+	KeepAlive:   30 * time.Second,
+	DialRetries: 2,
+	DialBackoff: 100 * time.Millisecond,
+}
+
+// newTransport builds an http.Transport whose dialer retries failed dials.
+func newTransport(s TransportSettings) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   s.DialTimeout,
+		KeepAlive: s.KeepAlive,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		backoff := s.DialBackoff
+		for attempt := 0; ; attempt++ {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err == nil || attempt >= s.DialRetries {
+				return conn, err
+			}
+			log.Printf("[DEBUG] dial %s failed (attempt %d): %v", addr, attempt+1, err)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+	return transport
+}
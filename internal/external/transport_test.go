@@ -0,0 +1,83 @@
+package external
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// unusedAddr returns a local address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestTransportRetriesDials(t *testing.T) {
+	addr := unusedAddr(t)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		srv := &http.Server{Handler: respond(http.StatusOK, `{"link":"l"}`)}
+		t.Cleanup(func() { srv.Close() })
+		srv.Serve(l)
+	}()
+
+	client := NewMusicInfoClient("http://"+addr, 5*time.Second, WithTransport(TransportSettings{
+		DialTimeout: time.Second,
+		DialRetries: 6,
+		DialBackoff: 20 * time.Millisecond,
+	}))
+	info, err := client.FetchSongInfo(context.Background(), "Muse", "Uprising")
+	if err != nil {
+		t.Fatalf("FetchSongInfo: %v", err)
+	}
+	if info.Link != "l" {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestTransportGivesUp(t *testing.T) {
+	addr := unusedAddr(t)
+
+	t.Run("no retries", func(t *testing.T) {
+		client := NewMusicInfoClient("http://"+addr, 5*time.Second, WithTransport(TransportSettings{
+			DialTimeout: time.Second,
+			DialBackoff: time.Second,
+		}))
+		start := time.Now()
+		if _, err := client.FetchSongInfo(context.Background(), "Muse", "Uprising"); err == nil {
+			t.Fatal("want a dial error")
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("took %v, want no backoff without retries", elapsed)
+		}
+	})
+
+	t.Run("context done during backoff", func(t *testing.T) {
+		client := NewMusicInfoClient("http://"+addr, 5*time.Second, WithTransport(TransportSettings{
+			DialTimeout: time.Second,
+			DialRetries: 10,
+			DialBackoff: time.Second,
+		}))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := client.FetchSongInfo(ctx, "Muse", "Uprising"); err == nil {
+			t.Fatal("want an error")
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("took %v, want the backoff cut short by the context", elapsed)
+		}
+	})
+}
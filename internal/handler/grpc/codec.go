@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+
+	"song-library-test-task/internal/handler/grpc/pb"
+	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+)
+
+// The decoders translate protobuf requests to endpoint requests, applying the
+// same defaults and access rules as the HTTP decoders; the encoders turn a
+// failed endpoint response into a status error.
+
+func decodeCreateSongRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.CreateSongRequest)
+	return endpoints.CreateSongRequest{
+		GroupName:      req.GetGroup(),
+		Title:          req.GetTitle(),
+		ReleaseDate:    req.GetReleaseDate(),
+		Link:           req.GetLink(),
+		Text:           req.GetText(),
+		IdempotencyKey: req.GetIdempotencyKey(),
+	}, nil
+}
+
+func encodeCreateSongResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	resp := response.(endpoints.CreateSongResponse)
+	return &pb.CreateSongResponse{Id: resp.ID, Warnings: resp.Warnings}, nil
+}
+
+func decodeGetSongRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetSongRequest)
+	return endpoints.GetSongRequest{ID: req.GetId(), PublicOnly: !middleware.IsAuthenticated(ctx)}, nil
+}
+
+func encodeGetSongResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	resp := response.(endpoints.GetSongResponse)
+	return &pb.GetSongResponse{Song: pbSong(*resp.Song)}, nil
+}
+
+func decodeListSongsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.ListSongsRequest)
+	return endpoints.ListSongsRequest{
+		GroupName:      req.GetGroup(),
+		Title:          req.GetTitle(),
+		Match:          req.GetMatch(),
+		Limit:          int(req.GetLimit()),
+		Offset:         int(req.GetOffset()),
+		PublicOnly:     !middleware.IsAuthenticated(ctx),
+		ReleasedAfter:  req.GetReleasedAfter(),
+		ReleasedBefore: req.GetReleasedBefore(),
+		SortBy:         req.GetSortBy(),
+		SortDir:        req.GetSortDir(),
+		AfterID:        req.GetAfterId(),
+		Query:          req.GetQ(),
+	}, nil
+}
+
+func encodeListSongsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	resp := response.(endpoints.ListSongsResponse)
+	out := &pb.ListSongsResponse{Songs: make([]*pb.Song, 0, len(resp.Songs))}
+	for _, v := range resp.Songs {
+		out.Songs = append(out.Songs, pbSong(v))
+	}
+	if resp.Total != nil {
+		out.Total = *resp.Total
+	}
+	if resp.NextCursor != nil {
+		out.NextCursor = *resp.NextCursor
+	}
+	return out, nil
+}
+
+func decodeUpdateSongRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.UpdateSongRequest)
+	return endpoints.UpdateSongRequest{
+		ID:          req.GetId(),
+		GroupName:   req.GetGroup(),
+		Title:       req.GetTitle(),
+		ReleaseDate: req.GetReleaseDate(),
+		Link:        req.GetLink(),
+		Text:        req.GetText(),
+	}, nil
+}
+
+func encodeUpdateSongResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.UpdateSongResponse{}, nil
+}
+
+func decodeDeleteSongRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.DeleteSongRequest)
+	if req.GetHard() && !middleware.IsAuthenticated(ctx) {
+		return nil, models.ErrUnauthorized
+	}
+	return endpoints.DeleteSongRequest{ID: req.GetId(), Hard: req.GetHard()}, nil
+}
+
+func encodeDeleteSongResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.DeleteSongResponse{}, nil
+}
+
+func decodeGetSongLyricsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetSongLyricsRequest)
+	page, pageSize := int(req.GetPage()), int(req.GetPageSize())
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return endpoints.GetLyricsRequest{
+		ID:         req.GetId(),
+		Page:       page,
+		PageSize:   pageSize,
+		PublicOnly: !middleware.IsAuthenticated(ctx),
+	}, nil
+}
+
+func encodeGetSongLyricsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	if err := failed(response); err != nil {
+		return nil, statusError(err)
+	}
+	resp := response.(endpoints.GetLyricsResponse)
+	return &pb.GetSongLyricsResponse{Lyrics: resp.Lyrics, Total: int32(resp.Total)}, nil
+}
@@ -0,0 +1,203 @@
+// Package grpc serves the song endpoints over gRPC (see pb/song.proto),
+// alongside the HTTP transport and sharing its endpoints.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"song-library-test-task/internal/handler/grpc/pb"
+	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+)
+
+// apiKeyMetadata is the metadata key carrying the client's API key, the
+// counterpart of the X-API-Key HTTP header.
+const apiKeyMetadata = "x-api-key"
+
+// serverConfig holds the optional settings of NewGRPCServer.
+type serverConfig struct {
+	apiKeys []string
+}
+
+// ServerOption configures NewGRPCServer.
+type ServerOption func(*serverConfig)
+
+// WithAPIKeys authenticates calls presenting one of keys in the x-api-key
+// metadata, as middleware.APIKey does for HTTP.
+func WithAPIKeys(keys []string) ServerOption {
+	return func(c *serverConfig) {
+		c.apiKeys = keys
+	}
+}
+
+// songServer implements pb.SongServiceServer on top of the song endpoints.
+type songServer struct {
+	pb.UnimplementedSongServiceServer
+
+	createSong    kitgrpc.Handler
+	getSong       kitgrpc.Handler
+	listSongs     kitgrpc.Handler
+	updateSong    kitgrpc.Handler
+	deleteSong    kitgrpc.Handler
+	getSongLyrics kitgrpc.Handler
+}
+
+// NewGRPCServer returns a gRPC server with the SongService registered,
+// serving the same endpoints as the HTTP handler.
+func NewGRPCServer(eps endpoints.SongEndpoints, options ...ServerOption) *gogrpc.Server {
+	var cfg serverConfig
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	opts := []kitgrpc.ServerOption{
+		kitgrpc.ServerBefore(authenticate(cfg.apiKeys)),
+	}
+	s := &songServer{
+		createSong:    kitgrpc.NewServer(eps.CreateSongEndpoint, decodeCreateSongRequest, encodeCreateSongResponse, opts...),
+		getSong:       kitgrpc.NewServer(eps.GetSongEndpoint, decodeGetSongRequest, encodeGetSongResponse, opts...),
+		listSongs:     kitgrpc.NewServer(eps.ListSongsEndpoint, decodeListSongsRequest, encodeListSongsResponse, opts...),
+		updateSong:    kitgrpc.NewServer(eps.UpdateSongEndpoint, decodeUpdateSongRequest, encodeUpdateSongResponse, opts...),
+		deleteSong:    kitgrpc.NewServer(eps.DeleteSongEndpoint, decodeDeleteSongRequest, encodeDeleteSongResponse, opts...),
+		getSongLyrics: kitgrpc.NewServer(eps.GetLyricsEndpoint, decodeGetSongLyricsRequest, encodeGetSongLyricsResponse, opts...),
+	}
+
+	srv := gogrpc.NewServer()
+	pb.RegisterSongServiceServer(srv, s)
+	return srv
+}
+
+// authenticate marks the call's context as authenticated for a valid API key.
+func authenticate(keys []string) kitgrpc.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if values := md.Get(apiKeyMetadata); len(values) > 0 {
+			return middleware.Authenticate(ctx, values[0], keys)
+		}
+		return ctx
+	}
+}
+
+func (s *songServer) CreateSong(ctx context.Context, req *pb.CreateSongRequest) (*pb.CreateSongResponse, error) {
+	_, resp, err := s.createSong.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.CreateSongResponse), nil
+}
+
+func (s *songServer) GetSong(ctx context.Context, req *pb.GetSongRequest) (*pb.GetSongResponse, error) {
+	_, resp, err := s.getSong.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.GetSongResponse), nil
+}
+
+func (s *songServer) ListSongs(ctx context.Context, req *pb.ListSongsRequest) (*pb.ListSongsResponse, error) {
+	_, resp, err := s.listSongs.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.ListSongsResponse), nil
+}
+
+func (s *songServer) UpdateSong(ctx context.Context, req *pb.UpdateSongRequest) (*pb.UpdateSongResponse, error) {
+	_, resp, err := s.updateSong.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.UpdateSongResponse), nil
+}
+
+func (s *songServer) DeleteSong(ctx context.Context, req *pb.DeleteSongRequest) (*pb.DeleteSongResponse, error) {
+	_, resp, err := s.deleteSong.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.DeleteSongResponse), nil
+}
+
+func (s *songServer) GetSongLyrics(ctx context.Context, req *pb.GetSongLyricsRequest) (*pb.GetSongLyricsResponse, error) {
+	_, resp, err := s.getSongLyrics.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return resp.(*pb.GetSongLyricsResponse), nil
+}
+
+// errorCodes maps domain errors to gRPC status codes, checked in order; it
+// is the counterpart of the HTTP transport's error classes.
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{models.ErrValidation, codes.InvalidArgument},
+	{models.ErrUnauthorized, codes.Unauthenticated},
+	{models.ErrSongNotFound, codes.NotFound},
+	{models.ErrVerseNotFound, codes.NotFound},
+	{models.ErrDeleted, codes.NotFound},
+	{models.ErrDuplicateSong, codes.AlreadyExists},
+	{models.ErrRequestInProgress, codes.Aborted},
+	{models.ErrCircuitOpen, codes.Unavailable},
+	{models.ErrExternalAPI, codes.Unavailable},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+	{context.Canceled, codes.Canceled},
+}
+
+// statusError converts err to a gRPC status error; unknown errors are Internal.
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return status.Error(c.code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// failed returns the failure reported by an endpoint response, if any.
+func failed(response interface{}) error {
+	if f, ok := response.(interface{ Failed() error }); ok {
+		return f.Failed()
+	}
+	return nil
+}
+
+// pbSong renders a song view as a protobuf message, timestamps in UTC.
+func pbSong(v endpoints.SongView) *pb.Song {
+	song := &pb.Song{
+		Id:          v.ID,
+		Group:       v.GroupName,
+		Title:       v.Title,
+		ReleaseDate: v.ReleaseDate,
+		Link:        v.Link,
+		IsPublic:    v.IsPublic,
+		CreatedAt:   timestamp(v.CreatedAt),
+		UpdatedAt:   timestamp(v.UpdatedAt),
+	}
+	if v.Text != nil {
+		song.Text = *v.Text
+	}
+	if v.EnrichedAt != nil {
+		song.EnrichedAt = timestamp(*v.EnrichedAt)
+	}
+	return song
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
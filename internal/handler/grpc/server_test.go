@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"song-library-test-task/internal/handler/grpc/pb"
+	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+const testAPIKey = "test-key"
+
+// newTestClient serves NewGRPCServer over an in-memory connection and returns
+// a client for it together with the repository and fake external client
+// behind the endpoints.
+func newTestClient(t *testing.T) (pb.SongServiceClient, models.SongRepository, *testutil.FakeExternalClient) {
+	t.Helper()
+	repo := memory.NewInMemorySongRepository()
+	client := testutil.NewFakeExternalClient()
+	svc := service.NewSongService(repo, client, service.WithLogger(logger.NewStdLogger(logger.LevelError)))
+	srv := NewGRPCServer(endpoints.MakeSongEndpoints(*svc), WithAPIKeys([]string{testAPIKey}))
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := gogrpc.NewClient("passthrough:///bufnet",
+		gogrpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewSongServiceClient(conn), repo, client
+}
+
+// authed returns ctx carrying the test API key.
+func authed(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, apiKeyMetadata, testAPIKey)
+}
+
+func wantCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Errorf("code = %v (%v), want %v", got, err, code)
+	}
+}
+
+func TestSongServiceRPCs(t *testing.T) {
+	ctx := context.Background()
+	c, repo, external := newTestClient(t)
+	external.SetSong("Muse", "Uprising", service.SongInfo{Text: "one\n\ntwo\n\nthree", Link: "https://example.com/uprising"})
+
+	created, err := c.CreateSong(ctx, &pb.CreateSongRequest{Group: "Muse", Title: "Uprising", ReleaseDate: "2009-07-16"})
+	if err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	id := created.GetId()
+	if song, _ := repo.GetByID(ctx, id); song == nil || song.Link != "https://example.com/uprising" {
+		t.Errorf("stored %+v, want the enriched song", song)
+	}
+	_, err = c.CreateSong(ctx, &pb.CreateSongRequest{Group: "Muse", Title: "Uprising"})
+	wantCode(t, err, codes.AlreadyExists)
+	_, err = c.CreateSong(ctx, &pb.CreateSongRequest{Title: "Nameless"})
+	wantCode(t, err, codes.InvalidArgument)
+
+	got, err := c.GetSong(authed(ctx), &pb.GetSongRequest{Id: id})
+	if err != nil {
+		t.Fatalf("GetSong: %v", err)
+	}
+	if s := got.GetSong(); s.GetGroup() != "Muse" || s.GetTitle() != "Uprising" || s.GetReleaseDate() != "2009-07-16" || s.GetCreatedAt() == "" {
+		t.Errorf("song = %+v", s)
+	}
+	// The song is not public, so anonymous callers do not see it.
+	_, err = c.GetSong(ctx, &pb.GetSongRequest{Id: id})
+	wantCode(t, err, codes.NotFound)
+
+	list, err := c.ListSongs(authed(ctx), &pb.ListSongsRequest{Group: "muse", Limit: 5})
+	if err != nil {
+		t.Fatalf("ListSongs: %v", err)
+	}
+	if list.GetTotal() != 1 || len(list.GetSongs()) != 1 || list.GetSongs()[0].GetId() != id {
+		t.Errorf("list = %+v, want the song", list)
+	}
+	_, err = c.ListSongs(ctx, &pb.ListSongsRequest{SortBy: "color"})
+	wantCode(t, err, codes.InvalidArgument)
+
+	lyrics, err := c.GetSongLyrics(authed(ctx), &pb.GetSongLyricsRequest{Id: id, Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatalf("GetSongLyrics: %v", err)
+	}
+	if lyrics.GetTotal() != 3 || len(lyrics.GetLyrics()) != 1 || lyrics.GetLyrics()[0] != "three" {
+		t.Errorf("lyrics = %+v, want the third of 3 verses", lyrics)
+	}
+	_, err = c.GetSongLyrics(ctx, &pb.GetSongLyricsRequest{Id: id})
+	wantCode(t, err, codes.NotFound)
+
+	if _, err := c.UpdateSong(authed(ctx), &pb.UpdateSongRequest{Id: id, Group: "Muse", Title: "Uprising", Text: "new"}); err != nil {
+		t.Fatalf("UpdateSong: %v", err)
+	}
+	if song, _ := repo.GetByID(ctx, id); song == nil || song.Text != "new" || !song.ReleaseDate.IsZero() {
+		t.Errorf("stored %+v, want every field replaced", song)
+	}
+	_, err = c.UpdateSong(ctx, &pb.UpdateSongRequest{Id: 42, Group: "Muse", Title: "Missing"})
+	wantCode(t, err, codes.NotFound)
+
+	_, err = c.DeleteSong(ctx, &pb.DeleteSongRequest{Id: id, Hard: true})
+	wantCode(t, err, codes.Unauthenticated)
+	if _, err := c.DeleteSong(ctx, &pb.DeleteSongRequest{Id: id}); err != nil {
+		t.Fatalf("DeleteSong: %v", err)
+	}
+	_, err = c.GetSong(authed(ctx), &pb.GetSongRequest{Id: id})
+	wantCode(t, err, codes.NotFound)
+	if _, err := c.DeleteSong(authed(ctx), &pb.DeleteSongRequest{Id: id, Hard: true}); err != nil {
+		t.Fatalf("hard DeleteSong: %v", err)
+	}
+	_, err = c.DeleteSong(ctx, &pb.DeleteSongRequest{Id: id})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{models.ErrPageOutOfRange, codes.InvalidArgument},
+		{models.ErrDeleted, codes.NotFound},
+		{models.ErrRequestInProgress, codes.Aborted},
+		{models.ErrCircuitOpen, codes.Unavailable},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{status.Error(codes.PermissionDenied, "no"), codes.PermissionDenied},
+		{net.ErrClosed, codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := status.Code(statusError(tt.err)); got != tt.code {
+			t.Errorf("statusError(%v) = %v, want %v", tt.err, got, tt.code)
+		}
+	}
+}
@@ -2,32 +2,103 @@ package endpoints
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"song-library-test-task/internal/models"
+	"strconv"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	"golang.org/x/sync/errgroup"
 	"song-library-test-task/internal/service"
 )
 
 // SongEndpoints bundles all endpoints for the SongService
 type SongEndpoints struct {
-	CreateSongEndpoint endpoint.Endpoint
-	GetSongEndpoint    endpoint.Endpoint
-	ListSongsEndpoint  endpoint.Endpoint
-	UpdateSongEndpoint endpoint.Endpoint
-	DeleteSongEndpoint endpoint.Endpoint
-	GetLyricsEndpoint  endpoint.Endpoint
+	CreateSongEndpoint    endpoint.Endpoint
+	CreateSongsEndpoint   endpoint.Endpoint
+	UpsertSongEndpoint    endpoint.Endpoint
+	GetSongEndpoint       endpoint.Endpoint
+	FindSongEndpoint      endpoint.Endpoint
+	SongsExistEndpoint    endpoint.Endpoint
+	ListSongsEndpoint     endpoint.Endpoint
+	RecentSongsEndpoint   endpoint.Endpoint
+	SameReleaseEndpoint   endpoint.Endpoint
+	SongHistoryEndpoint   endpoint.Endpoint
+	ReleaseYearsEndpoint  endpoint.Endpoint
+	SearchLyricsEndpoint  endpoint.Endpoint
+	SongIndexEndpoint     endpoint.Endpoint
+	IndexLettersEndpoint  endpoint.Endpoint
+	UpdateSongEndpoint    endpoint.Endpoint
+	PatchSongEndpoint     endpoint.Endpoint
+	DeleteSongEndpoint    endpoint.Endpoint
+	RestoreSongEndpoint   endpoint.Endpoint
+	SetVisibilityEndpoint endpoint.Endpoint
+	MergeSongsEndpoint    endpoint.Endpoint
+	EnrichSongEndpoint    endpoint.Endpoint
+	GetLyricsEndpoint     endpoint.Endpoint
+	GetVerseEndpoint      endpoint.Endpoint
+	CountVersesEndpoint   endpoint.Endpoint
+	WordStatsEndpoint     endpoint.Endpoint
+	ExportSongEndpoint    endpoint.Endpoint
+	ExportSongsEndpoint   endpoint.Endpoint
+	ReorderLyricsEndpoint endpoint.Endpoint
+	PreviewSplitEndpoint  endpoint.Endpoint
+	SuggestGroupsEndpoint endpoint.Endpoint
+	ListGroupsEndpoint    endpoint.Endpoint
+	EnrichGroupEndpoint   endpoint.Endpoint
+	ImportSongsEndpoint   endpoint.Endpoint
+	ApplyMetadataEndpoint endpoint.Endpoint
+	ReprocessEndpoint     endpoint.Endpoint
 }
 
 // MakeSongEndpoints constructs a SongEndpoints struct with all endpoints
-func MakeSongEndpoints(s service.SongService) SongEndpoints {
-	return SongEndpoints{
-		CreateSongEndpoint: makeCreateSongEndpoint(s),
-		GetSongEndpoint:    makeGetSongEndpoint(s),
-		ListSongsEndpoint:  makeListSongsEndpoint(s),
-		UpdateSongEndpoint: makeUpdateSongEndpoint(s),
-		DeleteSongEndpoint: makeDeleteSongEndpoint(s),
-		GetLyricsEndpoint:  makeGetLyricsEndpoint(s),
+func MakeSongEndpoints(s service.SongService, opts ...Option) SongEndpoints {
+	var cfg settings
+	for _, opt := range opts {
+		opt(&cfg)
 	}
+	v := cfg.views
+	eps := SongEndpoints{
+		CreateSongEndpoint:    makeCreateSongEndpoint(s, v),
+		CreateSongsEndpoint:   makeCreateSongsEndpoint(s),
+		UpsertSongEndpoint:    makeUpsertSongEndpoint(s),
+		GetSongEndpoint:       makeGetSongEndpoint(s, v),
+		FindSongEndpoint:      makeFindSongEndpoint(s, v),
+		SongsExistEndpoint:    makeSongsExistEndpoint(s),
+		ListSongsEndpoint:     makeListSongsEndpoint(s, v),
+		RecentSongsEndpoint:   makeRecentSongsEndpoint(s, v),
+		SameReleaseEndpoint:   makeSameReleaseEndpoint(s, v),
+		SongHistoryEndpoint:   makeSongHistoryEndpoint(s, v),
+		ReleaseYearsEndpoint:  makeReleaseYearsEndpoint(s),
+		SearchLyricsEndpoint:  makeSearchLyricsEndpoint(s, v),
+		SongIndexEndpoint:     makeSongIndexEndpoint(s, v),
+		IndexLettersEndpoint:  makeIndexLettersEndpoint(s),
+		UpdateSongEndpoint:    makeUpdateSongEndpoint(s),
+		PatchSongEndpoint:     makePatchSongEndpoint(s),
+		DeleteSongEndpoint:    makeDeleteSongEndpoint(s),
+		RestoreSongEndpoint:   makeRestoreSongEndpoint(s, v),
+		SetVisibilityEndpoint: makeSetVisibilityEndpoint(s),
+		MergeSongsEndpoint:    makeMergeSongsEndpoint(s, v),
+		EnrichSongEndpoint:    makeEnrichSongEndpoint(s, v),
+		GetLyricsEndpoint:     makeGetLyricsEndpoint(s),
+		GetVerseEndpoint:      makeGetVerseEndpoint(s),
+		CountVersesEndpoint:   makeCountVersesEndpoint(s),
+		WordStatsEndpoint:     makeWordStatsEndpoint(s),
+		ExportSongEndpoint:    makeExportSongEndpoint(s),
+		ExportSongsEndpoint:   makeExportSongsEndpoint(s),
+		ReorderLyricsEndpoint: makeReorderLyricsEndpoint(s),
+		PreviewSplitEndpoint:  makePreviewSplitEndpoint(s),
+		SuggestGroupsEndpoint: makeSuggestGroupsEndpoint(s),
+		ListGroupsEndpoint:    makeListGroupsEndpoint(s),
+		EnrichGroupEndpoint:   makeEnrichGroupEndpoint(s),
+		ImportSongsEndpoint:   makeImportSongsEndpoint(s),
+		ApplyMetadataEndpoint: makeApplyMetadataEndpoint(s),
+		ReprocessEndpoint:     makeReprocessEndpoint(s),
+	}
+	wrap(&eps, cfg.middlewares)
+	return eps
 }
 
 // Request/Response for each operation:
@@ -35,40 +106,323 @@ func MakeSongEndpoints(s service.SongService) SongEndpoints {
 type CreateSongRequest struct {
 	GroupName string `json:"group"`
 	Title     string `json:"song"`
+	// Optional fields; merged with the external enrichment data.
+	ReleaseDate string `json:"releaseDate,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Text        string `json:"text,omitempty"`
+	// IdempotencyKey comes from the Idempotency-Key header; a retry with
+	// the same key returns the song the first request created.
+	IdempotencyKey string `json:"-"`
+	// OnConflict is empty (or "error") to fail when the song exists, or
+	// "return" to return the existing song instead.
+	OnConflict string `json:"-"`
+	// PublicOnly hides private songs from unauthenticated callers: an
+	// existing private song is a plain conflict for onConflict=return.
+	PublicOnly bool `json:"-"`
 }
 type CreateSongResponse struct {
-	ID  int64  `json:"id"`
-	Err string `json:"error,omitempty"`
+	ID int64 `json:"id"`
+	// Song is the existing song returned instead of a conflict
+	// (onConflict=return); the status is then 200.
+	Song *SongView `json:"song,omitempty"`
+	// Warnings describe what enrichment failed when the song was stored
+	// without it (allow-partial mode).
+	Warnings []string `json:"warnings,omitempty"`
+	Err      error    `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r CreateSongResponse) Failed() error { return r.Err }
+
+// StatusCode implements kithttp.StatusCoder.
+func (r CreateSongResponse) StatusCode() int {
+	if r.Song != nil {
+		return http.StatusOK
+	}
+	return http.StatusCreated
+}
+
+// InZone implements Zoner.
+func (r CreateSongResponse) InZone(loc *time.Location) interface{} {
+	if r.Song != nil {
+		song := r.Song.inZone(loc)
+		r.Song = &song
+	}
+	return r
+}
+
+// Headers implements kithttp.Headerer, pointing Location at a new song. An
+// existing song returned for onConflict=return was not created, so it gets
+// no Location.
+func (r CreateSongResponse) Headers() http.Header {
+	if r.Song != nil {
+		return nil
+	}
+	return http.Header{"Location": []string{"/songs/" + strconv.FormatInt(r.ID, 10)}}
 }
 
-func makeCreateSongEndpoint(s service.SongService) endpoint.Endpoint {
+func makeCreateSongEndpoint(s service.SongService, v views) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(CreateSongRequest)
-		id, err := s.CreateSong(ctx, req.GroupName, req.Title)
+		if err := req.Validate(); err != nil {
+			return CreateSongResponse{Err: err}, nil
+		}
+		releaseDate, err := parseReleaseDate(req.ReleaseDate)
+		if err != nil {
+			return CreateSongResponse{Err: err}, nil
+		}
+		info := service.SongInfo{
+			ReleaseDate: releaseDate,
+			Link:        req.Link,
+			Text:        req.Text,
+		}
+
+		switch req.OnConflict {
+		case "", "error":
+		case "return":
+			id, existing, warnings, err := s.FindOrCreateSong(ctx, req.IdempotencyKey, req.GroupName, req.Title, info)
+			if err != nil {
+				return CreateSongResponse{Err: err}, nil
+			}
+			if existing != nil && req.PublicOnly && !existing.IsPublic {
+				return CreateSongResponse{Err: fmt.Errorf("%q - %q: %w", existing.GroupName, existing.Title, models.ErrDuplicateSong)}, nil
+			}
+			if existing != nil {
+				view := v.songView(*existing)
+				return CreateSongResponse{ID: id, Song: &view}, nil
+			}
+			return CreateSongResponse{ID: id, Warnings: warnings}, nil
+		default:
+			return CreateSongResponse{Err: fmt.Errorf("%w: onConflict must be \"error\" or \"return\"", models.ErrValidation)}, nil
+		}
+
+		id, warnings, _, err := s.CreateSongOnce(ctx, req.IdempotencyKey, req.GroupName, req.Title, info)
+		if err != nil {
+			return CreateSongResponse{Err: err}, nil
+		}
+		return CreateSongResponse{ID: id, Warnings: warnings}, nil
+	}
+}
+
+// Create Songs (batch)
+type CreateSongsRequest struct {
+	Songs []CreateSongRequest
+}
+type CreateSongResult struct {
+	ID     int64  `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+type CreateSongsResponse struct {
+	// Results is parallel to the request: Results[i] is the outcome of Songs[i].
+	Results []CreateSongResult `json:"results"`
+	Err     error              `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r CreateSongsResponse) Failed() error { return r.Err }
+
+func makeCreateSongsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CreateSongsRequest)
+		if err := req.Validate(); err != nil {
+			return CreateSongsResponse{Err: err}, nil
+		}
+		songs := make([]service.NewSong, len(req.Songs))
+		for i, song := range req.Songs {
+			releaseDate, err := parseReleaseDate(song.ReleaseDate)
+			if err != nil {
+				return CreateSongsResponse{Err: fmt.Errorf("song %d: %w", i, err)}, nil
+			}
+			songs[i] = service.NewSong{
+				GroupName: song.GroupName,
+				Title:     song.Title,
+				Provided: service.SongInfo{
+					ReleaseDate: releaseDate,
+					Link:        song.Link,
+					Text:        song.Text,
+				},
+			}
+		}
+
+		results, err := s.CreateSongs(ctx, songs)
+		if err != nil {
+			return CreateSongsResponse{Err: err}, nil
+		}
+
+		resp := CreateSongsResponse{Results: make([]CreateSongResult, 0, len(results))}
+		for _, res := range results {
+			item := CreateSongResult{ID: res.ID, Status: res.Status}
+			if res.Err != nil {
+				item.Error = res.Err.Error()
+			}
+			resp.Results = append(resp.Results, item)
+		}
+		return resp, nil
+	}
+}
+
+// Upsert Song
+type UpsertSongRequest struct {
+	GroupName   string `json:"group"`
+	Title       string `json:"song"`
+	ReleaseDate string `json:"releaseDate"`
+	Link        string `json:"link"`
+	Text        string `json:"text"`
+}
+type UpsertSongResponse struct {
+	ID      int64 `json:"id"`
+	Created bool  `json:"created"`
+	Err     error `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r UpsertSongResponse) Failed() error { return r.Err }
+
+// StatusCode implements kithttp.StatusCoder: 201 when the song was created,
+// 200 when it was replaced.
+func (r UpsertSongResponse) StatusCode() int {
+	if r.Created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// Headers implements kithttp.Headerer, pointing Location at a new song.
+func (r UpsertSongResponse) Headers() http.Header {
+	if !r.Created {
+		return nil
+	}
+	return http.Header{"Location": []string{"/songs/" + strconv.FormatInt(r.ID, 10)}}
+}
+
+func makeUpsertSongEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(UpsertSongRequest)
+		if err := req.Validate(); err != nil {
+			return UpsertSongResponse{Err: err}, nil
+		}
+		releaseDate, err := parseReleaseDate(req.ReleaseDate)
+		if err != nil {
+			return UpsertSongResponse{Err: err}, nil
+		}
+		id, created, err := s.UpsertSong(ctx, req.GroupName, req.Title, service.SongInfo{
+			ReleaseDate: releaseDate,
+			Link:        req.Link,
+			Text:        req.Text,
+		})
 		if err != nil {
-			return CreateSongResponse{Err: err.Error()}, nil
+			return UpsertSongResponse{Err: err}, nil
 		}
-		return CreateSongResponse{ID: id}, nil
+		return UpsertSongResponse{ID: id, Created: created}, nil
 	}
 }
 
 // Get Song
 type GetSongRequest struct {
 	ID int64
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
 }
 type GetSongResponse struct {
-	Song *models.Song `json:"song,omitempty"`
-	Err  string       `json:"error,omitempty"`
+	Song *SongView `json:"song,omitempty"`
+	Err  error     `json:"-"`
 }
 
-func makeGetSongEndpoint(s service.SongService) endpoint.Endpoint {
+// Failed implements the transport failureer interface.
+func (r GetSongResponse) Failed() error { return r.Err }
+
+// InZone implements Zoner.
+func (r GetSongResponse) InZone(loc *time.Location) interface{} {
+	if r.Song != nil {
+		song := r.Song.inZone(loc)
+		r.Song = &song
+	}
+	return r
+}
+
+func makeGetSongEndpoint(s service.SongService, v views) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(GetSongRequest)
 		song, err := s.GetSong(ctx, req.ID)
 		if err != nil {
-			return GetSongResponse{Err: err.Error()}, nil
+			return GetSongResponse{Err: err}, nil
+		}
+		if req.PublicOnly && !song.IsPublic {
+			return GetSongResponse{Err: models.ErrSongNotFound}, nil
+		}
+		view := v.songView(*song)
+		return GetSongResponse{Song: &view}, nil
+	}
+}
+
+// Find Song
+type FindSongRequest struct {
+	GroupName string
+	Title     string
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeFindSongEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(FindSongRequest)
+		song, err := s.FindSong(ctx, req.GroupName, req.Title)
+		if err != nil {
+			return GetSongResponse{Err: err}, nil
+		}
+		if req.PublicOnly && !song.IsPublic {
+			return GetSongResponse{Err: models.ErrSongNotFound}, nil
+		}
+		view := v.songView(*song)
+		return GetSongResponse{Song: &view}, nil
+	}
+}
+
+// Songs Exist
+type SongKey struct {
+	GroupName string `json:"group"`
+	Title     string `json:"song"`
+}
+type SongsExistRequest struct {
+	Songs []SongKey
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type SongExistence struct {
+	Exists bool   `json:"exists"`
+	ID     *int64 `json:"id,omitempty"`
+}
+type SongsExistResponse struct {
+	// Results is parallel to the request: Results[i] is the answer for Songs[i].
+	Results []SongExistence `json:"results"`
+	Err     error           `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r SongsExistResponse) Failed() error { return r.Err }
+
+func makeSongsExistEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SongsExistRequest)
+		keys := make([]models.SongKey, len(req.Songs))
+		for i, k := range req.Songs {
+			keys[i] = models.SongKey{GroupName: k.GroupName, Title: k.Title}
+		}
+
+		ids, err := s.ExistingSongIDs(ctx, keys, req.PublicOnly)
+		if err != nil {
+			return SongsExistResponse{Err: err}, nil
 		}
-		return GetSongResponse{Song: song}, nil
+
+		results := make([]SongExistence, len(ids))
+		for i, id := range ids {
+			if id != 0 {
+				id := id
+				results[i] = SongExistence{Exists: true, ID: &id}
+			}
+		}
+		return SongsExistResponse{Results: results}, nil
 	}
 }
 
@@ -76,26 +430,432 @@ func makeGetSongEndpoint(s service.SongService) endpoint.Endpoint {
 type ListSongsRequest struct {
 	GroupName string
 	Title     string
+	Match     string
 	Limit     int
 	Offset    int
+	// Fields is empty for full songs or "id" for IDs only.
+	Fields string
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+	// ReleasedAfter and ReleasedBefore are optional RFC 3339 date bounds.
+	ReleasedAfter  string
+	ReleasedBefore string
+	SortBy         string
+	SortDir        string
+	// AfterID is the keyset cursor: the next_cursor of the previous page.
+	AfterID int64
+	// Query is the full-text search over group, title and lyrics.
+	Query string
+	// Shape is empty or "array" for a list of songs, or "map" for songs
+	// keyed by ID (see ListSongsMapResponse).
+	Shape string
+	// IncludeFilters echoes the applied filters in the response.
+	IncludeFilters bool
 }
+
 type ListSongsResponse struct {
-	Songs []models.Song `json:"songs"`
-	Err   string        `json:"error,omitempty"`
+	Songs []SongView `json:"songs"`
+	// Total is the number of songs matching the filter across all pages;
+	// only set by the paginated song list.
+	Total *int64 `json:"total,omitempty"`
+	// NextCursor is the after_id fetching the next page of the song list in
+	// its default order; absent on the last page.
+	NextCursor *int64 `json:"next_cursor,omitempty"`
+	// AppliedFilters is only set by the song list with include_filters=true.
+	AppliedFilters *AppliedFilters `json:"appliedFilters,omitempty"`
+	Err            error           `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ListSongsResponse) Failed() error { return r.Err }
+
+// InZone implements Zoner.
+func (r ListSongsResponse) InZone(loc *time.Location) interface{} {
+	songs := make([]SongView, len(r.Songs))
+	for i, song := range r.Songs {
+		songs[i] = song.inZone(loc)
+	}
+	r.Songs = songs
+	return r
+}
+
+// ListSongsMapResponse is the song list keyed by ID; the JSON object keys
+// carry no order, so Order lists the IDs in the order of the page.
+type ListSongsMapResponse struct {
+	Songs          map[int64]SongView `json:"songs"`
+	Order          []int64            `json:"order"`
+	Total          int64              `json:"total"`
+	NextCursor     *int64             `json:"next_cursor,omitempty"`
+	AppliedFilters *AppliedFilters    `json:"appliedFilters,omitempty"`
+	Err            error              `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ListSongsMapResponse) Failed() error { return r.Err }
+
+// InZone implements Zoner.
+func (r ListSongsMapResponse) InZone(loc *time.Location) interface{} {
+	songs := make(map[int64]SongView, len(r.Songs))
+	for id, song := range r.Songs {
+		songs[id] = song.inZone(loc)
+	}
+	r.Songs = songs
+	return r
 }
 
-func makeListSongsEndpoint(s service.SongService) endpoint.Endpoint {
+type ListSongIDsResponse struct {
+	IDs            []int64         `json:"ids"`
+	Total          int64           `json:"total"`
+	AppliedFilters *AppliedFilters `json:"appliedFilters,omitempty"`
+	Err            error           `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ListSongIDsResponse) Failed() error { return r.Err }
+
+// AppliedFilters echoes the filters and page the song list actually applied,
+// with defaults filled in. Group and title are matched literally: LIKE
+// wildcards in them are escaped. The keys are camelCase like the rest of the
+// response, not the snake_case of the query parameters.
+type AppliedFilters struct {
+	Group          string `json:"group,omitempty"`
+	Title          string `json:"title,omitempty"`
+	Match          string `json:"match"`
+	Query          string `json:"q,omitempty"`
+	ReleasedAfter  string `json:"releasedAfter,omitempty"`
+	ReleasedBefore string `json:"releasedBefore,omitempty"`
+	PublicOnly     bool   `json:"publicOnly"`
+	SortBy         string `json:"sortBy"`
+	SortDir        string `json:"sortDir"`
+	AfterID        int64  `json:"afterId,omitempty"`
+	Limit          int    `json:"limit"`
+	Offset         int    `json:"offset"`
+}
+
+// appliedFilters describes filter and the page as applied by the song list.
+func appliedFilters(filter models.SongFilter, limit, offset int) *AppliedFilters {
+	applied := &AppliedFilters{
+		Group:      filter.GroupName,
+		Title:      filter.Title,
+		Match:      filter.Match,
+		Query:      filter.SearchQuery,
+		PublicOnly: filter.PublicOnly,
+		SortBy:     filter.SortBy,
+		SortDir:    filter.SortDir,
+		AfterID:    filter.AfterID,
+		Limit:      limit,
+		Offset:     offset,
+	}
+	if applied.Match == "" {
+		applied.Match = models.MatchSubstring
+	}
+	if applied.SortBy == "" {
+		applied.SortBy = models.SortByID
+		if filter.SearchQuery != "" {
+			applied.SortBy = "relevance"
+		}
+	}
+	if applied.SortDir == "" {
+		applied.SortDir = models.SortDesc
+	}
+	if !filter.ReleasedAfter.IsZero() {
+		applied.ReleasedAfter = filter.ReleasedAfter.Format(models.ReleaseDateLayout)
+	}
+	if !filter.ReleasedBefore.IsZero() {
+		applied.ReleasedBefore = filter.ReleasedBefore.Format(models.ReleaseDateLayout)
+	}
+	return applied
+}
+
+func makeListSongsEndpoint(s service.SongService, v views) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(ListSongsRequest)
+		releasedAfter, releasedBefore, err := service.ParseReleaseRange(req.ReleasedAfter, req.ReleasedBefore)
+		if err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
 		filter := models.SongFilter{
-			GroupName: req.GroupName,
-			Title:     req.Title,
+			GroupName:      req.GroupName,
+			Title:          req.Title,
+			Match:          req.Match,
+			PublicOnly:     req.PublicOnly,
+			ReleasedAfter:  releasedAfter,
+			ReleasedBefore: releasedBefore,
+			SortBy:         req.SortBy,
+			SortDir:        req.SortDir,
+			AfterID:        req.AfterID,
+			SearchQuery:    req.Query,
+		}
+
+		if req.Fields != "" && req.Fields != "id" {
+			return ListSongsResponse{Err: fmt.Errorf("%w: fields must be empty or \"id\"", models.ErrValidation)}, nil
+		}
+		switch req.Shape {
+		case "", "array":
+		case "map":
+			if req.Fields == "id" {
+				return ListSongsResponse{Err: fmt.Errorf("%w: shape=map cannot be combined with fields=id", models.ErrValidation)}, nil
+			}
+		default:
+			return ListSongsResponse{Err: fmt.Errorf("%w: shape must be \"array\" or \"map\"", models.ErrValidation)}, nil
+		}
+		limit, offset, err := s.ListPage(req.Limit, req.Offset)
+		if err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
+		var applied *AppliedFilters
+		if req.IncludeFilters {
+			applied = appliedFilters(filter, limit, offset)
+		}
+
+		// The total and the page are independent queries; run them concurrently.
+		var total int64
+		g, gctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			var err error
+			total, err = s.CountSongs(gctx, filter)
+			return err
+		})
+
+		if req.Fields == "id" {
+			var ids []int64
+			g.Go(func() error {
+				var err error
+				ids, err = s.ListSongIDs(gctx, filter, limit, offset)
+				return err
+			})
+			if err := g.Wait(); err != nil {
+				return ListSongIDsResponse{Err: err}, nil
+			}
+			return ListSongIDsResponse{IDs: ids, Total: total, AppliedFilters: applied}, nil
+		}
+
+		var songs []models.Song
+		g.Go(func() error {
+			var err error
+			songs, err = s.ListSongs(gctx, filter, limit, offset)
+			return err
+		})
+		if err := g.Wait(); err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
+		var nextCursor *int64
+		// A full page in the default order may have a successor; a short one
+		// is the last.
+		if len(songs) > 0 && len(songs) == limit && offset == 0 &&
+			(req.SortBy == models.SortByID || req.SortBy == "" && req.Query == "") &&
+			(req.SortDir == "" || req.SortDir == models.SortDesc) {
+			next := songs[len(songs)-1].ID
+			nextCursor = &next
+		}
+
+		page := v.songViews(songs)
+		if req.Shape == "map" {
+			resp := ListSongsMapResponse{
+				Songs:          make(map[int64]SongView, len(page)),
+				Order:          make([]int64, len(page)),
+				Total:          total,
+				NextCursor:     nextCursor,
+				AppliedFilters: applied,
+			}
+			for i, view := range page {
+				resp.Songs[view.ID] = view
+				resp.Order[i] = view.ID
+			}
+			return resp, nil
+		}
+		return ListSongsResponse{Songs: page, Total: &total, NextCursor: nextCursor, AppliedFilters: applied}, nil
+	}
+}
+
+// Recent Songs
+type RecentSongsRequest struct {
+	Limit int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeRecentSongsEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RecentSongsRequest)
+		songs, err := s.RecentSongs(ctx, req.PublicOnly, req.Limit)
+		if err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
+		return ListSongsResponse{Songs: v.songViews(songs)}, nil
+	}
+}
+
+// ReleaseYears
+type ReleaseYearsRequest struct {
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type ReleaseYearsResponse struct {
+	Years []int `json:"years"`
+	Err   error `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ReleaseYearsResponse) Failed() error { return r.Err }
+
+func makeReleaseYearsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ReleaseYearsRequest)
+		years, err := s.ReleaseYears(ctx, req.PublicOnly)
+		if err != nil {
+			return ReleaseYearsResponse{Err: err}, nil
+		}
+		if years == nil {
+			years = []int{}
+		}
+		return ReleaseYearsResponse{Years: years}, nil
+	}
+}
+
+// SearchLyrics
+type SearchLyricsRequest struct {
+	Query  string
+	Order  string
+	Limit  int
+	Offset int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeSearchLyricsEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SearchLyricsRequest)
+		search := models.LyricsSearch{
+			Query:      req.Query,
+			Order:      req.Order,
+			PublicOnly: req.PublicOnly,
+		}
+		songs, err := s.SearchLyrics(ctx, search, req.Limit, req.Offset)
+		if err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
+		return ListSongsResponse{Songs: v.songViews(songs)}, nil
+	}
+}
+
+// SongIndex
+type SongIndexRequest struct {
+	Letter string
+	Limit  int
+	Offset int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeSongIndexEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SongIndexRequest)
+		songs, err := s.SongsByIndexLetter(ctx, req.Letter, req.PublicOnly, req.Limit, req.Offset)
+		if err != nil {
+			return ListSongsResponse{Err: err}, nil
+		}
+		return ListSongsResponse{Songs: v.songViews(songs)}, nil
+	}
+}
+
+// IndexLetters
+type IndexLettersRequest struct {
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type IndexLettersResponse struct {
+	Letters []string `json:"letters"`
+	Err     error    `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r IndexLettersResponse) Failed() error { return r.Err }
+
+func makeIndexLettersEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(IndexLettersRequest)
+		letters, err := s.IndexLetters(ctx, req.PublicOnly)
+		if err != nil {
+			return IndexLettersResponse{Err: err}, nil
+		}
+		if letters == nil {
+			letters = []string{}
 		}
-		songs, err := s.ListSongs(ctx, filter, req.Limit, req.Offset)
+		return IndexLettersResponse{Letters: letters}, nil
+	}
+}
+
+// SameRelease
+type SameReleaseRequest struct {
+	ID     int64
+	Limit  int
+	Offset int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeSameReleaseEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SameReleaseRequest)
+		songs, err := s.SameReleaseDateSongs(ctx, req.ID, req.PublicOnly, req.Limit, req.Offset)
 		if err != nil {
-			return ListSongsResponse{Err: err.Error()}, nil
+			return ListSongsResponse{Err: err}, nil
 		}
-		return ListSongsResponse{Songs: songs}, nil
+		return ListSongsResponse{Songs: v.songViews(songs)}, nil
+	}
+}
+
+// SongHistory
+type SongHistoryRequest struct {
+	ID     int64
+	Limit  int
+	Offset int
+}
+type HistoryEntryView struct {
+	Operation  string    `json:"operation"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// Snapshot is the song right after the operation; for a delete, the
+	// song as it was deleted.
+	Snapshot SongView `json:"snapshot"`
+}
+type SongHistoryResponse struct {
+	Entries []HistoryEntryView `json:"entries"`
+	Total   int64              `json:"total"`
+	Err     error              `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r SongHistoryResponse) Failed() error { return r.Err }
+
+// InZone implements Zoner.
+func (r SongHistoryResponse) InZone(loc *time.Location) interface{} {
+	entries := make([]HistoryEntryView, len(r.Entries))
+	for i, e := range r.Entries {
+		e.OccurredAt = e.OccurredAt.In(loc)
+		e.Snapshot = e.Snapshot.inZone(loc)
+		entries[i] = e
+	}
+	r.Entries = entries
+	return r
+}
+
+func makeSongHistoryEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SongHistoryRequest)
+		entries, total, err := s.SongHistory(ctx, req.ID, req.Limit, req.Offset)
+		if err != nil {
+			return SongHistoryResponse{Err: err}, nil
+		}
+		resp := SongHistoryResponse{Entries: make([]HistoryEntryView, 0, len(entries)), Total: total}
+		for _, e := range entries {
+			resp.Entries = append(resp.Entries, HistoryEntryView{
+				Operation:  e.Operation,
+				OccurredAt: e.OccurredAt,
+				Snapshot:   v.songView(e.Snapshot),
+			})
+		}
+		return resp, nil
 	}
 }
 
@@ -109,22 +869,69 @@ type UpdateSongRequest struct {
 	Text        string `json:"text"`
 }
 type UpdateSongResponse struct {
-	Err string `json:"error,omitempty"`
+	Err error `json:"-"`
 }
 
+// Failed implements the transport failureer interface.
+func (r UpdateSongResponse) Failed() error { return r.Err }
+
 func makeUpdateSongEndpoint(s service.SongService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(UpdateSongRequest)
-		err := s.UpdateSong(ctx, models.Song{
+		if err := req.Validate(); err != nil {
+			return UpdateSongResponse{Err: err}, nil
+		}
+		releaseDate, err := parseReleaseDate(req.ReleaseDate)
+		if err != nil {
+			return UpdateSongResponse{Err: err}, nil
+		}
+		err = s.UpdateSong(ctx, models.Song{
 			ID:          req.ID,
 			GroupName:   req.GroupName,
 			Title:       req.Title,
-			ReleaseDate: req.ReleaseDate,
+			ReleaseDate: releaseDate,
 			Link:        req.Link,
 			Text:        req.Text,
 		})
 		if err != nil {
-			return UpdateSongResponse{Err: err.Error()}, nil
+			return UpdateSongResponse{Err: err}, nil
+		}
+		return UpdateSongResponse{}, nil
+	}
+}
+
+// Patch Song
+type PatchSongRequest struct {
+	ID          int64   `json:"-"`
+	GroupName   *string `json:"group"`
+	Title       *string `json:"song"`
+	ReleaseDate *string `json:"releaseDate"`
+	Link        *string `json:"link"`
+	Text        *string `json:"text"`
+}
+
+func makePatchSongEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(PatchSongRequest)
+		if err := req.Validate(); err != nil {
+			return UpdateSongResponse{Err: err}, nil
+		}
+		patch := service.SongPatch{
+			GroupName: req.GroupName,
+			Title:     req.Title,
+			Link:      req.Link,
+			Text:      req.Text,
+		}
+		if req.ReleaseDate != nil {
+			releaseDate, err := parseReleaseDate(*req.ReleaseDate)
+			if err != nil {
+				return UpdateSongResponse{Err: err}, nil
+			}
+			patch.ReleaseDate = &releaseDate
+		}
+
+		if err := s.PatchSong(ctx, req.ID, patch); err != nil {
+			return UpdateSongResponse{Err: err}, nil
 		}
 		return UpdateSongResponse{}, nil
 	}
@@ -133,41 +940,602 @@ func makeUpdateSongEndpoint(s service.SongService) endpoint.Endpoint {
 // Delete Song
 type DeleteSongRequest struct {
 	ID int64
+	// Hard removes the song for good instead of soft-deleting it.
+	Hard bool
 }
 type DeleteSongResponse struct {
-	Err string `json:"error,omitempty"`
+	Err error `json:"-"`
 }
 
+// Failed implements the transport failureer interface.
+func (r DeleteSongResponse) Failed() error { return r.Err }
+
+// StatusCode implements kithttp.StatusCoder; deletes answer 204 No Content.
+func (r DeleteSongResponse) StatusCode() int { return http.StatusNoContent }
+
 func makeDeleteSongEndpoint(s service.SongService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(DeleteSongRequest)
-		err := s.DeleteSong(ctx, req.ID)
+		var err error
+		if req.Hard {
+			err = s.PurgeSong(ctx, req.ID)
+		} else {
+			err = s.DeleteSong(ctx, req.ID)
+		}
 		if err != nil {
-			return DeleteSongResponse{Err: err.Error()}, nil
+			return DeleteSongResponse{Err: err}, nil
 		}
 		return DeleteSongResponse{}, nil
 	}
 }
 
+// Set Visibility
+type SetVisibilityRequest struct {
+	ID     int64 `json:"-"`
+	Public bool  `json:"public"`
+}
+
+func makeSetVisibilityEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SetVisibilityRequest)
+		err := s.SetSongVisibility(ctx, req.ID, req.Public)
+		if err != nil {
+			return UpdateSongResponse{Err: err}, nil
+		}
+		return UpdateSongResponse{}, nil
+	}
+}
+
+// MergeSongs
+type MergeSongsRequest struct {
+	ID   int64 `json:"-"`
+	Into int64 `json:"into"`
+	// Prefer is "target" (default) or "source": whose non-empty fields win.
+	Prefer string `json:"prefer,omitempty"`
+}
+
+func makeMergeSongsEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(MergeSongsRequest)
+		song, err := s.MergeSongs(ctx, req.ID, req.Into, req.Prefer)
+		if err != nil {
+			return GetSongResponse{Err: err}, nil
+		}
+		view := v.songView(*song)
+		return GetSongResponse{Song: &view}, nil
+	}
+}
+
 // GetLyrics
 type GetLyricsRequest struct {
 	ID       int64
 	Page     int
 	PageSize int
+	// Format is empty (or "json") for paginated verses, "detailed" for
+	// paginated verse objects, or "lrc".
+	Format string
+	// Duration spreads LRC timestamps evenly when known.
+	Duration time.Duration
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
 }
 type GetLyricsResponse struct {
 	Lyrics []string `json:"lyrics"`
 	Total  int      `json:"total"`
-	Err    string   `json:"error,omitempty"`
+	Err    error    `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r GetLyricsResponse) Failed() error { return r.Err }
+
+type VerseView struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	Lines  int    `json:"lines"`
+}
+type DetailedLyricsResponse struct {
+	Verses []VerseView `json:"verses"`
+	Total  int         `json:"total"`
+	Page   int         `json:"page"`
+	// PageSize is the page size applied, capped at the max page size.
+	PageSize int   `json:"pageSize"`
+	Err      error `json:"-"`
 }
 
+// Failed implements the transport failureer interface.
+func (r DetailedLyricsResponse) Failed() error { return r.Err }
+
 func makeGetLyricsEndpoint(s service.SongService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(GetLyricsRequest)
-		verses, total, err := s.GetSongLyrics(ctx, req.ID, req.Page, req.PageSize)
+		switch req.Format {
+		case "", "json":
+		case "lrc":
+			lrc, err := s.GetSongLRC(ctx, req.ID, req.PublicOnly, req.Duration)
+			if err != nil {
+				return TextResponse{Err: err}, nil
+			}
+			return TextResponse{ContentType: "text/plain; charset=utf-8", Body: lrc}, nil
+		case "detailed":
+			page, err := s.GetSongVerses(ctx, req.ID, req.PublicOnly, req.Page, req.PageSize)
+			if err != nil {
+				return DetailedLyricsResponse{Err: err}, nil
+			}
+			verses := make([]VerseView, 0, len(page.Verses))
+			for _, v := range page.Verses {
+				verses = append(verses, VerseView{Number: v.Number, Text: v.Text, Lines: v.Lines})
+			}
+			return DetailedLyricsResponse{Verses: verses, Total: page.Total, Page: page.Page, PageSize: page.PageSize}, nil
+		default:
+			return GetLyricsResponse{Err: fmt.Errorf("%w: format must be \"json\", \"detailed\" or \"lrc\"", models.ErrValidation)}, nil
+		}
+
+		verses, total, err := s.GetSongLyrics(ctx, req.ID, req.PublicOnly, req.Page, req.PageSize)
 		if err != nil {
-			return GetLyricsResponse{Err: err.Error()}, nil
+			return GetLyricsResponse{Err: err}, nil
 		}
 		return GetLyricsResponse{Lyrics: verses, Total: total}, nil
 	}
 }
+
+// GetVerse
+type GetVerseRequest struct {
+	ID int64
+	// Verse is the 1-based verse number.
+	Verse int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type GetVerseResponse struct {
+	Verse int    `json:"verse"`
+	Total int    `json:"total"`
+	Text  string `json:"text"`
+	Err   error  `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r GetVerseResponse) Failed() error { return r.Err }
+
+func makeGetVerseEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(GetVerseRequest)
+		text, total, err := s.GetVerse(ctx, req.ID, req.PublicOnly, req.Verse)
+		if err != nil {
+			return GetVerseResponse{Err: err}, nil
+		}
+		return GetVerseResponse{Verse: req.Verse, Total: total, Text: text}, nil
+	}
+}
+
+// CountVerses
+type CountVersesRequest struct {
+	ID int64
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type CountVersesResponse struct {
+	Total int   `json:"total"`
+	Err   error `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r CountVersesResponse) Failed() error { return r.Err }
+
+func makeCountVersesEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CountVersesRequest)
+		total, err := s.CountVerses(ctx, req.ID, req.PublicOnly)
+		if err != nil {
+			return CountVersesResponse{Err: err}, nil
+		}
+		return CountVersesResponse{Total: total}, nil
+	}
+}
+
+// WordStats
+type WordStatsRequest struct {
+	ID int64
+	// Top is the number of words returned; 0 uses the default.
+	Top int
+	// Stopwords is empty or "en" to skip common English words.
+	Stopwords string
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type WordCountView struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+type WordStatsResponse struct {
+	Words []WordCountView `json:"words"`
+	// Total is the number of words counted, stopwords excluded.
+	Total int   `json:"total"`
+	Err   error `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r WordStatsResponse) Failed() error { return r.Err }
+
+func makeWordStatsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(WordStatsRequest)
+		stats, total, err := s.LyricsWordStats(ctx, req.ID, req.PublicOnly, req.Top, req.Stopwords)
+		if err != nil {
+			return WordStatsResponse{Err: err}, nil
+		}
+		words := make([]WordCountView, 0, len(stats))
+		for _, w := range stats {
+			words = append(words, WordCountView{Word: w.Word, Count: w.Count})
+		}
+		return WordStatsResponse{Words: words, Total: total}, nil
+	}
+}
+
+// ExportSongs
+type ExportSongsRequest struct {
+	GroupName string
+	Title     string
+	Match     string
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+	// ReleasedAfter and ReleasedBefore are optional RFC 3339 date bounds.
+	ReleasedAfter  string
+	ReleasedBefore string
+}
+
+func makeExportSongsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ExportSongsRequest)
+		releasedAfter, releasedBefore, err := service.ParseReleaseRange(req.ReleasedAfter, req.ReleasedBefore)
+		if err != nil {
+			return StreamResponse{Err: err}, nil
+		}
+		write, err := s.ExportCSV(ctx, models.SongFilter{
+			GroupName:      req.GroupName,
+			Title:          req.Title,
+			Match:          req.Match,
+			PublicOnly:     req.PublicOnly,
+			ReleasedAfter:  releasedAfter,
+			ReleasedBefore: releasedBefore,
+		})
+		if err != nil {
+			return StreamResponse{Err: err}, nil
+		}
+		return StreamResponse{ContentType: "text/csv; charset=utf-8", Filename: "songs.csv", Write: write}, nil
+	}
+}
+
+// ExportSong
+type ExportSongRequest struct {
+	ID int64
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+
+func makeExportSongEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ExportSongRequest)
+		filename, text, err := s.ExportSongText(ctx, req.ID, req.PublicOnly)
+		if err != nil {
+			return TextResponse{Err: err}, nil
+		}
+		return TextResponse{
+			ContentType: "text/plain; charset=utf-8",
+			Filename:    filename,
+			Body:        text,
+		}, nil
+	}
+}
+
+// ReorderLyrics
+type ReorderLyricsRequest struct {
+	ID    int64 `json:"-"`
+	Order []int `json:"order"`
+}
+type ReorderLyricsResponse struct {
+	Lyrics []string `json:"lyrics"`
+	Err    error    `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ReorderLyricsResponse) Failed() error { return r.Err }
+
+func makeReorderLyricsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ReorderLyricsRequest)
+		verses, err := s.ReorderVerses(ctx, req.ID, req.Order)
+		if err != nil {
+			return ReorderLyricsResponse{Err: err}, nil
+		}
+		return ReorderLyricsResponse{Lyrics: verses}, nil
+	}
+}
+
+// PreviewSplit
+type PreviewSplitRequest struct {
+	Text     string `json:"text"`
+	Strategy string `json:"strategy,omitempty"`
+}
+type PreviewSplitResponse struct {
+	Verses []string `json:"verses"`
+	Err    error    `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r PreviewSplitResponse) Failed() error { return r.Err }
+
+func makePreviewSplitEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(PreviewSplitRequest)
+		verses, err := s.PreviewVerses(req.Text, req.Strategy)
+		if err != nil {
+			return PreviewSplitResponse{Err: err}, nil
+		}
+		return PreviewSplitResponse{Verses: verses}, nil
+	}
+}
+
+// SuggestGroups
+type SuggestGroupsRequest struct {
+	Prefix     string
+	Limit      int
+	WithCounts bool
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type GroupSuggestion struct {
+	Group string `json:"group"`
+	Songs *int64 `json:"songs,omitempty"`
+}
+type SuggestGroupsResponse struct {
+	Groups []GroupSuggestion `json:"groups"`
+	Err    error             `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r SuggestGroupsResponse) Failed() error { return r.Err }
+
+func makeSuggestGroupsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SuggestGroupsRequest)
+		groups, err := s.SuggestGroups(ctx, req.Prefix, req.PublicOnly, req.Limit, req.WithCounts)
+		if err != nil {
+			return SuggestGroupsResponse{Err: err}, nil
+		}
+
+		suggestions := make([]GroupSuggestion, 0, len(groups))
+		for _, g := range groups {
+			suggestion := GroupSuggestion{Group: g.GroupName}
+			if req.WithCounts {
+				count := g.SongCount
+				suggestion.Songs = &count
+			}
+			suggestions = append(suggestions, suggestion)
+		}
+		return SuggestGroupsResponse{Groups: suggestions}, nil
+	}
+}
+
+// ListGroups
+type ListGroupsRequest struct {
+	Prefix string
+	Limit  int
+	Offset int
+	// PublicOnly hides private songs from unauthenticated callers.
+	PublicOnly bool
+}
+type GroupInfo struct {
+	Group string `json:"group"`
+	Songs int64  `json:"songs"`
+}
+type ListGroupsResponse struct {
+	Groups []GroupInfo `json:"groups"`
+	Total  int64       `json:"total"`
+	Err    error       `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ListGroupsResponse) Failed() error { return r.Err }
+
+func makeListGroupsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListGroupsRequest)
+		groups, total, err := s.ListGroups(ctx, req.Prefix, req.PublicOnly, req.Limit, req.Offset)
+		if err != nil {
+			return ListGroupsResponse{Err: err}, nil
+		}
+
+		resp := ListGroupsResponse{Groups: make([]GroupInfo, 0, len(groups)), Total: total}
+		for _, g := range groups {
+			resp.Groups = append(resp.Groups, GroupInfo{Group: g.GroupName, Songs: g.SongCount})
+		}
+		return resp, nil
+	}
+}
+
+// RestoreSong
+type RestoreSongRequest struct {
+	ID int64
+}
+
+func makeRestoreSongEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RestoreSongRequest)
+		song, err := s.RestoreSong(ctx, req.ID)
+		if err != nil {
+			return GetSongResponse{Err: err}, nil
+		}
+		view := v.songView(*song)
+		return GetSongResponse{Song: &view}, nil
+	}
+}
+
+// EnrichSong
+type EnrichSongRequest struct {
+	ID int64
+}
+
+func makeEnrichSongEndpoint(s service.SongService, v views) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(EnrichSongRequest)
+		song, err := s.EnrichSongByID(ctx, req.ID)
+		if err != nil {
+			return GetSongResponse{Err: err}, nil
+		}
+		view := v.songView(*song)
+		return GetSongResponse{Song: &view}, nil
+	}
+}
+
+// EnrichGroup
+type EnrichGroupRequest struct {
+	GroupName string
+}
+type EnrichSongResult struct {
+	ID       int64  `json:"id"`
+	Enriched bool   `json:"enriched"`
+	Error    string `json:"error,omitempty"`
+}
+type EnrichGroupResponse struct {
+	Results []EnrichSongResult `json:"results"`
+	Err     error              `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r EnrichGroupResponse) Failed() error { return r.Err }
+
+func makeEnrichGroupEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(EnrichGroupRequest)
+		results, err := s.EnrichGroup(ctx, req.GroupName)
+		if err != nil {
+			return EnrichGroupResponse{Err: err}, nil
+		}
+
+		resp := EnrichGroupResponse{Results: make([]EnrichSongResult, 0, len(results))}
+		for _, res := range results {
+			item := EnrichSongResult{ID: res.SongID, Enriched: res.Err == nil}
+			if res.Err != nil {
+				item.Error = res.Err.Error()
+			}
+			resp.Results = append(resp.Results, item)
+		}
+		return resp, nil
+	}
+}
+
+// importRowErrors converts row errors to their view, never returning nil.
+func importRowErrors(errs []service.ImportRowError) []ImportRowError {
+	views := make([]ImportRowError, 0, len(errs))
+	for _, e := range errs {
+		views = append(views, ImportRowError{Line: e.Line, Reason: e.Reason})
+	}
+	return views
+}
+
+// ImportSongs
+type ImportSongsRequest struct {
+	Format string
+	Body   io.Reader
+}
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+type ImportSongsResponse struct {
+	ImportedRows int              `json:"imported"`
+	SkippedRows  int              `json:"skipped"`
+	FailedRows   int              `json:"failed"`
+	Errors       []ImportRowError `json:"errors"`
+	Warnings     []ImportRowError `json:"warnings"`
+	Err          error            `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ImportSongsResponse) Failed() error { return r.Err }
+
+func makeImportSongsEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ImportSongsRequest)
+		if req.Format != "csv" {
+			return ImportSongsResponse{Err: fmt.Errorf("%w: unsupported import format %q", models.ErrValidation, req.Format)}, nil
+		}
+
+		summary, err := s.ImportCSV(ctx, req.Body)
+		if err != nil {
+			return ImportSongsResponse{Err: err}, nil
+		}
+
+		return ImportSongsResponse{
+			ImportedRows: summary.Imported,
+			SkippedRows:  summary.Skipped,
+			FailedRows:   summary.Failed,
+			Errors:       importRowErrors(summary.Errors),
+			Warnings:     importRowErrors(summary.Warnings),
+		}, nil
+	}
+}
+
+// ApplyMetadata
+type ApplyMetadataRequest struct {
+	Format string
+	Body   io.Reader
+}
+type UnmatchedRow struct {
+	Line      int    `json:"line"`
+	GroupName string `json:"group"`
+	Title     string `json:"song"`
+}
+type ApplyMetadataResponse struct {
+	Matched   int              `json:"matched"`
+	Updated   int              `json:"updated"`
+	Unmatched []UnmatchedRow   `json:"unmatched"`
+	Errors    []ImportRowError `json:"errors"`
+	Err       error            `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ApplyMetadataResponse) Failed() error { return r.Err }
+
+func makeApplyMetadataEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ApplyMetadataRequest)
+		summary, err := s.ApplyMetadataFile(ctx, req.Format, req.Body)
+		if err != nil {
+			return ApplyMetadataResponse{Err: err}, nil
+		}
+
+		resp := ApplyMetadataResponse{
+			Matched:   summary.Matched,
+			Updated:   summary.Updated,
+			Unmatched: make([]UnmatchedRow, 0, len(summary.Unmatched)),
+			Errors:    importRowErrors(summary.Errors),
+		}
+		for _, u := range summary.Unmatched {
+			resp.Unmatched = append(resp.Unmatched, UnmatchedRow{Line: u.Line, GroupName: u.Key.GroupName, Title: u.Key.Title})
+		}
+		return resp, nil
+	}
+}
+
+// Reprocess
+type ReprocessRequest struct{}
+type ReprocessResponse struct {
+	Scanned  int   `json:"scanned"`
+	Changed  int   `json:"changed"`
+	Rejected int   `json:"rejected"`
+	Err      error `json:"-"`
+}
+
+// Failed implements the transport failureer interface.
+func (r ReprocessResponse) Failed() error { return r.Err }
+
+func makeReprocessEndpoint(s service.SongService) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		result, err := s.Reprocess(ctx)
+		if err != nil {
+			return ReprocessResponse{Err: err}, nil
+		}
+		return ReprocessResponse{Scanned: result.Scanned, Changed: result.Changed, Rejected: result.Rejected}, nil
+	}
+}
@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"song-library-test-task/internal/middleware"
+)
+
+// settings holds the optional behaviour configured by Options.
+type settings struct {
+	views       views
+	middlewares []endpoint.Middleware
+}
+
+// Option configures optional endpoint behaviour.
+type Option func(*settings)
+
+// WithNullEmptyLyrics renders songs without lyrics with "Text": null instead
+// of "Text": "", so clients can tell "no lyrics available" apart from a
+// value. It applies to every endpoint returning songs (get, find and lists).
+func WithNullEmptyLyrics(enabled bool) Option {
+	return func(s *settings) {
+		s.views.nullEmptyLyrics = enabled
+	}
+}
+
+// WithTextPreviewLength truncates the lyrics of every song in list responses
+// to their first n characters plus an ellipsis, flagging such songs with
+// "textTruncated": true. Zero (the default) returns the full lyrics.
+func WithTextPreviewLength(n int) Option {
+	return func(s *settings) {
+		s.views.textPreviewLength = n
+	}
+}
+
+// WithMiddleware wraps every endpoint in mw. Middlewares are applied in the
+// order given, the first being outermost; each call's context carries the
+// endpoint's name (see middleware.EndpointName).
+func WithMiddleware(mw endpoint.Middleware) Option {
+	return func(s *settings) {
+		s.middlewares = append(s.middlewares, mw)
+	}
+}
+
+// wrap applies middlewares to every endpoint of eps, naming each after its
+// field without the "Endpoint" suffix (e.g. "CreateSong").
+func wrap(eps *SongEndpoints, middlewares []endpoint.Middleware) {
+	if len(middlewares) == 0 {
+		return
+	}
+	chain := endpoint.Chain(middlewares[0], middlewares[1:]...)
+
+	v := reflect.ValueOf(eps).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		ep, ok := field.Interface().(endpoint.Endpoint)
+		if !ok {
+			continue
+		}
+		name := t.Field(i).Name
+		name = name[:len(name)-len("Endpoint")]
+		next := chain(ep)
+		field.Set(reflect.ValueOf(endpoint.Endpoint(func(ctx context.Context, request interface{}) (interface{}, error) {
+			return next(middleware.WithEndpointName(ctx, name), request)
+		})))
+	}
+}
@@ -0,0 +1,165 @@
+package endpoints
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"song-library-test-task/internal/models"
+)
+
+// ValidationError reports the fields of a request body that failed
+// validation, keyed by their JSON name. It matches models.ErrValidation, so
+// it is answered with 422, and the transport sends Fields as the details of
+// the error body.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + " " + e.Fields[name]
+	}
+	return models.ErrValidation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return models.ErrValidation }
+
+// fieldErrors collects per-field problems; the first problem of a field wins.
+type fieldErrors map[string]string
+
+func (f fieldErrors) add(field, msg string) {
+	if _, ok := f[field]; !ok {
+		f[field] = msg
+	}
+}
+
+// name checks a required group name or song title.
+func (f fieldErrors) name(field, value string, maxLen int) {
+	switch {
+	case strings.TrimSpace(value) == "":
+		f.add(field, "is required")
+	case utf8.RuneCountInString(value) > maxLen:
+		f.add(field, "must be at most "+strconv.Itoa(maxLen)+" characters")
+	}
+	f.text(field, value)
+}
+
+// text rejects invalid UTF-8 and control characters other than line breaks
+// and tabs.
+func (f fieldErrors) text(field, value string) {
+	if !utf8.ValidString(value) {
+		f.add(field, "must be valid UTF-8")
+		return
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			f.add(field, "must not contain control characters")
+			return
+		}
+	}
+}
+
+// singleLine additionally rejects line breaks and tabs.
+func (f fieldErrors) singleLine(field, value string) {
+	if strings.ContainsAny(value, "\n\r\t") {
+		f.add(field, "must be a single line")
+	}
+	f.text(field, value)
+}
+
+func (f fieldErrors) releaseDate(value string) {
+	if value == "" {
+		return
+	}
+	if _, ok := models.ParseReleaseDate(value); !ok {
+		f.add("releaseDate", "must be a valid date")
+	}
+}
+
+func (f fieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: f}
+}
+
+// Validate checks the fields of a new song before it reaches the service.
+func (r CreateSongRequest) Validate() error {
+	f := fieldErrors{}
+	f.name("group", r.GroupName, models.MaxGroupNameLength)
+	f.name("song", r.Title, models.MaxTitleLength)
+	f.releaseDate(r.ReleaseDate)
+	f.singleLine("link", r.Link)
+	f.text("text", r.Text)
+	return f.err()
+}
+
+// Validate checks the fields of an upserted song.
+func (r UpsertSongRequest) Validate() error {
+	f := fieldErrors{}
+	f.name("group", r.GroupName, models.MaxGroupNameLength)
+	f.name("song", r.Title, models.MaxTitleLength)
+	f.releaseDate(r.ReleaseDate)
+	f.singleLine("link", r.Link)
+	f.text("text", r.Text)
+	return f.err()
+}
+
+// Validate checks the fields of a replaced song.
+func (r UpdateSongRequest) Validate() error {
+	f := fieldErrors{}
+	f.name("group", r.GroupName, models.MaxGroupNameLength)
+	f.name("song", r.Title, models.MaxTitleLength)
+	f.releaseDate(r.ReleaseDate)
+	f.singleLine("link", r.Link)
+	f.text("text", r.Text)
+	return f.err()
+}
+
+// Validate checks the fields present in a patch; absent fields are left
+// alone.
+func (r PatchSongRequest) Validate() error {
+	f := fieldErrors{}
+	if r.GroupName != nil {
+		f.name("group", *r.GroupName, models.MaxGroupNameLength)
+	}
+	if r.Title != nil {
+		f.name("song", *r.Title, models.MaxTitleLength)
+	}
+	if r.ReleaseDate != nil {
+		f.releaseDate(*r.ReleaseDate)
+	}
+	if r.Link != nil {
+		f.singleLine("link", *r.Link)
+	}
+	if r.Text != nil {
+		f.text("text", *r.Text)
+	}
+	return f.err()
+}
+
+// Validate checks every song of a batch. The fields of the returned
+// ValidationError are prefixed with the index of their song, as in
+// "[2].group".
+func (r CreateSongsRequest) Validate() error {
+	f := fieldErrors{}
+	for i, song := range r.Songs {
+		var invalid *ValidationError
+		if errors.As(song.Validate(), &invalid) {
+			for field, msg := range invalid.Fields {
+				f.add("["+strconv.Itoa(i)+"]."+field, msg)
+			}
+		}
+	}
+	return f.err()
+}
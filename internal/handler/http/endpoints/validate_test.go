@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestCreateSongRequestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CreateSongRequest
+		want map[string]string
+	}{
+		{
+			name: "valid",
+			req:  CreateSongRequest{GroupName: "Muse", Title: "Uprising", ReleaseDate: "16.07.2009", Link: "https://example.com", Text: "one\n\ttwo"},
+		},
+		{
+			name: "blank names",
+			req:  CreateSongRequest{GroupName: " ", Title: ""},
+			want: map[string]string{"group": "is required", "song": "is required"},
+		},
+		{
+			name: "bad date",
+			req:  CreateSongRequest{GroupName: "Muse", Title: "Uprising", ReleaseDate: "2009-13-01"},
+			want: map[string]string{"releaseDate": "must be a valid date"},
+		},
+		{
+			name: "multi-line link",
+			req:  CreateSongRequest{GroupName: "Muse", Title: "Uprising", Link: "https://a\nhttps://b"},
+			want: map[string]string{"link": "must be a single line"},
+		},
+		{
+			name: "control characters",
+			req:  CreateSongRequest{GroupName: "Mu\x00se", Title: "Uprising", Text: "bell\a"},
+			want: map[string]string{"group": "must not contain control characters", "text": "must not contain control characters"},
+		},
+		{
+			name: "invalid UTF-8",
+			req:  CreateSongRequest{GroupName: "Muse", Title: "Upr\xffising"},
+			want: map[string]string{"song": "must be valid UTF-8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, models.ErrValidation) {
+				t.Fatalf("Validate error = %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(invalid.Fields, tt.want) {
+				t.Errorf("fields = %v, want %v", invalid.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchSongRequestValidate(t *testing.T) {
+	empty, bad := "", "someday"
+	if err := (PatchSongRequest{}).Validate(); err != nil {
+		t.Errorf("empty patch: %v", err)
+	}
+	err := PatchSongRequest{Title: &empty, ReleaseDate: &bad}.Validate()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 2 {
+		t.Errorf("Validate error = %v, want song and releaseDate rejected", err)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := &ValidationError{Fields: map[string]string{"song": "is required", "group": "is required"}}
+	if want := "validation failed: group is required; song is required"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,149 @@
+package endpoints
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"song-library-test-task/internal/models"
+)
+
+// SongView is the JSON representation of a song. The release date is rendered
+// as "2006-01-02" (empty when unknown) and also split into components, which
+// are omitted when the release date is unknown. Text is the lyrics, or null
+// for a song without lyrics when WithNullEmptyLyrics is enabled; in lists it
+// may be cut short (see WithTextPreviewLength), which TextTruncated reports.
+// EnrichedAt is null for a song never enriched from the external API.
+type SongView struct {
+	models.Song
+	// ReleaseDate, Text and EnrichedAt shadow the Song fields in JSON.
+	ReleaseDate  string     `json:"ReleaseDate"`
+	Text         *string    `json:"Text"`
+	EnrichedAt   *time.Time `json:"EnrichedAt"`
+	Enriched     bool       `json:"enriched"`
+	ReleaseYear  int        `json:"releaseYear,omitempty"`
+	ReleaseMonth int        `json:"releaseMonth,omitempty"`
+	ReleaseDay   int        `json:"releaseDay,omitempty"`
+	// TextTruncated is set when Text is only a preview of the lyrics.
+	TextTruncated bool `json:"textTruncated,omitempty"`
+}
+
+// Zoner is implemented by responses carrying timestamps. InZone returns the
+// response with every timestamp converted to loc; the transport applies it
+// with the zone the client asked for, or UTC.
+type Zoner interface {
+	InZone(loc *time.Location) interface{}
+}
+
+// inZone converts the song's timestamps to loc. ReleaseDate is a calendar
+// day, not an instant, and is left alone.
+func (v SongView) inZone(loc *time.Location) SongView {
+	v.CreatedAt = v.CreatedAt.In(loc)
+	v.UpdatedAt = v.UpdatedAt.In(loc)
+	if v.EnrichedAt != nil {
+		t := v.EnrichedAt.In(loc)
+		v.EnrichedAt = &t
+	}
+	return v
+}
+
+// views holds the rendering settings shared by the endpoints returning songs.
+type views struct {
+	nullEmptyLyrics bool
+	// textPreviewLength, when positive, caps the lyrics in list responses
+	// at that many characters.
+	textPreviewLength int
+}
+
+func (vs views) songView(song models.Song) SongView {
+	v := SongView{Song: song}
+	if t := song.ReleaseDate; !t.IsZero() {
+		v.ReleaseDate = t.Format(models.ReleaseDateLayout)
+		v.ReleaseYear = t.Year()
+		v.ReleaseMonth = int(t.Month())
+		v.ReleaseDay = t.Day()
+	}
+	if t := song.EnrichedAt; !t.IsZero() {
+		v.EnrichedAt = &t
+		v.Enriched = true
+	}
+	if song.Text != "" || !vs.nullEmptyLyrics {
+		text := song.Text
+		v.Text = &text
+	}
+	return v
+}
+
+// songViews renders a list of songs; unlike songView it applies the text
+// preview length, since the full lyrics stay available from the single-song
+// endpoints.
+func (vs views) songViews(songs []models.Song) []SongView {
+	out := make([]SongView, 0, len(songs))
+	for _, s := range songs {
+		v := vs.songView(s)
+		if v.Text != nil && vs.textPreviewLength > 0 {
+			if preview, cut := truncateText(*v.Text, vs.textPreviewLength); cut {
+				v.Text = &preview
+				v.TextTruncated = true
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// truncateText cuts text to its first n characters (runes, so multi-byte
+// characters are never split) followed by an ellipsis. It reports whether
+// anything was cut.
+func truncateText(text string, n int) (string, bool) {
+	if utf8.RuneCountInString(text) <= n {
+		return text, false
+	}
+	i := 0
+	for pos := range text {
+		if i == n {
+			return text[:pos] + "…", true
+		}
+		i++
+	}
+	return text, false
+}
+
+// parseReleaseDate parses a client-supplied release date in any of the
+// accepted formats. An empty value means unknown and yields the zero time.
+func parseReleaseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, ok := models.ParseReleaseDate(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: invalid releaseDate %q", models.ErrValidation, value)
+	}
+	return t, nil
+}
+
+// TextResponse is written verbatim with its content type instead of being
+// encoded as JSON. A non-empty Filename makes it a download.
+type TextResponse struct {
+	ContentType string
+	Filename    string
+	Body        string
+	Err         error
+}
+
+// Failed implements the transport failureer interface.
+func (r TextResponse) Failed() error { return r.Err }
+
+// StreamResponse is written by calling Write with the response body once the
+// headers are sent, so large bodies are never buffered. An error from Write
+// can no longer change the status; it only cuts the body short.
+type StreamResponse struct {
+	ContentType string
+	Filename    string
+	Write       func(w io.Writer) error
+	Err         error
+}
+
+// Failed implements the transport failureer interface.
+func (r StreamResponse) Failed() error { return r.Err }
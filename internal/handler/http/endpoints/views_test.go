@@ -0,0 +1,153 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestSongViewReleaseDate(t *testing.T) {
+	tests := []struct {
+		name string
+		date time.Time
+		want map[string]interface{}
+	}{
+		{
+			name: "known",
+			date: time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC),
+			want: map[string]interface{}{"ReleaseDate": "2009-07-16", "releaseYear": 2009.0, "releaseMonth": 7.0, "releaseDay": 16.0},
+		},
+		{
+			name: "unknown",
+			want: map[string]interface{}{"ReleaseDate": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(views{}.songView(models.Song{ID: 1, ReleaseDate: tt.date}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"ReleaseDate", "releaseYear", "releaseMonth", "releaseDay"} {
+				if got[key] != tt.want[key] {
+					t.Errorf("%s = %v, want %v", key, got[key], tt.want[key])
+				}
+			}
+		})
+	}
+}
+
+func TestSongViewNullEmptyLyrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		nullEmpty bool
+		text      string
+		want      string
+	}{
+		{"empty as string", false, "", `"Text":""`},
+		{"empty as null", true, "", `"Text":null`},
+		{"lyrics unaffected", true, "one", `"Text":"one"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(views{nullEmptyLyrics: tt.nullEmpty}.songView(models.Song{ID: 1, Text: tt.text}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("JSON = %s, want it to contain %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+		cut  bool
+	}{
+		{"Uprising", 8, "Uprising", false},
+		{"Paranoia is in bloom", 8, "Paranoia…", true},
+		{"Группа крови", 6, "Группа…", true},
+		{"Группа", 6, "Группа", false},
+		{"日本語の歌詞です", 6, "日本語の歌詞…", true},
+		{"😀😃😄😁😆😅😂🤣", 7, "😀😃😄😁😆😅😂…", true},
+		{"", 6, "", false},
+	}
+	for _, tt := range tests {
+		got, cut := truncateText(tt.text, tt.n)
+		if got != tt.want || cut != tt.cut {
+			t.Errorf("truncateText(%q, %d) = %q, %v; want %q, %v", tt.text, tt.n, got, cut, tt.want, tt.cut)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateText(%q, %d) = %q, not valid UTF-8", tt.text, tt.n, got)
+		}
+	}
+}
+
+func TestSongViewsTextPreview(t *testing.T) {
+	songs := []models.Song{
+		{ID: 1, Title: "Группа крови", Text: "Тёплое место, но улицы ждут"},
+		{ID: 2, Title: "Short", Text: "Кино"},
+	}
+	got := views{textPreviewLength: 5}.songViews(songs)
+	if *got[0].Text != "Тёпло…" || !got[0].TextTruncated {
+		t.Errorf("first view: text = %q, truncated = %v", *got[0].Text, got[0].TextTruncated)
+	}
+	if *got[1].Text != "Кино" || got[1].TextTruncated {
+		t.Errorf("second view: text = %q, truncated = %v", *got[1].Text, got[1].TextTruncated)
+	}
+
+	data, err := json.Marshal(got[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "textTruncated") {
+		t.Errorf("untruncated view %s carries textTruncated", data)
+	}
+
+	single := views{textPreviewLength: 5}.songView(songs[0])
+	if *single.Text != songs[0].Text || single.TextTruncated {
+		t.Errorf("single view text = %q, want the full lyrics", *single.Text)
+	}
+}
+
+func TestSongViewInZone(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	created := time.Date(2024, time.March, 1, 21, 30, 0, 0, time.UTC)
+	enriched := time.Date(2024, time.March, 2, 9, 0, 0, 0, time.UTC)
+	song := models.Song{ID: 1, ReleaseDate: time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC), CreatedAt: created, UpdatedAt: created, EnrichedAt: enriched}
+
+	view := views{}.songView(song)
+	resp := GetSongResponse{Song: &view}.InZone(moscow)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"CreatedAt":"2024-03-02T00:30:00+03:00"`,
+		`"UpdatedAt":"2024-03-02T00:30:00+03:00"`,
+		`"EnrichedAt":"2024-03-02T12:00:00+03:00"`,
+		`"ReleaseDate":"2009-07-16"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("response %s lacks %s", data, want)
+		}
+	}
+	if view.CreatedAt.Location() != time.UTC {
+		t.Errorf("InZone modified the view it was given")
+	}
+}
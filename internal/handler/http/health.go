@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+)
+
+// Pinger checks a backing service is reachable; *sql.DB implements it.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// MigrationStatuser reports the schema migration state of the database: the
+// version it is at and the versions not applied yet.
+type MigrationStatuser interface {
+	MigrationStatus(ctx context.Context) (current int64, pending []int64, err error)
+}
+
+// ServerDependencies are the infrastructure handles the transport needs
+// directly, outside the go-kit endpoints.
+type ServerDependencies struct {
+	// DB is pinged by the readiness probe.
+	DB Pinger
+	// Migrations backs GET /admin/db-status.
+	Migrations MigrationStatuser
+	// Logger receives the failures the transport logs itself: 5xx errors,
+	// aborted streams and failed readiness checks. It defaults to a
+	// debug-level logger.NewStdLogger.
+	Logger logger.Logger
+}
+
+// readyTimeout bounds the database ping of the readiness probe.
+const readyTimeout = time.Second
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// healthHandler is the liveness probe: it answers as long as the process
+// serves HTTP at all.
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// readyHandler is the readiness probe: it reports 503 while the database
+// cannot be reached.
+func readyHandler(db Pinger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Reason: "db"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			requestLogger(ctx).Warn("readiness: database ping failed", "err", err)
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Reason: "db"})
+			return
+		}
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+	}
+}
+
+type dbStatusResponse struct {
+	Version         int64   `json:"version"`
+	Pending         bool    `json:"pending"`
+	PendingVersions []int64 `json:"pendingVersions"`
+}
+
+// dbStatusHandler reports the migration version of the database to
+// authenticated callers.
+func dbStatusHandler(m MigrationStatuser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !middleware.IsAuthenticated(r.Context()) {
+			encodeErrorResponse(r.Context(), models.ErrUnauthorized, w)
+			return
+		}
+		if m == nil {
+			encodeErrorResponse(r.Context(), errors.New("migration status unavailable"), w)
+			return
+		}
+
+		current, pending, err := m.MigrationStatus(r.Context())
+		if err != nil {
+			encodeErrorResponse(r.Context(), err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(dbStatusResponse{
+			Version:         current,
+			Pending:         len(pending) > 0,
+			PendingVersions: pending,
+		})
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
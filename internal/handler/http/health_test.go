@@ -0,0 +1,70 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveHealth runs h on a recorded GET request and decodes its body.
+func serveHealth(t *testing.T, h http.HandlerFunc) (int, healthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/", nil))
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+	var resp healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealthHandler(t *testing.T) {
+	if code, resp := serveHealth(t, healthHandler); code != http.StatusOK || resp != (healthResponse{Status: "ok"}) {
+		t.Errorf("health = %d %+v", code, resp)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	unavailable := healthResponse{Status: "unavailable", Reason: "db"}
+	tests := []struct {
+		name   string
+		db     Pinger
+		status int
+		want   healthResponse
+	}{
+		{"healthy", pingerFunc(func(context.Context) error { return nil }), http.StatusOK, healthResponse{Status: "ok"}},
+		{"ping fails", pingerFunc(func(context.Context) error { return errors.New("connection refused") }), http.StatusServiceUnavailable, unavailable},
+		{"no database", nil, http.StatusServiceUnavailable, unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := serveHealth(t, readyHandler(tt.db))
+			if code != tt.status || resp != tt.want {
+				t.Errorf("ready = %d %+v, want %d %+v", code, resp, tt.status, tt.want)
+			}
+		})
+	}
+
+	t.Run("ping times out", func(t *testing.T) {
+		var deadline time.Time
+		hanging := pingerFunc(func(ctx context.Context) error {
+			deadline, _ = ctx.Deadline()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		start := time.Now()
+		if code, resp := serveHealth(t, readyHandler(hanging)); code != http.StatusServiceUnavailable || resp != unavailable {
+			t.Errorf("ready = %d %+v", code, resp)
+		}
+		if elapsed := time.Since(start); deadline.IsZero() || elapsed > 2*readyTimeout {
+			t.Errorf("ready took %v with ping deadline %v, want the ping cut off after %v", elapsed, deadline, readyTimeout)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+)
+
+// idempotencyKeyHeader carries the client's idempotency key on POST /songs.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// CORS headers sent to allowed origins.
+const corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+var (
+	corsAllowHeaders = strings.Join([]string{
+		"Content-Type",
+		middleware.APIKeyHeader,
+		middleware.TimeoutHeader,
+		idempotencyKeyHeader,
+		middleware.TraceIDHeader,
+	}, ", ")
+	corsExposeHeaders = strings.Join([]string{
+		"Location",
+		"Retry-After",
+		middleware.TraceIDHeader,
+		middleware.RateLimitLimitHeader,
+		middleware.RateLimitRemainingHeader,
+		middleware.RateLimitResetHeader,
+	}, ", ")
+)
+
+// cors lets browsers on the allowed origins ("*" allows any) call the API.
+// Preflight requests are answered with 204 here and never reach the router;
+// requests from other origins get no CORS headers, so the browser blocks
+// them.
+func cors(allowedOrigins []string, next http.Handler) http.Handler {
+	allowAny := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o == "*" {
+			allowAny = true
+		}
+		allowed[o] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" && (allowAny || allowed[origin]) {
+			if allowAny {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+			if h.Get("Access-Control-Allow-Origin") != "" {
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tzParam is the query parameter naming the IANA time zone (e.g.
+// "Europe/Moscow") timestamps are rendered in; it is accepted by every route.
+const tzParam = "tz"
+
+type timeZoneKey struct{}
+
+// timeZone validates the tz query parameter, rejecting unknown zones with
+// 422 before the request reaches its endpoint, and stores the zone in the
+// request context for encodeJSONResponse.
+func timeZone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get(tzParam)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// "Local" would expose the server's zone and is not an IANA name.
+		loc, err := time.LoadLocation(name)
+		if err != nil || name == "Local" {
+			encodeErrorResponse(r.Context(), fmt.Errorf("%w: unknown time zone %q", models.ErrValidation, name), w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), timeZoneKey{}, loc)))
+	})
+}
+
+// responseZone returns the zone requested with tz, UTC by default.
+func responseZone(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(timeZoneKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+type loggerKey struct{}
+
+// withLogger stores log in the request context for requestLogger, so the
+// encoders, which only see the context, log through the injected logger.
+func withLogger(log logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, log)))
+	})
+}
+
+// requestLogger returns the logger stored by withLogger, a debug-level
+// standard logger outside a handler, tagged with the request's trace ID.
+func requestLogger(ctx context.Context) logger.Logger {
+	log, ok := ctx.Value(loggerKey{}).(logger.Logger)
+	if !ok {
+		log = logger.NewStdLogger(logger.LevelDebug)
+	}
+	if id := logger.TraceIDFromContext(ctx); id != "" {
+		return logger.With(log, "trace_id", id)
+	}
+	return log
+}
+
+// unlimitedBodyPaths are the file upload routes exempt from limitBody.
+var unlimitedBodyPaths = map[string]bool{
+	"/songs/import":           true,
+	"/songs/enrich-from-file": true,
+}
+
+// limitBody caps request bodies at limit bytes, so a client cannot make the
+// server buffer an arbitrarily large payload. Bodies declaring a larger
+// Content-Length are refused with 413 up front; others fail when the decoder
+// reads past the limit.
+func limitBody(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedBodyPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			encodeErrorResponse(r.Context(), fmt.Errorf("%w: request body exceeds %d bytes", errBodyTooLarge, limit), w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestCORS(t *testing.T) {
+	s := newTestServer(t, withHandlerOptions(WithCORSOrigins([]string{"https://app.example.com"})))
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	t.Run("allowed origin", func(t *testing.T) {
+		resp := s.do(t, "GET", "/songs/1", nil, "Origin", "https://app.example.com")
+		if resp.status != http.StatusOK {
+			t.Fatalf("status = %d", resp.status)
+		}
+		if got := resp.header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+		if got := resp.header.Get("Access-Control-Expose-Headers"); !strings.Contains(got, "Location") {
+			t.Errorf("Access-Control-Expose-Headers = %q, want Location exposed", got)
+		}
+		if got := resp.header.Values("Vary"); !contains(got, "Origin") {
+			t.Errorf("Vary = %q, want Origin", got)
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		resp := s.do(t, "GET", "/songs/1", nil, "Origin", "https://evil.example.com")
+		if resp.status != http.StatusOK {
+			t.Fatalf("status = %d, want the request served without CORS headers", resp.status)
+		}
+		if got := resp.header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+		}
+		if got := resp.header.Values("Vary"); !contains(got, "Origin") {
+			t.Errorf("Vary = %q, want Origin", got)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		resp := s.do(t, "OPTIONS", "/songs", nil,
+			"Origin", "https://app.example.com",
+			"Access-Control-Request-Method", "POST",
+			"Access-Control-Request-Headers", "Content-Type, X-API-Key")
+		if resp.status != http.StatusNoContent || len(resp.body) != 0 {
+			t.Fatalf("status = %d, body = %q; want an empty 204", resp.status, resp.body)
+		}
+		if got := resp.header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, "POST") || !strings.Contains(got, "DELETE") {
+			t.Errorf("Access-Control-Allow-Methods = %q", got)
+		}
+		if got := resp.header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Content-Type") || !strings.Contains(got, "X-API-Key") {
+			t.Errorf("Access-Control-Allow-Headers = %q", got)
+		}
+		if got := resp.header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+		if n := s.count(t); n != 1 {
+			t.Errorf("%d songs stored, want the preflight kept from the endpoint", n)
+		}
+	})
+
+	t.Run("preflight from a disallowed origin", func(t *testing.T) {
+		resp := s.do(t, "OPTIONS", "/songs", nil, "Origin", "https://evil.example.com", "Access-Control-Request-Method", "DELETE")
+		if resp.status != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", resp.status)
+		}
+		for _, h := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+			if got := resp.header.Get(h); got != "" {
+				t.Errorf("%s = %q, want none", h, got)
+			}
+		}
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		s := newTestServer(t, withHandlerOptions(WithCORSOrigins([]string{"*"})))
+		resp := s.do(t, "GET", "/songs/years", nil, "Origin", "https://anywhere.example.com")
+		if got := resp.header.Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newTestServer(t)
+		resp := s.do(t, "GET", "/songs/years", nil, "Origin", "https://app.example.com")
+		if got := resp.header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q without WithCORSOrigins", got)
+		}
+	})
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLimitBody(t *testing.T) {
+	var decoded error
+	called := false
+	h := limitBody(16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		var v interface{}
+		decoded = decodeJSONBody(r, &v)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(path, body string, streamed bool) *httptest.ResponseRecorder {
+		called, decoded = false, nil
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if streamed {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/songs", `{"group":"Muse"}`, false); w.Code != http.StatusNoContent || decoded != nil {
+		t.Errorf("body at the limit: status %d, decode error %v", w.Code, decoded)
+	}
+	if w := serve("/songs", `{"group":"Muse","song":"Uprising"}`, false); w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Errorf("declared oversized body: status %d, handler called %v; want 413 up front", w.Code, called)
+	}
+	if serve("/songs", `{"group":"Muse","song":"Uprising"}`, true); !errors.Is(decoded, errBodyTooLarge) {
+		t.Errorf("streamed oversized body: decode error %v, want errBodyTooLarge", decoded)
+	}
+	if w := serve("/songs/import", `{"group":"Muse","song":"Uprising"}`, false); w.Code != http.StatusNoContent || decoded != nil {
+		t.Errorf("upload route: status %d, decode error %v; want it exempt", w.Code, decoded)
+	}
+}
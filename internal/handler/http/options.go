@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"song-library-test-task/internal/middleware"
+)
+
+// handlerConfig holds the optional settings of NewHTTPHandler.
+type handlerConfig struct {
+	strictQuery bool
+	corsOrigins []string
+	maxBody     int64
+	// middleware wraps the routes, the first entry outermost.
+	middleware []func(http.Handler) http.Handler
+}
+
+// HandlerOption configures NewHTTPHandler.
+type HandlerOption func(*handlerConfig)
+
+// WithStrictQueryParams makes the list and lyrics endpoints reject requests
+// carrying query parameters they do not recognise, instead of ignoring them.
+func WithStrictQueryParams() HandlerOption {
+	return func(c *handlerConfig) {
+		c.strictQuery = true
+	}
+}
+
+// WithCORSOrigins answers CORS preflight requests and adds CORS headers for
+// browsers on the given origins; "*" allows any origin. Without it no CORS
+// headers are sent.
+func WithCORSOrigins(origins []string) HandlerOption {
+	return func(c *handlerConfig) {
+		c.corsOrigins = origins
+	}
+}
+
+// WithMaxBodyBytes rejects request bodies larger than n bytes with 413.
+// File uploads to /songs/import and /songs/enrich-from-file are exempt; their
+// size is bounded by the row limits of the service instead. Zero or less
+// disables the check.
+func WithMaxBodyBytes(n int64) HandlerOption {
+	return func(c *handlerConfig) {
+		c.maxBody = n
+	}
+}
+
+// WithMiddleware wraps the handler in mw. Middleware options wrap in the
+// order they are given, the first one outermost, so it sees every request
+// first and every response last. CORS and the body limit always sit inside
+// them, next to the routes.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) HandlerOption {
+	return func(c *handlerConfig) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// WithTraceID gives every request a trace ID; see middleware.TraceID.
+func WithTraceID() HandlerOption {
+	return WithMiddleware(middleware.TraceID)
+}
+
+// WithRateLimiter limits all clients together to rps requests per second
+// with bursts of up to burst; see middleware.RateLimit.
+func WithRateLimiter(rps float64, burst int) HandlerOption {
+	return WithMiddleware(middleware.RateLimit(rps, burst))
+}
+
+// WithPerIPRateLimiter limits each client IP separately; see
+// middleware.RateLimitPerIP.
+func WithPerIPRateLimiter(rps float64, burst int) HandlerOption {
+	return WithMiddleware(middleware.RateLimitPerIP(rps, burst))
+}
+
+// WithMetrics counts responses by status code and method in
+// http_responses_total on reg. Unlike the endpoint metrics this includes
+// requests answered by middleware, such as rate-limited ones, as long as it
+// is placed outside that middleware.
+func WithMetrics(reg prometheus.Registerer) HandlerOption {
+	responses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_responses_total",
+		Help: "Number of HTTP responses by status code and method.",
+	}, []string{"code", "method"})
+	if err := reg.Register(responses); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			panic(err)
+		}
+		responses = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	return WithMiddleware(func(next http.Handler) http.Handler {
+		return promhttp.InstrumentHandlerCounter(responses, next)
+	})
+}
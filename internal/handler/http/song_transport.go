@@ -1,40 +1,152 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
 )
 
 // NewHTTPHandler constructs a http.Handler with all the Song routes.
-func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
+func NewHTTPHandler(eps endpoints.SongEndpoints, deps ServerDependencies, options ...HandlerOption) http.Handler {
+	var cfg handlerConfig
+	for _, option := range options {
+		option(&cfg)
+	}
+
 	r := mux.NewRouter()
+	r.NotFoundHandler = errorHandler(errRouteNotFound)
+	r.MethodNotAllowedHandler = errorHandler(errMethodNotAllowed)
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(encodeErrorResponse),
+	}
 
 	// --------------------------------------------------------------------------------
 	// Create a new song
 	// --------------------------------------------------------------------------------
 	// CreateSong godoc
 	// @Summary     Create a new song
-	// @Description Provide a JSON body with "group" and "song" fields. This also calls an external API to enrich the data with release date, text, and link.
+	// @Description Provide a JSON body with "group" and "song" fields. This also calls an external API to enrich the data with release date, text, and link. Optional "releaseDate", "link" and "text" fields are merged with the external data; which side wins when both are set is configurable (client by default).
 	// @Tags        songs
 	// @Accept      json
 	// @Produce     json
 	// @Param       input body endpoints.CreateSongRequest true "New Song Data"
+	// @Param       Idempotency-Key header string false "Client-chosen key (at most 255 characters); a retry with the same key within 24 hours returns the song the first request created, or 409 while that request is still running"
+	// @Param       onConflict query string false "error (default) fails with 409 when the song exists; return responds 200 with the existing song instead, without calling the external API; without a valid API key a private existing song is still 409"
+	// @Success     200 {object} endpoints.CreateSongResponse
 	// @Success     201 {object} endpoints.CreateSongResponse
+	// @Header      201 {string} Location "URL of the new song"
 	// @Failure     400 {object} errorResponse
+	// @Failure     409 {object} errorResponse
+	// @Failure     422 {object} errorResponse
 	// @Failure     500 {object} errorResponse
+	// @Failure     502 {object} errorResponse
+	// @Failure     503 {object} errorResponse
 	// @Router      /songs [post]
 	r.Handle("/songs",
 		kithttp.NewServer(
 			eps.CreateSongEndpoint,
 			decodeCreateSongRequest,
 			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Create or replace a song by group and title
+	// --------------------------------------------------------------------------------
+	// UpsertSong godoc
+	// @Summary     Create or replace a song by identity
+	// @Description Stores the song identified by "group" and "song": a new song is created with the given fields (201 with a Location header), an existing one has its release date, link and lyrics replaced (200). The external API is not called.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       input body endpoints.UpsertSongRequest true "Song data"
+	// @Success     200 {object} endpoints.UpsertSongResponse
+	// @Success     201 {object} endpoints.UpsertSongResponse
+	// @Header      201 {string} Location "URL of the new song"
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs [put]
+	r.Handle("/songs",
+		kithttp.NewServer(
+			eps.UpsertSongEndpoint,
+			decodeUpsertSongRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("PUT")
+
+	// --------------------------------------------------------------------------------
+	// Bulk import songs
+	// --------------------------------------------------------------------------------
+	// ImportSongs godoc
+	// @Summary     Import songs
+	// @Description Streams a CSV (with a header row: group, title and optional release_date, link, text; the output of GET /songs/export is accepted) and creates the songs row by row, enriching each from the external API. When enrichment fails the row is stored with its own fields and a warning. Rows whose group and title already exist are skipped with a warning. Invalid rows are reported with their line number. At most IMPORT_MAX_ROWS rows are read. The CSV is either the request body (with ?format=csv) or the "file" field of a multipart/form-data upload.
+	// @Tags        songs
+	// @Accept      text/csv
+	// @Accept      multipart/form-data
+	// @Produce     json
+	// @Param       format query    string false "Import format of a raw body; only csv is supported"
+	// @Param       file   formData file   false "CSV file (multipart uploads)"
+	// @Success     200 {object} endpoints.ImportSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/import [post]
+	r.Handle("/songs/import",
+		kithttp.NewServer(
+			eps.ImportSongsEndpoint,
+			decodeImportSongsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Apply curated metadata from a mapping file
+	// --------------------------------------------------------------------------------
+	// ApplyMetadata godoc
+	// @Summary     Apply metadata from a file
+	// @Description Applies a mapping of group and title to release date, link and lyrics to the existing songs with exactly that group and title; empty values leave a field unchanged. A CSV mapping has a header row (group, title and optional release_date, link, text); a JSON mapping is an array of {"group", "song", "releaseDate", "link", "text"} objects. Rows are applied in batches, each in one transaction. The response counts the rows that matched a song and those that changed it, and lists unmatched and invalid rows by line (CSV) or position (JSON). The mapping is either the request body or the "file" field of a multipart/form-data upload; its format comes from ?format= or else from its Content-Type.
+	// @Tags        songs
+	// @Accept      text/csv
+	// @Accept      json
+	// @Accept      multipart/form-data
+	// @Produce     json
+	// @Param       format query    string false "csv or json"
+	// @Param       file   formData file   false "Mapping file (multipart uploads)"
+	// @Success     200 {object} endpoints.ApplyMetadataResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/enrich-from-file [post]
+	r.Handle("/songs/enrich-from-file",
+		kithttp.NewServer(
+			eps.ApplyMetadataEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeApplyMetadataRequest, "format"),
+			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("POST")
 
@@ -43,21 +155,244 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 	// --------------------------------------------------------------------------------
 	// ListSongs godoc
 	// @Summary     List songs
-	// @Description Returns a list of songs with optional filtering by group, title, and pagination.
+	// @Description Returns a list of songs with optional filtering by group, title, and pagination. "total" is the number of matching songs across all pages. Without a valid API key only public songs are listed.
 	// @Tags        songs
 	// @Produce     json
 	// @Param       group  query   string false "Filter by group name (partial match)"
 	// @Param       title  query   string false "Filter by song title (partial match)"
-	// @Param       limit  query   int    false "Max records to return (default 10)"
+	// @Param       match  query   string false "Match mode for group/title: substring (default) or exact. Empty values never filter."
+	// @Param       limit  query   int    false "Max records to return, 1 to the max page size (default 10)"
 	// @Param       offset query   int    false "Offset from first record (default 0)"
+	// @Param       fields query   string false "Set to \"id\" to return only the matching IDs"
+	// @Param       released_after  query string false "Only songs released on or after this date (RFC 3339)"
+	// @Param       released_before query string false "Only songs released on or before this date (RFC 3339)"
+	// @Param       sort_by  query string false "Sort column: id (default), title, group_name or release_date"
+	// @Param       sort_dir query string false "Sort direction: desc (default) or asc"
+	// @Param       q        query string false "Full-text search over group, title and lyrics (English stemming); ranked by relevance unless sort_by is set"
+	// @Param       after_id query int    false "Keyset cursor: the next_cursor of the previous page. Stable while songs are added or removed, but only valid with the default sort and no offset."
+	// @Param       include_filters query bool false "Echo the applied filters and page, with defaults filled in, as appliedFilters"
+	// @Param       shape    query string false "Response shape: array (default) or map, with songs keyed by ID and their page order in order"
 	// @Success     200 {object} endpoints.ListSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
 	// @Failure     500 {object} errorResponse
 	// @Router      /songs [get]
 	r.Handle("/songs",
 		kithttp.NewServer(
 			eps.ListSongsEndpoint,
-			decodeListSongsRequest,
+			allowQueryParams(cfg.strictQuery, decodeListSongsRequest, "group", "title", "match", "limit", "offset", "fields", "released_after", "released_before", "sort_by", "sort_dir", "after_id", "q", "shape", "include_filters"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Most recently added songs
+	// --------------------------------------------------------------------------------
+	// RecentSongs godoc
+	// @Summary     Recently added songs
+	// @Description Returns the most recently created songs, newest first (by creation time, not release date). Without a valid API key only public songs are listed.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       limit query int false "Number of songs, 1 to the max page size (default 10)"
+	// @Success     200 {object} endpoints.ListSongsResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/recent [get]
+	r.Handle("/songs/recent",
+		kithttp.NewServer(
+			eps.RecentSongsEndpoint,
+			decodeRecentSongsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Distinct release years
+	// --------------------------------------------------------------------------------
+	// ReleaseYears godoc
+	// @Summary     Release years
+	// @Description Returns the distinct years songs were released in, ascending, e.g. to populate a year filter. Songs without a known release date are not counted. Without a valid API key only public songs are counted.
+	// @Tags        songs
+	// @Produce     json
+	// @Success     200 {object} endpoints.ReleaseYearsResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/years [get]
+	r.Handle("/songs/years",
+		kithttp.NewServer(
+			eps.ReleaseYearsEndpoint,
+			decodeReleaseYearsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Search within lyrics
+	// --------------------------------------------------------------------------------
+	// SearchLyrics godoc
+	// @Summary     Search lyrics
+	// @Description Returns songs whose lyrics contain every word of q (English stemming, so "loving" also finds "love"). Results are ordered by relevance (default), by release date (newest first, unknown dates last) or by group name.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       q      query string true  "Words to search for"
+	// @Param       order  query string false "Result order: relevance (default), release_date or group"
+	// @Param       limit  query int    false "Max records to return, 1 to the max page size (default 20)"
+	// @Param       offset query int    false "Offset from first record (default 0)"
+	// @Success     200 {object} endpoints.ListSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/search [get]
+	r.Handle("/songs/search",
+		kithttp.NewServer(
+			eps.SearchLyricsEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeSearchLyricsRequest, "q", "order", "limit", "offset"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Alphabetical index
+	// --------------------------------------------------------------------------------
+	// SongIndex godoc
+	// @Summary     Songs by first letter
+	// @Description Returns songs whose title starts with the given letter (case-insensitive), ordered by title. Titles starting with a digit or symbol are listed under "#" (send it URL-encoded as %23).
+	// @Tags        songs
+	// @Produce     json
+	// @Param       letter query string true  "A single letter, or # for everything else"
+	// @Param       limit  query int    false "Max records to return, 1 to the max page size (default 20)"
+	// @Param       offset query int    false "Offset from first record (default 0)"
+	// @Success     200 {object} endpoints.ListSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/index [get]
+	r.Handle("/songs/index",
+		kithttp.NewServer(
+			eps.SongIndexEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeSongIndexRequest, "letter", "limit", "offset"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// IndexLetters godoc
+	// @Summary     Index letters
+	// @Description Returns the first letters that have songs, in order, with "#" (titles not starting with a letter) last.
+	// @Tags        songs
+	// @Produce     json
+	// @Success     200 {object} endpoints.IndexLettersResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/index/letters [get]
+	r.Handle("/songs/index/letters",
+		kithttp.NewServer(
+			eps.IndexLettersEndpoint,
+			decodeIndexLettersRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Export songs as CSV
+	// --------------------------------------------------------------------------------
+	// ExportSongs godoc
+	// @Summary     Export songs as CSV
+	// @Description Streams every song matching the filters, in ID order, as a CSV download (songs.csv) with columns id, group, title, release_date, link and text. The export is capped at EXPORT_MAX_ROWS songs. The file can be imported back with POST /songs/import.
+	// @Tags        songs
+	// @Produce     text/csv
+	// @Param       group           query string false "Filter by group name"
+	// @Param       title           query string false "Filter by song title"
+	// @Param       match           query string false "substring (default) or exact"
+	// @Param       released_after  query string false "Only songs released on or after this date (RFC 3339)"
+	// @Param       released_before query string false "Only songs released on or before this date (RFC 3339)"
+	// @Success     200 {string} string
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/export [get]
+	r.Handle("/songs/export",
+		kithttp.NewServer(
+			eps.ExportSongsEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeExportSongsRequest, "group", "title", "match", "released_after", "released_before"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Create several songs at once
+	// --------------------------------------------------------------------------------
+	// CreateSongs godoc
+	// @Summary     Create songs in bulk
+	// @Description Takes an array of songs shaped like the POST /songs body and creates each one. Every song is enriched within its own time limit; a song whose enrichment fails or times out is still stored with the fields provided and reported as "enrichment_failed". Results are parallel to the input, each with status "created", "enrichment_failed" or "failed". The whole batch is refused with 422 when any song is invalid; the details of the error are keyed by the index of their song and the field, as in "[2].group".
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       input body []endpoints.CreateSongRequest true "New songs"
+	// @Success     200 {object} endpoints.CreateSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/batch [post]
+	r.Handle("/songs/batch",
+		kithttp.NewServer(
+			eps.CreateSongsEndpoint,
+			decodeCreateSongsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Check which songs already exist
+	// --------------------------------------------------------------------------------
+	// SongsExist godoc
+	// @Summary     Check songs exist
+	// @Description Takes an array of group/song pairs and returns a parallel array telling, for each pair, whether a song with exactly that group and title exists and its ID. Without a valid API key private songs are reported as not existing.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       input body []endpoints.SongKey true "Group/song pairs"
+	// @Success     200 {object} endpoints.SongsExistResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/exists [post]
+	r.Handle("/songs/exists",
+		kithttp.NewServer(
+			eps.SongsExistEndpoint,
+			decodeSongsExistRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Find a single song by group and title
+	// --------------------------------------------------------------------------------
+	// FindSong godoc
+	// @Summary     Find song by group and title
+	// @Description Returns the song whose group and title exactly match the query. If several songs match, the first one created is returned. Without a valid API key a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       group query string true "Group name (exact match)"
+	// @Param       song  query string true "Song title (exact match)"
+	// @Success     200 {object} endpoints.GetSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/find [get]
+	r.Handle("/songs/find",
+		kithttp.NewServer(
+			eps.FindSongEndpoint,
+			decodeFindSongRequest,
 			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("GET")
 
@@ -66,12 +401,14 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 	// --------------------------------------------------------------------------------
 	// GetSong godoc
 	// @Summary     Get song by ID
-	// @Description Returns a single song's data by its ID.
+	// @Description Returns a single song's data by its ID. Without a valid API key a private song is answered with 404.
 	// @Tags        songs
 	// @Produce     json
 	// @Param       id   path int true "Song ID"
 	// @Success     200 {object} endpoints.GetSongResponse
 	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     410 {object} errorResponse "The song has been deleted"
 	// @Failure     500 {object} errorResponse
 	// @Router      /songs/{id} [get]
 	r.Handle("/songs/{id}",
@@ -79,6 +416,7 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 			eps.GetSongEndpoint,
 			decodeGetSongRequest,
 			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("GET")
 
@@ -86,8 +424,8 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 	// Update an existing song by ID
 	// --------------------------------------------------------------------------------
 	// UpdateSong godoc
-	// @Summary     Update an existing song
-	// @Description Updates a song's fields by ID (e.g. title, group, release date, link, text).
+	// @Summary     Replace an existing song
+	// @Description Replaces all fields of a song by ID. Every field must be present; an empty release date, link or text clears it. Use PATCH to change only some fields.
 	// @Tags        songs
 	// @Accept      json
 	// @Produce     json
@@ -95,6 +433,9 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 	// @Param       input body   endpoints.UpdateSongRequest true "Song Data"
 	// @Success     200 {object} endpoints.UpdateSongResponse
 	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     409 {object} errorResponse
 	// @Failure     500 {object} errorResponse
 	// @Router      /songs/{id} [put]
 	r.Handle("/songs/{id}",
@@ -102,95 +443,860 @@ func NewHTTPHandler(eps endpoints.SongEndpoints) http.Handler {
 			eps.UpdateSongEndpoint,
 			decodeUpdateSongRequest,
 			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("PUT")
 
+	// --------------------------------------------------------------------------------
+	// Partially update an existing song by ID
+	// --------------------------------------------------------------------------------
+	// PatchSong godoc
+	// @Summary     Partially update a song
+	// @Description Updates only the fields present in the body; absent fields are left unchanged. At least one field is required.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       id    path   int  true "Song ID"
+	// @Param       input body   endpoints.PatchSongRequest true "Fields to change"
+	// @Success     200 {object} endpoints.UpdateSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     409 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id} [patch]
+	r.Handle("/songs/{id}",
+		kithttp.NewServer(
+			eps.PatchSongEndpoint,
+			decodePatchSongRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("PATCH")
+
 	// --------------------------------------------------------------------------------
 	// Delete a song by ID
 	// --------------------------------------------------------------------------------
 	// DeleteSong godoc
 	// @Summary     Delete a song
-	// @Description Removes a song from the database by ID.
+	// @Description Soft-deletes a song by ID: it disappears from every endpoint (410 Gone by ID) until restored with POST /songs/{id}/restore. With hard=true (API key required) the song, deleted or not, is removed for good.
 	// @Tags        songs
 	// @Produce     json
 	// @Param       id   path  int  true "Song ID"
+	// @Param       hard query bool false "Remove the song permanently"
 	// @Success     204 "No Content"
 	// @Failure     400 {object} errorResponse
+	// @Failure     401 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     410 {object} errorResponse
 	// @Failure     500 {object} errorResponse
 	// @Router      /songs/{id} [delete]
 	r.Handle("/songs/{id}",
 		kithttp.NewServer(
 			eps.DeleteSongEndpoint,
-			decodeDeleteSongRequest,
+			allowQueryParams(cfg.strictQuery, decodeDeleteSongRequest, "hard"),
 			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("DELETE")
 
+	// --------------------------------------------------------------------------------
+	// Restore a deleted song
+	// --------------------------------------------------------------------------------
+	// RestoreSong godoc
+	// @Summary     Restore a deleted song
+	// @Description Undoes the soft deletion of a song and returns it.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id path int true "Song ID"
+	// @Success     200 {object} endpoints.GetSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse "The song does not exist or is not deleted"
+	// @Failure     409 {object} errorResponse "Another song has taken its group and title"
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/restore [post]
+	r.Handle("/songs/{id}/restore",
+		kithttp.NewServer(
+			eps.RestoreSongEndpoint,
+			decodeRestoreSongRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Make a song public or private
+	// --------------------------------------------------------------------------------
+	// SetVisibility godoc
+	// @Summary     Set song visibility
+	// @Description Makes a song public or private. Requires a valid API key.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       id    path int true "Song ID"
+	// @Param       input body endpoints.SetVisibilityRequest true "Visibility"
+	// @Success     200 {object} endpoints.UpdateSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     401 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/visibility [put]
+	r.Handle("/songs/{id}/visibility",
+		kithttp.NewServer(
+			eps.SetVisibilityEndpoint,
+			decodeSetVisibilityRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("PUT")
+
+	// --------------------------------------------------------------------------------
+	// Merge a duplicate song into another
+	// --------------------------------------------------------------------------------
+	// MergeSongs godoc
+	// @Summary     Merge duplicate songs
+	// @Description Merges song {id} into the song "into" and deletes {id}, in one transaction. Each of release date, link, lyrics and visibility takes the preferred song's value ("prefer": "target", the default, or "source") unless it is empty. Returns the merged song.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       id    path int true "ID of the duplicate to merge and delete"
+	// @Param       input body endpoints.MergeSongsRequest true "Target song and field preference"
+	// @Success     200 {object} endpoints.GetSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/merge [post]
+	r.Handle("/songs/{id}/merge",
+		kithttp.NewServer(
+			eps.MergeSongsEndpoint,
+			decodeMergeSongsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Re-enrich a single song
+	// --------------------------------------------------------------------------------
+	// EnrichSong godoc
+	// @Summary     Re-enrich a song
+	// @Description Fetches the song's metadata from the external API again and stores every non-empty field it returns, e.g. for a song created while the API was unavailable ("enriched": false). Returns the updated song.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id path int true "Song ID"
+	// @Success     200 {object} endpoints.GetSongResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Failure     502 {object} errorResponse
+	// @Failure     503 {object} errorResponse
+	// @Router      /songs/{id}/enrich [post]
+	r.Handle("/songs/{id}/enrich",
+		kithttp.NewServer(
+			eps.EnrichSongEndpoint,
+			decodeEnrichSongRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Songs released on the same day
+	// --------------------------------------------------------------------------------
+	// SameReleaseDate godoc
+	// @Summary     Songs with the same release date
+	// @Description Returns the other songs released on the same day as the given song, ordered by ID. A song without a known release date has no matches. Without a valid API key only public songs are listed, and a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id     path  int true  "Song ID"
+	// @Param       limit  query int false "Max songs to return, 1 to the max page size (default 20)"
+	// @Param       offset query int false "Offset from first song (default 0)"
+	// @Success     200 {object} endpoints.ListSongsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/same-release-date [get]
+	r.Handle("/songs/{id}/same-release-date",
+		kithttp.NewServer(
+			eps.SameReleaseEndpoint,
+			decodeSameReleaseRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Song history
+	// --------------------------------------------------------------------------------
+	// SongHistory godoc
+	// @Summary     Song history
+	// @Description Returns the recorded creates, updates and deletes of the song, oldest first, each with a snapshot of the song right after it (for a delete, as it was deleted). A restore is recorded as an update. Deleted songs keep their history. Requires an API key.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id     path  int true  "Song ID"
+	// @Param       limit  query int false "Max entries to return, 1 to the max page size (default 20)"
+	// @Param       offset query int false "Offset from first entry (default 0)"
+	// @Success     200 {object} endpoints.SongHistoryResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     401 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/history [get]
+	r.Handle("/songs/{id}/history",
+		kithttp.NewServer(
+			eps.SongHistoryEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeSongHistoryRequest, "limit", "offset"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
 	// --------------------------------------------------------------------------------
 	// Get song lyrics (verses) with pagination
 	// --------------------------------------------------------------------------------
 	// GetLyrics godoc
 	// @Summary     Get lyrics by verse
-	// @Description Returns paginated verses of the song text, by ID. For example, page=1&pageSize=1 returns the first verse.
+	// @Description Returns paginated verses of the song text, by ID. For example, page=1&pageSize=1 returns the first verse. Without a valid API key a private song is answered with 404.
 	// @Tags        songs
 	// @Produce     json
 	// @Param       id        path  int true "Song ID"
 	// @Param       page      query int false "Verse page (default 1)"
 	// @Param       pageSize  query int false "Verses per page (default 1)"
+	// @Param       format    query string false "json (default); detailed for verse objects with their number and line count, at most the max page size per page; or lrc for an LRC skeleton with one [mm:ss.xx] tag per line"
+	// @Param       duration  query int false "Song length in seconds (positive); spreads LRC timestamps evenly"
 	// @Success     200 {object} endpoints.GetLyricsResponse
+	// @Success     200 {object} endpoints.DetailedLyricsResponse
 	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     404 {object} errorResponse
 	// @Failure     500 {object} errorResponse
 	// @Router      /songs/{id}/lyrics [get]
 	r.Handle("/songs/{id}/lyrics",
 		kithttp.NewServer(
 			eps.GetLyricsEndpoint,
-			decodeGetLyricsRequest,
+			allowQueryParams(cfg.strictQuery, decodeGetLyricsRequest, "page", "pageSize", "format", "duration"),
 			encodeJSONResponse,
+			opts...,
 		),
 	).Methods("GET")
 
-	return r
-}
+	// --------------------------------------------------------------------------------
+	// Count song verses
+	// --------------------------------------------------------------------------------
+	// CountVerses godoc
+	// @Summary     Count verses
+	// @Description Returns the number of verses of the song's lyrics, without the text. Without a valid API key a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id path int true "Song ID"
+	// @Success     200 {object} endpoints.CountVersesResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/lyrics/count [get]
+	r.Handle("/songs/{id}/lyrics/count",
+		kithttp.NewServer(
+			eps.CountVersesEndpoint,
+			decodeCountVersesRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
 
-// --------------------------------------------------------------------------------
-// Decode functions
-// --------------------------------------------------------------------------------
+	// --------------------------------------------------------------------------------
+	// Most frequent lyrics words
+	// --------------------------------------------------------------------------------
+	// WordStats godoc
+	// @Summary     Lyrics word statistics
+	// @Description Returns the most frequent words of the song's lyrics, lowercased, with their counts: most frequent first, ties alphabetically. Without a valid API key a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id        path  int    true  "Song ID"
+	// @Param       top       query int    false "Number of words, 1 to the max page size (default 20)"
+	// @Param       stopwords query string false "en to skip common English words"
+	// @Success     200 {object} endpoints.WordStatsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/lyrics/wordstats [get]
+	r.Handle("/songs/{id}/lyrics/wordstats",
+		kithttp.NewServer(
+			eps.WordStatsEndpoint,
+			allowQueryParams(cfg.strictQuery, decodeWordStatsRequest, "top", "stopwords"),
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
 
-func decodeCreateSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var req endpoints.CreateSongRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, err
-	}
-	return req, nil
-}
+	// --------------------------------------------------------------------------------
+	// Get a single verse by number
+	// --------------------------------------------------------------------------------
+	// GetVerse godoc
+	// @Summary     Get a verse
+	// @Description Returns verse {verse} (1-based) of the song's lyrics with the song's verse count. A verse number beyond the count is 404. Without a valid API key a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     json
+	// @Param       id    path int true "Song ID"
+	// @Param       verse path int true "Verse number, from 1"
+	// @Success     200 {object} endpoints.GetVerseResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/lyrics/{verse} [get]
+	r.Handle("/songs/{id}/lyrics/{verse:[0-9]+}",
+		kithttp.NewServer(
+			eps.GetVerseEndpoint,
+			decodeGetVerseRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Export a song as a plain-text lyric sheet
+	// --------------------------------------------------------------------------------
+	// ExportSong godoc
+	// @Summary     Export song as text
+	// @Description Downloads the song as a plain-text lyric sheet: "group — title", release date and link, then the lyrics. The file is named "<group> - <title>.txt" with unsafe characters replaced. Without a valid API key a private song is answered with 404.
+	// @Tags        songs
+	// @Produce     plain
+	// @Param       id path int true "Song ID"
+	// @Success     200 {string} string
+	// @Failure     400 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/export.txt [get]
+	r.Handle("/songs/{id}/export.txt",
+		kithttp.NewServer(
+			eps.ExportSongEndpoint,
+			decodeExportSongRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Reorder song verses
+	// --------------------------------------------------------------------------------
+	// ReorderLyrics godoc
+	// @Summary     Reorder verses
+	// @Description Rearranges the song's verses and stores the result. "order" lists the current 0-based verse indices in the desired new order and must include every verse exactly once.
+	// @Tags        songs
+	// @Accept      json
+	// @Produce     json
+	// @Param       id    path int true "Song ID"
+	// @Param       input body endpoints.ReorderLyricsRequest true "New verse order"
+	// @Success     200 {object} endpoints.ReorderLyricsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     404 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /songs/{id}/lyrics/reorder [put]
+	r.Handle("/songs/{id}/lyrics/reorder",
+		kithttp.NewServer(
+			eps.ReorderLyricsEndpoint,
+			decodeReorderLyricsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("PUT")
+
+	// --------------------------------------------------------------------------------
+	// Preview verse splitting
+	// --------------------------------------------------------------------------------
+	// PreviewSplit godoc
+	// @Summary     Preview verse splitting
+	// @Description Splits arbitrary text into verses the same way stored lyrics are split, without storing anything. "strategy" defaults to "blankline", the only supported strategy.
+	// @Tags        lyrics
+	// @Accept      json
+	// @Produce     json
+	// @Param       input body endpoints.PreviewSplitRequest true "Text to split"
+	// @Success     200 {object} endpoints.PreviewSplitResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Router      /lyrics/split [post]
+	r.Handle("/lyrics/split",
+		kithttp.NewServer(
+			eps.PreviewSplitEndpoint,
+			decodePreviewSplitRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// List groups with song counts
+	// --------------------------------------------------------------------------------
+	// ListGroups godoc
+	// @Summary     List groups
+	// @Description Returns a page of groups in alphabetical order with their song counts, plus the total number of groups matching the prefix. Without a valid API key only public songs are counted.
+	// @Tags        groups
+	// @Produce     json
+	// @Param       prefix query string false "Group name prefix (case-insensitive)"
+	// @Param       limit  query int    false "Max groups to return, 1 to the max page size (default 20)"
+	// @Param       offset query int    false "Offset from first group (default 0)"
+	// @Success     200 {object} endpoints.ListGroupsResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /groups [get]
+	r.Handle("/groups",
+		kithttp.NewServer(
+			eps.ListGroupsEndpoint,
+			decodeListGroupsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Suggest group names for auto-complete
+	// --------------------------------------------------------------------------------
+	// SuggestGroups godoc
+	// @Summary     Suggest groups
+	// @Description Returns group names starting with the given prefix (case-insensitive). With withCounts=true each group also carries its song count. Without a valid API key only public songs are counted.
+	// @Tags        groups
+	// @Produce     json
+	// @Param       prefix     query string false "Group name prefix"
+	// @Param       limit      query int    false "Max suggestions to return, 1 to 50 (default 10)"
+	// @Param       withCounts query bool   false "Include each group's song count"
+	// @Success     200 {object} endpoints.SuggestGroupsResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /groups/suggest [get]
+	r.Handle("/groups/suggest",
+		kithttp.NewServer(
+			eps.SuggestGroupsEndpoint,
+			decodeSuggestGroupsRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Re-enrich all incomplete songs of a group
+	// --------------------------------------------------------------------------------
+	// EnrichGroup godoc
+	// @Summary     Bulk-enrich a group
+	// @Description Re-fetches external metadata for every song of the group that is missing a link or lyrics. Returns the outcome per song.
+	// @Tags        groups
+	// @Produce     json
+	// @Param       name path string true "Group name (exact match)"
+	// @Success     200 {object} endpoints.EnrichGroupResponse
+	// @Failure     400 {object} errorResponse
+	// @Failure     422 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /groups/{name}/enrich [post]
+	r.Handle("/groups/{name}/enrich",
+		kithttp.NewServer(
+			eps.EnrichGroupEndpoint,
+			decodeEnrichGroupRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Liveness and readiness probes
+	// --------------------------------------------------------------------------------
+	// Health godoc
+	// @Summary     Liveness probe
+	// @Description Always returns 200 while the process is serving requests.
+	// @Tags        health
+	// @Produce     json
+	// @Success     200 {object} healthResponse
+	// @Router      /health [get]
+	r.HandleFunc("/health", healthHandler).Methods("GET")
+
+	// Ready godoc
+	// @Summary     Readiness probe
+	// @Description Returns 200 when the database answers a ping within a second, 503 otherwise.
+	// @Tags        health
+	// @Produce     json
+	// @Success     200 {object} healthResponse
+	// @Failure     503 {object} healthResponse
+	// @Router      /ready [get]
+	r.HandleFunc("/ready", readyHandler(deps.DB)).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Database migration status
+	// --------------------------------------------------------------------------------
+	// DBStatus godoc
+	// @Summary     Database migration status
+	// @Description Returns the goose migration version the database is at and the versions not applied yet. Requires an API key.
+	// @Tags        admin
+	// @Produce     json
+	// @Success     200 {object} dbStatusResponse
+	// @Failure     401 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /admin/db-status [get]
+	r.HandleFunc("/admin/db-status", dbStatusHandler(deps.Migrations)).Methods("GET")
+
+	// --------------------------------------------------------------------------------
+	// Re-apply normalization to stored songs
+	// --------------------------------------------------------------------------------
+	// Reprocess godoc
+	// @Summary     Re-normalize all songs
+	// @Description Re-applies the current normalization rules (trimmed names and links, title case when enabled, canonical lyrics when enabled) to every stored song, for after the rules change. Songs are streamed and rewritten in batches; songs whose cleaned form is invalid or collides with another song are left unchanged and counted as rejected. Requires an API key.
+	// @Tags        admin
+	// @Produce     json
+	// @Success     200 {object} endpoints.ReprocessResponse
+	// @Failure     401 {object} errorResponse
+	// @Failure     500 {object} errorResponse
+	// @Router      /admin/reprocess [post]
+	r.Handle("/admin/reprocess",
+		kithttp.NewServer(
+			eps.ReprocessEndpoint,
+			decodeReprocessRequest,
+			encodeJSONResponse,
+			opts...,
+		),
+	).Methods("POST")
+
+	// --------------------------------------------------------------------------------
+	// Prometheus metrics
+	// --------------------------------------------------------------------------------
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	var h http.Handler = timeZone(r)
+	if cfg.maxBody > 0 {
+		h = limitBody(cfg.maxBody, h)
+	}
+	if len(cfg.corsOrigins) > 0 {
+		h = cors(cfg.corsOrigins, h)
+	}
+	for i := len(cfg.middleware) - 1; i >= 0; i-- {
+		h = cfg.middleware[i](h)
+	}
+
+	log := deps.Logger
+	if log == nil {
+		log = logger.NewStdLogger(logger.LevelDebug)
+	}
+	return withLogger(log, h)
+}
+
+// --------------------------------------------------------------------------------
+// Decode functions
+// --------------------------------------------------------------------------------
+
+// allowQueryParams wraps dec so that, in strict mode, requests carrying query
+// parameters outside the allowlist are rejected with a validation error.
+func allowQueryParams(strict bool, dec kithttp.DecodeRequestFunc, allowed ...string) kithttp.DecodeRequestFunc {
+	if !strict {
+		return dec
+	}
+	known := map[string]bool{tzParam: true}
+	for _, name := range allowed {
+		known[name] = true
+	}
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		var unknown []string
+		for name := range r.URL.Query() {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, fmt.Errorf("%w: unknown query parameters: %s", errMalformedRequest, strings.Join(unknown, ", "))
+		}
+		return dec(ctx, r)
+	}
+}
+
+// maxJSONDepth is the deepest nesting of arrays and objects accepted in a
+// JSON request body.
+const maxJSONDepth = 32
+
+// decodeJSONBody decodes the request body into v after a streaming pass over
+// its tokens that rejects bodies nested deeper than maxJSONDepth. The size of
+// the body is capped by WithMaxBodyBytes, whose limitBody wraps r.Body in an
+// http.MaxBytesReader. The tokens are read straight from that reader, so a
+// pathological payload is refused as soon as it crosses either limit; only
+// what has been read so far is kept for the final decode.
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	var body bytes.Buffer
+	dec := json.NewDecoder(io.TeeReader(r.Body, &body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w: request body exceeds %d bytes", errBodyTooLarge, tooLarge.Limit)
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			if depth++; depth > maxJSONDepth {
+				return fmt.Errorf("JSON nested deeper than %d levels", maxJSONDepth)
+			}
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+
+	return json.Unmarshal(body.Bytes(), v)
+}
+
+func decodeCreateSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.CreateSongRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		return nil, malformed(err)
+	}
+	req.IdempotencyKey = strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+	req.OnConflict = r.URL.Query().Get("onConflict")
+	req.PublicOnly = !middleware.IsAuthenticated(r.Context())
+	return req, nil
+}
+
+func decodeUpsertSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.UpsertSongRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		return nil, malformed(err)
+	}
+	return req, nil
+}
+
+func decodeImportSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		part, err := uploadedFile(r)
+		if err != nil {
+			return nil, err
+		}
+		return endpoints.ImportSongsRequest{Format: "csv", Body: part}, nil
+	}
+	return endpoints.ImportSongsRequest{
+		Format: r.URL.Query().Get("format"),
+		Body:   r.Body,
+	}, nil
+}
+
+func decodeApplyMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var body io.Reader = r.Body
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		part, err := uploadedFile(r)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = part, part.Header.Get("Content-Type")
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(contentType); mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/json":
+			format = "json"
+		}
+	}
+	return endpoints.ApplyMetadataRequest{Format: format, Body: body}, nil
+}
+
+// uploadedFile streams the "file" part of a multipart upload without
+// buffering the form.
+func uploadedFile(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, malformed(errors.New("multipart upload has no \"file\" field"))
+		}
+		if err != nil {
+			return nil, malformed(err)
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
 
 func decodeListSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	vals := r.URL.Query()
 	group := vals.Get("group")
 	title := vals.Get("title")
-	limit, _ := strconv.Atoi(vals.Get("limit"))
-	offset, _ := strconv.Atoi(vals.Get("offset"))
+	limit, offset, err := parsePage(vals)
+	if err != nil {
+		return nil, err
+	}
+	var afterID int64
+	if v := vals.Get("after_id"); v != "" {
+		if afterID, err = strconv.ParseInt(v, 10, 64); err != nil || afterID < 1 {
+			return nil, malformed(fmt.Errorf("invalid after_id %q", v))
+		}
+	}
+	var includeFilters bool
+	if v := vals.Get("include_filters"); v != "" {
+		if includeFilters, err = strconv.ParseBool(v); err != nil {
+			return nil, malformed(fmt.Errorf("invalid include_filters %q", v))
+		}
+	}
 
 	req := endpoints.ListSongsRequest{
-		GroupName: group,
-		Title:     title,
-		Limit:     limit,
-		Offset:    offset,
+		GroupName:      group,
+		Title:          title,
+		Match:          vals.Get("match"),
+		Limit:          limit,
+		Offset:         offset,
+		Fields:         vals.Get("fields"),
+		PublicOnly:     !middleware.IsAuthenticated(r.Context()),
+		ReleasedAfter:  vals.Get("released_after"),
+		ReleasedBefore: vals.Get("released_before"),
+		SortBy:         vals.Get("sort_by"),
+		SortDir:        vals.Get("sort_dir"),
+		AfterID:        afterID,
+		Query:          strings.TrimSpace(vals.Get("q")),
+		Shape:          vals.Get("shape"),
+		IncludeFilters: includeFilters,
 	}
 	return req, nil
 }
 
+// parsePage reads the limit and offset of a paged route. Absent values are 0,
+// which the service turns into its defaults; a limit that is not a positive
+// integer or an offset that is not a non-negative integer is rejected with
+// 422. The upper bound on limit is checked by the service.
+func parsePage(vals url.Values) (int, int, error) {
+	limit, err := parsePositive(vals, "limit")
+	if err != nil {
+		return 0, 0, err
+	}
+	var offset int
+	if v := vals.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a non-negative integer, got %q", models.ErrPageOutOfRange, v)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// parsePositive reads the optional positive integer query parameter key, as
+// a limit or a page size. An absent value is 0; anything else is wrapped in
+// models.ErrPageOutOfRange.
+func parsePositive(vals url.Values, key string) (int, error) {
+	v := vals.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer, got %q", models.ErrPageOutOfRange, key, v)
+	}
+	return n, nil
+}
+
+func decodeExportSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vals := r.URL.Query()
+	return endpoints.ExportSongsRequest{
+		GroupName:      vals.Get("group"),
+		Title:          vals.Get("title"),
+		Match:          vals.Get("match"),
+		PublicOnly:     !middleware.IsAuthenticated(r.Context()),
+		ReleasedAfter:  vals.Get("released_after"),
+		ReleasedBefore: vals.Get("released_before"),
+	}, nil
+}
+
 func decodeGetSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	vars := mux.Vars(r)
 	idStr, ok := vars["id"]
 	if !ok {
-		return nil, errBadRoute // define an error
+		return nil, errBadRoute
 	}
 	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return endpoints.GetSongRequest{ID: id, PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeCreateSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.CreateSongsRequest
+	if err := decodeJSONBody(r, &req.Songs); err != nil {
+		return nil, malformed(err)
+	}
+	return req, nil
+}
+
+func decodeSongsExistRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.SongsExistRequest
+	if err := decodeJSONBody(r, &req.Songs); err != nil {
+		return nil, malformed(err)
+	}
+	req.PublicOnly = !middleware.IsAuthenticated(r.Context())
+	return req, nil
+}
+
+func decodeRecentSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	limit, err := parsePositive(r.URL.Query(), "limit")
 	if err != nil {
 		return nil, err
 	}
-	return endpoints.GetSongRequest{ID: id}, nil
+	return endpoints.RecentSongsRequest{Limit: limit, PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeSearchLyricsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vals := r.URL.Query()
+	limit, offset, err := parsePage(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.SearchLyricsRequest{
+		Query:      vals.Get("q"),
+		Order:      vals.Get("order"),
+		Limit:      limit,
+		Offset:     offset,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
+}
+
+func decodeSongIndexRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vals := r.URL.Query()
+	limit, offset, err := parsePage(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.SongIndexRequest{
+		Letter:     vals.Get("letter"),
+		Limit:      limit,
+		Offset:     offset,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
+}
+
+func decodeReleaseYearsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return endpoints.ReleaseYearsRequest{PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeIndexLettersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return endpoints.IndexLettersRequest{PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeFindSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vals := r.URL.Query()
+	return endpoints.FindSongRequest{
+		GroupName:  vals.Get("group"),
+		Title:      vals.Get("song"),
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
 }
 
 func decodeUpdateSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -201,12 +1307,95 @@ func decodeUpdateSongRequest(_ context.Context, r *http.Request) (interface{}, e
 	}
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, malformed(err)
 	}
 
-	var body endpoints.UpdateSongRequest
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		return nil, err
+	// PUT replaces the whole song, so every field must be present.
+	var body endpoints.PatchSongRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		return nil, malformed(err)
+	}
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"group", body.GroupName},
+		{"song", body.Title},
+		{"releaseDate", body.ReleaseDate},
+		{"link", body.Link},
+		{"text", body.Text},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			return nil, malformed(fmt.Errorf("missing required field %q", f.name))
+		}
+	}
+
+	return endpoints.UpdateSongRequest{
+		ID:          id,
+		GroupName:   *body.GroupName,
+		Title:       *body.Title,
+		ReleaseDate: *body.ReleaseDate,
+		Link:        *body.Link,
+		Text:        *body.Text,
+	}, nil
+}
+
+func decodePatchSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	var body endpoints.PatchSongRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		return nil, malformed(err)
+	}
+	body.ID = id
+	return body, nil
+}
+
+func decodeSetVisibilityRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if !middleware.IsAuthenticated(r.Context()) {
+		return nil, models.ErrUnauthorized
+	}
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	var body endpoints.SetVisibilityRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		return nil, malformed(err)
+	}
+	body.ID = id
+	return body, nil
+}
+
+func decodeMergeSongsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	var body endpoints.MergeSongsRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		return nil, malformed(err)
 	}
 	body.ID = id
 	return body, nil
@@ -219,55 +1408,446 @@ func decodeDeleteSongRequest(_ context.Context, r *http.Request) (interface{}, e
 		return nil, errBadRoute
 	}
 	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	req := endpoints.DeleteSongRequest{ID: id}
+	if v := r.URL.Query().Get("hard"); v != "" {
+		if req.Hard, err = strconv.ParseBool(v); err != nil {
+			return nil, malformed(fmt.Errorf("invalid hard %q", v))
+		}
+	}
+	if req.Hard && !middleware.IsAuthenticated(r.Context()) {
+		return nil, models.ErrUnauthorized
+	}
+	return req, nil
+}
+
+func decodeRestoreSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return endpoints.RestoreSongRequest{ID: id}, nil
+}
+
+func decodeEnrichSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return endpoints.EnrichSongRequest{ID: id}, nil
+}
+
+func decodeSameReleaseRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePage(q)
 	if err != nil {
 		return nil, err
 	}
-	return endpoints.DeleteSongRequest{ID: id}, nil
+
+	return endpoints.SameReleaseRequest{
+		ID:         id,
+		Limit:      limit,
+		Offset:     offset,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
 }
 
-func decodeGetLyricsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeSongHistoryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if !middleware.IsAuthenticated(r.Context()) {
+		return nil, models.ErrUnauthorized
+	}
 	vars := mux.Vars(r)
 	idStr, ok := vars["id"]
 	if !ok {
 		return nil, errBadRoute
 	}
 	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePage(q)
 	if err != nil {
 		return nil, err
 	}
 
+	return endpoints.SongHistoryRequest{ID: id, Limit: limit, Offset: offset}, nil
+}
+
+func decodeGetLyricsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
 	q := r.URL.Query()
-	page, _ := strconv.Atoi(q.Get("page"))
-	if page < 1 {
+	page, err := parsePositive(q, "page")
+	if err != nil {
+		return nil, err
+	}
+	if page == 0 {
 		page = 1
 	}
-	pageSize, _ := strconv.Atoi(q.Get("pageSize"))
-	if pageSize < 1 {
+	pageSize, err := parsePositive(q, "pageSize")
+	if err != nil {
+		return nil, err
+	}
+	if pageSize == 0 {
 		pageSize = 1
 	}
 
+	duration, err := parsePositive(q, "duration")
+	if err != nil {
+		return nil, err
+	}
+
 	return endpoints.GetLyricsRequest{
-		ID:       id,
-		Page:     page,
-		PageSize: pageSize,
+		ID:         id,
+		Page:       page,
+		PageSize:   pageSize,
+		Format:     q.Get("format"),
+		Duration:   time.Duration(duration) * time.Second,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
 	}, nil
 }
 
+func decodeGetVerseRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	verse, err := strconv.Atoi(vars["verse"])
+	if err != nil || verse < 1 {
+		return nil, malformed(fmt.Errorf("invalid verse number %q", vars["verse"]))
+	}
+	return endpoints.GetVerseRequest{ID: id, Verse: verse, PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeWordStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	q := r.URL.Query()
+	top, err := parsePositive(q, "top")
+	if err != nil {
+		return nil, err
+	}
+	return endpoints.WordStatsRequest{
+		ID:         id,
+		Top:        top,
+		Stopwords:  q.Get("stopwords"),
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
+}
+
+func decodeCountVersesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return endpoints.CountVersesRequest{ID: id, PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeExportSongRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return endpoints.ExportSongRequest{ID: id, PublicOnly: !middleware.IsAuthenticated(r.Context())}, nil
+}
+
+func decodeReorderLyricsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	var body endpoints.ReorderLyricsRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		return nil, malformed(err)
+	}
+	body.ID = id
+	return body, nil
+}
+
+func decodePreviewSplitRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.PreviewSplitRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		return nil, malformed(err)
+	}
+	return req, nil
+}
+
+func decodeListGroupsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.ListGroupsRequest{
+		Prefix:     q.Get("prefix"),
+		Limit:      limit,
+		Offset:     offset,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
+}
+
+func decodeSuggestGroupsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	limit, err := parsePositive(q, "limit")
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and 50", models.ErrPageOutOfRange)
+	}
+	var withCounts bool
+	if v := q.Get("withCounts"); v != "" {
+		if withCounts, err = strconv.ParseBool(v); err != nil {
+			return nil, malformed(fmt.Errorf("invalid withCounts %q", v))
+		}
+	}
+
+	return endpoints.SuggestGroupsRequest{
+		Prefix:     q.Get("prefix"),
+		Limit:      limit,
+		WithCounts: withCounts,
+		PublicOnly: !middleware.IsAuthenticated(r.Context()),
+	}, nil
+}
+
+func decodeEnrichGroupRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	name, ok := mux.Vars(r)["name"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	return endpoints.EnrichGroupRequest{GroupName: name}, nil
+}
+
+func decodeReprocessRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if !middleware.IsAuthenticated(r.Context()) {
+		return nil, models.ErrUnauthorized
+	}
+	return endpoints.ReprocessRequest{}, nil
+}
+
 // --------------------------------------------------------------------------------
 // Encode (response) functions
 // --------------------------------------------------------------------------------
 
-func encodeJSONResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+func encodeJSONResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if f, ok := response.(failureer); ok && f.Failed() != nil {
-		http.Error(w, f.Failed().Error(), http.StatusInternalServerError)
+		encodeErrorResponse(ctx, f.Failed(), w)
+		return nil
+	}
+	if h, ok := response.(kithttp.Headerer); ok {
+		for key, values := range h.Headers() {
+			for _, v := range values {
+				w.Header().Add(key, v)
+			}
+		}
+	}
+	status := http.StatusOK
+	if sc, ok := response.(kithttp.StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
 		return nil
 	}
+	if text, ok := response.(endpoints.TextResponse); ok {
+		w.Header().Set("Content-Type", text.ContentType)
+		if text.Filename != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": text.Filename}))
+		}
+		_, err := io.WriteString(w, text.Body)
+		return err
+	}
+	if stream, ok := response.(endpoints.StreamResponse); ok {
+		w.Header().Set("Content-Type", stream.ContentType)
+		if stream.Filename != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stream.Filename}))
+		}
+		w.WriteHeader(status)
+		if err := stream.Write(w); err != nil {
+			requestLogger(ctx).Error("streaming response aborted", "err", err)
+		}
+		return nil
+	}
+	if z, ok := response.(endpoints.Zoner); ok {
+		response = z.InZone(responseZone(ctx))
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
 	return json.NewEncoder(w).Encode(response)
 }
 
+// errorResponse is the JSON body written for every failed request. Code is a
+// stable, machine-readable identifier of the error class and Message a
+// human-readable description. Details lists the problem with each invalid
+// field of a request body, keyed by field name.
+type errorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// internalErrorMessage replaces the message of an internal (500) error, whose
+// text may reveal internals such as SQL or connection addresses. The other
+// 5xx errors describe the external API's state and keep their message.
+const internalErrorMessage = "internal error"
+
+// encodeErrorResponse writes err as an errorResponse with the matching HTTP
+// status. A server error is logged; a 500 is answered with
+// internalErrorMessage.
+func encodeErrorResponse(ctx context.Context, err error, w http.ResponseWriter) {
+	status, code := errorStatus(err)
+	resp := errorResponse{Code: code, Message: err.Error()}
+	if status >= http.StatusInternalServerError {
+		requestLogger(ctx).Error("request failed", "status", status, "err", err)
+	}
+	if status == http.StatusInternalServerError {
+		resp.Message = internalErrorMessage
+	}
+	var invalid *endpoints.ValidationError
+	if errors.As(err, &invalid) {
+		resp.Details = invalid.Fields
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// errorClasses maps domain errors to HTTP statuses and error codes, checked
+// in order. Malformed requests are 400, well-formed requests failing
+// validation are 422.
+var errorClasses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{errBodyTooLarge, http.StatusRequestEntityTooLarge, "body_too_large"},
+	{errMalformedRequest, http.StatusBadRequest, "malformed_request"},
+	{errBadRoute, http.StatusBadRequest, "malformed_request"},
+	{errRouteNotFound, http.StatusNotFound, "not_found"},
+	{errMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed"},
+	{models.ErrValidation, http.StatusUnprocessableEntity, "validation_failed"},
+	{models.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{models.ErrSongNotFound, http.StatusNotFound, "not_found"},
+	{models.ErrVerseNotFound, http.StatusNotFound, "not_found"},
+	{models.ErrDeleted, http.StatusGone, "deleted"},
+	{models.ErrDuplicateSong, http.StatusConflict, "conflict"},
+	{models.ErrRequestInProgress, http.StatusConflict, "conflict"},
+	{models.ErrCircuitOpen, http.StatusServiceUnavailable, "external_api_unavailable"},
+	{models.ErrExternalAPI, http.StatusBadGateway, "external_api_error"},
+}
+
+// errorStatus returns the HTTP status and error code for err; unknown errors
+// are 500 internal_error.
+func errorStatus(err error) (int, string) {
+	for _, c := range errorClasses {
+		if errors.Is(err, c.err) {
+			return c.status, c.code
+		}
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
+
+// errMalformedRequest marks requests that could not be decoded at all (bad
+// JSON, non-numeric ids, unknown query parameters), as opposed to well-formed
+// input rejected by business rules (models.ErrValidation).
+var errMalformedRequest = errors.New("malformed request")
+
+// errBodyTooLarge marks request bodies cut off by the WithMaxBodyBytes limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// errRouteNotFound and errMethodNotAllowed answer requests matching no route,
+// so that they get an errorResponse too rather than mux's plain text.
+var (
+	errRouteNotFound    = errors.New("no such route")
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// errorHandler answers every request with err.
+func errorHandler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodeErrorResponse(r.Context(), err, w)
+	})
+}
+
+// malformed wraps a decode error so that it maps to 400 Bad Request. Bodies
+// over the size limit keep their own 413.
+func malformed(err error) error {
+	if errors.Is(err, errBodyTooLarge) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errMalformedRequest, err)
+}
+
+// errBadRoute is returned by decoders when a path variable their route
+// declares is missing; it is answered with 400.
 var errBadRoute = &BadRouteError{"bad route"}
 
+// BadRouteError reports a request whose path lacks a variable the route
+// needs.
 type BadRouteError struct{ msg string }
 
 func (e *BadRouteError) Error() string { return e.msg }
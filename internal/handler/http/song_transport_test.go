@@ -0,0 +1,2250 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+// testAPIKey authenticates test requests sent with the authed header pair.
+const testAPIKey = "test-key"
+
+// authed is the header pair of an authenticated request.
+var authed = []string{middleware.APIKeyHeader, testAPIKey}
+
+// testServer serves NewHTTPHandler over an in-memory repository and a fake
+// external client, which tests use to arrange and inspect state.
+type testServer struct {
+	*httptest.Server
+	repo   models.SongRepository
+	client *testutil.FakeExternalClient
+}
+
+// serverConfig holds the options a test passes down to each layer.
+type serverConfig struct {
+	service  []service.Option
+	endpoint []endpoints.Option
+	handler  []HandlerOption
+	deps     ServerDependencies
+}
+
+type serverOption func(*serverConfig)
+
+func withServiceOptions(opts ...service.Option) serverOption {
+	return func(c *serverConfig) { c.service = append(c.service, opts...) }
+}
+
+func withEndpointOptions(opts ...endpoints.Option) serverOption {
+	return func(c *serverConfig) { c.endpoint = append(c.endpoint, opts...) }
+}
+
+func withHandlerOptions(opts ...HandlerOption) serverOption {
+	return func(c *serverConfig) { c.handler = append(c.handler, opts...) }
+}
+
+func withDependencies(deps ServerDependencies) serverOption {
+	return func(c *serverConfig) { c.deps = deps }
+}
+
+// newTestServer starts a server accepting testAPIKey, closed when the test
+// ends.
+func newTestServer(t *testing.T, opts ...serverOption) *testServer {
+	t.Helper()
+	cfg := serverConfig{
+		service: []service.Option{service.WithLogger(logger.NewStdLogger(logger.LevelError))},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	repo := memory.NewInMemorySongRepository()
+	client := testutil.NewFakeExternalClient()
+	svc := service.NewSongService(repo, client, cfg.service...)
+	eps := endpoints.MakeSongEndpoints(*svc, cfg.endpoint...)
+	handlerOpts := append([]HandlerOption{WithMiddleware(middleware.APIKey([]string{testAPIKey}))}, cfg.handler...)
+
+	srv := httptest.NewServer(NewHTTPHandler(eps, cfg.deps, handlerOpts...))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, repo: repo, client: client}
+}
+
+// testResponse is a response read in full.
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request to path and returns the response. A string or []byte
+// body is sent as is, any other non-nil body JSON-encoded; header lists
+// name-value pairs.
+func (s *testServer) do(t *testing.T, method, path string, body interface{}, header ...string) testResponse {
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("encode request body: %v", err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.URL+path, r)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response body: %v", err)
+	}
+	return testResponse{status: resp.StatusCode, header: resp.Header, body: data}
+}
+
+// decode checks the status and decodes the JSON body into v.
+func (r testResponse) decode(t *testing.T, status int, v interface{}) {
+	t.Helper()
+	if r.status != status {
+		t.Fatalf("status = %d, want %d; body: %s", r.status, status, r.body)
+	}
+	if err := json.Unmarshal(r.body, v); err != nil {
+		t.Fatalf("decode %s: %v", r.body, err)
+	}
+}
+
+// wantError checks the response is an errorResponse with status and code and
+// returns it.
+func (r testResponse) wantError(t *testing.T, status int, code string) errorResponse {
+	t.Helper()
+	var resp errorResponse
+	r.decode(t, status, &resp)
+	if resp.Code != code {
+		t.Fatalf("code = %q, want %q; body: %s", resp.Code, code, r.body)
+	}
+	if resp.Message == "" {
+		t.Fatalf("error without a message: %s", r.body)
+	}
+	return resp
+}
+
+// seed stores song directly in the repository and returns its ID.
+func (s *testServer) seed(t *testing.T, song models.Song) int64 {
+	t.Helper()
+	id, err := s.repo.Create(context.Background(), &song)
+	if err != nil {
+		t.Fatalf("seed %q: %v", song.Title, err)
+	}
+	return id
+}
+
+// stored returns the live song id from the repository, or nil.
+func (s *testServer) stored(t *testing.T, id int64) *models.Song {
+	t.Helper()
+	song, err := s.repo.GetByID(context.Background(), id)
+	if err != nil && !errors.Is(err, models.ErrDeleted) {
+		t.Fatalf("get song %d: %v", id, err)
+	}
+	return song
+}
+
+// count returns the number of live songs in the repository.
+func (s *testServer) count(t *testing.T) int64 {
+	t.Helper()
+	n, err := s.repo.Count(context.Background(), models.SongFilter{})
+	if err != nil {
+		t.Fatalf("count songs: %v", err)
+	}
+	return n
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// songJSON is the part of endpoints.SongView the tests look at.
+type songJSON struct {
+	ID          int64
+	GroupName   string
+	Title       string
+	ReleaseDate string
+	Link        string
+	Text        *string
+	IsPublic    bool
+	Enriched    bool `json:"enriched"`
+}
+
+type songResponse struct {
+	Song songJSON `json:"song"`
+}
+
+type songsResponse struct {
+	Songs []songJSON `json:"songs"`
+	Total *int64     `json:"total"`
+}
+
+func titles(songs []songJSON) string {
+	names := make([]string, len(songs))
+	for i, s := range songs {
+		names[i] = s.Title
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCreateSong(t *testing.T) {
+	s := newTestServer(t)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{
+		ReleaseDate: day(2009, time.July, 16),
+		Text:        "Paranoia is in bloom\n\nThey will not force us",
+		Link:        "https://example.com/uprising",
+	})
+
+	resp := s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"})
+	var created endpoints.CreateSongResponse
+	resp.decode(t, http.StatusCreated, &created)
+	if want := "/songs/1"; resp.header.Get("Location") != want {
+		t.Errorf("Location = %q, want %q", resp.header.Get("Location"), want)
+	}
+	song := s.stored(t, created.ID)
+	if song == nil {
+		t.Fatalf("song %d not stored", created.ID)
+	}
+	if !song.ReleaseDate.Equal(day(2009, time.July, 16)) || song.Link != "https://example.com/uprising" || song.EnrichedAt.IsZero() {
+		t.Errorf("stored song = %+v, want it enriched from the external API", song)
+	}
+
+	t.Run("external API failure", func(t *testing.T) {
+		resp := s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Unknown"})
+		resp.wantError(t, http.StatusBadGateway, "external_api_error")
+		if n := s.count(t); n != 1 {
+			t.Errorf("%d songs stored, want 1", n)
+		}
+	})
+
+	t.Run("circuit open", func(t *testing.T) {
+		s := newTestServer(t)
+		s.client.SetCircuitOpen()
+		resp := s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"}).
+			wantError(t, http.StatusServiceUnavailable, "external_api_unavailable")
+		if !strings.Contains(resp.Message, models.ErrCircuitOpen.Error()) {
+			t.Errorf("message = %q, want it to say %q", resp.Message, models.ErrCircuitOpen)
+		}
+		if n := s.count(t); n != 0 {
+			t.Errorf("%d songs stored, want 0", n)
+		}
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		resp := s.do(t, "POST", "/songs", map[string]string{"group": "", "song": "Uprising"})
+		e := resp.wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+		if e.Details["group"] == "" {
+			t.Errorf("details = %v, want a problem with group", e.Details)
+		}
+	})
+}
+
+func TestCreateSongRequireLyrics(t *testing.T) {
+	s := newTestServer(t, withServiceOptions(service.WithRequireLyrics(true)))
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+
+	s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"}).
+		wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	if n := s.count(t); n != 0 {
+		t.Errorf("%d songs stored, want 0", n)
+	}
+	var created endpoints.CreateSongResponse
+	s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising", "text": "Paranoia is in bloom"}).
+		decode(t, http.StatusCreated, &created)
+}
+
+func TestCreateSongWarnings(t *testing.T) {
+	s := newTestServer(t, withServiceOptions(service.WithAllowPartialEnrichment(true)))
+
+	var created endpoints.CreateSongResponse
+	s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Unknown"}).decode(t, http.StatusCreated, &created)
+	if len(created.Warnings) == 0 || !strings.Contains(strings.Join(created.Warnings, "; "), "release date unknown") {
+		t.Errorf("warnings = %q, want what enrichment left unknown", created.Warnings)
+	}
+	if s.stored(t, created.ID) == nil {
+		t.Errorf("song %d not stored", created.ID)
+	}
+
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{ReleaseDate: day(2009, time.July, 16), Text: "one", Link: "https://example.com"})
+	resp := s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"})
+	if resp.status != http.StatusCreated || strings.Contains(string(resp.body), "warnings") {
+		t.Errorf("complete enrichment: status = %d, body = %s; want no warnings", resp.status, resp.body)
+	}
+}
+
+func TestDegradedCreateThenEnrich(t *testing.T) {
+	s := newTestServer(t, withServiceOptions(service.WithAllowPartialEnrichment(true)))
+	s.client.SetError(fmt.Errorf("connection refused: %w", models.ErrExternalAPI))
+
+	var created endpoints.CreateSongResponse
+	s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"}).decode(t, http.StatusCreated, &created)
+	var got songResponse
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", created.ID), nil, authed...).decode(t, http.StatusOK, &got)
+	if got.Song.Enriched || got.Song.ReleaseDate != "" || got.Song.Link != "" {
+		t.Errorf("song = %+v, want it stored unenriched and empty", got.Song)
+	}
+
+	s.client.SetError(nil)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{ReleaseDate: day(2009, time.July, 16), Link: "https://example.com/uprising"})
+	s.do(t, "POST", fmt.Sprintf("/songs/%d/enrich", created.ID), nil).decode(t, http.StatusOK, &got)
+	if !got.Song.Enriched || got.Song.ReleaseDate != "2009-07-16" || got.Song.Link != "https://example.com/uprising" {
+		t.Errorf("enriched song = %+v", got.Song)
+	}
+	if song := s.stored(t, created.ID); song.EnrichedAt.IsZero() {
+		t.Error("enriched_at not stored")
+	}
+}
+
+func TestReleaseDateRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com"})
+	s.client.SetSong("Muse", "Starlight", service.SongInfo{ReleaseDate: day(2006, time.September, 4)})
+
+	tests := []struct {
+		song, releaseDate, want string
+	}{
+		{"Uprising", "16.07.2009", "2009-07-16"},
+		{"Starlight", "", "2006-09-04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.song, func(t *testing.T) {
+			var created endpoints.CreateSongResponse
+			body := map[string]string{"group": "Muse", "song": tt.song, "releaseDate": tt.releaseDate}
+			s.do(t, "POST", "/songs", body).decode(t, http.StatusCreated, &created)
+
+			var got songResponse
+			s.do(t, "GET", fmt.Sprintf("/songs/%d", created.ID), nil, authed...).decode(t, http.StatusOK, &got)
+			if got.Song.ReleaseDate != tt.want {
+				t.Errorf("releaseDate = %q, want %q", got.Song.ReleaseDate, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertSong(t *testing.T) {
+	s := newTestServer(t)
+	body := map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "2009-07-16", "link": "", "text": "v1"}
+
+	var created endpoints.UpsertSongResponse
+	resp := s.do(t, "PUT", "/songs", body)
+	resp.decode(t, http.StatusCreated, &created)
+	if !created.Created {
+		t.Errorf("created = false on the first upsert")
+	}
+	if want := fmt.Sprintf("/songs/%d", created.ID); resp.header.Get("Location") != want {
+		t.Errorf("Location = %q, want %q", resp.header.Get("Location"), want)
+	}
+
+	body["text"] = "v2"
+	var replaced endpoints.UpsertSongResponse
+	resp = s.do(t, "PUT", "/songs", body)
+	resp.decode(t, http.StatusOK, &replaced)
+	if replaced.Created || replaced.ID != created.ID {
+		t.Errorf("second upsert = %+v, want song %d replaced", replaced, created.ID)
+	}
+	if resp.header.Get("Location") != "" {
+		t.Errorf("Location set on a replace")
+	}
+	if song := s.stored(t, created.ID); song.Text != "v2" {
+		t.Errorf("stored text = %q, want v2", song.Text)
+	}
+	if s.client.Calls() != 0 {
+		t.Errorf("upsert called the external API")
+	}
+
+	t.Run("missing title", func(t *testing.T) {
+		resp := s.do(t, "PUT", "/songs", map[string]string{"group": "Muse"})
+		resp.wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestImportSongs(t *testing.T) {
+	s := newTestServer(t)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+	csv := "group,title,release_date\nMuse,Uprising,2009-07-16\nMuse,Resistance,\n,Nameless,\n"
+
+	var summary endpoints.ImportSongsResponse
+	s.do(t, "POST", "/songs/import?format=csv", csv).decode(t, http.StatusOK, &summary)
+	if summary.ImportedRows != 2 || summary.FailedRows != 1 {
+		t.Errorf("summary = %+v, want 2 imported and 1 failed", summary)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Line != 4 {
+		t.Errorf("errors = %+v, want line 4", summary.Errors)
+	}
+	if n := s.count(t); n != 2 {
+		t.Errorf("%d songs stored, want 2", n)
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		s.do(t, "POST", "/songs/import", csv).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	src := newTestServer(t)
+	src.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), Link: "https://example.com/uprising", Text: "Paranoia is in bloom,\n\nthe PR transmissions", IsPublic: true})
+	src.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+	export := src.do(t, "GET", "/songs/export", nil)
+
+	dst := newTestServer(t)
+	dst.client.SetError(fmt.Errorf("connection refused: %w", models.ErrExternalAPI))
+	var summary endpoints.ImportSongsResponse
+	dst.do(t, "POST", "/songs/import?format=csv", export.body).decode(t, http.StatusOK, &summary)
+	if summary.ImportedRows != 2 || summary.FailedRows != 0 {
+		t.Fatalf("summary = %+v, want both songs imported despite the external failure", summary)
+	}
+	song, err := dst.repo.GetByGroupAndTitle(context.Background(), "Muse", "Uprising")
+	if err != nil || song == nil || !song.ReleaseDate.Equal(day(2009, time.July, 16)) ||
+		song.Link != "https://example.com/uprising" || song.Text != "Paranoia is in bloom,\n\nthe PR transmissions" {
+		t.Errorf("imported song = %+v, %v; want the exported fields", song, err)
+	}
+
+	t.Run("again", func(t *testing.T) {
+		var summary endpoints.ImportSongsResponse
+		dst.do(t, "POST", "/songs/import?format=csv", export.body).decode(t, http.StatusOK, &summary)
+		if summary.ImportedRows != 0 || summary.SkippedRows != 2 || len(summary.Warnings) != 2 {
+			t.Errorf("summary = %+v, want both rows skipped with a warning", summary)
+		}
+		if n := dst.count(t); n != 2 {
+			t.Errorf("%d songs stored, want no duplicates", n)
+		}
+	})
+}
+
+func TestApplyMetadataFile(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	mapping := `[{"group":"Muse","song":"Uprising","link":"https://example.com/new"},{"group":"Muse","song":"Missing","link":"https://example.com/missing"}]`
+
+	var summary endpoints.ApplyMetadataResponse
+	s.do(t, "POST", "/songs/enrich-from-file", mapping, "Content-Type", "application/json").decode(t, http.StatusOK, &summary)
+	if summary.Matched != 1 || summary.Updated != 1 || len(summary.Unmatched) != 1 {
+		t.Errorf("summary = %+v, want 1 matched and updated, 1 unmatched", summary)
+	}
+	if song := s.stored(t, id); song.Link != "https://example.com/new" {
+		t.Errorf("stored link = %q", song.Link)
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		resp := s.do(t, "POST", "/songs/enrich-from-file", mapping, "Content-Type", "text/plain")
+		resp.wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestListSongs(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance"})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs?group=muse", nil, authed...).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Resistance,Uprising" {
+		t.Errorf("songs = %s, want Resistance,Uprising", got)
+	}
+	if list.Total == nil || *list.Total != 2 {
+		t.Errorf("total = %v, want 2", list.Total)
+	}
+
+	var public songsResponse
+	s.do(t, "GET", "/songs", nil).decode(t, http.StatusOK, &public)
+	if got := titles(public.Songs); got != "Bohemian Rhapsody,Uprising" {
+		t.Errorf("anonymous songs = %s, want the public ones", got)
+	}
+
+	t.Run("invalid page", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=-1", "limit=abc", "limit=201", "offset=-1", "offset=x", "limit=1e3"} {
+			s.do(t, "GET", "/songs?"+query, nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+		}
+		s.do(t, "GET", "/songs?limit=200", nil).decode(t, http.StatusOK, &songsResponse{})
+	})
+
+	t.Run("release range", func(t *testing.T) {
+		s.seed(t, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4), IsPublic: true})
+		var list songsResponse
+		s.do(t, "GET", "/songs?released_after=2006-01-01T00:00:00Z&released_before=2006-12-31", nil).decode(t, http.StatusOK, &list)
+		if got := titles(list.Songs); got != "Starlight" {
+			t.Errorf("songs = %s, want Starlight", got)
+		}
+		s.do(t, "GET", "/songs?released_after=2007-01-01&released_before=2006-01-01", nil).
+			wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestListSongsTextPreview(t *testing.T) {
+	s := newTestServer(t, withEndpointOptions(endpoints.WithTextPreviewLength(6)))
+	id := s.seed(t, models.Song{GroupName: "Кино", Title: "Группа крови", Text: "Тёплое место, но улицы ждут", IsPublic: true})
+
+	var list struct {
+		Songs []struct {
+			Text          string `json:"Text"`
+			TextTruncated bool   `json:"textTruncated"`
+		} `json:"songs"`
+	}
+	s.do(t, "GET", "/songs", nil).decode(t, http.StatusOK, &list)
+	if len(list.Songs) != 1 || list.Songs[0].Text != "Тёплое…" || !list.Songs[0].TextTruncated {
+		t.Errorf("songs = %+v, want the lyrics cut after 6 characters", list.Songs)
+	}
+
+	var single songResponse
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", id), nil).decode(t, http.StatusOK, &single)
+	if single.Song.Text == nil || *single.Song.Text != "Тёплое место, но улицы ждут" {
+		t.Errorf("single song text = %v, want the full lyrics", single.Song.Text)
+	}
+}
+
+func TestListSongsSort(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", ReleaseDate: day(1975, time.October, 31), IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), IsPublic: true})
+	s.seed(t, models.Song{GroupName: "ABBA", Title: "Waterloo", IsPublic: true})
+
+	tests := []struct {
+		query, want string
+	}{
+		{"", "Waterloo,Uprising,Bohemian Rhapsody"},
+		{"sort_by=id&sort_dir=asc", "Bohemian Rhapsody,Uprising,Waterloo"},
+		{"sort_by=title&sort_dir=asc", "Bohemian Rhapsody,Uprising,Waterloo"},
+		{"sort_by=title&sort_dir=desc", "Waterloo,Uprising,Bohemian Rhapsody"},
+		{"sort_by=group_name&sort_dir=asc", "Waterloo,Uprising,Bohemian Rhapsody"},
+		{"sort_by=group_name", "Bohemian Rhapsody,Uprising,Waterloo"},
+		{"sort_by=release_date&sort_dir=asc", "Bohemian Rhapsody,Uprising,Waterloo"},
+		{"sort_by=release_date&sort_dir=desc", "Uprising,Bohemian Rhapsody,Waterloo"},
+	}
+	for _, tt := range tests {
+		var list songsResponse
+		s.do(t, "GET", "/songs?"+tt.query, nil).decode(t, http.StatusOK, &list)
+		if got := titles(list.Songs); got != tt.want {
+			t.Errorf("%q: songs = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"sort_by=text", "sort_by=title&sort_dir=up"} {
+		s.do(t, "GET", "/songs?"+query, nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	}
+}
+
+func TestListSongsTotal(t *testing.T) {
+	s := newTestServer(t)
+	total := func() int64 {
+		t.Helper()
+		var list songsResponse
+		s.do(t, "GET", "/songs?group=muse&limit=1", nil, authed...).decode(t, http.StatusOK, &list)
+		if list.Total == nil {
+			t.Fatalf("no total in the response")
+		}
+		if int64(len(list.Songs)) > 1 {
+			t.Errorf("%d songs on a page of 1", len(list.Songs))
+		}
+		return *list.Total
+	}
+
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Innuendo"})
+	if n := total(); n != 1 {
+		t.Errorf("total = %d, want 1", n)
+	}
+
+	s.client.SetSong("Muse", "Starlight", service.SongInfo{Text: "x"})
+	s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Starlight"})
+	if n := total(); n != 2 {
+		t.Errorf("after creating Starlight: total = %d, want 2", n)
+	}
+
+	if resp := s.do(t, "DELETE", "/songs/1", nil); resp.status != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", resp.status)
+	}
+	if n := total(); n != 1 {
+		t.Errorf("after a delete: total = %d, want 1", n)
+	}
+}
+
+func TestRecentSongs(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "First", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Second", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Third", IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs/recent?limit=2", nil).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Third,Second" {
+		t.Errorf("songs = %s, want Third,Second", got)
+	}
+
+	t.Run("invalid limit", func(t *testing.T) {
+		s.do(t, "GET", "/songs/recent?limit=abc", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestReleaseYears(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Plug In Baby", ReleaseDate: day(2001, time.March, 5), IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Undated", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Hidden", ReleaseDate: day(1999, time.May, 1)})
+
+	var years endpoints.ReleaseYearsResponse
+	s.do(t, "GET", "/songs/years", nil).decode(t, http.StatusOK, &years)
+	if len(years.Years) != 2 || years.Years[0] != 2001 || years.Years[1] != 2009 {
+		t.Errorf("years = %v, want [2001 2009]", years.Years)
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		var years endpoints.ReleaseYearsResponse
+		s.do(t, "GET", "/songs/years", nil, authed...).decode(t, http.StatusOK, &years)
+		if len(years.Years) != 3 || years.Years[0] != 1999 {
+			t.Errorf("years = %v, want [1999 2001 2009]", years.Years)
+		}
+	})
+	t.Run("wrong method", func(t *testing.T) {
+		s.do(t, "POST", "/songs/years", nil).wantError(t, http.StatusMethodNotAllowed, "method_not_allowed")
+	})
+}
+
+func TestSearchLyrics(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "they will not control us", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", Text: "is this the real life", IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs/search?q=control", nil).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Uprising" {
+		t.Errorf("songs = %s, want Uprising", got)
+	}
+
+	t.Run("missing query", func(t *testing.T) {
+		s.do(t, "GET", "/songs/search", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+
+	t.Run("order", func(t *testing.T) {
+		s := newTestServer(t)
+		s.seed(t, models.Song{GroupName: "Queen", Title: "Under Pressure", Text: "pressure", ReleaseDate: day(1981, time.October, 26), IsPublic: true})
+		s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "pressure pressure pressure", ReleaseDate: day(2009, time.July, 16), IsPublic: true})
+		s.seed(t, models.Song{GroupName: "Muse", Title: "Hysteria", Text: "pressure pressure", ReleaseDate: day(2003, time.December, 1), IsPublic: true})
+
+		for order, want := range map[string]string{
+			"":             "Uprising,Hysteria,Under Pressure",
+			"relevance":    "Uprising,Hysteria,Under Pressure",
+			"release_date": "Uprising,Hysteria,Under Pressure",
+			"group":        "Hysteria,Uprising,Under Pressure",
+		} {
+			var list songsResponse
+			s.do(t, "GET", "/songs/search?q=pressure&order="+order, nil).decode(t, http.StatusOK, &list)
+			if got := titles(list.Songs); got != want {
+				t.Errorf("order %q: songs = %s, want %s", order, got, want)
+			}
+		}
+		s.do(t, "GET", "/songs/search?q=pressure&order=title", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestSongIndex(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Undisclosed Desires", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs/index?letter=u", nil).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Undisclosed Desires,Uprising" {
+		t.Errorf("songs = %s, want the titles starting with U by title", got)
+	}
+
+	t.Run("# bucket", func(t *testing.T) {
+		s.seed(t, models.Song{GroupName: "Muse", Title: "1984", IsPublic: true})
+		s.seed(t, models.Song{GroupName: "Muse", Title: "(Don't Fear) The Reaper", IsPublic: true})
+		var list songsResponse
+		s.do(t, "GET", "/songs/index?letter=%23", nil).decode(t, http.StatusOK, &list)
+		if got := titles(list.Songs); got != "(Don't Fear) The Reaper,1984" {
+			t.Errorf("songs = %s, want the titles not starting with a letter", got)
+		}
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		var list songsResponse
+		s.do(t, "GET", "/songs/index?letter=U&limit=1&offset=1", nil).decode(t, http.StatusOK, &list)
+		if got := titles(list.Songs); got != "Uprising" {
+			t.Errorf("songs = %s, want the second U title", got)
+		}
+	})
+
+	t.Run("not a letter", func(t *testing.T) {
+		s.do(t, "GET", "/songs/index?letter=ab", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestIndexLetters(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "1984", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Apocalypse Please", IsPublic: true})
+
+	var letters endpoints.IndexLettersResponse
+	s.do(t, "GET", "/songs/index/letters", nil).decode(t, http.StatusOK, &letters)
+	if got := strings.Join(letters.Letters, ""); got != "AU#" {
+		t.Errorf("letters = %q, want AU#", got)
+	}
+
+	t.Run("wrong method", func(t *testing.T) {
+		s.do(t, "DELETE", "/songs/index/letters", nil).wantError(t, http.StatusMethodNotAllowed, "method_not_allowed")
+	})
+}
+
+func TestExportSongs(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), IsPublic: true})
+
+	resp := s.do(t, "GET", "/songs/export", nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	if ct := resp.header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := "id,group,title,release_date,link,text\n1,Muse,Uprising,2009-07-16,,\n"
+	if string(resp.body) != want {
+		t.Errorf("body = %q, want %q", resp.body, want)
+	}
+
+	t.Run("invalid date bound", func(t *testing.T) {
+		s.do(t, "GET", "/songs/export?released_after=someday", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestExportSongsLarge(t *testing.T) {
+	s := newTestServer(t, withServiceOptions(service.WithExportMaxRows(450)))
+	for i := 1; i <= 500; i++ {
+		group := "Muse"
+		if i%2 == 0 {
+			group = "Queen"
+		}
+		s.seed(t, models.Song{GroupName: group, Title: fmt.Sprintf("Song %03d", i), Text: "line one\nline, two", IsPublic: true})
+	}
+
+	read := func(path string) [][]string {
+		t.Helper()
+		resp := s.do(t, "GET", path, nil)
+		if resp.status != http.StatusOK {
+			t.Fatalf("%s: status = %d", path, resp.status)
+		}
+		if d, params, _ := mime.ParseMediaType(resp.header.Get("Content-Disposition")); d != "attachment" || params["filename"] != "songs.csv" {
+			t.Errorf("Content-Disposition = %q, want a songs.csv attachment", resp.header.Get("Content-Disposition"))
+		}
+		records, err := csv.NewReader(bytes.NewReader(resp.body)).ReadAll()
+		if err != nil {
+			t.Fatalf("parse %s: %v", path, err)
+		}
+		if got := strings.Join(records[0], ","); got != "id,group,title,release_date,link,text" {
+			t.Errorf("header = %s", got)
+		}
+		return records[1:]
+	}
+
+	rows := read("/songs/export")
+	if len(rows) != 450 {
+		t.Fatalf("%d rows, want the export capped at 450", len(rows))
+	}
+	if rows[0][0] != "1" || rows[449][0] != "450" || rows[0][5] != "line one\nline, two" {
+		t.Errorf("rows run %v to %v, want IDs 1 to 450 with the lyrics intact", rows[0], rows[449])
+	}
+	if rows := read("/songs/export?group=Queen"); len(rows) != 250 {
+		t.Errorf("%d Queen rows, want 250", len(rows))
+	}
+}
+
+func TestCreateSongs(t *testing.T) {
+	s := newTestServer(t)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+	body := []map[string]string{
+		{"group": "Muse", "song": "Uprising"},
+		{"group": "Muse", "song": "Resistance", "text": "Is our secret safe tonight"},
+	}
+
+	var batch endpoints.CreateSongsResponse
+	s.do(t, "POST", "/songs/batch", body).decode(t, http.StatusOK, &batch)
+	if len(batch.Results) != 2 || batch.Results[0].Status != service.BatchItemCreated ||
+		batch.Results[1].Status != service.BatchItemEnrichmentFailed {
+		t.Fatalf("results = %+v, want created then enrichment_failed", batch.Results)
+	}
+	if song := s.stored(t, batch.Results[1].ID); song == nil || song.Text != "Is our secret safe tonight" {
+		t.Errorf("second song = %+v, want it stored with the provided text", song)
+	}
+
+	t.Run("invalid song", func(t *testing.T) {
+		body := []map[string]string{{"group": "Muse", "song": "Starlight"}, {"group": "Muse"}}
+		e := s.do(t, "POST", "/songs/batch", body).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+		if e.Details["[1].song"] == "" {
+			t.Errorf("details = %v, want a problem with [1].song", e.Details)
+		}
+		if n := s.count(t); n != 2 {
+			t.Errorf("%d songs stored, want the batch refused as a whole", n)
+		}
+	})
+}
+
+func TestSongsExist(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	var exist endpoints.SongsExistResponse
+	body := []map[string]string{{"group": "Muse", "song": "Uprising"}, {"group": "Muse", "song": "Missing"}}
+	s.do(t, "POST", "/songs/exists", body).decode(t, http.StatusOK, &exist)
+	if len(exist.Results) != 2 || !exist.Results[0].Exists || *exist.Results[0].ID != id || exist.Results[1].Exists {
+		t.Errorf("results = %+v, want only the first to exist", exist.Results)
+	}
+
+	t.Run("private song", func(t *testing.T) {
+		private := s.seed(t, models.Song{GroupName: "Muse", Title: "Hidden"})
+		body := []map[string]string{{"group": "Muse", "song": "Hidden"}}
+
+		var exist endpoints.SongsExistResponse
+		s.do(t, "POST", "/songs/exists", body).decode(t, http.StatusOK, &exist)
+		if len(exist.Results) != 1 || exist.Results[0].Exists {
+			t.Errorf("anonymous: results = %+v, want the private song missing", exist.Results)
+		}
+		s.do(t, "POST", "/songs/exists", body, authed...).decode(t, http.StatusOK, &exist)
+		if len(exist.Results) != 1 || !exist.Results[0].Exists || *exist.Results[0].ID != private {
+			t.Errorf("authenticated: results = %+v, want song %d", exist.Results, private)
+		}
+	})
+	t.Run("malformed body", func(t *testing.T) {
+		s.do(t, "POST", "/songs/exists", `{"group":`).wantError(t, http.StatusBadRequest, "malformed_request")
+	})
+}
+
+func TestFindSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	var found songResponse
+	s.do(t, "GET", "/songs/find?group=Muse&song=Uprising", nil).decode(t, http.StatusOK, &found)
+	if found.Song.ID != id {
+		t.Errorf("found song %d, want %d", found.Song.ID, id)
+	}
+
+	t.Run("no such song", func(t *testing.T) {
+		s.do(t, "GET", "/songs/find?group=Muse&song=Missing", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestGetSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), IsPublic: true})
+
+	var got songResponse
+	s.do(t, "GET", "/songs/1", nil).decode(t, http.StatusOK, &got)
+	if got.Song.ID != id || got.Song.Title != "Uprising" || got.Song.ReleaseDate != "2009-07-16" {
+		t.Errorf("song = %+v", got.Song)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestNullEmptyLyrics(t *testing.T) {
+	s := newTestServer(t, withEndpointOptions(endpoints.WithNullEmptyLyrics(true)))
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Instrumental", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one", IsPublic: true})
+
+	var got songResponse
+	s.do(t, "GET", "/songs/1", nil).decode(t, http.StatusOK, &got)
+	if got.Song.Text != nil {
+		t.Errorf("get: Text = %q, want null", *got.Song.Text)
+	}
+
+	var list songsResponse
+	s.do(t, "GET", "/songs?group=muse", nil).decode(t, http.StatusOK, &list)
+	if len(list.Songs) != 2 || list.Songs[0].Text == nil || *list.Songs[0].Text != "one" || list.Songs[1].Text != nil {
+		t.Errorf("list = %+v, want null only for the song without lyrics", list.Songs)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newTestServer(t)
+		s.seed(t, models.Song{GroupName: "Muse", Title: "Instrumental", IsPublic: true})
+		var got songResponse
+		s.do(t, "GET", "/songs/1", nil).decode(t, http.StatusOK, &got)
+		if got.Song.Text == nil || *got.Song.Text != "" {
+			t.Errorf("Text = %v, want an empty string", got.Song.Text)
+		}
+	})
+}
+
+func TestUpdateSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com/old"})
+
+	body := map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "2009-07-16", "link": "", "text": "new"}
+	resp := s.do(t, "PUT", "/songs/1", body)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	song := s.stored(t, id)
+	if song.Link != "" || song.Text != "new" || !song.ReleaseDate.Equal(day(2009, time.July, 16)) {
+		t.Errorf("stored song = %+v, want every field replaced", song)
+	}
+
+	t.Run("missing field", func(t *testing.T) {
+		resp := s.do(t, "PUT", "/songs/1", map[string]string{"group": "Muse", "song": "Uprising"})
+		resp.wantError(t, http.StatusBadRequest, "malformed_request")
+	})
+}
+
+func TestPatchSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com/old", Text: "kept"})
+
+	resp := s.do(t, "PATCH", "/songs/1", map[string]string{"link": "https://example.com/new"})
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	song := s.stored(t, id)
+	if song.Link != "https://example.com/new" || song.Text != "kept" {
+		t.Errorf("stored song = %+v, want only the link changed", song)
+	}
+
+	t.Run("no fields", func(t *testing.T) {
+		s.do(t, "PATCH", "/songs/1", "{}").wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "PATCH", "/songs/42", map[string]string{"link": "x"}).wantError(t, http.StatusNotFound, "not_found")
+	})
+
+	t.Run("PUT replaces every field", func(t *testing.T) {
+		s.do(t, "PUT", "/songs/1", map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "", "link": ""}).
+			wantError(t, http.StatusBadRequest, "malformed_request")
+		if song := s.stored(t, id); song.Link != "https://example.com/new" {
+			t.Errorf("rejected PUT changed the link to %q", song.Link)
+		}
+	})
+}
+
+func TestDeleteSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	resp := s.do(t, "DELETE", "/songs/1", nil)
+	if resp.status != http.StatusNoContent || len(resp.body) != 0 {
+		t.Fatalf("status = %d, body %q; want 204 without a body", resp.status, resp.body)
+	}
+	if s.stored(t, id) != nil {
+		t.Errorf("song %d still live", id)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "DELETE", "/songs/42", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestRestoreSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	s.do(t, "DELETE", "/songs/1", nil)
+
+	var restored songResponse
+	s.do(t, "POST", "/songs/1/restore", nil).decode(t, http.StatusOK, &restored)
+	if restored.Song.ID != id || s.stored(t, id) == nil {
+		t.Errorf("song %d not restored", id)
+	}
+
+	t.Run("not deleted", func(t *testing.T) {
+		s.do(t, "POST", "/songs/1/restore", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestSoftDeleteStates(t *testing.T) {
+	s := newTestServer(t)
+	live := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	deleted := s.seed(t, models.Song{GroupName: "Muse", Title: "Starlight", IsPublic: true})
+	purged := s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+
+	if resp := s.do(t, "DELETE", fmt.Sprintf("/songs/%d", deleted), nil); resp.status != http.StatusNoContent {
+		t.Fatalf("soft delete: status %d", resp.status)
+	}
+	s.do(t, "DELETE", fmt.Sprintf("/songs/%d?hard=true", purged), nil).wantError(t, http.StatusUnauthorized, "unauthorized")
+	if resp := s.do(t, "DELETE", fmt.Sprintf("/songs/%d?hard=true", purged), nil, authed...); resp.status != http.StatusNoContent {
+		t.Fatalf("hard delete: status %d", resp.status)
+	}
+
+	var got songResponse
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", live), nil).decode(t, http.StatusOK, &got)
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", deleted), nil).wantError(t, http.StatusGone, "deleted")
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", purged), nil).wantError(t, http.StatusNotFound, "not_found")
+
+	var list songsResponse
+	s.do(t, "GET", "/songs", nil).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Uprising" {
+		t.Errorf("listed %s, want only the live song", got)
+	}
+
+	s.do(t, "POST", fmt.Sprintf("/songs/%d/restore", purged), nil).wantError(t, http.StatusNotFound, "not_found")
+	s.do(t, "POST", fmt.Sprintf("/songs/%d/restore", deleted), nil).decode(t, http.StatusOK, &got)
+	s.do(t, "GET", fmt.Sprintf("/songs/%d", deleted), nil).decode(t, http.StatusOK, &got)
+	if got.Song.Title != "Starlight" {
+		t.Errorf("restored song = %+v", got.Song)
+	}
+}
+
+func TestSetVisibility(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	resp := s.do(t, "PUT", "/songs/1/visibility", map[string]bool{"public": true}, authed...)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	if !s.stored(t, id).IsPublic {
+		t.Errorf("song %d still private", id)
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s.do(t, "PUT", "/songs/1/visibility", map[string]bool{"public": false}).wantError(t, http.StatusUnauthorized, "unauthorized")
+		if !s.stored(t, id).IsPublic {
+			t.Errorf("visibility changed without an API key")
+		}
+	})
+}
+
+func TestMergeSongs(t *testing.T) {
+	s := newTestServer(t)
+	source := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising (live)", Text: "lyrics"})
+	target := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com/uprising"})
+
+	var merged songResponse
+	s.do(t, "POST", "/songs/1/merge", map[string]int64{"into": target}).decode(t, http.StatusOK, &merged)
+	if merged.Song.ID != target || merged.Song.Text == nil || *merged.Song.Text != "lyrics" {
+		t.Errorf("merged song = %+v, want the target with the source's lyrics", merged.Song)
+	}
+	if s.stored(t, source) != nil {
+		t.Errorf("source song %d still live", source)
+	}
+
+	t.Run("into itself", func(t *testing.T) {
+		s.do(t, "POST", "/songs/2/merge", map[string]int64{"into": target}).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestEnrichSong(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+
+	var enriched songResponse
+	s.do(t, "POST", "/songs/1/enrich", nil).decode(t, http.StatusOK, &enriched)
+	if !enriched.Song.Enriched || enriched.Song.Link != "https://example.com/uprising" {
+		t.Errorf("song = %+v, want it enriched", enriched.Song)
+	}
+	if song := s.stored(t, id); song.EnrichedAt.IsZero() {
+		t.Errorf("stored song not marked enriched")
+	}
+
+	t.Run("circuit open", func(t *testing.T) {
+		s.client.SetCircuitOpen()
+		s.do(t, "POST", "/songs/1/enrich", nil).wantError(t, http.StatusServiceUnavailable, "external_api_unavailable")
+	})
+}
+
+func TestSameReleaseDate(t *testing.T) {
+	s := newTestServer(t)
+	release := day(2009, time.September, 14)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: release, IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", ReleaseDate: release, IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4), IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs/1/same-release-date", nil).decode(t, http.StatusOK, &list)
+	if got := titles(list.Songs); got != "Resistance" {
+		t.Errorf("songs = %s, want Resistance", got)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42/same-release-date", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestSongHistory(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	s.do(t, "PATCH", "/songs/1", map[string]string{"text": "new lyrics"})
+
+	var history endpoints.SongHistoryResponse
+	s.do(t, "GET", "/songs/1/history", nil, authed...).decode(t, http.StatusOK, &history)
+	if history.Total != 2 || len(history.Entries) != 2 ||
+		history.Entries[0].Operation != models.HistoryCreate || history.Entries[1].Operation != models.HistoryUpdate {
+		t.Errorf("history = %+v, want create then update", history)
+	}
+
+	t.Run("after delete", func(t *testing.T) {
+		s.do(t, "DELETE", "/songs/1", nil, authed...)
+		var page endpoints.SongHistoryResponse
+		s.do(t, "GET", "/songs/1/history?limit=1&offset=2", nil, authed...).decode(t, http.StatusOK, &page)
+		if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0].Operation != models.HistoryDelete {
+			t.Errorf("history = %+v, want the delete as the third of 3 entries", page)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s.do(t, "GET", "/songs/1/history", nil).wantError(t, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+func TestGetLyrics(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one\n\ntwo\n\nthree"})
+
+	var lyrics endpoints.GetLyricsResponse
+	s.do(t, "GET", "/songs/1/lyrics?page=2&pageSize=2", nil).decode(t, http.StatusOK, &lyrics)
+	if lyrics.Total != 3 || len(lyrics.Lyrics) != 1 || lyrics.Lyrics[0] != "three" {
+		t.Errorf("lyrics = %+v, want the third verse of 3", lyrics)
+	}
+
+	t.Run("detailed", func(t *testing.T) {
+		s := newTestServer(t, withServiceOptions(service.WithMaxPageSize(2)))
+		s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one\n\ntwo\n\nthree\nfour"})
+
+		var detailed endpoints.DetailedLyricsResponse
+		s.do(t, "GET", "/songs/1/lyrics?format=detailed&pageSize=50", nil).decode(t, http.StatusOK, &detailed)
+		if len(detailed.Verses) != 2 || detailed.PageSize != 2 || detailed.Total != 3 {
+			t.Errorf("page 1 = %+v, want 2 of 3 verses at the capped page size", detailed)
+		}
+		s.do(t, "GET", "/songs/1/lyrics?format=detailed&pageSize=50&page=2", nil).decode(t, http.StatusOK, &detailed)
+		if len(detailed.Verses) != 1 || detailed.Verses[0] != (endpoints.VerseView{Number: 3, Text: "three\nfour", Lines: 2}) {
+			t.Errorf("page 2 = %+v, want the third verse", detailed.Verses)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		s.do(t, "GET", "/songs/1/lyrics?format=xml", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestCountVerses(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one\n\ntwo"})
+
+	var count endpoints.CountVersesResponse
+	s.do(t, "GET", "/songs/1/lyrics/count", nil).decode(t, http.StatusOK, &count)
+	if count.Total != 2 {
+		t.Errorf("total = %d, want 2", count.Total)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42/lyrics/count", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestWordStats(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "rise up rise\n\nrise"})
+
+	var stats endpoints.WordStatsResponse
+	s.do(t, "GET", "/songs/1/lyrics/wordstats?top=1", nil).decode(t, http.StatusOK, &stats)
+	if stats.Total != 4 || len(stats.Words) != 1 || stats.Words[0] != (endpoints.WordCountView{Word: "rise", Count: 3}) {
+		t.Errorf("stats = %+v, want rise×3 of 4 words", stats)
+	}
+
+	t.Run("unknown stopwords", func(t *testing.T) {
+		s.do(t, "GET", "/songs/1/lyrics/wordstats?stopwords=fr", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestGetVerse(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one\n\ntwo"})
+
+	var verse endpoints.GetVerseResponse
+	s.do(t, "GET", "/songs/1/lyrics/2", nil).decode(t, http.StatusOK, &verse)
+	if verse.Verse != 2 || verse.Total != 2 || verse.Text != "two" {
+		t.Errorf("verse = %+v", verse)
+	}
+
+	t.Run("past the last verse", func(t *testing.T) {
+		e := s.do(t, "GET", "/songs/1/lyrics/3", nil).wantError(t, http.StatusNotFound, "not_found")
+		if !strings.Contains(e.Message, "has 2 verses, not 3") {
+			t.Errorf("message = %q, want the verse count", e.Message)
+		}
+	})
+	t.Run("verse zero", func(t *testing.T) {
+		s.do(t, "GET", "/songs/1/lyrics/0", nil).wantError(t, http.StatusBadRequest, "malformed_request")
+	})
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42/lyrics/1", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+	t.Run("without lyrics", func(t *testing.T) {
+		id := s.seed(t, models.Song{GroupName: "Muse", Title: "Instrumental", IsPublic: true})
+		s.do(t, "GET", fmt.Sprintf("/songs/%d/lyrics/1", id), nil).wantError(t, http.StatusNotFound, "not_found")
+		var count endpoints.CountVersesResponse
+		s.do(t, "GET", fmt.Sprintf("/songs/%d/lyrics/count", id), nil).decode(t, http.StatusOK, &count)
+		if count.Total != 0 {
+			t.Errorf("count = %d, want 0", count.Total)
+		}
+	})
+}
+
+func TestExportSongText(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one"})
+
+	resp := s.do(t, "GET", "/songs/1/export.txt", nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	if cd := resp.header.Get("Content-Disposition"); !strings.Contains(cd, `filename="Muse - Uprising.txt"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if want := "Muse — Uprising\n\none\n"; string(resp.body) != want {
+		t.Errorf("body = %q, want %q", resp.body, want)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42/export.txt", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestReorderLyrics(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one\n\ntwo"})
+
+	var reordered endpoints.ReorderLyricsResponse
+	s.do(t, "PUT", "/songs/1/lyrics/reorder", map[string][]int{"order": {1, 0}}).decode(t, http.StatusOK, &reordered)
+	if strings.Join(reordered.Lyrics, ",") != "two,one" {
+		t.Errorf("lyrics = %v, want [two one]", reordered.Lyrics)
+	}
+	if song := s.stored(t, id); song.Text != "two\n\none" {
+		t.Errorf("stored text = %q", song.Text)
+	}
+
+	t.Run("incomplete order", func(t *testing.T) {
+		s.do(t, "PUT", "/songs/1/lyrics/reorder", map[string][]int{"order": {0}}).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestPreviewSplit(t *testing.T) {
+	s := newTestServer(t)
+
+	var preview endpoints.PreviewSplitResponse
+	s.do(t, "POST", "/lyrics/split", map[string]string{"text": "one\r\n\r\n\r\ntwo  \n"}).decode(t, http.StatusOK, &preview)
+	if strings.Join(preview.Verses, ",") != "one,two" {
+		t.Errorf("verses = %q, want [one two]", preview.Verses)
+	}
+	if n := s.count(t); n != 0 {
+		t.Errorf("preview stored %d songs", n)
+	}
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		s.do(t, "POST", "/lyrics/split", map[string]string{"text": "x", "strategy": "lines"}).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestListGroups(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Hidden"})
+	s.seed(t, models.Song{GroupName: "Abba", Title: "Hidden"})
+
+	var groups endpoints.ListGroupsResponse
+	s.do(t, "GET", "/groups?limit=1", nil).decode(t, http.StatusOK, &groups)
+	if groups.Total != 2 || len(groups.Groups) != 1 || groups.Groups[0] != (endpoints.GroupInfo{Group: "Muse", Songs: 2}) {
+		t.Errorf("groups = %+v, want Muse with 2 songs of 2 groups", groups)
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		var groups endpoints.ListGroupsResponse
+		s.do(t, "GET", "/groups?limit=2", nil, authed...).decode(t, http.StatusOK, &groups)
+		want := []endpoints.GroupInfo{{Group: "Abba", Songs: 1}, {Group: "Muse", Songs: 3}}
+		if groups.Total != 3 || len(groups.Groups) != 2 || groups.Groups[0] != want[0] || groups.Groups[1] != want[1] {
+			t.Errorf("groups = %+v, want %+v of 3 groups", groups, want)
+		}
+	})
+	t.Run("negative offset", func(t *testing.T) {
+		s.do(t, "GET", "/groups?offset=-1", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestSuggestGroups(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Metallica", Title: "One", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Megadeth", Title: "Hidden"})
+
+	var suggestions endpoints.SuggestGroupsResponse
+	s.do(t, "GET", "/groups/suggest?prefix=m&withCounts=true", nil).decode(t, http.StatusOK, &suggestions)
+	if len(suggestions.Groups) != 2 || suggestions.Groups[0].Group != "Metallica" || suggestions.Groups[0].Songs == nil {
+		t.Errorf("groups = %+v, want Metallica and Muse with counts", suggestions.Groups)
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		var suggestions endpoints.SuggestGroupsResponse
+		s.do(t, "GET", "/groups/suggest?prefix=m", nil, authed...).decode(t, http.StatusOK, &suggestions)
+		if len(suggestions.Groups) != 3 || suggestions.Groups[0].Group != "Megadeth" {
+			t.Errorf("groups = %+v, want Megadeth, Metallica and Muse", suggestions.Groups)
+		}
+	})
+
+	t.Run("limit over 50", func(t *testing.T) {
+		s.do(t, "GET", "/groups/suggest?limit=51", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestEnrichGroup(t *testing.T) {
+	s := newTestServer(t)
+	complete := s.seed(t, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4), Link: "l", Text: "t"})
+	known := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+	unknown := s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance"})
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+
+	var enriched endpoints.EnrichGroupResponse
+	s.do(t, "POST", "/groups/Muse/enrich", nil).decode(t, http.StatusOK, &enriched)
+	if len(enriched.Results) != 2 ||
+		enriched.Results[0] != (endpoints.EnrichSongResult{ID: known, Enriched: true}) ||
+		enriched.Results[1].ID != unknown || enriched.Results[1].Enriched || enriched.Results[1].Error == "" {
+		t.Errorf("results = %+v, want %d enriched and %d failed", enriched.Results, known, unknown)
+	}
+	if song := s.stored(t, known); song.Link != "https://example.com/uprising" {
+		t.Errorf("stored link = %q", song.Link)
+	}
+	if !s.stored(t, complete).EnrichedAt.IsZero() {
+		t.Errorf("complete song %d was re-enriched", complete)
+	}
+
+	t.Run("wrong method", func(t *testing.T) {
+		s.do(t, "GET", "/groups/Muse/enrich", nil).wantError(t, http.StatusMethodNotAllowed, "method_not_allowed")
+	})
+}
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) PingContext(ctx context.Context) error { return f(ctx) }
+
+func TestHealthAndReady(t *testing.T) {
+	var dbErr error
+	logs := &testutil.RecordingLogger{}
+	s := newTestServer(t, withDependencies(ServerDependencies{
+		DB:     pingerFunc(func(context.Context) error { return dbErr }),
+		Logger: logs,
+	}))
+
+	var health healthResponse
+	s.do(t, "GET", "/health", nil).decode(t, http.StatusOK, &health)
+	if health.Status != "ok" {
+		t.Errorf("health = %+v", health)
+	}
+	var ready healthResponse
+	s.do(t, "GET", "/ready", nil).decode(t, http.StatusOK, &ready)
+	if ready.Status != "ok" {
+		t.Errorf("ready = %+v", ready)
+	}
+
+	t.Run("database down", func(t *testing.T) {
+		dbErr = errors.New("connection refused")
+		var ready healthResponse
+		s.do(t, "GET", "/ready", nil).decode(t, http.StatusServiceUnavailable, &ready)
+		if ready.Status != "unavailable" || ready.Reason != "db" {
+			t.Errorf("ready = %+v", ready)
+		}
+		if _, ok := logs.Find(logger.LevelWarn, "readiness: database ping failed"); !ok {
+			t.Errorf("ping failure not logged through the injected logger: %+v", logs.Entries())
+		}
+	})
+}
+
+type migrationStatusFunc func(ctx context.Context) (int64, []int64, error)
+
+func (f migrationStatusFunc) MigrationStatus(ctx context.Context) (int64, []int64, error) {
+	return f(ctx)
+}
+
+func TestDBStatus(t *testing.T) {
+	s := newTestServer(t, withDependencies(ServerDependencies{
+		Migrations: migrationStatusFunc(func(context.Context) (int64, []int64, error) {
+			return 3, []int64{4}, nil
+		}),
+	}))
+
+	var status dbStatusResponse
+	s.do(t, "GET", "/admin/db-status", nil, authed...).decode(t, http.StatusOK, &status)
+	if status.Version != 3 || !status.Pending || len(status.PendingVersions) != 1 {
+		t.Errorf("status = %+v, want version 3 with 4 pending", status)
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s.do(t, "GET", "/admin/db-status", nil).wantError(t, http.StatusUnauthorized, "unauthorized")
+	})
+	t.Run("up to date", func(t *testing.T) {
+		s := newTestServer(t, withDependencies(ServerDependencies{
+			Migrations: migrationStatusFunc(func(context.Context) (int64, []int64, error) {
+				return 12, nil, nil
+			}),
+		}))
+		var status dbStatusResponse
+		s.do(t, "GET", "/admin/db-status", nil, authed...).decode(t, http.StatusOK, &status)
+		if status.Version != 12 || status.Pending {
+			t.Errorf("status = %+v, want version 12 with nothing pending", status)
+		}
+	})
+	t.Run("failing", func(t *testing.T) {
+		logs := &testutil.RecordingLogger{}
+		s := newTestServer(t, withHandlerOptions(WithTraceID()), withDependencies(ServerDependencies{
+			Migrations: migrationStatusFunc(func(context.Context) (int64, []int64, error) {
+				return 0, nil, errors.New("relation goose_db_version does not exist")
+			}),
+			Logger: logs,
+		}))
+		e := s.do(t, "GET", "/admin/db-status", nil, append([]string{middleware.TraceIDHeader, "req-42"}, authed...)...).
+			wantError(t, http.StatusInternalServerError, "internal_error")
+		if strings.Contains(e.Message, "goose") {
+			t.Errorf("message leaks the cause: %q", e.Message)
+		}
+		entry, ok := logs.Find(logger.LevelError, "request failed")
+		if !ok {
+			t.Fatalf("no request failed message in %+v", logs.Entries())
+		}
+		if status, _ := entry.Value("status"); status != http.StatusInternalServerError {
+			t.Errorf("logged status %v, want 500", status)
+		}
+		if id, _ := entry.Value("trace_id"); id != "req-42" {
+			t.Errorf("logged trace_id %v, want req-42", id)
+		}
+	})
+	t.Run("not configured", func(t *testing.T) {
+		newTestServer(t).do(t, "GET", "/admin/db-status", nil, authed...).wantError(t, http.StatusInternalServerError, "internal_error")
+	})
+}
+
+func TestReprocess(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: " Muse ", Title: "Uprising"})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody"})
+
+	var result endpoints.ReprocessResponse
+	s.do(t, "POST", "/admin/reprocess", nil, authed...).decode(t, http.StatusOK, &result)
+	if result.Scanned != 2 || result.Changed != 1 {
+		t.Errorf("result = %+v, want 2 scanned and 1 changed", result)
+	}
+	if song := s.stored(t, id); song.GroupName != "Muse" {
+		t.Errorf("stored group = %q, want it trimmed", song.GroupName)
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s.do(t, "POST", "/admin/reprocess", nil).wantError(t, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t, withEndpointOptions(endpoints.WithMiddleware(middleware.NewMetricsMiddleware("transport_test"))))
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	s.do(t, "GET", "/songs/1", nil)
+	s.do(t, "GET", "/songs/99", nil)
+
+	resp := s.do(t, "GET", "/metrics", nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d", resp.status)
+	}
+	for _, want := range []string{
+		`transport_test_http_requests_total{endpoint="GetSong",status="success"} 1`,
+		`transport_test_http_requests_total{endpoint="GetSong",status="error"} 1`,
+		`transport_test_http_request_duration_seconds_count{endpoint="GetSong"} 2`,
+	} {
+		if !strings.Contains(string(resp.body), want) {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, "GET", "/albums", nil).wantError(t, http.StatusNotFound, "not_found")
+}
+
+func TestSongNameLength(t *testing.T) {
+	s := newTestServer(t)
+	longest := strings.Repeat("é", models.MaxTitleLength)
+
+	var created endpoints.UpsertSongResponse
+	body := map[string]string{"group": "Muse", "song": longest}
+	s.do(t, "PUT", "/songs", body).decode(t, http.StatusCreated, &created)
+	if song := s.stored(t, created.ID); song.Title != longest {
+		t.Errorf("stored title has %d bytes, want %d", len(song.Title), len(longest))
+	}
+
+	t.Run("too long", func(t *testing.T) {
+		body := map[string]string{"group": strings.Repeat("g", models.MaxGroupNameLength+1), "song": longest + "é"}
+		e := s.do(t, "POST", "/songs", body).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+		if e.Details["group"] != "must be at most 512 characters" || e.Details["song"] != "must be at most 512 characters" {
+			t.Errorf("details = %v, want both names too long", e.Details)
+		}
+		if s.client.Calls() != 0 || s.count(t) != 1 {
+			t.Errorf("oversized song reached the service")
+		}
+	})
+}
+
+func TestFindSongVisibility(t *testing.T) {
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	var found songResponse
+	s.do(t, "GET", "/songs/find?group=Muse&song=Uprising", nil, authed...).decode(t, http.StatusOK, &found)
+	if found.Song.ID != id {
+		t.Errorf("found song %d, want %d", found.Song.ID, id)
+	}
+
+	t.Run("private song, anonymous", func(t *testing.T) {
+		s.do(t, "GET", "/songs/find?group=Muse&song=Uprising", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+	t.Run("missing title", func(t *testing.T) {
+		s.do(t, "GET", "/songs/find?group=Muse", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestLyricsVisibility(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one\n\ntwo"})
+
+	for _, path := range []string{
+		"/songs/1/lyrics",
+		"/songs/1/lyrics?format=detailed",
+		"/songs/1/lyrics?format=lrc",
+		"/songs/1/lyrics/1",
+		"/songs/1/lyrics/count",
+		"/songs/1/lyrics/wordstats",
+		"/songs/1/export.txt",
+	} {
+		t.Run(path, func(t *testing.T) {
+			s.do(t, "GET", path, nil).wantError(t, http.StatusNotFound, "not_found")
+			if resp := s.do(t, "GET", path, nil, authed...); resp.status != http.StatusOK {
+				t.Errorf("authenticated: status = %d; body: %s", resp.status, resp.body)
+			}
+		})
+	}
+}
+
+func TestSuggestGroupsCounts(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Hidden"})
+
+	resp := s.do(t, "GET", "/groups/suggest?prefix=mu&withCounts=true", nil)
+	if resp.status != http.StatusOK || string(resp.body) != `{"groups":[{"group":"Muse","songs":2}]}`+"\n" {
+		t.Errorf("with counts: %d %s", resp.status, resp.body)
+	}
+	resp = s.do(t, "GET", "/groups/suggest?prefix=mu", nil)
+	if resp.status != http.StatusOK || string(resp.body) != `{"groups":[{"group":"Muse"}]}`+"\n" {
+		t.Errorf("without counts: %d %s", resp.status, resp.body)
+	}
+
+	t.Run("invalid withCounts", func(t *testing.T) {
+		s.do(t, "GET", "/groups/suggest?prefix=mu&withCounts=yes", nil).wantError(t, http.StatusBadRequest, "malformed_request")
+	})
+}
+
+func TestReorderLyricsUnknownSong(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, "PUT", "/songs/42/lyrics/reorder", map[string][]int{"order": {0}}).wantError(t, http.StatusNotFound, "not_found")
+	s.do(t, "PUT", "/songs/42/lyrics/reorder", `{"order":"0,1"}`).wantError(t, http.StatusBadRequest, "malformed_request")
+}
+
+func TestStrictQueryParams(t *testing.T) {
+	s := newTestServer(t, withHandlerOptions(WithStrictQueryParams()))
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one", IsPublic: true})
+
+	var list songsResponse
+	s.do(t, "GET", "/songs?group=muse&limit=5&tz=Europe/Berlin", nil).decode(t, http.StatusOK, &list)
+	if len(list.Songs) != 1 {
+		t.Errorf("got %d songs, want 1", len(list.Songs))
+	}
+
+	for _, path := range []string{"/songs?grop=muse", "/songs/1/lyrics?page=1&verse=2", "/songs/search?q=one&sort=id"} {
+		e := s.do(t, "GET", path, nil).wantError(t, http.StatusBadRequest, "malformed_request")
+		if !strings.Contains(e.Message, "unknown query parameters") {
+			t.Errorf("GET %s: message = %q", path, e.Message)
+		}
+	}
+
+	t.Run("lenient by default", func(t *testing.T) {
+		s := newTestServer(t)
+		s.do(t, "GET", "/songs?grop=muse", nil).decode(t, http.StatusOK, &list)
+	})
+}
+
+func TestListSongIDs(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+
+	resp := s.do(t, "GET", "/songs?fields=id&group=muse", nil)
+	if resp.status != http.StatusOK || string(resp.body) != `{"ids":[3,1],"total":2}`+"\n" {
+		t.Errorf("got %d %s", resp.status, resp.body)
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		s.do(t, "GET", "/songs?fields=title", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+	t.Run("with the map shape", func(t *testing.T) {
+		s.do(t, "GET", "/songs?fields=id&shape=map", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestImportSongsMultipart(t *testing.T) {
+	s := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "songs.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(part, "group,title\nMuse,Uprising\n")
+	form.Close()
+
+	var summary endpoints.ImportSongsResponse
+	s.do(t, "POST", "/songs/import", body.Bytes(), "Content-Type", form.FormDataContentType()).decode(t, http.StatusOK, &summary)
+	if summary.ImportedRows != 1 || len(summary.Warnings) != 1 {
+		t.Errorf("summary = %+v, want 1 song imported without enrichment", summary)
+	}
+	if s.count(t) != 1 {
+		t.Errorf("song not stored")
+	}
+
+	t.Run("bad header", func(t *testing.T) {
+		s.do(t, "POST", "/songs/import?format=csv", "name\nMuse\n").wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestUnauthenticatedListing(t *testing.T) {
+	s := newTestServer(t)
+	release := day(2009, time.September, 14)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Text: "rise", ReleaseDate: release, IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Undisclosed Desires", Text: "rise", ReleaseDate: release})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", Text: "rise", ReleaseDate: day(2010, time.February, 22)})
+
+	lists := []struct {
+		path      string
+		anonymous string
+		authed    string
+	}{
+		{"/songs", "Uprising", "Resistance,Undisclosed Desires,Uprising"},
+		{"/songs/recent", "Uprising", "Resistance,Undisclosed Desires,Uprising"},
+		{"/songs/search?q=rise", "Uprising", "Resistance,Undisclosed Desires,Uprising"},
+		{"/songs/index?letter=U", "Uprising", "Undisclosed Desires,Uprising"},
+		{"/songs/1/same-release-date", "", "Undisclosed Desires"},
+	}
+	for _, tt := range lists {
+		var anonymous, all songsResponse
+		s.do(t, "GET", tt.path, nil).decode(t, http.StatusOK, &anonymous)
+		s.do(t, "GET", tt.path, nil, authed...).decode(t, http.StatusOK, &all)
+		if got := titles(anonymous.Songs); got != tt.anonymous {
+			t.Errorf("anonymous GET %s = %s, want %s", tt.path, got, tt.anonymous)
+		}
+		if got := titles(all.Songs); got != tt.authed {
+			t.Errorf("authenticated GET %s = %s, want %s", tt.path, got, tt.authed)
+		}
+	}
+
+	var letters endpoints.IndexLettersResponse
+	s.do(t, "GET", "/songs/index/letters", nil).decode(t, http.StatusOK, &letters)
+	if got := strings.Join(letters.Letters, ""); got != "U" {
+		t.Errorf("anonymous letters = %q, want U", got)
+	}
+
+	resp := s.do(t, "GET", "/songs/export", nil)
+	if resp.status != http.StatusOK || strings.Contains(string(resp.body), "Resistance") {
+		t.Errorf("anonymous export included private songs: %s", resp.body)
+	}
+
+	t.Run("private song by ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/3", nil).wantError(t, http.StatusNotFound, "not_found")
+		s.do(t, "GET", "/songs/2/same-release-date", nil).wantError(t, http.StatusNotFound, "not_found")
+		s.do(t, "GET", "/songs/3", nil, "X-API-Key", "wrong-key").wantError(t, http.StatusNotFound, "not_found")
+		var got songResponse
+		s.do(t, "GET", "/songs/3", nil, authed...).decode(t, http.StatusOK, &got)
+		if got.Song.IsPublic {
+			t.Errorf("private song reported public")
+		}
+	})
+}
+
+func TestSetVisibilityUnknownSong(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, "PUT", "/songs/42/visibility", map[string]bool{"public": true}, authed...).wantError(t, http.StatusNotFound, "not_found")
+	s.do(t, "PUT", "/songs/42/visibility", `{"public":"yes"}`, authed...).wantError(t, http.StatusBadRequest, "malformed_request")
+}
+
+func TestGetLyricsLRC(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true, Text: "one\n\ntwo"})
+
+	resp := s.do(t, "GET", "/songs/1/lyrics?format=lrc&duration=60", nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", resp.status, resp.body)
+	}
+	if ct := resp.header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if want := "[00:00.00]one\n[00:30.00]two\n"; string(resp.body) != want {
+		t.Errorf("body = %q, want %q", resp.body, want)
+	}
+
+	t.Run("unknown ID", func(t *testing.T) {
+		s.do(t, "GET", "/songs/42/lyrics?format=lrc", nil).wantError(t, http.StatusNotFound, "not_found")
+	})
+	for _, duration := range []string{"abc", "-5"} {
+		t.Run("duration "+duration, func(t *testing.T) {
+			s.do(t, "GET", "/songs/1/lyrics?format=lrc&duration="+duration, nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+		})
+	}
+}
+
+func TestListSongsRequiresFilter(t *testing.T) {
+	s := newTestServer(t, withServiceOptions(service.WithRequireListFilter(true)))
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	s.do(t, "GET", "/songs", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	var list songsResponse
+	s.do(t, "GET", "/songs?title=up", nil).decode(t, http.StatusOK, &list)
+	if len(list.Songs) != 1 {
+		t.Errorf("got %d songs, want 1", len(list.Songs))
+	}
+}
+
+func TestSemanticValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	e := s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "2009-02-30"}).
+		wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	if e.Details["releaseDate"] != "must be a valid date" {
+		t.Errorf("details = %v", e.Details)
+	}
+	s.do(t, "PATCH", "/songs/1", map[string]string{"link": "a\nb"}).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+
+	t.Run("malformed is 400", func(t *testing.T) {
+		for _, body := range []string{`{"group":"Muse",`, `{"group":1}`, `[]`} {
+			s.do(t, "POST", "/songs", body).wantError(t, http.StatusBadRequest, "malformed_request")
+		}
+	})
+	if s.client.Calls() != 0 || s.count(t) != 0 {
+		t.Errorf("invalid requests reached the service")
+	}
+}
+
+func TestCreateSongFieldErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	e := s.do(t, "POST", "/songs", map[string]string{"group": "  ", "link": "https://a\tb", "text": "la\x00la"}).
+		wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	want := map[string]string{
+		"group": "is required",
+		"song":  "is required",
+		"link":  "must be a single line",
+		"text":  "must not contain control characters",
+	}
+	if !reflect.DeepEqual(e.Details, want) {
+		t.Errorf("details = %v, want %v", e.Details, want)
+	}
+
+	e = s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": strings.Repeat("я", models.MaxTitleLength+1)}).
+		wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	if e.Details["song"] != fmt.Sprintf("must be at most %d characters", models.MaxTitleLength) {
+		t.Errorf("details = %v", e.Details)
+	}
+	if s.client.Calls() != 0 || s.count(t) != 0 {
+		t.Errorf("invalid requests reached the service")
+	}
+}
+
+// FuzzDecodeCreateSongRequest feeds arbitrary bodies to the create decoder:
+// it must never panic, must refuse anything that is not a JSON object as a
+// malformed request, and whatever it accepts must survive Validate.
+func FuzzDecodeCreateSongRequest(f *testing.F) {
+	for _, seed := range []string{
+		`{"group":"Muse","song":"Uprising"}`,
+		`{"group":"Muse","song":"Uprising","releaseDate":"16.07.2006","link":"https://example.com","text":"a\n\nb"}`,
+		`{"group":"","song":null}`,
+		`{"group":1}`,
+		`{"group":"Muse",`,
+		`[]`,
+		`null`,
+		strings.Repeat("[", maxJSONDepth+1),
+		"{\"group\":\"\xff\"}",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		r := httptest.NewRequest("POST", "/songs", bytes.NewReader(body))
+		v, err := decodeCreateSongRequest(context.Background(), r)
+		if err != nil {
+			if !errors.Is(err, errMalformedRequest) {
+				t.Fatalf("decode error %v is not a malformed request", err)
+			}
+			return
+		}
+		if !json.Valid(body) {
+			t.Fatalf("accepted invalid JSON %q", body)
+		}
+		req, ok := v.(endpoints.CreateSongRequest)
+		if !ok {
+			t.Fatalf("decoded %T", v)
+		}
+		if err := req.Validate(); err != nil && !errors.Is(err, models.ErrValidation) {
+			t.Fatalf("Validate error %v is not a validation error", err)
+		}
+	})
+}
+
+func TestTraceIDHeader(t *testing.T) {
+	logs := &testutil.RecordingLogger{}
+	s := newTestServer(t, withHandlerOptions(WithTraceID()), withServiceOptions(service.WithLogger(logs)))
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+
+	resp := s.do(t, "GET", fmt.Sprintf("/songs/%d", id), nil, middleware.TraceIDHeader, "req-42")
+	if got := resp.header.Get(middleware.TraceIDHeader); got != "req-42" {
+		t.Errorf("%s = %q, want the incoming req-42", middleware.TraceIDHeader, got)
+	}
+	entry, ok := logs.Find(logger.LevelDebug, "getSong")
+	if !ok {
+		t.Fatalf("no getSong message in %+v", logs.Entries())
+	}
+	if got, _ := entry.Value("trace_id"); got != "req-42" {
+		t.Errorf("service logged trace_id %v, want req-42", got)
+	}
+
+	a := s.do(t, "GET", "/songs/999", nil).header.Get(middleware.TraceIDHeader)
+	b := s.do(t, "GET", "/songs/999", nil).header.Get(middleware.TraceIDHeader)
+	if a == "" || a == b {
+		t.Errorf("generated IDs %q and %q, want distinct IDs on error responses too", a, b)
+	}
+}
+
+func TestEncodeErrorResponse(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{malformed(errors.New("unexpected EOF")), http.StatusBadRequest, "malformed_request"},
+		{errBadRoute, http.StatusBadRequest, "malformed_request"},
+		{fmt.Errorf("title: %w", models.ErrValidation), http.StatusUnprocessableEntity, "validation_failed"},
+		{fmt.Errorf("song 7: %w", models.ErrSongNotFound), http.StatusNotFound, "not_found"},
+		{models.ErrVerseNotFound, http.StatusNotFound, "not_found"},
+		{fmt.Errorf("song 7: %w", models.ErrDeleted), http.StatusGone, "deleted"},
+		{models.ErrDuplicateSong, http.StatusConflict, "conflict"},
+		{fmt.Errorf("fetch: %w", models.ErrExternalAPI), http.StatusBadGateway, "external_api_error"},
+		{models.ErrCircuitOpen, http.StatusServiceUnavailable, "external_api_unavailable"},
+		{errors.New("pq: connection refused"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code+" "+tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			encodeErrorResponse(context.Background(), tt.err, rec)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var resp errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if resp.Code != tt.code {
+				t.Errorf("code = %q, want %q", resp.Code, tt.code)
+			}
+			wantMessage := tt.err.Error()
+			if tt.status == http.StatusInternalServerError {
+				wantMessage = internalErrorMessage
+			}
+			if resp.Message != wantMessage {
+				t.Errorf("message = %q, want %q", resp.Message, wantMessage)
+			}
+		})
+	}
+
+	t.Run("validation details", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		encodeErrorResponse(context.Background(), &endpoints.ValidationError{Fields: map[string]string{"group": "is required"}}, rec)
+		var resp errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		if rec.Code != http.StatusUnprocessableEntity || resp.Details["group"] != "is required" {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestJSONDepthGuard(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+	}
+	s := newTestServer(t)
+
+	s.do(t, "POST", "/songs/batch", nested(maxJSONDepth+1)).wantError(t, http.StatusBadRequest, "malformed_request")
+	s.do(t, "POST", "/songs/exists", nested(maxJSONDepth+1)).wantError(t, http.StatusBadRequest, "malformed_request")
+	s.do(t, "POST", "/songs", `{"group":"Muse","song":"Uprising","extra":`+strings.Repeat(`{"a":`, maxJSONDepth)+`1`+strings.Repeat("}", maxJSONDepth)+`}`).
+		wantError(t, http.StatusBadRequest, "malformed_request")
+	if s.client.Calls() != 0 || s.count(t) != 0 {
+		t.Errorf("over-nested requests reached the service")
+	}
+
+	t.Run("at the limit", func(t *testing.T) {
+		var v interface{}
+		r := httptest.NewRequest("POST", "/songs/batch", strings.NewReader(nested(maxJSONDepth)))
+		if err := decodeJSONBody(r, &v); err != nil {
+			t.Errorf("decode %d levels: %v", maxJSONDepth, err)
+		}
+	})
+
+	t.Run("rejected before the end", func(t *testing.T) {
+		body := &countingReader{r: strings.NewReader(strings.Repeat("[", 1<<20))}
+		var v interface{}
+		if err := decodeJSONBody(httptest.NewRequest("POST", "/songs/batch", body), &v); err == nil {
+			t.Fatal("decode succeeded, want the nesting refused")
+		}
+		if body.n >= 1<<20 {
+			t.Errorf("read all %d bytes before refusing the body", body.n)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		s := newTestServer(t, withHandlerOptions(WithMaxBodyBytes(64)))
+		body := []map[string]string{{"group": "Muse", "song": strings.Repeat("Uprising ", 16)}}
+		s.do(t, "POST", "/songs/batch", body).wantError(t, http.StatusRequestEntityTooLarge, "body_too_large")
+		if s.count(t) != 0 {
+			t.Errorf("an oversized batch was stored")
+		}
+	})
+}
+
+func TestTimeZoneParam(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Moscow"); err != nil {
+		t.Skip("no tz database:", err)
+	}
+	s := newTestServer(t)
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	created := s.stored(t, id).CreatedAt
+
+	var timestamps struct {
+		Song struct{ CreatedAt, UpdatedAt string } `json:"song"`
+	}
+	check := func(path, offset string) {
+		t.Helper()
+		s.do(t, "GET", path, nil).decode(t, http.StatusOK, &timestamps)
+		for _, ts := range []string{timestamps.Song.CreatedAt, timestamps.Song.UpdatedAt} {
+			if !strings.HasSuffix(ts, offset) {
+				t.Errorf("GET %s: timestamp %s, want offset %s", path, ts, offset)
+			}
+		}
+		if got, _ := time.Parse(time.RFC3339Nano, timestamps.Song.CreatedAt); !got.Equal(created) {
+			t.Errorf("GET %s: CreatedAt = %s, want the instant %s", path, got, created)
+		}
+	}
+	check(fmt.Sprintf("/songs/%d", id), "Z")
+	check(fmt.Sprintf("/songs/%d?tz=UTC", id), "Z")
+	check(fmt.Sprintf("/songs/%d?tz=Europe/Moscow", id), "+03:00")
+
+	for _, tz := range []string{"Mars/Olympus", "Local"} {
+		s.do(t, "GET", fmt.Sprintf("/songs/%d?tz=%s", id, tz), nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	}
+}
+
+func TestListSongsCursor(t *testing.T) {
+	s := newTestServer(t)
+	for _, title := range []string{"One", "Two", "Three", "Four", "Five"} {
+		s.seed(t, models.Song{GroupName: "Muse", Title: title, IsPublic: true})
+	}
+	type cursorPage struct {
+		Songs      []songJSON `json:"songs"`
+		NextCursor *int64     `json:"next_cursor"`
+	}
+	fetch := func(path string) cursorPage {
+		t.Helper()
+		var page cursorPage
+		s.do(t, "GET", path, nil).decode(t, http.StatusOK, &page)
+		return page
+	}
+
+	first := fetch("/songs?limit=2")
+	if got := titles(first.Songs); got != "Five,Four" || first.NextCursor == nil || *first.NextCursor != 4 {
+		t.Fatalf("first page %s, cursor %v; want Five,Four and 4", got, first.NextCursor)
+	}
+
+	// A song added in front and one removed behind the cursor between the
+	// fetches neither repeat nor skip a song, unlike with offset=2.
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Six", IsPublic: true})
+	s.do(t, "DELETE", "/songs/3", nil)
+	if got := titles(fetch("/songs?limit=2&offset=2").Songs); got != "Four,Two" {
+		t.Errorf("offset page = %s, want the shifted Four,Two", got)
+	}
+	second := fetch(fmt.Sprintf("/songs?limit=2&after_id=%d", *first.NextCursor))
+	if got := titles(second.Songs); got != "Two,One" || second.NextCursor == nil || *second.NextCursor != 1 {
+		t.Fatalf("second page %s, cursor %v; want Two,One and 1", got, second.NextCursor)
+	}
+	last := fetch("/songs?limit=2&after_id=1")
+	if len(last.Songs) != 0 || last.NextCursor != nil {
+		t.Errorf("past the end: %s, cursor %v; want nothing", titles(last.Songs), last.NextCursor)
+	}
+
+	t.Run("short page", func(t *testing.T) {
+		if page := fetch("/songs?limit=5&after_id=4"); titles(page.Songs) != "Two,One" || page.NextCursor != nil {
+			t.Errorf("page %s, cursor %v; want Two,One and no cursor", titles(page.Songs), page.NextCursor)
+		}
+	})
+	t.Run("custom sort", func(t *testing.T) {
+		if page := fetch("/songs?limit=2&sort_by=title"); page.NextCursor != nil {
+			t.Errorf("cursor %v with sort_by=title, want none", *page.NextCursor)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, v := range []string{"0", "-1", "x"} {
+			s.do(t, "GET", "/songs?after_id="+v, nil).wantError(t, http.StatusBadRequest, "malformed_request")
+		}
+	})
+}
+
+func TestListSongsMapShape(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody", IsPublic: true})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "Resistance", IsPublic: true})
+
+	var resp struct {
+		Songs map[string]songJSON `json:"songs"`
+		Order []int64             `json:"order"`
+		Total int64               `json:"total"`
+	}
+	s.do(t, "GET", "/songs?shape=map&group=muse&sort_by=title&sort_dir=asc", nil).decode(t, http.StatusOK, &resp)
+	if len(resp.Songs) != 2 || resp.Songs["1"].Title != "Uprising" || resp.Songs["3"].Title != "Resistance" {
+		t.Errorf("songs = %+v, want Uprising and Resistance keyed by ID", resp.Songs)
+	}
+	if len(resp.Order) != 2 || resp.Order[0] != 3 || resp.Order[1] != 1 || resp.Total != 2 {
+		t.Errorf("order = %v, total %d; want [3 1] by title and 2", resp.Order, resp.Total)
+	}
+
+	t.Run("array by default", func(t *testing.T) {
+		for _, path := range []string{"/songs", "/songs?shape=array"} {
+			var list songsResponse
+			s.do(t, "GET", path, nil).decode(t, http.StatusOK, &list)
+			if len(list.Songs) != 3 {
+				t.Errorf("GET %s: %d songs, want 3 in an array", path, len(list.Songs))
+			}
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		raw := s.do(t, "GET", "/songs?shape=map&group=abba", nil)
+		if raw.status != http.StatusOK || !strings.HasPrefix(string(raw.body), `{"songs":{},"order":[],"total":0`) {
+			t.Errorf("got %d %s, want an empty object and order", raw.status, raw.body)
+		}
+	})
+	t.Run("unknown shape", func(t *testing.T) {
+		s.do(t, "GET", "/songs?shape=tree", nil).wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestCreateSongIdempotencyKey(t *testing.T) {
+	store := memory.NewIdempotencyStore()
+	s := newTestServer(t, withServiceOptions(service.WithIdempotencyStore(store)))
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Text: "lyrics"})
+	body := map[string]string{"group": "Muse", "song": "Uprising"}
+
+	var first, retry endpoints.CreateSongResponse
+	s.do(t, "POST", "/songs", body, "Idempotency-Key", "abc").decode(t, http.StatusCreated, &first)
+	s.do(t, "POST", "/songs", body, "Idempotency-Key", "abc").decode(t, http.StatusCreated, &retry)
+	if retry.ID != first.ID {
+		t.Errorf("retry created song %d, want the original %d", retry.ID, first.ID)
+	}
+	if n := s.count(t); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+	if n := s.client.Calls(); n != 1 {
+		t.Errorf("external API called %d times, want once", n)
+	}
+
+	t.Run("without a key", func(t *testing.T) {
+		s.do(t, "POST", "/songs", body).wantError(t, http.StatusConflict, "conflict")
+	})
+	t.Run("in flight", func(t *testing.T) {
+		if _, err := store.ReserveKey(context.Background(), "busy"); err != nil {
+			t.Fatal(err)
+		}
+		s.do(t, "POST", "/songs", map[string]string{"group": "Muse", "song": "Starlight"}, "Idempotency-Key", "busy").
+			wantError(t, http.StatusConflict, "conflict")
+		if n := s.count(t); n != 1 {
+			t.Errorf("%d songs stored, want the in-flight retry to store nothing", n)
+		}
+	})
+}
+
+func TestCreateSongOnConflict(t *testing.T) {
+	s := newTestServer(t)
+	s.client.SetSong("Muse", "Starlight", service.SongInfo{Text: "lyrics"})
+	id := s.seed(t, models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com/uprising", IsPublic: true})
+
+	var resp struct {
+		ID   int64     `json:"id"`
+		Song *songJSON `json:"song"`
+	}
+	s.do(t, "POST", "/songs?onConflict=return", map[string]string{"group": "Muse", "song": "Uprising"}).decode(t, http.StatusOK, &resp)
+	if resp.ID != id || resp.Song == nil || resp.Song.Link != "https://example.com/uprising" {
+		t.Errorf("got %+v, want the existing song %d", resp, id)
+	}
+	if n := s.count(t); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+
+	t.Run("new song", func(t *testing.T) {
+		var created struct {
+			ID   int64     `json:"id"`
+			Song *songJSON `json:"song"`
+		}
+		s.do(t, "POST", "/songs?onConflict=return", map[string]string{"group": "Muse", "song": "Starlight"}).decode(t, http.StatusCreated, &created)
+		if created.ID == id || created.Song != nil {
+			t.Errorf("got %+v, want a new song's ID", created)
+		}
+	})
+	t.Run("private song", func(t *testing.T) {
+		private := s.seed(t, models.Song{GroupName: "Muse", Title: "Hidden", Text: "secret"})
+		body := map[string]string{"group": "Muse", "song": "Hidden"}
+
+		resp := s.do(t, "POST", "/songs?onConflict=return", body)
+		resp.wantError(t, http.StatusConflict, "conflict")
+		if bytes.Contains(resp.body, []byte("secret")) {
+			t.Errorf("anonymous conflict leaks the private song: %s", resp.body)
+		}
+
+		var found struct {
+			ID   int64     `json:"id"`
+			Song *songJSON `json:"song"`
+		}
+		s.do(t, "POST", "/songs?onConflict=return", body, authed...).decode(t, http.StatusOK, &found)
+		if found.ID != private || found.Song == nil || found.Song.Text == nil || *found.Song.Text != "secret" {
+			t.Errorf("authenticated: got %+v, want the private song %d", found, private)
+		}
+	})
+	t.Run("default", func(t *testing.T) {
+		s.client.SetSong("Muse", "Uprising", service.SongInfo{})
+		for _, path := range []string{"/songs", "/songs?onConflict=error"} {
+			s.do(t, "POST", path, map[string]string{"group": "Muse", "song": "Uprising"}).wantError(t, http.StatusConflict, "conflict")
+		}
+	})
+	t.Run("unknown mode", func(t *testing.T) {
+		s.do(t, "POST", "/songs?onConflict=ignore", map[string]string{"group": "Muse", "song": "Uprising"}).
+			wantError(t, http.StatusUnprocessableEntity, "validation_failed")
+	})
+}
+
+func TestListSongsAppliedFilters(t *testing.T) {
+	s := newTestServer(t)
+	s.seed(t, models.Song{GroupName: "Muse", Title: "100%", IsPublic: true, ReleaseDate: day(2010, time.May, 1)})
+	s.seed(t, models.Song{GroupName: "Muse", Title: "1000", IsPublic: true, ReleaseDate: day(2010, time.May, 1)})
+
+	var resp struct {
+		Songs          []songJSON                `json:"songs"`
+		AppliedFilters *endpoints.AppliedFilters `json:"appliedFilters"`
+	}
+	s.do(t, "GET", "/songs?title=100%25&released_after=2010-01-01T00:00:00Z&include_filters=true", nil).decode(t, http.StatusOK, &resp)
+	if got := titles(resp.Songs); got != "100%" {
+		t.Errorf("songs = %s, want only the literal match of 100%%", got)
+	}
+	want := endpoints.AppliedFilters{
+		Title:         "100%",
+		Match:         models.MatchSubstring,
+		ReleasedAfter: "2010-01-01",
+		PublicOnly:    true,
+		SortBy:        models.SortByID,
+		SortDir:       models.SortDesc,
+		Limit:         10,
+	}
+	if resp.AppliedFilters == nil || *resp.AppliedFilters != want {
+		t.Errorf("appliedFilters = %+v, want %+v", resp.AppliedFilters, want)
+	}
+
+	t.Run("explicit values", func(t *testing.T) {
+		resp.AppliedFilters = nil
+		s.do(t, "GET", "/songs?group=Muse&match=exact&sort_by=title&sort_dir=asc&limit=5&offset=1&include_filters=true", nil, authed...).
+			decode(t, http.StatusOK, &resp)
+		want := endpoints.AppliedFilters{Group: "Muse", Match: models.MatchExact, SortBy: models.SortByTitle, SortDir: models.SortAsc, Limit: 5, Offset: 1}
+		if resp.AppliedFilters == nil || *resp.AppliedFilters != want {
+			t.Errorf("appliedFilters = %+v, want %+v", resp.AppliedFilters, want)
+		}
+	})
+	t.Run("search", func(t *testing.T) {
+		resp.AppliedFilters = nil
+		s.do(t, "GET", "/songs?q=muse&include_filters=true", nil).decode(t, http.StatusOK, &resp)
+		if resp.AppliedFilters == nil || resp.AppliedFilters.Query != "muse" || resp.AppliedFilters.SortBy != "relevance" {
+			t.Errorf("appliedFilters = %+v, want ranked by relevance", resp.AppliedFilters)
+		}
+	})
+	t.Run("IDs only", func(t *testing.T) {
+		var ids struct {
+			AppliedFilters *endpoints.AppliedFilters `json:"appliedFilters"`
+		}
+		s.do(t, "GET", "/songs?fields=id&limit=3&include_filters=true", nil).decode(t, http.StatusOK, &ids)
+		if ids.AppliedFilters == nil || ids.AppliedFilters.Limit != 3 {
+			t.Errorf("appliedFilters = %+v, want limit 3", ids.AppliedFilters)
+		}
+	})
+	t.Run("off by default", func(t *testing.T) {
+		raw := s.do(t, "GET", "/songs", nil)
+		if raw.status != http.StatusOK || strings.Contains(string(raw.body), "appliedFilters") {
+			t.Errorf("got %d %s, want no appliedFilters", raw.status, raw.body)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		s.do(t, "GET", "/songs?include_filters=maybe", nil).wantError(t, http.StatusBadRequest, "malformed_request")
+	})
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"song-library-test-task/internal/handler/http/endpoints"
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+const statusAPIKey = "status-key"
+
+// statusServer serves NewHTTPHandler for the status code tests. The test
+// seeds repo directly; the service may be handed a wrapper of it.
+type statusServer struct {
+	*httptest.Server
+	repo   models.SongRepository
+	client *testutil.FakeExternalClient
+}
+
+// newStatusServer starts a server over an in-memory repository, passed to
+// the service through wrap when it is not nil.
+func newStatusServer(t *testing.T, wrap func(models.SongRepository) models.SongRepository) *statusServer {
+	t.Helper()
+	repo := memory.NewInMemorySongRepository()
+	svcRepo := repo
+	if wrap != nil {
+		svcRepo = wrap(repo)
+	}
+	client := testutil.NewFakeExternalClient()
+	svc := service.NewSongService(svcRepo, client, service.WithLogger(logger.NoopLogger{}))
+	handler := NewHTTPHandler(endpoints.MakeSongEndpoints(*svc), ServerDependencies{},
+		WithMiddleware(middleware.APIKey([]string{statusAPIKey})))
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &statusServer{Server: srv, repo: repo, client: client}
+}
+
+// seed stores a public song directly in the repository and returns its ID.
+func (s *statusServer) seed(t *testing.T, groupName, title string) int64 {
+	t.Helper()
+	id, err := s.repo.Create(context.Background(), &models.Song{GroupName: groupName, Title: title, Text: "a\n\nb", IsPublic: true})
+	if err != nil {
+		t.Fatalf("seed %q: %v", title, err)
+	}
+	return id
+}
+
+// send makes an authenticated request, JSON-encoding a non-nil body, and
+// returns the response with its body read in full.
+func (s *statusServer) send(t *testing.T, method, path string, body interface{}) (*http.Response, []byte) {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(middleware.APIKeyHeader, statusAPIKey)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// wantErrorCode checks a JSON error response with status and code.
+func wantErrorCode(t *testing.T, resp *http.Response, body []byte, status int, code string) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Errorf("%s %s: status = %d, want %d; body: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+		return
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("%s %s: Content-Type = %q, want JSON", resp.Request.Method, resp.Request.URL.Path, ct)
+	}
+	var e struct{ Code string }
+	if err := json.Unmarshal(body, &e); err != nil || e.Code != code {
+		t.Errorf("%s %s: body %s, want code %q", resp.Request.Method, resp.Request.URL.Path, body, code)
+	}
+}
+
+// dbDownRepo fails the reads and writes behind the song routes with err, as
+// a database that has gone away would.
+type dbDownRepo struct {
+	models.SongRepository
+	err error
+}
+
+func (r dbDownRepo) GetByID(context.Context, int64) (*models.Song, error) { return nil, r.err }
+
+func (r dbDownRepo) BeginTx(context.Context) (models.SongRepositoryTx, error) { return nil, r.err }
+
+func (r dbDownRepo) Create(context.Context, *models.Song) (int64, error) { return 0, r.err }
+
+func (r dbDownRepo) GetAll(context.Context, models.SongFilter, int, int) ([]models.Song, error) {
+	return nil, r.err
+}
+
+func (r dbDownRepo) Count(context.Context, models.SongFilter) (int64, error) { return 0, r.err }
+
+func withDBDown(err error) func(models.SongRepository) models.SongRepository {
+	return func(repo models.SongRepository) models.SongRepository { return dbDownRepo{repo, err} }
+}
+
+var statusUpdateBody = map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "", "link": "", "text": ""}
+
+func TestSongNotFound(t *testing.T) {
+	s := newStatusServer(t, nil)
+	s.seed(t, "Muse", "Uprising")
+
+	for _, req := range []struct {
+		method string
+		body   interface{}
+	}{
+		{"GET", nil},
+		{"PUT", statusUpdateBody},
+		{"PATCH", map[string]string{"text": "new"}},
+		{"DELETE", nil},
+	} {
+		resp, body := s.send(t, req.method, "/songs/999", req.body)
+		wantErrorCode(t, resp, body, http.StatusNotFound, "not_found")
+	}
+	if song, _ := s.repo.GetByID(context.Background(), 1); song == nil || song.Text != "a\n\nb" {
+		t.Errorf("the existing song changed: %+v", song)
+	}
+
+	t.Run("database failure is 500", func(t *testing.T) {
+		s := newStatusServer(t, withDBDown(errors.New("dial tcp: connection refused")))
+		s.seed(t, "Muse", "Uprising")
+		for _, req := range []struct {
+			method string
+			body   interface{}
+		}{
+			{"GET", nil},
+			{"PUT", statusUpdateBody},
+			{"DELETE", nil},
+		} {
+			resp, body := s.send(t, req.method, "/songs/1", req.body)
+			wantErrorCode(t, resp, body, http.StatusInternalServerError, "internal_error")
+		}
+	})
+}
+
+func TestFailedRequests(t *testing.T) {
+	s := newStatusServer(t, nil)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{})
+	s.seed(t, "Muse", "Uprising")
+	broken := newStatusServer(t, withDBDown(errors.New("connection refused")))
+	broken.client.SetSong("Muse", "Resistance", service.SongInfo{})
+	broken.seed(t, "Muse", "Uprising")
+
+	tests := []struct {
+		name   string
+		s      *statusServer
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"create external failure", s, "POST", "/songs", map[string]string{"group": "Muse", "song": "Unknown"}, http.StatusBadGateway, "external_api_error"},
+		{"create duplicate", s, "POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"}, http.StatusConflict, "conflict"},
+		{"create database failure", broken, "POST", "/songs", map[string]string{"group": "Muse", "song": "Resistance"}, http.StatusInternalServerError, "internal_error"},
+		{"update invalid", s, "PUT", "/songs/1", map[string]string{"group": "", "song": "Uprising", "releaseDate": "", "link": "", "text": ""}, http.StatusUnprocessableEntity, "validation_failed"},
+		{"update unknown", s, "PUT", "/songs/9", statusUpdateBody, http.StatusNotFound, "not_found"},
+		{"delete bad ID", s, "DELETE", "/songs/abc", nil, http.StatusBadRequest, "malformed_request"},
+		{"delete unknown", s, "DELETE", "/songs/9", nil, http.StatusNotFound, "not_found"},
+		{"list invalid", s, "GET", "/songs?limit=-1", nil, http.StatusUnprocessableEntity, "validation_failed"},
+		{"list database failure", broken, "GET", "/songs", nil, http.StatusInternalServerError, "internal_error"},
+		{"lyrics unknown", s, "GET", "/songs/9/lyrics", nil, http.StatusNotFound, "not_found"},
+		{"lyrics database failure", broken, "GET", "/songs/1/lyrics", nil, http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := tt.s.send(t, tt.method, tt.path, tt.body)
+			wantErrorCode(t, resp, body, tt.status, tt.code)
+		})
+	}
+	if n, err := s.repo.Count(context.Background(), models.SongFilter{}); err != nil || n != 1 {
+		t.Errorf("Count = %d, %v after the failures; want 1", n, err)
+	}
+}
+
+func TestSuccessStatusCodes(t *testing.T) {
+	s := newStatusServer(t, nil)
+	s.client.SetSong("Muse", "Uprising", service.SongInfo{Text: "a\n\nb"})
+	song := map[string]string{"group": "Muse", "song": "Resistance", "releaseDate": "", "link": "", "text": ""}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     interface{}
+		status   int
+		location string
+	}{
+		{"POST", "/songs", map[string]string{"group": "Muse", "song": "Uprising"}, http.StatusCreated, "/songs/1"},
+		{"PUT", "/songs", song, http.StatusCreated, "/songs/2"},
+		{"PUT", "/songs", song, http.StatusOK, ""},
+		{"GET", "/songs/1", nil, http.StatusOK, ""},
+		{"GET", "/songs", nil, http.StatusOK, ""},
+		{"GET", "/songs/1/lyrics", nil, http.StatusOK, ""},
+		{"PUT", "/songs/1", map[string]string{"group": "Muse", "song": "Uprising", "releaseDate": "", "link": "", "text": "c"}, http.StatusOK, ""},
+		{"PATCH", "/songs/1", map[string]string{"text": "d"}, http.StatusOK, ""},
+		{"DELETE", "/songs/2", nil, http.StatusNoContent, ""},
+		{"POST", "/songs/2/restore", nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		resp, body := s.send(t, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status = %d, want %d; body: %s", tt.method, tt.path, resp.StatusCode, tt.status, body)
+			continue
+		}
+		if got := resp.Header.Get("Location"); got != tt.location {
+			t.Errorf("%s %s: Location = %q, want %q", tt.method, tt.path, got, tt.location)
+		}
+		if tt.status == http.StatusNoContent {
+			if len(body) != 0 || resp.Header.Get("Content-Type") != "" {
+				t.Errorf("%s %s: body %q with Content-Type %q, want neither", tt.method, tt.path, body, resp.Header.Get("Content-Type"))
+			}
+			continue
+		}
+		if !json.Valid(body) || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			t.Errorf("%s %s: body %q with Content-Type %q, want JSON", tt.method, tt.path, body, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestEncodeJSONResponseStatus(t *testing.T) {
+	encode := func(response interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		if err := encodeJSONResponse(context.Background(), rec, response); err != nil {
+			t.Fatalf("encode %T: %v", response, err)
+		}
+		return rec
+	}
+
+	if rec := encode(endpoints.CreateSongResponse{ID: 3}); rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/songs/3" {
+		t.Errorf("create: status %d, Location %q; want 201 pointing at the song", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := encode(endpoints.DeleteSongResponse{}); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("delete: status %d, body %q; want 204 without a body", rec.Code, rec.Body)
+	}
+	if rec := encode(endpoints.UpdateSongResponse{}); rec.Code != http.StatusOK {
+		t.Errorf("update: status %d, want 200", rec.Code)
+	}
+	if rec := encode(endpoints.DeleteSongResponse{Err: models.ErrSongNotFound}); rec.Code != http.StatusNotFound {
+		t.Errorf("failed delete: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,17 @@
+package logger
+
+import "context"
+
+type traceIDKey struct{}
+
+// ContextWithTraceID returns ctx carrying the request's trace ID; each
+// transport sets it so every layer can log it.
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceIDFromContext returns the request's trace ID, or "" outside a request.
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
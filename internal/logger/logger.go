@@ -0,0 +1,115 @@
+// Package logger defines the levelled, key-value Logger the service and
+// repository layers log through, with adapters over the standard library.
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger logs a message with optional alternating key-value pairs, e.g.
+// Info("song created", "id", 42).
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Level is a log severity; messages below a StdLogger's level are dropped.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error" (case-insensitive).
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return LevelDebug, fmt.Errorf("unknown log level %q", s)
+}
+
+// StdLogger writes through the standard log package in the
+// "[LEVEL] msg key=value ..." format used across the service.
+type StdLogger struct {
+	level Level
+}
+
+// NewStdLogger returns a StdLogger dropping messages below level.
+func NewStdLogger(level Level) *StdLogger {
+	return &StdLogger{level: level}
+}
+
+func (l *StdLogger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+func (l *StdLogger) Info(msg string, keyvals ...interface{})  { l.log(LevelInfo, msg, keyvals) }
+func (l *StdLogger) Warn(msg string, keyvals ...interface{})  { l.log(LevelWarn, msg, keyvals) }
+func (l *StdLogger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+func (l *StdLogger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[" + levelNames[level] + "] " + msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		// A trailing key without a value is kept rather than dropped.
+		var val interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%+v", keyvals[i], val)
+	}
+	log.Print(b.String())
+}
+
+// With returns a Logger adding keyvals before the key-value pairs of every
+// message logged through l.
+func With(l Logger, keyvals ...interface{}) Logger {
+	return contextLogger{next: l, keyvals: keyvals}
+}
+
+type contextLogger struct {
+	next    Logger
+	keyvals []interface{}
+}
+
+func (l contextLogger) Debug(msg string, keyvals ...interface{}) {
+	l.next.Debug(msg, l.with(keyvals)...)
+}
+func (l contextLogger) Info(msg string, keyvals ...interface{}) {
+	l.next.Info(msg, l.with(keyvals)...)
+}
+func (l contextLogger) Warn(msg string, keyvals ...interface{}) {
+	l.next.Warn(msg, l.with(keyvals)...)
+}
+func (l contextLogger) Error(msg string, keyvals ...interface{}) {
+	l.next.Error(msg, l.with(keyvals)...)
+}
+
+func (l contextLogger) with(keyvals []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(l.keyvals)+len(keyvals)), l.keyvals...), keyvals...)
+}
+
+// NoopLogger discards everything; useful in tests.
+type NoopLogger struct{}
+
+func (NoopLogger) Debug(string, ...interface{}) {}
+func (NoopLogger) Info(string, ...interface{})  {}
+func (NoopLogger) Warn(string, ...interface{})  {}
+func (NoopLogger) Error(string, ...interface{}) {}
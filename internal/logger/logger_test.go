@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger into a buffer for the rest of the
+// test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	flags, out := log.Flags(), log.Writer()
+	log.SetFlags(0)
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetFlags(flags)
+		log.SetOutput(out)
+	})
+	return &buf
+}
+
+func TestStdLogger(t *testing.T) {
+	buf := captureLog(t)
+	l := NewStdLogger(LevelInfo)
+
+	l.Debug("dropped", "id", 1)
+	l.Info("song created", "id", 42, "title", "Uprising")
+	l.Warn("odd keyvals", "id")
+	l.Error("nil values", "err", nil, "song", (*struct{ Title string })(nil))
+
+	want := "[INFO] song created id=42 title=Uprising\n" +
+		"[WARN] odd keyvals id=(MISSING)\n" +
+		"[ERROR] nil values err=<nil> song=<nil>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("logged:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "Warn": LevelWarn, "error": LevelError} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
+
+func TestWith(t *testing.T) {
+	buf := captureLog(t)
+	base := With(NewStdLogger(LevelDebug), "trace_id", "abc")
+
+	base.Debug("first", "id", 1)
+	base.Info("second")
+	With(base, "song", 7).Warn("third", "id", 2)
+
+	want := "[DEBUG] first trace_id=abc id=1\n" +
+		"[INFO] second trace_id=abc\n" +
+		"[WARN] third trace_id=abc song=7 id=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("logged:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNoopLogger(t *testing.T) {
+	buf := captureLog(t)
+	var l Logger = NoopLogger{}
+	l.Debug("a", nil)
+	l.Info("b", "k", nil)
+	l.Warn("c", nil, nil)
+	l.Error("d")
+	With(l, "trace_id", nil).Error("e", "err", nil)
+	if strings.TrimSpace(buf.String()) != "" {
+		t.Errorf("NoopLogger wrote %q", buf.String())
+	}
+}
+
+func TestTraceIDFromContext(t *testing.T) {
+	if id := TraceIDFromContext(context.Background()); id != "" {
+		t.Errorf("TraceIDFromContext outside a request = %q, want empty", id)
+	}
+	if id := TraceIDFromContext(ContextWithTraceID(context.Background(), "req-42")); id != "req-42" {
+		t.Errorf("TraceIDFromContext = %q, want req-42", id)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+// APIKeyHeader is the request header carrying the client's API key.
+const APIKeyHeader = "X-API-Key"
+
+type authenticatedKey struct{}
+
+// APIKey marks requests presenting one of the given keys as authenticated.
+// Requests without a valid key are passed through unchanged; handlers decide
+// what unauthenticated callers may do via IsAuthenticated.
+func APIKey(keys []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(Authenticate(r.Context(), r.Header.Get(APIKeyHeader), keys)))
+		})
+	}
+}
+
+// Authenticate returns ctx marked as authenticated when key is one of keys,
+// and ctx unchanged otherwise. It lets transports other than HTTP apply the
+// same API keys.
+func Authenticate(ctx context.Context, key string, keys []string) context.Context {
+	if key == "" || !validKey(key, keys) {
+		return ctx
+	}
+	return context.WithValue(ctx, authenticatedKey{}, true)
+}
+
+// IsAuthenticated reports whether the request presented a valid API key.
+func IsAuthenticated(ctx context.Context) bool {
+	ok, _ := ctx.Value(authenticatedKey{}).(bool)
+	return ok
+}
+
+func validKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return true
+		}
+	}
+	return false
+}
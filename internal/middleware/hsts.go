@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HSTS sets a Strict-Transport-Security header on every response so browsers
+// only reach the server over HTTPS for maxAge. Only install it when the server
+// itself terminates TLS. A non-positive maxAge disables the header.
+func HSTS(maxAge time.Duration, includeSubDomains bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxAge <= 0 {
+			return next
+		}
+		value := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		if includeSubDomains {
+			value += "; includeSubDomains"
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
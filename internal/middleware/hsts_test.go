@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHSTS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name              string
+		maxAge            time.Duration
+		includeSubDomains bool
+		want              string
+	}{
+		{"max-age", 24 * time.Hour, false, "max-age=86400"},
+		{"with subdomains", time.Hour, true, "max-age=3600; includeSubDomains"},
+		{"disabled", 0, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HSTS(tt.maxAge, tt.includeSubDomains)(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/songs", nil))
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.want {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
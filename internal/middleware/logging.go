@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"song-library-test-task/internal/logger"
+)
+
+// NewLoggingMiddleware returns an endpoint middleware logging every call
+// with its endpoint name (see WithEndpointName), outcome, duration and trace
+// ID (see TraceID). Calls taking longer than slow are logged as warnings with
+// slow=true and counted in <namespace>_http_slow_requests_total{endpoint};
+// the others are logged at debug level. A zero slow disables the check.
+func NewLoggingMiddleware(log logger.Logger, namespace string, slow time.Duration) endpoint.Middleware {
+	slowRequests := register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_slow_requests_total",
+		Help:      "Number of requests slower than the slow-request threshold, by endpoint.",
+	}, []string{"endpoint"}))
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(start time.Time) {
+				name := EndpointName(ctx)
+				took := time.Since(start)
+				keyvals := []interface{}{"endpoint", name, "status", outcome(response, err), "duration", took}
+				if id := logger.TraceIDFromContext(ctx); id != "" {
+					keyvals = append(keyvals, "trace_id", id)
+				}
+				if slow > 0 && took > slow {
+					slowRequests.WithLabelValues(name).Inc()
+					log.Warn("request", append(keyvals, "slow", true)...)
+					return
+				}
+				log.Debug("request", keyvals...)
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
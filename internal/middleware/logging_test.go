@@ -0,0 +1,71 @@
+// The test is external because testutil depends on the service package,
+// which imports middleware.
+package middleware_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/middleware"
+	"song-library-test-task/internal/testutil"
+)
+
+func TestLoggingMiddlewareSlowRequests(t *testing.T) {
+	log := &testutil.RecordingLogger{}
+	mw := middleware.NewLoggingMiddleware(log, "logging_test", 20*time.Millisecond)
+	fast := mw(func(context.Context, interface{}) (interface{}, error) { return "song", nil })
+	slow := mw(func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "song", nil
+	})
+
+	ctx := logger.ContextWithTraceID(middleware.WithEndpointName(context.Background(), "GetSong"), "trace-1")
+	fast(ctx, nil)
+	slow(ctx, nil)
+
+	entries := log.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d messages, want 2", len(entries))
+	}
+	if e := entries[0]; e.Level != logger.LevelDebug {
+		t.Errorf("fast request logged at %v, want debug", e.Level)
+	} else if _, ok := e.Value("slow"); ok {
+		t.Errorf("fast request tagged slow: %v", e.Keyvals)
+	}
+	e := entries[1]
+	if v, _ := e.Value("slow"); e.Level != logger.LevelWarn || v != true {
+		t.Errorf("slow request logged at %v with %v, want a warning with slow=true", e.Level, e.Keyvals)
+	}
+	if v, _ := e.Value("trace_id"); v != "trace-1" {
+		t.Errorf("trace_id = %v", v)
+	}
+	if v, _ := e.Value("duration"); v.(time.Duration) < 50*time.Millisecond {
+		t.Errorf("duration = %v", v)
+	}
+
+	want := `
+# HELP logging_test_http_slow_requests_total Number of requests slower than the slow-request threshold, by endpoint.
+# TYPE logging_test_http_slow_requests_total counter
+logging_test_http_slow_requests_total{endpoint="GetSong"} 1
+`
+	if err := promtest.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "logging_test_http_slow_requests_total"); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		log := &testutil.RecordingLogger{}
+		middleware.NewLoggingMiddleware(log, "logging_test", 0)(func(context.Context, interface{}) (interface{}, error) {
+			time.Sleep(30 * time.Millisecond)
+			return nil, nil
+		})(ctx, nil)
+		if _, ok := log.Find(logger.LevelWarn, "request"); ok {
+			t.Error("slow request flagged with the check disabled")
+		}
+	})
+}
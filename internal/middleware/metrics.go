@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type endpointNameKey struct{}
+
+// WithEndpointName returns ctx carrying the name endpoint middlewares report
+// the call under.
+func WithEndpointName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointNameKey{}, name)
+}
+
+// EndpointName returns the name set by WithEndpointName, or "unknown".
+func EndpointName(ctx context.Context) string {
+	if name, ok := ctx.Value(endpointNameKey{}).(string); ok {
+		return name
+	}
+	return "unknown"
+}
+
+// NewMetricsMiddleware returns an endpoint middleware recording
+// <namespace>_http_requests_total{endpoint,status} and
+// <namespace>_http_request_duration_seconds{endpoint} in the default
+// Prometheus registry. status is "success", or "error" when the endpoint
+// fails or its response reports a failure. The endpoint label comes from
+// WithEndpointName.
+func NewMetricsMiddleware(namespace string) endpoint.Middleware {
+	requests := register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of requests by endpoint and outcome.",
+	}, []string{"endpoint", "status"}))
+	duration := register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Request latency by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"}))
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(start time.Time) {
+				name := EndpointName(ctx)
+				requests.WithLabelValues(name, outcome(response, err)).Inc()
+				duration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+
+// outcome is "success", or "error" when the endpoint failed or its response
+// reports a failure.
+func outcome(response interface{}, err error) string {
+	if err != nil {
+		return "error"
+	}
+	if f, ok := response.(interface{ Failed() error }); ok && f.Failed() != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// register registers c with the default registry, returning the collector
+// already registered under the same name if there is one, so building the
+// middleware twice does not panic.
+func register[C prometheus.Collector](c C) C {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
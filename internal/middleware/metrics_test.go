@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// failedResponse is an endpoint response reporting a business failure.
+type failedResponse struct{ err error }
+
+func (r failedResponse) Failed() error { return r.err }
+
+func TestMetricsMiddleware(t *testing.T) {
+	mw := NewMetricsMiddleware("metrics_test")
+	ok := mw(func(context.Context, interface{}) (interface{}, error) { return "song", nil })
+	failed := mw(func(context.Context, interface{}) (interface{}, error) {
+		return failedResponse{errors.New("not found")}, nil
+	})
+	broken := mw(func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("boom") })
+
+	ctx := WithEndpointName(context.Background(), "GetSong")
+	for i := 0; i < 2; i++ {
+		ok(ctx, nil)
+	}
+	failed(ctx, nil)
+	broken(WithEndpointName(context.Background(), "DeleteSong"), nil)
+	ok(context.Background(), nil)
+
+	want := `
+# HELP metrics_test_http_requests_total Number of requests by endpoint and outcome.
+# TYPE metrics_test_http_requests_total counter
+metrics_test_http_requests_total{endpoint="DeleteSong",status="error"} 1
+metrics_test_http_requests_total{endpoint="GetSong",status="error"} 1
+metrics_test_http_requests_total{endpoint="GetSong",status="success"} 2
+metrics_test_http_requests_total{endpoint="unknown",status="success"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "metrics_test_http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(durationCollector(t, "metrics_test"), "metrics_test_http_request_duration_seconds"); n != 3 {
+		t.Errorf("%d duration series, want one per endpoint name", n)
+	}
+
+	t.Run("built twice", func(t *testing.T) {
+		again := NewMetricsMiddleware("metrics_test")(func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		again(ctx, nil)
+		want := strings.Replace(want, `status="success"} 2`, `status="success"} 3`, 1)
+		if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "metrics_test_http_requests_total"); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// durationCollector returns the latency histogram registered for namespace.
+func durationCollector(t *testing.T, namespace string) prometheus.Collector {
+	t.Helper()
+	err := prometheus.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Request latency by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"}))
+	var are prometheus.AlreadyRegisteredError
+	if !errors.As(err, &are) {
+		t.Fatalf("latency histogram not registered: %v", err)
+	}
+	return are.ExistingCollector
+}
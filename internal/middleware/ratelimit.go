@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Rate limit headers set on every response while the limiter is enabled.
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// Rate limiting modes: one bucket shared by all clients, or one per client IP.
+const (
+	RateLimitModeGlobal = "global"
+	RateLimitModeIP     = "ip"
+)
+
+// ipLimiterIdleTTL is how long a client's bucket is kept after its last
+// request; the bucket of a client idle that long is full again anyway.
+const ipLimiterIdleTTL = 5 * time.Minute
+
+// RateLimit admits requests through a single token bucket refilled at rps
+// tokens per second and holding up to burst tokens. Every response carries
+// the bucket size, the tokens left after this request and the seconds until
+// the bucket is full again, so clients can throttle themselves; requests
+// arriving at an empty bucket get 429 Too Many Requests with Retry-After.
+// A non-positive rps disables limiting.
+func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		limiter := rate.NewLimiter(rate.Limit(rps), burst)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			admit(w, r, next, limiter, rps, burst)
+		})
+	}
+}
+
+// RateLimitPerIP is RateLimit with a separate bucket per client IP, taken
+// from the connection's remote address (X-Forwarded-For is not trusted), so
+// one busy client cannot use up the others' budget. Buckets idle for
+// ipLimiterIdleTTL are evicted by a background goroutine, which runs for the
+// life of the process.
+func RateLimitPerIP(rps float64, burst int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		var clients sync.Map // client IP -> *ipLimiter
+		go evictIdleLimiters(&clients, ipLimiterIdleTTL)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			v, ok := clients.Load(ip)
+			if !ok {
+				v, _ = clients.LoadOrStore(ip, &ipLimiter{limiter: rate.NewLimiter(rate.Limit(rps), burst)})
+			}
+			l := v.(*ipLimiter)
+			l.lastSeen.Store(time.Now().UnixNano())
+			admit(w, r, next, l.limiter, rps, burst)
+		})
+	}
+}
+
+// ipLimiter is the bucket of one client and the time of its last request.
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64
+}
+
+// evictIdleLimiters removes, every ttl, the buckets of clients idle for
+// longer than ttl.
+func evictIdleLimiters(clients *sync.Map, ttl time.Duration) {
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-ttl).UnixNano()
+		clients.Range(func(key, v interface{}) bool {
+			if v.(*ipLimiter).lastSeen.Load() < cutoff {
+				clients.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admit takes a token from limiter for the request, sets the rate limit
+// headers and either serves the request or answers 429.
+func admit(w http.ResponseWriter, r *http.Request, next http.Handler, limiter *rate.Limiter, rps float64, burst int) {
+	allowed := limiter.Allow()
+	tokens := limiter.Tokens()
+
+	h := w.Header()
+	h.Set(RateLimitLimitHeader, strconv.Itoa(burst))
+	h.Set(RateLimitRemainingHeader, strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+	h.Set(RateLimitResetHeader, strconv.Itoa(int(math.Ceil((float64(burst)-tokens)/rps))))
+
+	if !allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/rps))))
+		h.Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"code":"rate_limited","message":"rate limit exceeded"}` + "\n"))
+		return
+	}
+	next.ServeHTTP(w, r)
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(1, 3)(ok)
+
+	// Each request takes a token; the bucket refills one token per second.
+	for i, want := range []struct{ remaining, reset string }{{"2", "1"}, {"1", "2"}, {"0", "3"}} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/songs", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+		h := rec.Header()
+		if h.Get(RateLimitLimitHeader) != "3" || h.Get(RateLimitRemainingHeader) != want.remaining || h.Get(RateLimitResetHeader) != want.reset {
+			t.Errorf("request %d: limit = %q, remaining = %q, reset = %q; want 3, %s, %s", i+1,
+				h.Get(RateLimitLimitHeader), h.Get(RateLimitRemainingHeader), h.Get(RateLimitResetHeader), want.remaining, want.reset)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/songs", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the burst: status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get(RateLimitRemainingHeader) != "0" || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the burst: remaining = %q, Retry-After = %q; want 0, 1",
+			rec.Header().Get(RateLimitRemainingHeader), rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get(RateLimitResetHeader) != "3" {
+		t.Errorf("over the burst: reset = %q, want 3", rec.Header().Get(RateLimitResetHeader))
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		RateLimit(0, 3)(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/songs", nil))
+		if rec.Header().Get(RateLimitLimitHeader) != "" {
+			t.Errorf("headers set with the limiter disabled: %v", rec.Header())
+		}
+	})
+}
+
+// fire sends n concurrent requests, from remoteAddr, through h and returns how
+// many were admitted and how many got 429 with a Retry-After header.
+func fire(t *testing.T, h http.Handler, n int, remoteAddr string) (admitted, limited int) {
+	t.Helper()
+	var ok, tooMany, other atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/songs", nil)
+			r.RemoteAddr = remoteAddr
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			switch {
+			case rec.Code == http.StatusOK:
+				ok.Add(1)
+			case rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "":
+				tooMany.Add(1)
+			default:
+				other.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if other.Load() != 0 {
+		t.Errorf("%d responses were neither 200 nor 429 with Retry-After", other.Load())
+	}
+	return int(ok.Load()), int(tooMany.Load())
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	admitted, limited := fire(t, RateLimit(10, 50)(ok), 200, "192.0.2.1:1234")
+	if limited == 0 || admitted < 50 || admitted > 55 {
+		t.Errorf("admitted %d and limited %d of 200, want about the burst of 50 admitted", admitted, limited)
+	}
+}
+
+func TestRateLimitPerIP(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RateLimitPerIP(10, 50)(ok)
+
+	admitted, limited := fire(t, h, 200, "192.0.2.1:1234")
+	if limited == 0 || admitted < 50 || admitted > 55 {
+		t.Errorf("admitted %d and limited %d of 200, want about the burst of 50 admitted", admitted, limited)
+	}
+	// Another port of the same host shares its bucket; another host does not.
+	if admitted, _ := fire(t, h, 1, "192.0.2.1:4321"); admitted != 0 {
+		t.Error("a new connection from the exhausted client was admitted")
+	}
+	if admitted, limited := fire(t, h, 50, "198.51.100.7:1234"); admitted != 50 || limited != 0 {
+		t.Errorf("other client: admitted %d, limited %d; want its own full burst", admitted, limited)
+	}
+}
+
+func TestEvictIdleLimiters(t *testing.T) {
+	var clients sync.Map
+	idle, busy := &ipLimiter{limiter: rate.NewLimiter(1, 1)}, &ipLimiter{limiter: rate.NewLimiter(1, 1)}
+	idle.lastSeen.Store(time.Now().Add(-time.Hour).UnixNano())
+	busy.lastSeen.Store(time.Now().Add(time.Hour).UnixNano())
+	clients.Store("192.0.2.1", idle)
+	clients.Store("198.51.100.7", busy)
+
+	go evictIdleLimiters(&clients, 10*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := clients.Load("192.0.2.1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the idle client's bucket was not evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := clients.Load("198.51.100.7"); !ok {
+		t.Error("the busy client's bucket was evicted")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	for addr, want := range map[string]string{
+		"192.0.2.1:1234": "192.0.2.1",
+		"[::1]:8080":     "::1",
+		"unix-socket":    "unix-socket",
+	} {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("X-Forwarded-For", "203.0.113.9")
+		if got := clientIP(r); got != want {
+			t.Errorf("clientIP(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
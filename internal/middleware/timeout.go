@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader lets trusted clients request a longer deadline, in milliseconds.
+const TimeoutHeader = "X-Request-Timeout-Ms"
+
+// Timeout bounds every request's context by defaultTimeout. Authenticated
+// clients (see APIKey) may override it with the X-Request-Timeout-Ms header,
+// clamped to maxTimeout; the header is ignored for everyone else.
+func Timeout(defaultTimeout, maxTimeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := requestTimeout(r, defaultTimeout, maxTimeout)
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func requestTimeout(r *http.Request, defaultTimeout, maxTimeout time.Duration) time.Duration {
+	if !IsAuthenticated(r.Context()) {
+		return defaultTimeout
+	}
+	ms, err := strconv.ParseInt(r.Header.Get(TimeoutHeader), 10, 64)
+	if err != nil || ms <= 0 {
+		return defaultTimeout
+	}
+	timeout := time.Duration(ms) * time.Millisecond
+	if timeout > maxTimeout {
+		return maxTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	const (
+		defaultTimeout = time.Second
+		maxTimeout     = 10 * time.Second
+	)
+	var remaining time.Duration
+	handler := APIKey([]string{"secret"})(Timeout(defaultTimeout, maxTimeout)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok := r.Context().Deadline()
+			if !ok {
+				t.Fatal("request context has no deadline")
+			}
+			remaining = time.Until(deadline)
+		})))
+
+	tests := []struct {
+		name    string
+		key     string
+		timeout string
+		want    time.Duration
+	}{
+		{"no header", "secret", "", defaultTimeout},
+		{"trusted override", "secret", "3000", 3 * time.Second},
+		{"clamped to the maximum", "secret", "60000", maxTimeout},
+		{"not a number", "secret", "soon", defaultTimeout},
+		{"not positive", "secret", "0", defaultTimeout},
+		{"ignored without a key", "", "3000", defaultTimeout},
+		{"ignored with a wrong key", "guess", "3000", defaultTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/songs", nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.timeout != "" {
+				req.Header.Set(TimeoutHeader, tt.timeout)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if remaining > tt.want || remaining < tt.want-100*time.Millisecond {
+				t.Errorf("deadline in %v, want about %v", remaining, tt.want)
+			}
+		})
+	}
+}
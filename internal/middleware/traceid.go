@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"song-library-test-task/internal/logger"
+)
+
+// TraceIDHeader carries the request's trace ID. A valid incoming value is
+// reused, so a caller's ID follows the request through the logs; the ID is
+// always echoed back in the response.
+const TraceIDHeader = "X-Request-ID"
+
+// maxTraceIDLength bounds client-supplied trace IDs.
+const maxTraceIDLength = 128
+
+// TraceID stores a trace ID in the request context, taken from the
+// X-Request-ID header or generated (see logger.ContextWithTraceID), and sets
+// it on the response.
+func TraceID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(TraceIDHeader)
+		if !validTraceID(id) {
+			id = NewTraceID()
+		}
+		w.Header().Set(TraceIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.ContextWithTraceID(r.Context(), id)))
+	})
+}
+
+// NewTraceID returns a random version 4 UUID.
+func NewTraceID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// validTraceID accepts non-empty printable ASCII IDs of bounded length, so a
+// client cannot inject line breaks or huge values into the logs.
+func validTraceID(id string) bool {
+	if id == "" || len(id) > maxTraceIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"song-library-test-task/internal/logger"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestTraceID(t *testing.T) {
+	var seen string
+	h := TraceID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logger.TraceIDFromContext(r.Context())
+	}))
+	serve := func(header string) string {
+		seen = ""
+		r := httptest.NewRequest("GET", "/songs", nil)
+		if header != "" {
+			r.Header.Set(TraceIDHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		got := rec.Header().Get(TraceIDHeader)
+		if got != seen {
+			t.Errorf("response %s = %q, but the context carried %q", TraceIDHeader, got, seen)
+		}
+		return got
+	}
+
+	if got := serve("req-42"); got != "req-42" {
+		t.Errorf("incoming ID echoed as %q, want req-42", got)
+	}
+	for _, header := range []string{"", "two words", "line\nbreak", strings.Repeat("x", maxTraceIDLength+1)} {
+		if got := serve(header); !uuidV4.MatchString(got) {
+			t.Errorf("ID for header %q = %q, want a generated UUID", header, got)
+		}
+	}
+	if a, b := serve(""), serve(""); a == b {
+		t.Errorf("generated the same ID %q twice", a)
+	}
+}
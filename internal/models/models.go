@@ -2,31 +2,271 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum lengths (in characters) of the song's natural key fields.
+// They match the VARCHAR constraints on the songs table.
+const (
+	MaxGroupNameLength = 512
+	MaxTitleLength     = 512
+)
+
+var (
+	// ErrValidation is returned (wrapped) when the input violates a business rule.
+	ErrValidation = errors.New("validation failed")
+	// ErrPageOutOfRange is returned (wrapped) for a list page whose limit is
+	// not between 1 and the maximum page size or whose offset is negative.
+	// It is a validation error.
+	ErrPageOutOfRange = fmt.Errorf("%w: page out of range", ErrValidation)
+	// ErrSongNotFound is returned when the requested song does not exist.
+	ErrSongNotFound = errors.New("song not found")
+	// ErrVerseNotFound is returned (wrapped) when a song has no verse with
+	// the requested number.
+	ErrVerseNotFound = errors.New("verse not found")
+	// ErrDeleted is returned (wrapped) when the requested song exists but
+	// has been soft-deleted.
+	ErrDeleted = errors.New("song deleted")
+	// ErrDuplicateSong is returned (wrapped) when a song with the same group
+	// and title already exists.
+	ErrDuplicateSong = errors.New("song already exists")
+	// ErrRequestInProgress is returned when a request with the same
+	// idempotency key has not completed yet.
+	ErrRequestInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrUnauthorized is returned when the caller must be authenticated.
+	ErrUnauthorized = errors.New("authentication required")
+	// ErrExternalAPI is returned (wrapped) when the external music API fails.
+	ErrExternalAPI = errors.New("external API error")
+	// ErrCircuitOpen is returned (wrapped) when calls to the external music
+	// API are short-circuited because it has been failing.
+	ErrCircuitOpen = errors.New("external API unavailable: circuit open")
 )
 
 // Song represents the song info (business entity)
 type Song struct {
-	ID          int64
-	GroupName   string
-	Title       string
-	ReleaseDate string
+	ID        int64
+	GroupName string
+	Title     string
+	// ReleaseDate is the release day (UTC midnight); zero when unknown.
+	ReleaseDate time.Time
 	Link        string
 	Text        string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	IsPublic    bool
+	// EnrichedAt is when external metadata was last fetched successfully;
+	// zero when the song has never been enriched.
+	EnrichedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Match modes for SongFilter.
+const (
+	MatchSubstring = "substring"
+	MatchExact     = "exact"
+)
+
+// Sort columns and directions for SongFilter.
+const (
+	SortByID          = "id"
+	SortByTitle       = "title"
+	SortByGroupName   = "group_name"
+	SortByReleaseDate = "release_date"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ReleaseDateLayout is the format release dates are rendered in.
+const ReleaseDateLayout = "2006-01-02"
+
+// releaseDateLayouts are the release date formats accepted from the external
+// API and the database, tried in order.
+var releaseDateLayouts = []string{
+	ReleaseDateLayout,
+	time.RFC3339,
+	"02.01.2006",
+}
+
+// ParseReleaseDate parses a release date in any of the known formats and
+// returns the calendar day it names as UTC midnight.
+// It reports false for empty or unrecognised values.
+func ParseReleaseDate(value string) (time.Time, bool) {
+	for _, layout := range releaseDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
 }
 
 // SongFilter is used to filter the results in GetAll (list) calls.
+// An empty GroupName or Title means "no filter on that field" in every match
+// mode; in particular exact mode never matches songs with an empty value.
 type SongFilter struct {
 	GroupName string
 	Title     string
+	// Match is MatchSubstring (the default when empty) or MatchExact.
+	Match string
+	// PublicOnly restricts the results to public songs.
+	PublicOnly bool
+	// ReleasedAfter and ReleasedBefore bound the release date (inclusive);
+	// the zero value leaves that end unbounded. Songs without a release date
+	// never match a bounded range.
+	ReleasedAfter  time.Time
+	ReleasedBefore time.Time
+	// SortBy is one of the SortBy* columns (SortByID when empty) and SortDir
+	// SortAsc or SortDesc (the default). Ties are broken by ID in the same
+	// direction; songs without a release date sort last.
+	SortBy  string
+	SortDir string
+	// SearchQuery, when set, keeps only songs whose group, title or lyrics
+	// contain every word of it (English stemming, as plainto_tsquery); the
+	// results are then ranked by relevance unless SortBy is set.
+	SearchQuery string
+	// AfterID, when positive, keeps only songs with a lower ID: the keyset
+	// cursor continuing a list in the default newest-first ID order, used
+	// instead of an offset.
+	AfterID int64
+}
+
+// HasCriteria reports whether the filter narrows the results by any field.
+// Visibility and match mode alone do not count.
+func (f SongFilter) HasCriteria() bool {
+	return f.GroupName != "" || f.Title != "" || f.SearchQuery != "" ||
+		!f.ReleasedAfter.IsZero() || !f.ReleasedBefore.IsZero()
+}
+
+// Orderings for lyrics search results.
+const (
+	SearchOrderRelevance   = "relevance"
+	SearchOrderReleaseDate = "release_date"
+	SearchOrderGroup       = "group"
+)
+
+// LyricsSearch describes a full-text search within song lyrics.
+type LyricsSearch struct {
+	// Query is matched against the lyrics as plain words.
+	Query string
+	// Order is one of the SearchOrder* values.
+	Order string
+	// PublicOnly restricts the results to public songs.
+	PublicOnly bool
+}
+
+// IndexOther is the alphabetical index bucket of titles that do not start
+// with a letter (digits, punctuation, ...).
+const IndexOther = "#"
+
+// IndexLetter returns the alphabetical index bucket of title: its first
+// character upper-cased if that is a letter, IndexOther otherwise.
+func IndexLetter(title string) string {
+	if r, _ := utf8.DecodeRuneInString(title); unicode.IsLetter(r) {
+		return string(unicode.ToUpper(r))
+	}
+	return IndexOther
+}
+
+// GroupCount is a group name together with the number of songs it has.
+type GroupCount struct {
+	GroupName string
+	SongCount int64
+}
+
+// SongKey is the natural key of a song: its group and title.
+type SongKey struct {
+	GroupName string
+	Title     string
+}
+
+// SongMetadata is curated metadata for the songs with Key's exact group and
+// title. Zero fields leave the stored values unchanged.
+type SongMetadata struct {
+	Key         SongKey
+	ReleaseDate time.Time
+	Link        string
+	Text        string
+}
+
+// Outcomes of applying a SongMetadata.
+const (
+	MetadataUnmatched = "unmatched"
+	// MetadataUnchanged means a song matched but already had the values.
+	MetadataUnchanged = "unchanged"
+	MetadataUpdated   = "updated"
+)
+
+// Operations recorded in a song's history.
+const (
+	HistoryCreate = "create"
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+)
+
+// HistoryEntry is one recorded mutation of a song: the operation and the song
+// as it was right after it, or, for a delete, as it was when deleted.
+type HistoryEntry struct {
+	Operation  string
+	OccurredAt time.Time
+	Snapshot   Song
 }
 
 type SongRepository interface {
 	Create(ctx context.Context, song *Song) (int64, error)
+	Upsert(ctx context.Context, song *Song) (int64, bool, error)
+	CreateBatch(ctx context.Context, songs []Song) ([]int64, error)
 	GetByID(ctx context.Context, id int64) (*Song, error)
+	GetByGroupAndTitle(ctx context.Context, groupName, title string) (*Song, error)
+	FindIDs(ctx context.Context, keys []SongKey, publicOnly bool) ([]int64, error)
 	GetAll(ctx context.Context, filter SongFilter, limit, offset int) ([]Song, error)
+	Count(ctx context.Context, filter SongFilter) (int64, error)
+	EachSong(ctx context.Context, filter SongFilter, limit int, fn func(Song) error) error
+	GetIDs(ctx context.Context, filter SongFilter, limit, offset int) ([]int64, error)
+	GetIncompleteByGroup(ctx context.Context, groupName string) ([]Song, error)
+	GetRecent(ctx context.Context, publicOnly bool, limit int) ([]Song, error)
+	GetSameReleaseDate(ctx context.Context, id int64, publicOnly bool, limit, offset int) ([]Song, error)
+	ReleaseYears(ctx context.Context, publicOnly bool) ([]int, error)
+	SearchLyrics(ctx context.Context, search LyricsSearch, limit, offset int) ([]Song, error)
+	GetByIndexLetter(ctx context.Context, letter string, publicOnly bool, limit, offset int) ([]Song, error)
+	IndexLetters(ctx context.Context, publicOnly bool) ([]string, error)
 	Update(ctx context.Context, song *Song) error
+	SetVisibility(ctx context.Context, id int64, public bool) error
+	MarkEnriched(ctx context.Context, id int64) error
 	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+	HardDelete(ctx context.Context, id int64) error
+	Merge(ctx context.Context, target *Song, sourceID int64) error
+	ApplyMetadata(ctx context.Context, items []SongMetadata) ([]string, error)
+	SuggestGroups(ctx context.Context, prefix string, publicOnly bool, limit int, withCounts bool) ([]GroupCount, error)
+	ListGroupsPaged(ctx context.Context, prefix string, publicOnly bool, limit, offset int) ([]GroupCount, int64, error)
+	History(ctx context.Context, songID int64, limit, offset int) ([]HistoryEntry, int64, error)
+	DeleteHistoryBefore(ctx context.Context, before time.Time) (int64, error)
+	BeginTx(ctx context.Context) (SongRepositoryTx, error)
+}
+
+// SongRepositoryTx is a SongRepository whose methods run in one transaction.
+// Nothing is visible to others until Commit; Rollback after Commit is a
+// no-op error, so it can be deferred.
+type SongRepositoryTx interface {
+	SongRepository
+	Commit() error
+	Rollback() error
+}
+
+// IdempotencyStore records which song each client-supplied idempotency key
+// created, so a retried create returns the original song.
+type IdempotencyStore interface {
+	// ReserveKey claims key for a new request and returns 0, or returns the
+	// ID of the song an earlier request with the key created. It fails with
+	// ErrRequestInProgress while that earlier request is still running.
+	ReserveKey(ctx context.Context, key string) (int64, error)
+	// CompleteKey records the song created under a reserved key.
+	CompleteKey(ctx context.Context, key string, songID int64) error
+	// ReleaseKey drops a reservation whose request failed, so it can be retried.
+	ReleaseKey(ctx context.Context, key string) error
+	// DeleteKeysBefore removes the keys reserved before t and returns how many.
+	DeleteKeysBefore(ctx context.Context, t time.Time) (int64, error)
 }
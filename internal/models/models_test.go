@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReleaseDate(t *testing.T) {
+	want := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	for _, value := range []string{"2009-07-16", "16.07.2009", "2009-07-16T23:30:00+03:00"} {
+		got, ok := ParseReleaseDate(value)
+		if !ok || !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("ParseReleaseDate(%q) = %v, %v; want %v", value, got, ok, want)
+		}
+	}
+
+	for _, value := range []string{"", "16/07/2009", "2009-02-30", "yesterday"} {
+		if got, ok := ParseReleaseDate(value); ok {
+			t.Errorf("ParseReleaseDate(%q) = %v, want it rejected", value, got)
+		}
+	}
+}
+
+func TestIndexLetter(t *testing.T) {
+	tests := map[string]string{
+		"Uprising":     "U",
+		"uprising":     "U",
+		"Группа крови": "Г",
+		"Élan":         "É",
+		"1984":         IndexOther,
+		"(Don't Fear)": IndexOther,
+		" Leading":     IndexOther,
+		"":             IndexOther,
+	}
+	for title, want := range tests {
+		if got := IndexLetter(title); got != want {
+			t.Errorf("IndexLetter(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// record appends a history entry for op with a copy of s; it must be called
+// with mu held.
+func (r *songRepository) record(op string, s *models.Song) {
+	r.history[s.ID] = append(r.history[s.ID], models.HistoryEntry{
+		Operation:  op,
+		OccurredAt: time.Now(),
+		Snapshot:   *s,
+	})
+}
+
+// History returns a page of the recorded mutations of song songID, oldest
+// first, and the total number of entries.
+func (r *songRepository) History(_ context.Context, songID int64, limit, offset int) ([]models.HistoryEntry, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.history[songID]
+	return append([]models.HistoryEntry{}, page(entries, limit, offset)...), int64(len(entries)), nil
+}
+
+// DeleteHistoryBefore removes the history entries recorded before the given
+// time and returns how many were removed.
+func (r *songRepository) DeleteHistoryBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, entries := range r.history {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.OccurredAt.Before(before) {
+				n++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if len(kept) == 0 {
+			delete(r.history, id)
+		} else {
+			r.history[id] = kept
+		}
+	}
+	return n, nil
+}
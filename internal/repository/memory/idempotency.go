@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// idempotencyKey is a reserved key; songID is 0 while its request runs.
+type idempotencyKey struct {
+	songID  int64
+	created time.Time
+}
+
+// idempotencyStore keeps idempotency keys in a map guarded by a mutex.
+type idempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]idempotencyKey
+}
+
+// NewIdempotencyStore returns an empty in-memory models.IdempotencyStore.
+func NewIdempotencyStore() models.IdempotencyStore {
+	return &idempotencyStore{keys: make(map[string]idempotencyKey)}
+}
+
+// ReserveKey reserves key, or returns the song it recorded
+// (ErrRequestInProgress while there is none).
+func (s *idempotencyStore) ReserveKey(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[key]
+	if !ok {
+		s.keys[key] = idempotencyKey{created: time.Now()}
+		return 0, nil
+	}
+	if k.songID == 0 {
+		return 0, models.ErrRequestInProgress
+	}
+	return k.songID, nil
+}
+
+// CompleteKey records the song created under key.
+func (s *idempotencyStore) CompleteKey(_ context.Context, key string, songID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[key]; ok {
+		k.songID = songID
+		s.keys[key] = k
+	}
+	return nil
+}
+
+// ReleaseKey deletes key unless a song was already recorded for it.
+func (s *idempotencyStore) ReleaseKey(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[key]; ok && k.songID == 0 {
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+// DeleteKeysBefore deletes the keys reserved before t.
+func (s *idempotencyStore) DeleteKeysBefore(_ context.Context, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, k := range s.keys {
+		if k.created.Before(t) {
+			delete(s.keys, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,702 @@
+// Package memory provides an in-memory models.SongRepository, mainly as a
+// test double for the service layer. It mirrors the semantics of the Postgres
+// repository (ordering, case-insensitive matching, nil for missing songs)
+// without needing a database.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"song-library-test-task/internal/models"
+)
+
+// songRepository keeps songs in a map guarded by a mutex. Songs are copied in
+// and out so callers never share memory with the store. Soft-deleted songs are
+// moved to a separate map, so every lookup of songs sees live songs only.
+type songRepository struct {
+	mu      sync.RWMutex
+	songs   map[int64]*models.Song
+	deleted map[int64]*models.Song
+	history map[int64][]models.HistoryEntry
+	nextID  int64
+}
+
+// NewInMemorySongRepository returns an empty in-memory song repository.
+func NewInMemorySongRepository() models.SongRepository {
+	return &songRepository{
+		songs:   make(map[int64]*models.Song),
+		deleted: make(map[int64]*models.Song),
+		history: make(map[int64][]models.HistoryEntry),
+	}
+}
+
+// Create stores a copy of song under a new ID and returns the ID.
+func (r *songRepository) Create(_ context.Context, song *models.Song) (int64, error) {
+	if err := checkLengths(*song); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keyTaken(song.GroupName, song.Title, 0) {
+		return 0, fmt.Errorf("%q - %q: %w", song.GroupName, song.Title, models.ErrDuplicateSong)
+	}
+	id := r.insert(*song)
+	r.record(models.HistoryCreate, r.songs[id])
+	return id, nil
+}
+
+// Upsert stores a copy of song or, if a song with the same group and title
+// exists, replaces its release date, link and lyrics.
+func (r *songRepository) Upsert(_ context.Context, song *models.Song) (int64, bool, error) {
+	if err := checkLengths(*song); err != nil {
+		return 0, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.songs {
+		if s.GroupName == song.GroupName && s.Title == song.Title {
+			s.ReleaseDate = song.ReleaseDate
+			s.Link = song.Link
+			s.Text = song.Text
+			s.UpdatedAt = time.Now()
+			r.record(models.HistoryUpdate, s)
+			return s.ID, false, nil
+		}
+	}
+	id := r.insert(*song)
+	r.record(models.HistoryCreate, r.songs[id])
+	return id, true, nil
+}
+
+// CreateBatch stores all songs or, if any is invalid, none of them.
+func (r *songRepository) CreateBatch(_ context.Context, songs []models.Song) ([]int64, error) {
+	for _, s := range songs {
+		if err := checkLengths(s); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[models.SongKey]bool, len(songs))
+	for _, s := range songs {
+		key := models.SongKey{GroupName: s.GroupName, Title: s.Title}
+		if seen[key] || r.keyTaken(s.GroupName, s.Title, 0) {
+			return nil, fmt.Errorf("%q - %q: %w", s.GroupName, s.Title, models.ErrDuplicateSong)
+		}
+		seen[key] = true
+	}
+	ids := make([]int64, 0, len(songs))
+	for _, s := range songs {
+		id := r.insert(s)
+		r.record(models.HistoryCreate, r.songs[id])
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// keyTaken reports whether a song other than exceptID has exactly the group
+// and title, like the unique constraint of the songs table. It must be called
+// with mu held.
+func (r *songRepository) keyTaken(groupName, title string, exceptID int64) bool {
+	for id, s := range r.songs {
+		if id != exceptID && s.GroupName == groupName && s.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+// insert must be called with mu held.
+func (r *songRepository) insert(s models.Song) int64 {
+	r.nextID++
+	now := time.Now()
+	s.ID = r.nextID
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	r.songs[s.ID] = &s
+	return s.ID
+}
+
+// GetByID returns the song with the given ID, or nil if there is none.
+func (r *songRepository) GetByID(_ context.Context, id int64) (*models.Song, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.songs[id]
+	if !ok {
+		if _, deleted := r.deleted[id]; deleted {
+			return nil, fmt.Errorf("song %d: %w", id, models.ErrDeleted)
+		}
+		return nil, nil
+	}
+	song := *s
+	return &song, nil
+}
+
+// GetByGroupAndTitle returns the oldest song with exactly that group and
+// title, or nil if there is none.
+func (r *songRepository) GetByGroupAndTitle(_ context.Context, groupName, title string) (*models.Song, error) {
+	for _, s := range r.sorted(false) {
+		if s.GroupName == groupName && s.Title == title {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+// FindIDs returns, for each key, the oldest matching song's ID or 0; also 0
+// for a private song if publicOnly is set.
+func (r *songRepository) FindIDs(ctx context.Context, keys []models.SongKey, publicOnly bool) ([]int64, error) {
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		s, _ := r.GetByGroupAndTitle(ctx, k.GroupName, k.Title)
+		if s != nil && (!publicOnly || s.IsPublic) {
+			ids[i] = s.ID
+		}
+	}
+	return ids, nil
+}
+
+// GetAll returns a page of the songs matching filter in the filter's sort
+// order (newest ID first by default).
+func (r *songRepository) GetAll(_ context.Context, filter models.SongFilter, limit, offset int) ([]models.Song, error) {
+	desc := true
+	switch filter.SortDir {
+	case "", models.SortDesc:
+	case models.SortAsc:
+		desc = false
+	default:
+		return nil, fmt.Errorf("unknown sort direction %q: %w", filter.SortDir, models.ErrValidation)
+	}
+
+	// songs is in ID order, so a stable sort keeps ID as the tie-breaker.
+	songs := r.matching(filter, desc)
+	var less func(a, b models.Song) bool
+	switch filter.SortBy {
+	case "", models.SortByID:
+	case models.SortByTitle:
+		less = func(a, b models.Song) bool { return a.Title < b.Title }
+	case models.SortByGroupName:
+		less = func(a, b models.Song) bool { return a.GroupName < b.GroupName }
+	case models.SortByReleaseDate:
+		less = func(a, b models.Song) bool { return a.ReleaseDate.Before(b.ReleaseDate) }
+	default:
+		return nil, fmt.Errorf("unknown sort column %q: %w", filter.SortBy, models.ErrValidation)
+	}
+	if less != nil {
+		sort.SliceStable(songs, func(i, j int) bool {
+			a, b := songs[i], songs[j]
+			if filter.SortBy == models.SortByReleaseDate && a.ReleaseDate.IsZero() != b.ReleaseDate.IsZero() {
+				return b.ReleaseDate.IsZero()
+			}
+			if desc {
+				return less(b, a)
+			}
+			return less(a, b)
+		})
+	}
+	return page(songs, limit, offset), nil
+}
+
+// Count returns the number of songs matching filter.
+func (r *songRepository) Count(_ context.Context, filter models.SongFilter) (int64, error) {
+	return int64(len(r.matching(filter, true))), nil
+}
+
+// EachSong calls fn for every song matching filter in ID order (at most limit
+// songs when limit is positive), stopping at the first error from fn or when
+// ctx is done.
+func (r *songRepository) EachSong(ctx context.Context, filter models.SongFilter, limit int, fn func(models.Song) error) error {
+	songs := r.matching(filter, false)
+	if limit > 0 {
+		songs = page(songs, limit, 0)
+	}
+	for _, s := range songs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetIDs returns the IDs of the songs GetAll would return.
+func (r *songRepository) GetIDs(ctx context.Context, filter models.SongFilter, limit, offset int) ([]int64, error) {
+	songs, err := r.GetAll(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, s := range songs {
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// GetIncompleteByGroup returns the group's songs missing a release date, a
+// link or lyrics, in ID order.
+func (r *songRepository) GetIncompleteByGroup(_ context.Context, groupName string) ([]models.Song, error) {
+	var songs []models.Song
+	for _, s := range r.sorted(false) {
+		if s.GroupName == groupName && (s.ReleaseDate.IsZero() || s.Link == "" || s.Text == "") {
+			songs = append(songs, s)
+		}
+	}
+	return songs, nil
+}
+
+// GetRecent returns up to limit songs, most recently created first; only the
+// public ones if publicOnly is set.
+func (r *songRepository) GetRecent(_ context.Context, publicOnly bool, limit int) ([]models.Song, error) {
+	var songs []models.Song
+	for _, s := range r.sorted(true) {
+		if !publicOnly || s.IsPublic {
+			songs = append(songs, s)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		return songs[i].CreatedAt.After(songs[j].CreatedAt)
+	})
+	return page(songs, limit, 0), nil
+}
+
+// GetSameReleaseDate returns a page of the other songs released on the same
+// day as the song with the given ID, in ID order; only the public ones if
+// publicOnly is set.
+func (r *songRepository) GetSameReleaseDate(ctx context.Context, id int64, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	song, _ := r.GetByID(ctx, id)
+	if song == nil || song.ReleaseDate.IsZero() {
+		return nil, nil
+	}
+
+	var songs []models.Song
+	for _, s := range r.sorted(false) {
+		if s.ID != id && s.ReleaseDate.Equal(song.ReleaseDate) && (!publicOnly || s.IsPublic) {
+			songs = append(songs, s)
+		}
+	}
+	return page(songs, limit, offset), nil
+}
+
+// ReleaseYears returns the distinct years songs were released in, ascending;
+// only those of public songs if publicOnly is set.
+func (r *songRepository) ReleaseYears(_ context.Context, publicOnly bool) ([]int, error) {
+	seen := make(map[int]bool)
+	var years []int
+	for _, s := range r.sorted(false) {
+		if publicOnly && !s.IsPublic {
+			continue
+		}
+		if y := s.ReleaseDate.Year(); !s.ReleaseDate.IsZero() && !seen[y] {
+			seen[y] = true
+			years = append(years, y)
+		}
+	}
+	sort.Ints(years)
+	return years, nil
+}
+
+// SearchLyrics returns a page of the songs whose lyrics contain every word
+// of search.Query (case-insensitive). Relevance is approximated by how often
+// the words occur; there is no stemming.
+func (r *songRepository) SearchLyrics(_ context.Context, search models.LyricsSearch, limit, offset int) ([]models.Song, error) {
+	words := strings.Fields(strings.ToLower(search.Query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var songs []models.Song
+	rank := make(map[int64]int)
+	for _, s := range r.sorted(true) {
+		if search.PublicOnly && !s.IsPublic {
+			continue
+		}
+		text := strings.ToLower(s.Text)
+		hits := 0
+		for _, w := range words {
+			n := strings.Count(text, w)
+			if n == 0 {
+				hits = 0
+				break
+			}
+			hits += n
+		}
+		if hits > 0 {
+			songs = append(songs, s)
+			rank[s.ID] = hits
+		}
+	}
+
+	// songs is newest first, so a stable sort keeps ID DESC as the tie-breaker.
+	switch search.Order {
+	case models.SearchOrderRelevance:
+		sort.SliceStable(songs, func(i, j int) bool { return rank[songs[i].ID] > rank[songs[j].ID] })
+	case models.SearchOrderReleaseDate:
+		sort.SliceStable(songs, func(i, j int) bool {
+			a, b := songs[i].ReleaseDate, songs[j].ReleaseDate
+			return !a.IsZero() && (b.IsZero() || a.After(b))
+		})
+	case models.SearchOrderGroup:
+		sort.SliceStable(songs, func(i, j int) bool {
+			if songs[i].GroupName != songs[j].GroupName {
+				return songs[i].GroupName < songs[j].GroupName
+			}
+			if songs[i].Title != songs[j].Title {
+				return songs[i].Title < songs[j].Title
+			}
+			return songs[i].ID < songs[j].ID
+		})
+	default:
+		return nil, fmt.Errorf("unknown search order %q: %w", search.Order, models.ErrValidation)
+	}
+	return page(songs, limit, offset), nil
+}
+
+// GetByIndexLetter returns a page of the songs in the given alphabetical
+// index bucket, ordered by title.
+func (r *songRepository) GetByIndexLetter(_ context.Context, letter string, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	var songs []models.Song
+	for _, s := range r.sorted(false) {
+		if models.IndexLetter(s.Title) == letter && (!publicOnly || s.IsPublic) {
+			songs = append(songs, s)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Title < songs[j].Title })
+	return page(songs, limit, offset), nil
+}
+
+// IndexLetters returns the alphabetical index buckets that have songs, in
+// order, with models.IndexOther last.
+func (r *songRepository) IndexLetters(_ context.Context, publicOnly bool) ([]string, error) {
+	seen := make(map[string]bool)
+	var letters []string
+	for _, s := range r.sorted(false) {
+		if letter := models.IndexLetter(s.Title); (!publicOnly || s.IsPublic) && !seen[letter] {
+			seen[letter] = true
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if (letters[i] == models.IndexOther) != (letters[j] == models.IndexOther) {
+			return letters[j] == models.IndexOther
+		}
+		return letters[i] < letters[j]
+	})
+	return letters, nil
+}
+
+// Update overwrites the stored fields of song; unknown IDs are ignored.
+func (r *songRepository) Update(_ context.Context, song *models.Song) error {
+	if err := checkLengths(*song); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.songs[song.ID]
+	if !ok {
+		return nil
+	}
+	if r.keyTaken(song.GroupName, song.Title, song.ID) {
+		return fmt.Errorf("%q - %q: %w", song.GroupName, song.Title, models.ErrDuplicateSong)
+	}
+	s.GroupName = song.GroupName
+	s.Title = song.Title
+	s.ReleaseDate = song.ReleaseDate
+	s.Link = song.Link
+	s.Text = song.Text
+	s.UpdatedAt = time.Now()
+	r.record(models.HistoryUpdate, s)
+	return nil
+}
+
+// SetVisibility marks a song as public or private; unknown IDs are ignored.
+func (r *songRepository) SetVisibility(_ context.Context, id int64, public bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.songs[id]; ok {
+		s.IsPublic = public
+		s.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// MarkEnriched sets the song's EnrichedAt to now; unknown IDs are ignored.
+func (r *songRepository) MarkEnriched(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.songs[id]; ok {
+		s.EnrichedAt = time.Now()
+	}
+	return nil
+}
+
+// Delete removes a song; unknown IDs are ignored.
+func (r *songRepository) Delete(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.songs[id]; ok {
+		r.softDelete(id)
+		r.record(models.HistoryDelete, s)
+	}
+	return nil
+}
+
+// softDelete moves song id to the deleted songs; it must be called with mu
+// held.
+func (r *songRepository) softDelete(id int64) {
+	if s, ok := r.songs[id]; ok {
+		r.deleted[id] = s
+		delete(r.songs, id)
+	}
+}
+
+// Restore moves a soft-deleted song back to the live songs.
+func (r *songRepository) Restore(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.deleted[id]
+	if !ok {
+		return fmt.Errorf("deleted song %d: %w", id, models.ErrSongNotFound)
+	}
+	if r.keyTaken(s.GroupName, s.Title, id) {
+		return fmt.Errorf("song %d: %w", id, models.ErrDuplicateSong)
+	}
+	s.UpdatedAt = time.Now()
+	r.songs[id] = s
+	delete(r.deleted, id)
+	r.record(models.HistoryUpdate, s)
+	return nil
+}
+
+// HardDelete forgets song id, whether deleted or not.
+func (r *songRepository) HardDelete(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.songs, id)
+	delete(r.deleted, id)
+	return nil
+}
+
+// Merge stores the merged fields of target and soft-deletes the song sourceID,
+// or returns models.ErrSongNotFound, changing nothing, if either is missing.
+func (r *songRepository) Merge(_ context.Context, target *models.Song, sourceID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.songs[target.ID]
+	if _, found := r.songs[sourceID]; !ok || !found {
+		return models.ErrSongNotFound
+	}
+	t.ReleaseDate = target.ReleaseDate
+	t.Link = target.Link
+	t.Text = target.Text
+	t.IsPublic = target.IsPublic
+	t.UpdatedAt = time.Now()
+	r.record(models.HistoryUpdate, t)
+	source := r.songs[sourceID]
+	r.softDelete(sourceID)
+	r.record(models.HistoryDelete, source)
+	return nil
+}
+
+// ApplyMetadata applies every item to the songs with exactly its key and
+// returns the outcome of each in order.
+func (r *songRepository) ApplyMetadata(_ context.Context, items []models.SongMetadata) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcomes := make([]string, 0, len(items))
+	for _, item := range items {
+		outcome := models.MetadataUnmatched
+		for _, s := range r.songs {
+			if s.GroupName != item.Key.GroupName || s.Title != item.Key.Title {
+				continue
+			}
+			if outcome == models.MetadataUnmatched {
+				outcome = models.MetadataUnchanged
+			}
+			changed := false
+			if !item.ReleaseDate.IsZero() && !s.ReleaseDate.Equal(item.ReleaseDate) {
+				s.ReleaseDate = item.ReleaseDate
+				changed = true
+			}
+			if item.Link != "" && s.Link != item.Link {
+				s.Link = item.Link
+				changed = true
+			}
+			if item.Text != "" && s.Text != item.Text {
+				s.Text = item.Text
+				changed = true
+			}
+			if changed {
+				s.UpdatedAt = time.Now()
+				r.record(models.HistoryUpdate, s)
+				outcome = models.MetadataUpdated
+			}
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
+
+// SuggestGroups returns up to limit group names starting with prefix
+// (case-insensitive) in alphabetical order, with song counts if withCounts;
+// see groups for publicOnly.
+func (r *songRepository) SuggestGroups(_ context.Context, prefix string, publicOnly bool, limit int, withCounts bool) ([]models.GroupCount, error) {
+	groups := page(r.groups(prefix, publicOnly), limit, 0)
+	if !withCounts {
+		for i := range groups {
+			groups[i].SongCount = 0
+		}
+	}
+	return groups, nil
+}
+
+// ListGroupsPaged returns a page of groups starting with prefix with their
+// song counts, plus the total number of matching groups; see groups for
+// publicOnly.
+func (r *songRepository) ListGroupsPaged(_ context.Context, prefix string, publicOnly bool, limit, offset int) ([]models.GroupCount, int64, error) {
+	groups := r.groups(prefix, publicOnly)
+	return page(groups, limit, offset), int64(len(groups)), nil
+}
+
+// groups counts the songs of every group starting with prefix
+// (case-insensitive), only the public ones if publicOnly is set, sorted by
+// group name.
+func (r *songRepository) groups(prefix string, publicOnly bool) []models.GroupCount {
+	counts := make(map[string]int64)
+	for _, s := range r.sorted(false) {
+		if (!publicOnly || s.IsPublic) && strings.HasPrefix(strings.ToLower(s.GroupName), strings.ToLower(prefix)) {
+			counts[s.GroupName]++
+		}
+	}
+
+	groups := make([]models.GroupCount, 0, len(counts))
+	for name, n := range counts {
+		groups = append(groups, models.GroupCount{GroupName: name, SongCount: n})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupName < groups[j].GroupName })
+	return groups
+}
+
+// sorted returns copies of all songs ordered by ID.
+func (r *songRepository) sorted(desc bool) []models.Song {
+	r.mu.RLock()
+	songs := make([]models.Song, 0, len(r.songs))
+	for _, s := range r.songs {
+		songs = append(songs, *s)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(songs, func(i, j int) bool {
+		if desc {
+			return songs[i].ID > songs[j].ID
+		}
+		return songs[i].ID < songs[j].ID
+	})
+	return songs
+}
+
+// matching returns copies of the songs matching filter, ordered by ID.
+func (r *songRepository) matching(filter models.SongFilter, desc bool) []models.Song {
+	var songs []models.Song
+	for _, s := range r.sorted(desc) {
+		if matches(s, filter) {
+			songs = append(songs, s)
+		}
+	}
+	return songs
+}
+
+// matches applies filter the way the Postgres WHERE clause does: substring
+// matching is case-insensitive (ILIKE), exact matching is not, and empty
+// values never filter.
+func matches(s models.Song, filter models.SongFilter) bool {
+	if filter.GroupName != "" && !matchField(s.GroupName, filter.GroupName, filter.Match) {
+		return false
+	}
+	if filter.Title != "" && !matchField(s.Title, filter.Title, filter.Match) {
+		return false
+	}
+	if !filter.ReleasedAfter.IsZero() && (s.ReleaseDate.IsZero() || s.ReleaseDate.Before(filter.ReleasedAfter)) {
+		return false
+	}
+	if !filter.ReleasedBefore.IsZero() && (s.ReleaseDate.IsZero() || s.ReleaseDate.After(filter.ReleasedBefore)) {
+		return false
+	}
+	if filter.PublicOnly && !s.IsPublic {
+		return false
+	}
+	if filter.SearchQuery != "" && !matchSearch(s, filter.SearchQuery) {
+		return false
+	}
+	if filter.AfterID > 0 && s.ID >= filter.AfterID {
+		return false
+	}
+	return true
+}
+
+// matchSearch approximates the full-text search: every word of query must
+// occur, case-insensitively, in the group, title or lyrics. Unlike Postgres
+// there is no stemming and results are not ranked.
+func matchSearch(s models.Song, query string) bool {
+	doc := strings.ToLower(s.GroupName + " " + s.Title + " " + s.Text)
+	for _, w := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(doc, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(value, query, match string) bool {
+	if match == models.MatchExact {
+		return value == query
+	}
+	return strings.Contains(strings.ToLower(value), strings.ToLower(query))
+}
+
+// page applies LIMIT/OFFSET semantics to items.
+func page[T any](items []T, limit, offset int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// checkLengths mirrors the VARCHAR limits of the group and title columns.
+func checkLengths(s models.Song) error {
+	if utf8.RuneCountInString(s.GroupName) > models.MaxGroupNameLength ||
+		utf8.RuneCountInString(s.Title) > models.MaxTitleLength {
+		return fmt.Errorf("value too long for song column: %w", models.ErrValidation)
+	}
+	return nil
+}
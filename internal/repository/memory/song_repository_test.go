@@ -0,0 +1,395 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestCreateChecksColumnLengths(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+
+	longest := strings.Repeat("ж", models.MaxTitleLength)
+	if _, err := repo.Create(ctx, &models.Song{GroupName: "Кино", Title: longest}); err != nil {
+		t.Fatalf("Create at the limit: %v", err)
+	}
+
+	tooLong := []models.Song{
+		{GroupName: strings.Repeat("g", models.MaxGroupNameLength+1), Title: "Uprising"},
+		{GroupName: "Muse", Title: longest + "ж"},
+	}
+	for _, song := range tooLong {
+		if _, err := repo.Create(ctx, &song); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("Create error = %v, want ErrValidation", err)
+		}
+		if _, _, err := repo.Upsert(ctx, &song); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("Upsert error = %v, want ErrValidation", err)
+		}
+	}
+	if _, err := repo.CreateBatch(ctx, []models.Song{{GroupName: "Muse", Title: "Starlight"}, tooLong[1]}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("CreateBatch error = %v, want ErrValidation", err)
+	}
+	if n, _ := repo.Count(ctx, models.SongFilter{}); n != 1 {
+		t.Errorf("%d songs stored, want only the one at the limit", n)
+	}
+}
+
+func TestSuggestGroups(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	for _, s := range []models.Song{
+		{GroupName: "Muse", Title: "Uprising"},
+		{GroupName: "Muse", Title: "Resistance"},
+		{GroupName: "Metallica", Title: "One"},
+		{GroupName: "Queen", Title: "Bohemian Rhapsody"},
+	} {
+		if _, err := repo.Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := repo.SuggestGroups(ctx, "m", false, 10, true)
+	if err != nil {
+		t.Fatalf("SuggestGroups: %v", err)
+	}
+	want := []models.GroupCount{{GroupName: "Metallica", SongCount: 1}, {GroupName: "Muse", SongCount: 2}}
+	if len(groups) != 2 || groups[0] != want[0] || groups[1] != want[1] {
+		t.Errorf("groups = %+v, want %+v", groups, want)
+	}
+
+	groups, _ = repo.SuggestGroups(ctx, "M", false, 1, false)
+	if len(groups) != 1 || groups[0] != (models.GroupCount{GroupName: "Metallica"}) {
+		t.Errorf("groups without counts = %+v, want only Metallica, uncounted", groups)
+	}
+}
+
+func TestSubstringMatchIsLiteral(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	for _, title := range []string{"100% Pure", "1000 Pure", "a_b", "axb"} {
+		if _, err := repo.Create(ctx, &models.Song{GroupName: "G", Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for query, want := range map[string]int{"100%": 1, "a_b": 1, "%": 1, "_": 1} {
+		songs, _ := repo.GetAll(ctx, models.SongFilter{Title: query}, 10, 0)
+		if len(songs) != want {
+			t.Errorf("title %q matched %d songs, want %d", query, len(songs), want)
+		}
+	}
+}
+
+func TestListGroupsPaged(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	for _, s := range []models.Song{
+		{GroupName: "ABBA", Title: "SOS"},
+		{GroupName: "Muse", Title: "Uprising"},
+		{GroupName: "Muse", Title: "Resistance"},
+		{GroupName: "Metallica", Title: "One"},
+		{GroupName: "Madonna", Title: "Vogue"},
+	} {
+		if _, err := repo.Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, total, err := repo.ListGroupsPaged(ctx, "m", false, 1, 1)
+	if err != nil {
+		t.Fatalf("ListGroupsPaged: %v", err)
+	}
+	if total != 2 || len(groups) != 1 || groups[0] != (models.GroupCount{GroupName: "Muse", SongCount: 2}) {
+		t.Errorf("got %+v of %d, want Muse (2 songs) of 2 groups, deleted songs excluded", groups, total)
+	}
+
+	groups, total, _ = repo.ListGroupsPaged(ctx, "", false, 10, 5)
+	if total != 3 || len(groups) != 0 {
+		t.Errorf("past the end: got %+v of %d", groups, total)
+	}
+}
+
+func TestDeleteHistoryBefore(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	oldID, _ := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising"})
+	newID, _ := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Starlight"})
+
+	// Age the history of the first song past the cutoff.
+	cutoff := time.Now().Add(-24 * time.Hour)
+	history := repo.(*songRepository).history
+	for i := range history[oldID] {
+		history[oldID][i].OccurredAt = cutoff.Add(-time.Minute)
+	}
+	history[newID] = append(history[newID], models.HistoryEntry{
+		Operation: models.HistoryUpdate, OccurredAt: cutoff.Add(-time.Minute),
+	})
+
+	n, err := repo.DeleteHistoryBefore(ctx, cutoff)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteHistoryBefore = %d, %v; want 2 entries removed", n, err)
+	}
+	if _, total, _ := repo.History(ctx, oldID, 10, 0); total != 0 {
+		t.Errorf("old song keeps %d entries, want 0", total)
+	}
+	entries, total, _ := repo.History(ctx, newID, 10, 0)
+	if total != 1 || entries[0].Operation != models.HistoryCreate {
+		t.Errorf("new song history = %+v, want only its create", entries)
+	}
+}
+
+func TestHistoryOfEveryMutation(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	ops := func(id int64) []string {
+		entries, _, _ := repo.History(ctx, id, 100, 0)
+		var ops []string
+		for _, e := range entries {
+			ops = append(ops, e.Operation)
+		}
+		return ops
+	}
+
+	target, _, err := repo.Upsert(ctx, &models.Song{GroupName: "Muse", Title: "Uprising", Text: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.Upsert(ctx, &models.Song{GroupName: "Muse", Title: "Uprising", Text: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := repo.CreateBatch(ctx, []models.Song{{GroupName: "Muse", Title: "Starlight"}, {GroupName: "Muse", Title: "Uprising (live)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := ids[1]
+	if err := repo.Merge(ctx, &models.Song{ID: target, Text: "v3"}, source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ApplyMetadata(ctx, []models.SongMetadata{{Key: models.SongKey{GroupName: "Muse", Title: "Starlight"}, Link: "https://example.com/starlight"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Restore(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int64][]string{
+		target: {models.HistoryCreate, models.HistoryUpdate, models.HistoryUpdate},
+		ids[0]: {models.HistoryCreate, models.HistoryUpdate},
+		source: {models.HistoryCreate, models.HistoryDelete, models.HistoryUpdate},
+	} {
+		if got := ops(id); !reflect.DeepEqual(got, want) {
+			t.Errorf("song %d history = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestEachSong(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	for _, title := range []string{"Uprising", "Resistance", "Starlight"} {
+		repo.Create(ctx, &models.Song{GroupName: "Muse", Title: title})
+	}
+	repo.Create(ctx, &models.Song{GroupName: "Queen", Title: "Innuendo"})
+
+	var titles []string
+	collect := func(s models.Song) error {
+		titles = append(titles, s.Title)
+		return nil
+	}
+	if err := repo.EachSong(ctx, models.SongFilter{GroupName: "muse"}, 0, collect); err != nil {
+		t.Fatalf("EachSong: %v", err)
+	}
+	if got := strings.Join(titles, ","); got != "Uprising,Resistance,Starlight" {
+		t.Errorf("callback saw %s, want the Muse songs in ID order", got)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := repo.EachSong(ctx, models.SongFilter{}, 0, func(models.Song) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
+
+func TestReleaseYears(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	var deleted int64
+	for _, s := range []models.Song{
+		{GroupName: "Muse", Title: "Uprising", ReleaseDate: time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)},
+		{GroupName: "Muse", Title: "Resistance", ReleaseDate: time.Date(2009, time.September, 14, 0, 0, 0, 0, time.UTC)},
+		{GroupName: "Muse", Title: "Plug In Baby", ReleaseDate: time.Date(2001, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{GroupName: "Muse", Title: "Undated"},
+		{GroupName: "Muse", Title: "Deleted", ReleaseDate: time.Date(1999, time.June, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		id, err := repo.Create(ctx, &s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted = id
+	}
+	if err := repo.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	years, err := repo.ReleaseYears(ctx, false)
+	if err != nil {
+		t.Fatalf("ReleaseYears: %v", err)
+	}
+	if len(years) != 2 || years[0] != 2001 || years[1] != 2009 {
+		t.Errorf("years = %v, want [2001 2009]", years)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+
+	id, created, err := repo.Upsert(ctx, &models.Song{GroupName: "Muse", Title: "Uprising", Text: "v1"})
+	if err != nil || !created {
+		t.Fatalf("first Upsert = %d, %v, %v; want created", id, created, err)
+	}
+	again, created, err := repo.Upsert(ctx, &models.Song{GroupName: "Muse", Title: "Uprising", Text: "v2"})
+	if err != nil || created || again != id {
+		t.Fatalf("second Upsert = %d, %v, %v; want song %d updated", again, created, err, id)
+	}
+	if song, _ := repo.GetByID(ctx, id); song.Text != "v2" {
+		t.Errorf("text = %q, want v2", song.Text)
+	}
+	if n, _ := repo.Count(ctx, models.SongFilter{}); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	live, _ := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising"})
+	deleted, _ := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Starlight"})
+	purged, _ := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Resistance"})
+	if err := repo.Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, purged); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.HardDelete(ctx, purged); err != nil {
+		t.Fatal(err)
+	}
+
+	if song, err := repo.GetByID(ctx, live); err != nil || song == nil {
+		t.Errorf("live: GetByID = %v, %v", song, err)
+	}
+	if song, err := repo.GetByID(ctx, deleted); !errors.Is(err, models.ErrDeleted) || song != nil {
+		t.Errorf("soft-deleted: GetByID = %v, %v; want ErrDeleted", song, err)
+	}
+	if song, err := repo.GetByID(ctx, purged); err != nil || song != nil {
+		t.Errorf("hard-deleted: GetByID = %v, %v; want nothing", song, err)
+	}
+	if n, _ := repo.Count(ctx, models.SongFilter{}); n != 1 {
+		t.Errorf("Count = %d, want only the live song", n)
+	}
+
+	if err := repo.Restore(ctx, live); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("restore live: err = %v, want ErrSongNotFound", err)
+	}
+	if err := repo.Restore(ctx, purged); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("restore hard-deleted: err = %v, want ErrSongNotFound", err)
+	}
+	if err := repo.Restore(ctx, deleted); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if song, err := repo.GetByID(ctx, deleted); err != nil || song == nil || song.Title != "Starlight" {
+		t.Errorf("restored: GetByID = %v, %v", song, err)
+	}
+
+	t.Run("key taken", func(t *testing.T) {
+		if err := repo.Delete(ctx, deleted); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Starlight"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Restore(ctx, deleted); !errors.Is(err, models.ErrDuplicateSong) {
+			t.Errorf("err = %v, want ErrDuplicateSong", err)
+		}
+	})
+}
+
+func TestGetAllSearchQuery(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemorySongRepository()
+	for _, s := range []models.Song{
+		{GroupName: "Muse", Title: "Uprising", Text: "They will not force us"},
+		{GroupName: "Muse", Title: "Starlight", Text: "Far away"},
+		{GroupName: "Queen", Title: "Bohemian Rhapsody", Text: "Is this the real life?"},
+	} {
+		if _, err := repo.Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for q, want := range map[string]string{
+		"FORCE us":    "Uprising",
+		"muse":        "Starlight,Uprising",
+		"queen life":  "Bohemian Rhapsody",
+		"muse life":   "",
+		"not-present": "",
+	} {
+		songs, err := repo.GetAll(ctx, models.SongFilter{SearchQuery: q}, 10, 0)
+		if err != nil {
+			t.Fatalf("GetAll %q: %v", q, err)
+		}
+		var titles []string
+		for _, s := range songs {
+			titles = append(titles, s.Title)
+		}
+		if got := strings.Join(titles, ","); got != want {
+			t.Errorf("search %q = %q, want %q", q, got, want)
+		}
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewIdempotencyStore()
+
+	if id, err := store.ReserveKey(ctx, "a"); err != nil || id != 0 {
+		t.Fatalf("ReserveKey = %d, %v; want it reserved", id, err)
+	}
+	if _, err := store.ReserveKey(ctx, "a"); !errors.Is(err, models.ErrRequestInProgress) {
+		t.Errorf("reserve twice: err = %v, want ErrRequestInProgress", err)
+	}
+	store.CompleteKey(ctx, "a", 7)
+	store.ReleaseKey(ctx, "a")
+	if id, err := store.ReserveKey(ctx, "a"); err != nil || id != 7 {
+		t.Errorf("completed key: ReserveKey = %d, %v; want 7", id, err)
+	}
+
+	store.ReserveKey(ctx, "b")
+	store.ReleaseKey(ctx, "b")
+	if id, err := store.ReserveKey(ctx, "b"); err != nil || id != 0 {
+		t.Errorf("released key: ReserveKey = %d, %v; want it reserved again", id, err)
+	}
+
+	if n, _ := store.DeleteKeysBefore(ctx, time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("deleted %d fresh keys", n)
+	}
+	if n, _ := store.DeleteKeysBefore(ctx, time.Now().Add(time.Second)); n != 2 {
+		t.Errorf("deleted %d keys, want 2", n)
+	}
+	if id, err := store.ReserveKey(ctx, "a"); err != nil || id != 0 {
+		t.Errorf("expired key: ReserveKey = %d, %v; want it reserved again", id, err)
+	}
+}
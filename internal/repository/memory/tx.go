@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"song-library-test-task/internal/models"
+)
+
+// BeginTx returns a repository working on a copy of the store. Commit
+// replaces the store with the copy, so it is not isolated from concurrent
+// writes made outside the transaction: those are lost on commit. That is
+// enough for a test double driving one request at a time.
+func (r *songRepository) BeginTx(_ context.Context) (models.SongRepositoryTx, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	working := &songRepository{
+		songs:   make(map[int64]*models.Song, len(r.songs)),
+		deleted: make(map[int64]*models.Song, len(r.deleted)),
+		history: make(map[int64][]models.HistoryEntry, len(r.history)),
+		nextID:  r.nextID,
+	}
+	for id, s := range r.songs {
+		c := *s
+		working.songs[id] = &c
+	}
+	for id, s := range r.deleted {
+		c := *s
+		working.deleted[id] = &c
+	}
+	for id, entries := range r.history {
+		working.history[id] = append([]models.HistoryEntry(nil), entries...)
+	}
+	return &songRepositoryTx{songRepository: working, parent: r}, nil
+}
+
+// songRepositoryTx is the working copy of a transaction and the store it is
+// committed to.
+type songRepositoryTx struct {
+	*songRepository
+	parent *songRepository
+
+	doneMu sync.Mutex
+	done   bool
+}
+
+// BeginTx refuses to nest transactions.
+func (t *songRepositoryTx) BeginTx(_ context.Context) (models.SongRepositoryTx, error) {
+	return nil, errors.New("transaction already in progress")
+}
+
+func (t *songRepositoryTx) Commit() error {
+	if !t.finish() {
+		return sql.ErrTxDone
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.parent.mu.Lock()
+	defer t.parent.mu.Unlock()
+	t.parent.songs = t.songs
+	t.parent.deleted = t.deleted
+	t.parent.history = t.history
+	t.parent.nextID = t.nextID
+	return nil
+}
+
+func (t *songRepositoryTx) Rollback() error {
+	if !t.finish() {
+		return sql.ErrTxDone
+	}
+	return nil
+}
+
+// finish marks the transaction done and reports whether it was still open.
+func (t *songRepositoryTx) finish() bool {
+	t.doneMu.Lock()
+	defer t.doneMu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	return true
+}
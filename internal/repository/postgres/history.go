@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"song-library-test-task/internal/models"
+)
+
+// RecordHistory adds a song_history entry for op on song songID with
+// snapshot. Mutations call it on the repository bound to their own
+// transaction (see in), so the entry is written if and only if the mutation
+// it records is.
+func (r *songRepository) RecordHistory(ctx context.Context, songID int64, op string, snapshot models.Song) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode song snapshot")
+	}
+	_, err = r.execContext(ctx,
+		`INSERT INTO song_history (song_id, operation, snapshot) VALUES ($1, $2, $3)`,
+		songID, op, data,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to record song history")
+	}
+	return nil
+}
+
+// History returns a page of the recorded mutations of song songID, oldest
+// first, and the total number of entries.
+func (r *songRepository) History(ctx context.Context, songID int64, limit, offset int) ([]models.HistoryEntry, int64, error) {
+	var total int64
+	if err := r.queryRowContext(ctx, `SELECT COUNT(*) FROM song_history WHERE song_id = $1`, songID).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count song history")
+	}
+
+	rows, err := r.queryContext(ctx, `
+        SELECT operation, occurred_at, snapshot
+        FROM song_history
+        WHERE song_id = $1
+        ORDER BY id
+        LIMIT $2 OFFSET $3
+    `, songID, limit, offset)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get song history")
+	}
+	defer rows.Close()
+
+	entries := []models.HistoryEntry{}
+	for rows.Next() {
+		var e models.HistoryEntry
+		var snapshot []byte
+		if err := rows.Scan(&e.Operation, &e.OccurredAt, &snapshot); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to scan history row")
+		}
+		if err := json.Unmarshal(snapshot, &e.Snapshot); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to decode song snapshot")
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "error iterating over history rows")
+	}
+	return entries, total, nil
+}
+
+// DeleteHistoryBefore removes the history entries recorded before the given
+// time and returns how many were removed.
+func (r *songRepository) DeleteHistoryBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.execContext(ctx, `DELETE FROM song_history WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete song history")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get rows affected")
+	}
+	return n, nil
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"song-library-test-task/internal/models"
+)
+
+// snapshotOf matches a JSON song snapshot with the given ID and title.
+type snapshotOf struct {
+	id    int64
+	title string
+}
+
+func (s snapshotOf) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var song models.Song
+	return json.Unmarshal(data, &song) == nil && song.ID == s.id && song.Title == s.title
+}
+
+func TestRecordHistory(t *testing.T) {
+	ctx := context.Background()
+	created := models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}
+	updated := models.Song{ID: 1, GroupName: "Muse", Title: "Resistance"}
+
+	t.Run("create, update, delete", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO songs`).WillReturnRows(songRows(created))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(1), models.HistoryCreate, snapshotOf{1, "Uprising"}).
+			WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE songs\s+SET`).WillReturnRows(songRows(updated))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(1), models.HistoryUpdate, snapshotOf{1, "Resistance"}).
+			WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE songs SET deleted_at = NOW\(\)`).WillReturnRows(songRows(updated))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(1), models.HistoryDelete, snapshotOf{1, "Resistance"}).
+			WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+
+		if _, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Update(ctx, &updated); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if err := repo.Delete(ctx, 1); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	})
+
+	t.Run("failed entry rolls back", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO songs`).WillReturnRows(songRows(created))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE songs\s+SET`).WillReturnRows(songRows(updated))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		if _, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising"}); err == nil {
+			t.Error("Create succeeded without its history entry")
+		}
+		if err := repo.Update(ctx, &updated); err == nil {
+			t.Error("Update succeeded without its history entry")
+		}
+	})
+}
+
+func TestCreateBatchHistory(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	insert := `INSERT INTO songs[\s\S]+RETURNING`
+	mock.ExpectBegin()
+	mock.ExpectPrepare(insert)
+	mock.ExpectQuery(insert).WithArgs("Muse", "Uprising", nil, "", "", nil).
+		WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}))
+	mock.ExpectExec(`INSERT INTO song_history`).
+		WithArgs(int64(1), models.HistoryCreate, snapshotOf{1, "Uprising"}).
+		WillReturnResult(sqlmockResult(1))
+	mock.ExpectQuery(insert).WithArgs("Muse", "Starlight", nil, "", "", nil).
+		WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Starlight"}))
+	mock.ExpectExec(`INSERT INTO song_history`).
+		WithArgs(int64(2), models.HistoryCreate, snapshotOf{2, "Starlight"}).
+		WillReturnResult(sqlmockResult(1))
+	mock.ExpectCommit()
+
+	ids, err := repo.CreateBatch(context.Background(), []models.Song{
+		{GroupName: "Muse", Title: "Uprising"},
+		{GroupName: "Muse", Title: "Starlight"},
+	})
+	if err != nil || len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("CreateBatch = %v, %v; want [1 2]", ids, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := func(title string) []byte {
+		data, _ := json.Marshal(models.Song{ID: 1, GroupName: "Muse", Title: title})
+		return data
+	}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM song_history WHERE song_id = \$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`FROM song_history\s+WHERE song_id = \$1\s+ORDER BY id\s+LIMIT \$2 OFFSET \$3`).
+		WithArgs(int64(1), 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"operation", "occurred_at", "snapshot"}).
+			AddRow(models.HistoryUpdate, at, snapshot("Resistance")).
+			AddRow(models.HistoryDelete, at.Add(time.Hour), snapshot("Resistance")))
+
+	entries, total, err := repo.History(context.Background(), 1, 2, 1)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if total != 3 || len(entries) != 2 {
+		t.Fatalf("got %d of %d entries, want 2 of 3", len(entries), total)
+	}
+	if e := entries[0]; e.Operation != models.HistoryUpdate || !e.OccurredAt.Equal(at) || e.Snapshot.Title != "Resistance" {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Operation != models.HistoryDelete || e.Snapshot.ID != 1 {
+		t.Errorf("second entry = %+v", e)
+	}
+}
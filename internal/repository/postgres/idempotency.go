@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"song-library-test-task/internal/models"
+)
+
+// idempotencyStore keeps idempotency keys in the idempotency_keys table.
+type idempotencyStore struct {
+	db *sql.DB
+}
+
+// NewIdempotencyStore returns a models.IdempotencyStore backed by db.
+func NewIdempotencyStore(db *sql.DB) models.IdempotencyStore {
+	return &idempotencyStore{db: db}
+}
+
+// ReserveKey inserts key with no song yet; if it already exists, the song it
+// recorded is returned, or ErrRequestInProgress while there is none.
+func (s *idempotencyStore) ReserveKey(ctx context.Context, key string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `INSERT INTO idempotency_keys (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to reserve idempotency key")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, errors.Wrap(err, "failed to reserve idempotency key")
+	} else if n == 1 {
+		return 0, nil
+	}
+
+	var songID sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `SELECT song_id FROM idempotency_keys WHERE key = $1`, key).Scan(&songID)
+	// A key released between the insert and the select belongs to a request
+	// that just failed; the client retries as for an in-flight one.
+	if err == sql.ErrNoRows || (err == nil && !songID.Valid) {
+		return 0, models.ErrRequestInProgress
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to look up idempotency key")
+	}
+	return songID.Int64, nil
+}
+
+// CompleteKey stores the song created under key.
+func (s *idempotencyStore) CompleteKey(ctx context.Context, key string, songID int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET song_id = $2 WHERE key = $1`, key, songID)
+	return errors.Wrap(err, "failed to complete idempotency key")
+}
+
+// ReleaseKey deletes key unless a song was already recorded for it.
+func (s *idempotencyStore) ReleaseKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND song_id IS NULL`, key)
+	return errors.Wrap(err, "failed to release idempotency key")
+}
+
+// DeleteKeysBefore deletes the keys created before t.
+func (s *idempotencyStore) DeleteKeysBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, t)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete expired idempotency keys")
+	}
+	n, err := res.RowsAffected()
+	return n, errors.Wrap(err, "failed to delete expired idempotency keys")
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"song-library-test-task/internal/models"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	reserve := regexp.QuoteMeta(`INSERT INTO idempotency_keys (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`)
+	lookup := regexp.QuoteMeta(`SELECT song_id FROM idempotency_keys WHERE key = $1`)
+
+	repo, mock := newMockRepository(t)
+	store := NewIdempotencyStore(repo.db)
+
+	mock.ExpectExec(reserve).WithArgs("new").WillReturnResult(sqlmockResult(1))
+	if id, err := store.ReserveKey(ctx, "new"); err != nil || id != 0 {
+		t.Errorf("new key: ReserveKey = %d, %v; want it reserved", id, err)
+	}
+
+	mock.ExpectExec(reserve).WithArgs("done").WillReturnResult(sqlmockResult(0))
+	mock.ExpectQuery(lookup).WithArgs("done").WillReturnRows(sqlmock.NewRows([]string{"song_id"}).AddRow(7))
+	if id, err := store.ReserveKey(ctx, "done"); err != nil || id != 7 {
+		t.Errorf("completed key: ReserveKey = %d, %v; want 7", id, err)
+	}
+
+	mock.ExpectExec(reserve).WithArgs("running").WillReturnResult(sqlmockResult(0))
+	mock.ExpectQuery(lookup).WithArgs("running").WillReturnRows(sqlmock.NewRows([]string{"song_id"}).AddRow(nil))
+	if _, err := store.ReserveKey(ctx, "running"); !errors.Is(err, models.ErrRequestInProgress) {
+		t.Errorf("in-flight key: err = %v, want ErrRequestInProgress", err)
+	}
+
+	mock.ExpectExec(reserve).WithArgs("released").WillReturnResult(sqlmockResult(0))
+	mock.ExpectQuery(lookup).WithArgs("released").WillReturnRows(sqlmock.NewRows([]string{"song_id"}))
+	if _, err := store.ReserveKey(ctx, "released"); !errors.Is(err, models.ErrRequestInProgress) {
+		t.Errorf("key released meanwhile: err = %v, want ErrRequestInProgress", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE idempotency_keys SET song_id = $2 WHERE key = $1`)).WithArgs("new", int64(3)).WillReturnResult(sqlmockResult(1))
+	if err := store.CompleteKey(ctx, "new", 3); err != nil {
+		t.Errorf("CompleteKey: %v", err)
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM idempotency_keys WHERE key = $1 AND song_id IS NULL`)).WithArgs("running").WillReturnResult(sqlmockResult(1))
+	if err := store.ReleaseKey(ctx, "running"); err != nil {
+		t.Errorf("ReleaseKey: %v", err)
+	}
+
+	cutoff := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM idempotency_keys WHERE created_at < $1`)).WithArgs(cutoff).WillReturnResult(sqlmockResult(4))
+	if n, err := store.DeleteKeysBefore(ctx, cutoff); err != nil || n != 4 {
+		t.Errorf("DeleteKeysBefore = %d, %v; want 4", n, err)
+	}
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/goose/v3"
+)
+
+// BaseMigration creates the songs table; every migration set must contain it.
+const BaseMigration = "00001_create_songs_table.sql"
+
+// CheckMigrations returns an error unless dir in fsys holds BaseMigration.
+// goose silently applies nothing from a missing or empty directory, so a
+// packaging mistake would otherwise only surface as missing tables at
+// runtime.
+func CheckMigrations(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read migrations directory")
+	}
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() == BaseMigration {
+			return nil
+		}
+	}
+	if len(entries) == 0 {
+		return errors.New("migrations directory is empty")
+	}
+	return errors.Errorf("migrations directory lacks the base migration %s", BaseMigration)
+}
+
+// Migrations reports the goose migration state of DB against the migrations
+// in Dir (read through goose's base filesystem).
+type Migrations struct {
+	DB  *sql.DB
+	Dir string
+}
+
+// MigrationStatus returns the version the database is migrated to and the
+// versions in Dir not applied yet, in order.
+func (m Migrations) MigrationStatus(ctx context.Context) (int64, []int64, error) {
+	current, err := goose.GetDBVersionContext(ctx, m.DB)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to get migration version")
+	}
+	migrations, err := goose.CollectMigrations(m.Dir, current, goose.MaxVersion)
+	if err != nil && !errors.Is(err, goose.ErrNoMigrationFiles) {
+		return 0, nil, errors.Wrap(err, "failed to collect migrations")
+	}
+	pending := make([]int64, 0, len(migrations))
+	for _, mig := range migrations {
+		pending = append(pending, mig.Version)
+	}
+	return current, pending, nil
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pressly/goose/v3"
+)
+
+func TestCheckMigrations(t *testing.T) {
+	base := &fstest.MapFile{Data: []byte("-- +goose Up\n")}
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{name: "base present", fsys: fstest.MapFS{"migrations/" + BaseMigration: base, "migrations/00002_more.sql": base}},
+		{name: "missing directory", fsys: fstest.MapFS{"other/" + BaseMigration: base}, wantErr: "failed to read migrations directory"},
+		{name: "empty directory", fsys: fstest.MapFS{"migrations": &fstest.MapFile{Mode: os.ModeDir}}, wantErr: "migrations directory is empty"},
+		{name: "no base migration", fsys: fstest.MapFS{"migrations/00002_more.sql": base}, wantErr: "lacks the base migration " + BaseMigration},
+		{name: "base is a directory", fsys: fstest.MapFS{"migrations/" + BaseMigration + "/x": base}, wantErr: "lacks the base migration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckMigrations(tt.fsys, "migrations")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CheckMigrations: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("CheckMigrations error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("shipped migrations", func(t *testing.T) {
+		if err := CheckMigrations(os.DirFS("../../../db/migrations"), "."); err != nil {
+			t.Errorf("db/migrations: %v", err)
+		}
+	})
+}
+
+func TestMigrationStatus(t *testing.T) {
+	const dir = "../../../db/migrations"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := int64(len(entries))
+
+	tests := []struct {
+		name        string
+		applied     [][2]interface{} // version_id, is_applied, newest first
+		wantVersion int64
+		wantPending []int64
+	}{
+		{name: "up to date", applied: [][2]interface{}{{latest, true}, {latest - 1, true}}, wantVersion: latest, wantPending: []int64{}},
+		{name: "behind", applied: [][2]interface{}{{latest - 2, true}}, wantVersion: latest - 2, wantPending: []int64{latest - 1, latest}},
+		{name: "rolled back", applied: [][2]interface{}{{latest, false}, {latest, true}, {latest - 1, true}}, wantVersion: latest - 1, wantPending: []int64{latest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rows := sqlmock.NewRows([]string{"version_id", "is_applied"})
+			for _, r := range tt.applied {
+				rows.AddRow(r[0], r[1])
+			}
+			mock.ExpectQuery(`SELECT version_id, is_applied from goose_db_version ORDER BY id DESC`).WillReturnRows(rows)
+
+			version, pending, err := Migrations{DB: db, Dir: dir}.MigrationStatus(context.Background())
+			if err != nil {
+				t.Fatalf("MigrationStatus: %v", err)
+			}
+			if version != tt.wantVersion || !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("status = %d, pending %v; want %d, pending %v", version, pending, tt.wantVersion, tt.wantPending)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestUniqueGroupTitleMigration checks against a real database (see
+// integrationDB) that the unique (group_name, title) migration fails over
+// duplicate songs, naming them, instead of deleting any.
+func TestSongVisibilityMigration(t *testing.T) {
+	const dir = "../../../db/migrations"
+	db := integrationDB(t)
+	if err := goose.UpTo(db, dir, 2); err != nil {
+		t.Fatalf("migrate to 2: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (group_name, title, release_date, link, text) VALUES ('Muse', 'Uprising', '2009-07-16', '', '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := goose.UpTo(db, dir, 3); err != nil {
+		t.Fatalf("migrate to 3: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (group_name, title, release_date, link, text) VALUES ('Muse', 'Starlight', '2006-09-04', '', '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT title, is_public FROM songs ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := map[string]bool{}
+	for rows.Next() {
+		var title string
+		var public bool
+		if err := rows.Scan(&title, &public); err != nil {
+			t.Fatal(err)
+		}
+		got[title] = public
+	}
+	if !got["Uprising"] || got["Starlight"] {
+		t.Errorf("is_public = %v, want the existing song public and the new one private", got)
+	}
+}
+
+func TestUniqueGroupTitleMigration(t *testing.T) {
+	const dir = "../../../db/migrations"
+	db := integrationDB(t)
+	if err := goose.UpTo(db, dir, 6); err != nil {
+		t.Fatalf("migrate to 6: %v", err)
+	}
+	for _, title := range []string{"Uprising", "Uprising", "Starlight"} {
+		if _, err := db.Exec(`INSERT INTO songs (group_name, title, link, text) VALUES ('Muse', $1, '', '')`, title); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := goose.UpTo(db, dir, 7)
+	if err == nil || !strings.Contains(err.Error(), `('Muse', 'Uprising'): 2 songs`) || strings.Contains(err.Error(), "Starlight") {
+		t.Fatalf("migrate to 7: err = %v, want the duplicate pair named", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&n); err != nil || n != 3 {
+		t.Errorf("%d songs left (err %v), want all 3 kept", n, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM songs WHERE id = (SELECT MAX(id) FROM songs WHERE title = 'Uprising')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := goose.UpTo(db, dir, 7); err != nil {
+		t.Errorf("migrate to 7 without duplicates: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+)
+
+func TestGetByIDFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewSongRepository(db, WithLogger(logger.NoopLogger{}))
+	cause := errors.New("connection refused")
+	mock.ExpectQuery(`WHERE id = \$1 AND deleted_at IS NULL`).WithArgs(int64(1)).WillReturnError(cause)
+
+	song, err := repo.GetByID(context.Background(), 1)
+	if song != nil || !errors.Is(err, cause) || errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("GetByID = %v, %v; want the database error, not ErrSongNotFound", song, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
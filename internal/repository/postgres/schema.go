@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// SearchPathParam returns the DSN parameter that makes every connection use
+// schema as its search_path, so unqualified table names (in the repository
+// and in migrations) resolve to it. It returns "" for an empty schema.
+func SearchPathParam(schema string) string {
+	if schema == "" {
+		return ""
+	}
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(pq.QuoteIdentifier(schema))
+	return "search_path='" + value + "'"
+}
+
+// StatementTimeoutParam returns the DSN parameter that makes the server
+// cancel any statement on the connection running longer than d, whatever the
+// caller's context says. It applies to migrations as well. It returns "" for
+// a non-positive d, leaving statements unbounded.
+func StatementTimeoutParam(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return "statement_timeout=" + strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+// CheckCollation returns an error unless collation is a collation known to
+// the database. An empty collation (the database default) is always valid.
+func CheckCollation(ctx context.Context, db *sql.DB, collation string) error {
+	if collation == "" {
+		return nil
+	}
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM pg_collation WHERE collname = $1)`
+	if err := db.QueryRowContext(ctx, query, collation).Scan(&exists); err != nil {
+		return errors.Wrap(err, "failed to look up collation")
+	}
+	if !exists {
+		return errors.Errorf("unknown collation %q", collation)
+	}
+	return nil
+}
+
+// EnsureSchema creates schema if it does not exist yet.
+func EnsureSchema(ctx context.Context, db *sql.DB, schema string) error {
+	if schema == "" {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(schema)); err != nil {
+		return errors.Wrapf(err, "failed to create schema %s", schema)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestSearchPathParam(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"songs":      `search_path='"songs"'`,
+		"Mixed Case": `search_path='"Mixed Case"'`,
+		`it's`:       `search_path='"it\'s"'`,
+		`a"b`:        `search_path='"a""b"'`,
+	}
+	for schema, want := range tests {
+		if got := SearchPathParam(schema); got != want {
+			t.Errorf("SearchPathParam(%q) = %s, want %s", schema, got, want)
+		}
+	}
+}
+
+func TestStatementTimeoutParam(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                      "",
+		-time.Second:           "",
+		250 * time.Millisecond: "statement_timeout=250",
+		30 * time.Second:       "statement_timeout=30000",
+	}
+	for d, want := range tests {
+		if got := StatementTimeoutParam(d); got != want {
+			t.Errorf("StatementTimeoutParam(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// TestStatementTimeout runs against the database named by
+// TEST_DATABASE_DSN (e.g. "host=localhost user=postgres sslmode=disable")
+// and is skipped without one.
+func TestStatementTimeout(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := sql.Open("postgres", dsn+" "+StatementTimeoutParam(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	_, err = db.ExecContext(context.Background(), "SELECT pg_sleep(5)")
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "57014" {
+		t.Fatalf("err = %v, want the statement cancelled (57014)", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancelled after %v, want about 100ms", elapsed)
+	}
+}
+
+func TestEnsureSchema(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	ctx := context.Background()
+
+	if err := EnsureSchema(ctx, repo.db, ""); err != nil {
+		t.Fatalf("EnsureSchema without a schema: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE SCHEMA IF NOT EXISTS "tenant; DROP TABLE songs"`)).
+		WillReturnResult(sqlmockResult(0))
+	if err := EnsureSchema(ctx, repo.db, "tenant; DROP TABLE songs"); err != nil {
+		t.Fatalf("EnsureSchema: %v", err)
+	}
+
+	mock.ExpectExec("CREATE SCHEMA").WillReturnError(errors.New("permission denied"))
+	if err := EnsureSchema(ctx, repo.db, "songs"); err == nil {
+		t.Error("want the failure to create the schema reported")
+	}
+}
+
+func TestCheckCollation(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	ctx := context.Background()
+
+	if err := CheckCollation(ctx, repo.db, ""); err != nil {
+		t.Errorf("default collation: %v", err)
+	}
+
+	lookup := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM pg_collation WHERE collname = $1)`)
+	mock.ExpectQuery(lookup).WithArgs("ru_RU").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(lookup).WithArgs("xx_XX").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if err := CheckCollation(ctx, repo.db, "ru_RU"); err != nil {
+		t.Errorf("known collation: %v", err)
+	}
+	if err := CheckCollation(ctx, repo.db, "xx_XX"); err == nil {
+		t.Error("unknown collation accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"song-library-test-task/internal/logger"
+)
+
+// The query helpers below run a statement on r.conn() and log a warning when
+// it takes longer than r.slowQuery. For QueryContext only the time to the
+// first row is measured, not the iteration over the result set.
+
+func (r *songRepository) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer r.logIfSlow(ctx, time.Now(), query)
+	return r.conn().QueryContext(ctx, query, args...)
+}
+
+func (r *songRepository) queryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer r.logIfSlow(ctx, time.Now(), query)
+	return r.conn().QueryRowContext(ctx, query, args...)
+}
+
+func (r *songRepository) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer r.logIfSlow(ctx, time.Now(), query)
+	return r.conn().ExecContext(ctx, query, args...)
+}
+
+func (r *songRepository) logIfSlow(ctx context.Context, start time.Time, query string) {
+	if r.slowQuery <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > r.slowQuery {
+		r.logFor(ctx).Warn("slow query", "elapsed", elapsed, "query", strings.Join(strings.Fields(query), " "))
+	}
+}
+
+// logFor returns the repository logger tagged with the trace ID of the
+// request ctx belongs to.
+func (r *songRepository) logFor(ctx context.Context) logger.Logger {
+	if id := logger.TraceIDFromContext(ctx); id != "" {
+		return logger.With(r.log, "trace_id", id)
+	}
+	return r.log
+}
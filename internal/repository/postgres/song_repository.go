@@ -4,79 +4,262 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"song-library-test-task/internal/logger"
 	"song-library-test-task/internal/models"
 	"strings"
+	"time"
 )
 
+// songColumns is the column list selected for a full models.Song, in the
+// order scanSong expects.
+const songColumns = `
+            id,
+            group_name,
+            title,
+            release_date,
+            link,
+            text,
+            is_public,
+            enriched_at,
+            created_at,
+            updated_at`
+
 // songRepository is a Postgres-based implementation of domain.SongRepository.
 type songRepository struct {
 	db *sql.DB
+	// tx, when set, is the transaction every statement runs in (see BeginTx).
+	tx *sql.Tx
+	// collation, when set, is used to sort group names.
+	collation string
+	log       logger.Logger
+	// slowQuery is the duration above which a query is logged as slow;
+	// zero disables the check.
+	slowQuery time.Duration
+}
+
+// Option configures optional songRepository behaviour.
+type Option func(*songRepository)
+
+// WithSortCollation sorts group names using the given Postgres collation
+// (e.g. "en_US", "ru_RU") instead of the database default. See
+// CheckCollation for validating the name at startup.
+func WithSortCollation(collation string) Option {
+	return func(r *songRepository) {
+		r.collation = collation
+	}
+}
+
+// WithLogger sets the logger slow queries are reported to; nil discards
+// them.
+func WithLogger(l logger.Logger) Option {
+	return func(r *songRepository) {
+		if l == nil {
+			l = logger.NoopLogger{}
+		}
+		r.log = l
+	}
+}
+
+// WithSlowQueryThreshold logs a warning for every query taking longer than
+// d; zero disables the check.
+func WithSlowQueryThreshold(d time.Duration) Option {
+	return func(r *songRepository) {
+		r.slowQuery = d
+	}
 }
 
 // NewSongRepository returns a new instance of a Postgres song repository.
-func NewSongRepository(db *sql.DB) models.SongRepository {
-	return &songRepository{db: db}
+func NewSongRepository(db *sql.DB, opts ...Option) models.SongRepository {
+	r := &songRepository{
+		db:        db,
+		log:       logger.NewStdLogger(logger.LevelDebug),
+		slowQuery: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-// Create inserts a new song into the DB and returns the newly created ID.
+// groupOrder is the ORDER BY expression for sorting by group name.
+func (r *songRepository) groupOrder() string {
+	if r.collation == "" {
+		return "group_name"
+	}
+	return "group_name COLLATE " + pq.QuoteIdentifier(r.collation)
+}
+
+// Create inserts a new song into the DB and returns the newly created ID. The
+// insert and its history entry are written in one transaction.
 func (r *songRepository) Create(ctx context.Context, song *models.Song) (int64, error) {
 	query := `
-        INSERT INTO songs (group_name, title, release_date, link, text, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-        RETURNING id
-    `
+        INSERT INTO songs (group_name, title, release_date, link, text, enriched_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+        RETURNING ` + songColumns
 
-	var newID int64
-	err := r.db.QueryRowContext(
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	created, err := scanSong(tx.QueryRowContext(
 		ctx,
 		query,
 		song.GroupName,
 		song.Title,
-		song.ReleaseDate,
+		nullDate(song.ReleaseDate),
 		song.Link,
 		song.Text,
-	).Scan(&newID)
+		nullDate(song.EnrichedAt),
+	))
 	if err != nil {
+		if isValueTooLong(err) {
+			return 0, errors.Wrap(models.ErrValidation, "value too long for song column")
+		}
+		if isUniqueViolation(err) {
+			return 0, errors.Wrapf(models.ErrDuplicateSong, "%q - %q", song.GroupName, song.Title)
+		}
 		return 0, errors.Wrap(err, "failed to insert new song")
 	}
+	if err := r.in(tx).RecordHistory(ctx, created.ID, models.HistoryCreate, created); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit new song")
+	}
+	return created.ID, nil
+}
+
+// Upsert inserts song or, if a song with the same group and title exists,
+// replaces its release date, link and lyrics. It returns the song's ID and
+// whether it was created. The upsert and its history entry (a create or an
+// update) are written in one transaction.
+func (r *songRepository) Upsert(ctx context.Context, song *models.Song) (int64, bool, error) {
+	// xmax is 0 only for a freshly inserted row version.
+	query := `
+        INSERT INTO songs (group_name, title, release_date, link, text, enriched_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+        ON CONFLICT (group_name, title) WHERE deleted_at IS NULL DO UPDATE
+        SET
+            release_date = EXCLUDED.release_date,
+            link         = EXCLUDED.link,
+            text         = EXCLUDED.text,
+            updated_at   = NOW()
+        RETURNING ` + songColumns + `, (xmax = 0)`
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var created bool
+	stored, err := scanSong(extraColumns{tx.QueryRowContext(
+		ctx,
+		query,
+		song.GroupName,
+		song.Title,
+		nullDate(song.ReleaseDate),
+		song.Link,
+		song.Text,
+		nullDate(song.EnrichedAt),
+	), []interface{}{&created}})
+	if err != nil {
+		if isValueTooLong(err) {
+			return 0, false, errors.Wrap(models.ErrValidation, "value too long for song column")
+		}
+		return 0, false, errors.Wrap(err, "failed to upsert song")
+	}
+	op := models.HistoryUpdate
+	if created {
+		op = models.HistoryCreate
+	}
+	if err := r.in(tx).RecordHistory(ctx, stored.ID, op, stored); err != nil {
+		return 0, false, err
+	}
 
-	return newID, nil
+	if err := tx.Commit(); err != nil {
+		return 0, false, errors.Wrap(err, "failed to commit song upsert")
+	}
+	return stored.ID, created, nil
 }
 
-// GetByID retrieves a single song by its ID.
+// CreateBatch inserts all songs in a single transaction, each with its
+// history entry, and returns their new IDs in order. Either every song is
+// stored or none is.
+func (r *songRepository) CreateBatch(ctx context.Context, songs []models.Song) ([]int64, error) {
+	query := `
+        INSERT INTO songs (group_name, title, release_date, link, text, enriched_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+        RETURNING ` + songColumns
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare insert")
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, 0, len(songs))
+	for _, song := range songs {
+		created, err := scanSong(stmt.QueryRowContext(
+			ctx,
+			song.GroupName,
+			song.Title,
+			nullDate(song.ReleaseDate),
+			song.Link,
+			song.Text,
+			nullDate(song.EnrichedAt),
+		))
+		if err != nil {
+			if isValueTooLong(err) {
+				return nil, errors.Wrap(models.ErrValidation, "value too long for song column")
+			}
+			if isUniqueViolation(err) {
+				return nil, errors.Wrapf(models.ErrDuplicateSong, "%q - %q", song.GroupName, song.Title)
+			}
+			return nil, errors.Wrap(err, "failed to insert song batch")
+		}
+		if err := r.in(tx).RecordHistory(ctx, created.ID, models.HistoryCreate, created); err != nil {
+			return nil, err
+		}
+		ids = append(ids, created.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit song batch")
+	}
+	return ids, nil
+}
+
+// GetByID retrieves a single song by its ID. It returns models.ErrDeleted if
+// the song has been soft-deleted.
 func (r *songRepository) GetByID(ctx context.Context, id int64) (*models.Song, error) {
 	query := `
-        SELECT
-            id,
-            group_name,
-            title,
-            release_date,
-            link,
-            text,
-            created_at,
-            updated_at
+        SELECT ` + songColumns + `
         FROM songs
-        WHERE id = $1
+        WHERE id = $1 AND deleted_at IS NULL
         LIMIT 1
     `
+	if r.tx != nil {
+		query += " FOR UPDATE"
+	}
 
-	row := r.db.QueryRowContext(ctx, query, id)
+	row := r.queryRowContext(ctx, query, id)
 
-	var s models.Song
-	err := row.Scan(
-		&s.ID,
-		&s.GroupName,
-		&s.Title,
-		&s.ReleaseDate,
-		&s.Link,
-		&s.Text,
-		&s.CreatedAt,
-		&s.UpdatedAt,
-	)
+	s, err := scanSong(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, r.checkDeleted(ctx, id)
 		}
 		return nil, errors.Wrap(err, "failed to get song by ID")
 	}
@@ -84,76 +267,535 @@ func (r *songRepository) GetByID(ctx context.Context, id int64) (*models.Song, e
 	return &s, nil
 }
 
+// checkDeleted returns models.ErrDeleted if the song id exists but has been
+// soft-deleted, nil otherwise.
+func (r *songRepository) checkDeleted(ctx context.Context, id int64) error {
+	var deleted bool
+	query := `SELECT EXISTS (SELECT 1 FROM songs WHERE id = $1 AND deleted_at IS NOT NULL)`
+	if err := r.queryRowContext(ctx, query, id).Scan(&deleted); err != nil {
+		return errors.Wrap(err, "failed to look up deleted song")
+	}
+	if deleted {
+		return errors.Wrapf(models.ErrDeleted, "song %d", id)
+	}
+	return nil
+}
+
+// GetByGroupAndTitle retrieves a single song by its natural key (exact match).
+// If several rows share the key, the oldest one is returned.
+func (r *songRepository) GetByGroupAndTitle(ctx context.Context, groupName, title string) (*models.Song, error) {
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE group_name = $1 AND title = $2 AND deleted_at IS NULL
+        ORDER BY id
+        LIMIT 1
+    `
+
+	row := r.queryRowContext(ctx, query, groupName, title)
+
+	s, err := scanSong(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get song by group and title")
+	}
+
+	return &s, nil
+}
+
+// FindIDs looks up every key (exact match) in a single query and returns the
+// matching song IDs in the order of keys, 0 for keys with no song (or only a
+// private one if publicOnly is set). If several rows share a key, the oldest
+// one's ID is returned.
+func (r *songRepository) FindIDs(ctx context.Context, keys []models.SongKey, publicOnly bool) ([]int64, error) {
+	groups := make([]string, len(keys))
+	titles := make([]string, len(keys))
+	for i, k := range keys {
+		groups[i] = k.GroupName
+		titles[i] = k.Title
+	}
+
+	query := `
+        SELECT k.ord, COALESCE(s.id, 0)
+        FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS k(group_name, title, ord)
+        LEFT JOIN LATERAL (
+            SELECT id FROM songs
+            WHERE group_name = k.group_name AND title = k.title AND deleted_at IS NULL
+              AND (is_public OR NOT $3)
+            ORDER BY id
+            LIMIT 1
+        ) s ON TRUE
+    `
+
+	rows, err := r.queryContext(ctx, query, pq.Array(groups), pq.Array(titles), publicOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find song IDs")
+	}
+	defer rows.Close()
+
+	ids := make([]int64, len(keys))
+	for rows.Next() {
+		var ord, id int64
+		if err := rows.Scan(&ord, &id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan song ID")
+		}
+		ids[ord-1] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over song ID rows")
+	}
+
+	return ids, nil
+}
+
 // GetAll retrieves songs from the DB matching the filter (if any) and applies pagination.
 func (r *songRepository) GetAll(ctx context.Context, filter models.SongFilter, limit, offset int) ([]models.Song, error) {
 	baseQuery := `
-        SELECT
-            id,
-            group_name,
-            title,
-            release_date,
-            link,
-            text,
-            created_at,
-            updated_at
+        SELECT ` + songColumns + `
         FROM songs
     `
-	whereClauses := []string{}
+	if err := checkPage(limit, offset); err != nil {
+		return nil, err
+	}
+	where, args := buildWhere(filter)
+	baseQuery += where
+
+	order, err := r.listOrder(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add pagination
+	baseQuery += " ORDER BY " + order + pageClause(&args, limit, offset)
+
+	rows, err := r.queryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get songs")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// EachSong streams the songs matching the filter, in ID order, to fn one row
+// at a time instead of collecting them in a slice; a positive limit caps the
+// number of rows. Iteration stops at the first error returned by fn, which is
+// returned as is, or when ctx is done.
+func (r *songRepository) EachSong(ctx context.Context, filter models.SongFilter, limit int, fn func(models.Song) error) error {
+	where, args := buildWhere(filter)
+	query := "SELECT " + songColumns + " FROM songs" + where + " ORDER BY id"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.queryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to stream songs")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s, err := scanSong(rows)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row into Song")
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "error iterating over song rows")
+	}
+	return nil
+}
+
+// Count returns the number of songs matching the filter, i.e. the total GetAll
+// pages through.
+func (r *songRepository) Count(ctx context.Context, filter models.SongFilter) (int64, error) {
+	where, args := buildWhere(filter)
+
+	var total int64
+	if err := r.queryRowContext(ctx, "SELECT COUNT(*) FROM songs"+where, args...).Scan(&total); err != nil {
+		return 0, errors.Wrap(err, "failed to count songs")
+	}
+	return total, nil
+}
+
+// listOrder builds the ORDER BY clause of the song list from the filter's
+// whitelisted sort column and direction. A search without an explicit sort
+// column is ranked by relevance; it refers to buildWhere's $1.
+func (r *songRepository) listOrder(filter models.SongFilter) (string, error) {
+	if filter.SearchQuery != "" && filter.SortBy == "" {
+		return "ts_rank(search_vector, plainto_tsquery('english', $1)) DESC, id DESC", nil
+	}
+
+	dir := "DESC"
+	switch filter.SortDir {
+	case "", models.SortDesc:
+	case models.SortAsc:
+		dir = "ASC"
+	default:
+		return "", errors.Wrapf(models.ErrValidation, "unknown sort direction %q", filter.SortDir)
+	}
+
+	var column string
+	switch filter.SortBy {
+	case "", models.SortByID:
+		return "id " + dir, nil
+	case models.SortByTitle:
+		column = "title " + dir
+	case models.SortByGroupName:
+		column = r.groupOrder() + " " + dir
+	case models.SortByReleaseDate:
+		column = "release_date " + dir + " NULLS LAST"
+	default:
+		return "", errors.Wrapf(models.ErrValidation, "unknown sort column %q", filter.SortBy)
+	}
+	return column + ", id " + dir, nil
+}
+
+// buildWhere builds the WHERE clause (with a leading space) and its
+// positional arguments for the given filter. Soft-deleted songs never match.
+// The search query, when set, is always $1 so listOrder can rank by it.
+func buildWhere(filter models.SongFilter) (string, []interface{}) {
+	whereClauses := []string{"deleted_at IS NULL"}
 	args := []interface{}{}
 	argPos := 1
 
+	if filter.SearchQuery != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("search_vector @@ plainto_tsquery('english', $%d)", argPos))
+		args = append(args, filter.SearchQuery)
+		argPos++
+	}
+
+	// Empty values never produce a clause, so exact mode cannot turn into "= ''".
 	if filter.GroupName != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("group_name ILIKE $%d", argPos))
-		args = append(args, "%"+filter.GroupName+"%")
+		whereClauses = append(whereClauses, matchClause("group_name", filter.Match, argPos))
+		args = append(args, matchArg(filter.GroupName, filter.Match))
 		argPos++
 	}
 
 	if filter.Title != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("title ILIKE $%d", argPos))
-		args = append(args, "%"+filter.Title+"%")
+		whereClauses = append(whereClauses, matchClause("title", filter.Match, argPos))
+		args = append(args, matchArg(filter.Title, filter.Match))
 		argPos++
 	}
 
-	if len(whereClauses) > 0 {
-		baseQuery += " WHERE " + strings.Join(whereClauses, " AND ")
+	if !filter.ReleasedAfter.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("release_date >= $%d", argPos))
+		args = append(args, filter.ReleasedAfter)
+		argPos++
 	}
 
-	// Add pagination
-	baseQuery += fmt.Sprintf(" ORDER BY id DESC LIMIT %d OFFSET %d", limit, offset)
+	if !filter.ReleasedBefore.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("release_date <= $%d", argPos))
+		args = append(args, filter.ReleasedBefore)
+		argPos++
+	}
+
+	if filter.PublicOnly {
+		whereClauses = append(whereClauses, "is_public")
+	}
+
+	if filter.AfterID > 0 {
+		whereClauses = append(whereClauses, fmt.Sprintf("id < $%d", argPos))
+		args = append(args, filter.AfterID)
+		argPos++
+	}
+
+	return " WHERE " + strings.Join(whereClauses, " AND "), args
+}
+
+// matchClause builds the WHERE condition for column according to the match mode.
+func matchClause(column, match string, argPos int) string {
+	if match == models.MatchExact {
+		return fmt.Sprintf("%s = $%d", column, argPos)
+	}
+	return fmt.Sprintf(`%s ILIKE $%d ESCAPE '\'`, column, argPos)
+}
+
+// matchArg builds the query argument for value according to the match mode.
+func matchArg(value, match string) string {
+	if match == models.MatchExact {
+		return value
+	}
+	return "%" + escapeLike(value) + "%"
+}
+
+// likeEscaper escapes the LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// checkPage rejects a limit below 1 or a negative offset with
+// models.ErrPageOutOfRange; the upper bound on limit is the service's.
+func checkPage(limit, offset int) error {
+	if limit < 1 || offset < 0 {
+		return errors.Wrapf(models.ErrPageOutOfRange, "limit %d, offset %d", limit, offset)
+	}
+	return nil
+}
+
+// pageClause appends limit and offset to args and returns the LIMIT/OFFSET
+// clause binding them, so no values are interpolated into the query.
+func pageClause(args *[]interface{}, limit, offset int) string {
+	*args = append(*args, limit, offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(*args)-1, len(*args))
+}
 
-	rows, err := r.db.QueryContext(ctx, baseQuery, args...)
+// escapeLike escapes %, _ and \ in value for use in a LIKE/ILIKE pattern
+// with ESCAPE '\'.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// GetIDs returns only the IDs of the songs GetAll would return for the same
+// filter and pagination, which is much cheaper than selecting every column.
+func (r *songRepository) GetIDs(ctx context.Context, filter models.SongFilter, limit, offset int) ([]int64, error) {
+	if err := checkPage(limit, offset); err != nil {
+		return nil, err
+	}
+	where, args := buildWhere(filter)
+	order, err := r.listOrder(filter)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get songs")
+		return nil, err
+	}
+	query := "SELECT id FROM songs" + where + " ORDER BY " + order + pageClause(&args, limit, offset)
+
+	rows, err := r.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get song IDs")
 	}
 	defer rows.Close()
 
-	var songs []models.Song
+	var ids []int64
 	for rows.Next() {
-		var s models.Song
-		err := rows.Scan(
-			&s.ID,
-			&s.GroupName,
-			&s.Title,
-			&s.ReleaseDate,
-			&s.Link,
-			&s.Text,
-			&s.CreatedAt,
-			&s.UpdatedAt,
-		)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan row into Song")
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan song ID")
 		}
-		songs = append(songs, s)
+		ids = append(ids, id)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "error iterating over song rows")
+		return nil, errors.Wrap(err, "error iterating over song ID rows")
 	}
 
-	return songs, nil
+	return ids, nil
+}
+
+// GetIncompleteByGroup returns the songs of the group (exact match) that are
+// missing a release date, a link or lyrics.
+func (r *songRepository) GetIncompleteByGroup(ctx context.Context, groupName string) ([]models.Song, error) {
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE group_name = $1 AND deleted_at IS NULL
+          AND (release_date IS NULL OR link = '' OR text = '')
+        ORDER BY id
+    `
+
+	rows, err := r.queryContext(ctx, query, groupName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get incomplete songs")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// GetRecent returns the most recently created songs, newest first; only the
+// public ones if publicOnly is set.
+func (r *songRepository) GetRecent(ctx context.Context, publicOnly bool, limit int) ([]models.Song, error) {
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE deleted_at IS NULL
+    `
+	if publicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $1"
+
+	rows, err := r.queryContext(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get recent songs")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// ReleaseYears returns the distinct years songs were released in, ascending;
+// only those of public songs if publicOnly is set. Songs without a known
+// release date are skipped.
+func (r *songRepository) ReleaseYears(ctx context.Context, publicOnly bool) ([]int, error) {
+	query := `
+        SELECT DISTINCT EXTRACT(YEAR FROM release_date)::int
+        FROM songs
+        WHERE release_date IS NOT NULL AND deleted_at IS NULL
+    `
+	if publicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY 1"
+
+	rows, err := r.queryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get release years")
+	}
+	defer rows.Close()
+
+	var years []int
+	for rows.Next() {
+		var year int
+		if err := rows.Scan(&year); err != nil {
+			return nil, errors.Wrap(err, "failed to scan release year")
+		}
+		years = append(years, year)
+	}
+	return years, errors.Wrap(rows.Err(), "failed to iterate release years")
+}
+
+// SearchLyrics returns a page of the songs whose lyrics contain every word of
+// search.Query (English stemming, as plainto_tsquery), in search.Order.
+func (r *songRepository) SearchLyrics(ctx context.Context, search models.LyricsSearch, limit, offset int) ([]models.Song, error) {
+	order, err := r.searchOrder(search.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE to_tsvector('english', text) @@ plainto_tsquery('english', $1)
+          AND deleted_at IS NULL
+    `
+	if search.PublicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY " + order + " LIMIT $2 OFFSET $3"
+
+	rows, err := r.queryContext(ctx, query, search.Query, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search lyrics")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// searchOrder maps a whitelisted lyrics search ordering to its ORDER BY
+// expression; $1 is the search query.
+func (r *songRepository) searchOrder(order string) (string, error) {
+	switch order {
+	case models.SearchOrderRelevance:
+		return "ts_rank(to_tsvector('english', text), plainto_tsquery('english', $1)) DESC, id DESC", nil
+	case models.SearchOrderReleaseDate:
+		return "release_date DESC NULLS LAST, id DESC", nil
+	case models.SearchOrderGroup:
+		return r.groupOrder() + ", title, id", nil
+	}
+	return "", errors.Wrapf(models.ErrValidation, "unknown search order %q", order)
+}
+
+// indexLetter is the SQL counterpart of models.IndexLetter.
+const indexLetter = `CASE WHEN LEFT(title, 1) ~ '^[[:alpha:]]$' THEN UPPER(LEFT(title, 1)) ELSE '` + models.IndexOther + `' END`
+
+// GetByIndexLetter returns a page of the songs in the given alphabetical
+// index bucket (see models.IndexLetter), ordered by title.
+func (r *songRepository) GetByIndexLetter(ctx context.Context, letter string, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE ` + indexLetter + ` = $1 AND deleted_at IS NULL
+    `
+	if publicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY title, id LIMIT $2 OFFSET $3"
+
+	rows, err := r.queryContext(ctx, query, letter, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get songs by index letter")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// IndexLetters returns the alphabetical index buckets that have songs, in
+// order, with models.IndexOther last.
+func (r *songRepository) IndexLetters(ctx context.Context, publicOnly bool) ([]string, error) {
+	query := "SELECT DISTINCT " + indexLetter + " AS letter FROM songs WHERE deleted_at IS NULL"
+	if publicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY letter = '" + models.IndexOther + "', letter"
+
+	rows, err := r.queryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get index letters")
+	}
+	defer rows.Close()
+
+	var letters []string
+	for rows.Next() {
+		var letter string
+		if err := rows.Scan(&letter); err != nil {
+			return nil, errors.Wrap(err, "failed to scan index letter")
+		}
+		letters = append(letters, letter)
+	}
+	return letters, errors.Wrap(rows.Err(), "failed to iterate index letters")
 }
 
-// Update modifies an existing song's data in the DB.
+// GetSameReleaseDate returns a page of the songs released on the same day as
+// the song with the given ID, excluding that song, ordered by ID; only the
+// public ones if publicOnly is set. A song without a known release date
+// shares it with no other song.
+func (r *songRepository) GetSameReleaseDate(ctx context.Context, id int64, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	query := `
+        SELECT ` + songColumns + `
+        FROM songs
+        WHERE release_date = (SELECT release_date FROM songs WHERE id = $1 AND deleted_at IS NULL)
+          AND id <> $1 AND deleted_at IS NULL
+    `
+	if publicOnly {
+		query += " AND is_public = TRUE"
+	}
+	query += " ORDER BY id LIMIT $2 OFFSET $3"
+
+	rows, err := r.queryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get songs with the same release date")
+	}
+	defer rows.Close()
+
+	return scanSongs(rows)
+}
+
+// SetVisibility marks a song as public or private.
+func (r *songRepository) SetVisibility(ctx context.Context, id int64, public bool) error {
+	query := `UPDATE songs SET is_public = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL`
+
+	_, err := r.execContext(ctx, query, public, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to update song visibility")
+	}
+
+	return nil
+}
+
+// Update modifies an existing song's data in the DB. The update and its
+// history entry are written in one transaction; unknown or deleted songs are
+// left alone.
 func (r *songRepository) Update(ctx context.Context, song *models.Song) error {
 	query := `
         UPDATE songs
@@ -164,34 +806,414 @@ func (r *songRepository) Update(ctx context.Context, song *models.Song) error {
             link         = $4,
             text         = $5,
             updated_at   = NOW()
-        WHERE id = $6
-    `
+        WHERE id = $6 AND deleted_at IS NULL
+        RETURNING ` + songColumns
 
-	_, err := r.db.ExecContext(
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	updated, err := scanSong(tx.QueryRowContext(
 		ctx,
 		query,
 		song.GroupName,
 		song.Title,
-		song.ReleaseDate,
+		nullDate(song.ReleaseDate),
 		song.Link,
 		song.Text,
 		song.ID,
-	)
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
+		if isValueTooLong(err) {
+			return errors.Wrap(models.ErrValidation, "value too long for song column")
+		}
+		if isUniqueViolation(err) {
+			return errors.Wrapf(models.ErrDuplicateSong, "%q - %q", song.GroupName, song.Title)
+		}
 		return errors.Wrap(err, "failed to update song")
 	}
+	if err := r.in(tx).RecordHistory(ctx, updated.ID, models.HistoryUpdate, updated); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit song update")
+	}
+	return nil
+}
+
+// Merge stores the merged fields of target and soft-deletes the song sourceID
+// in one transaction, recording an update of the target and a deletion of
+// the source. It returns models.ErrSongNotFound, changing nothing, if either
+// song no longer exists.
+func (r *songRepository) Merge(ctx context.Context, target *models.Song, sourceID int64) error {
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	updated, err := scanSong(tx.QueryRowContext(ctx, `
+        UPDATE songs
+        SET
+            release_date = $1,
+            link         = $2,
+            text         = $3,
+            is_public    = $4,
+            updated_at   = NOW()
+        WHERE id = $5 AND deleted_at IS NULL
+        RETURNING `+songColumns, nullDate(target.ReleaseDate), target.Link, target.Text, target.IsPublic, target.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(models.ErrSongNotFound, "merge target")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to update merge target")
+	}
+	if err := r.in(tx).RecordHistory(ctx, updated.ID, models.HistoryUpdate, updated); err != nil {
+		return err
+	}
+
+	deleted, err := scanSong(tx.QueryRowContext(ctx,
+		`UPDATE songs SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING `+songColumns, sourceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(models.ErrSongNotFound, "merge source")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to delete merge source")
+	}
+	if err := r.in(tx).RecordHistory(ctx, deleted.ID, models.HistoryDelete, deleted); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit merge")
+	}
+	return nil
+}
+
+// ApplyMetadata applies every item in a single transaction, recording an
+// update of each song it changes, and returns the outcome of each item (one
+// of the models.Metadata* constants) in order. Either every item is applied
+// or none is.
+func (r *songRepository) ApplyMetadata(ctx context.Context, items []models.SongMetadata) ([]string, error) {
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	// Only rows a non-empty value would actually change are updated, so the
+	// returned rows tell updated songs apart from merely matched ones.
+	update, err := tx.PrepareContext(ctx, `
+        UPDATE songs
+        SET
+            release_date = COALESCE($3, release_date),
+            link         = COALESCE(NULLIF($4, ''), link),
+            text         = COALESCE(NULLIF($5, ''), text),
+            updated_at   = NOW()
+        WHERE group_name = $1 AND title = $2 AND deleted_at IS NULL
+          AND (($3::date IS NOT NULL AND release_date IS DISTINCT FROM $3::date)
+            OR ($4 <> '' AND link <> $4)
+            OR ($5 <> '' AND text <> $5))
+        RETURNING `+songColumns)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare metadata update")
+	}
+	defer update.Close()
+
+	exists, err := tx.PrepareContext(ctx, `SELECT EXISTS (SELECT 1 FROM songs WHERE group_name = $1 AND title = $2 AND deleted_at IS NULL)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare song lookup")
+	}
+	defer exists.Close()
+
+	outcomes := make([]string, 0, len(items))
+	for _, item := range items {
+		rows, err := update.QueryContext(ctx, item.Key.GroupName, item.Key.Title, nullDate(item.ReleaseDate), item.Link, item.Text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to apply metadata to %q - %q", item.Key.GroupName, item.Key.Title)
+		}
+		updated, err := scanSongs(rows)
+		rows.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to apply metadata to %q - %q", item.Key.GroupName, item.Key.Title)
+		}
+		for _, song := range updated {
+			if err := r.in(tx).RecordHistory(ctx, song.ID, models.HistoryUpdate, song); err != nil {
+				return nil, err
+			}
+		}
+		if len(updated) > 0 {
+			outcomes = append(outcomes, models.MetadataUpdated)
+			continue
+		}
+
+		var found bool
+		if err := exists.QueryRowContext(ctx, item.Key.GroupName, item.Key.Title).Scan(&found); err != nil {
+			return nil, errors.Wrap(err, "failed to look up song")
+		}
+		if found {
+			outcomes = append(outcomes, models.MetadataUnchanged)
+		} else {
+			outcomes = append(outcomes, models.MetadataUnmatched)
+		}
+	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit metadata")
+	}
+	return outcomes, nil
+}
+
+// MarkEnriched records that the song's external metadata was just fetched.
+func (r *songRepository) MarkEnriched(ctx context.Context, id int64) error {
+	query := `UPDATE songs SET enriched_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	if _, err := r.execContext(ctx, query, id); err != nil {
+		return errors.Wrap(err, "failed to mark song enriched")
+	}
 	return nil
 }
 
-// Delete removes a song record by ID.
+// Delete soft-deletes a song by ID: the row is kept with deleted_at set, so
+// Restore can bring it back. The deletion and its history entry are written
+// in one transaction.
 func (r *songRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM songs WHERE id = $1`
+	query := `UPDATE songs SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING ` + songColumns
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	deleted, err := scanSong(tx.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to delete song")
 	}
+	if err := r.in(tx).RecordHistory(ctx, deleted.ID, models.HistoryDelete, deleted); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit song deletion")
+	}
+	return nil
+}
+
+// Restore undoes the soft deletion of a song. It returns
+// models.ErrSongNotFound unless the song exists and is deleted, and
+// models.ErrDuplicateSong if a live song has taken its group and title. The
+// restore and its history entry, an update, are written in one transaction.
+func (r *songRepository) Restore(ctx context.Context, id int64) error {
+	query := `UPDATE songs SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL RETURNING ` + songColumns
+
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	restored, err := scanSong(tx.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(models.ErrSongNotFound, "deleted song %d", id)
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return errors.Wrapf(models.ErrDuplicateSong, "song %d", id)
+		}
+		return errors.Wrap(err, "failed to restore song")
+	}
+	if err := r.in(tx).RecordHistory(ctx, restored.ID, models.HistoryUpdate, restored); err != nil {
+		return err
+	}
 
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit song restore")
+	}
 	return nil
 }
+
+// HardDelete removes a song row for good, whether deleted or not.
+func (r *songRepository) HardDelete(ctx context.Context, id int64) error {
+	query := `DELETE FROM songs WHERE id = $1`
+
+	_, err := r.execContext(ctx, query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to hard-delete song")
+	}
+
+	return nil
+}
+
+// isValueTooLong reports whether err is a Postgres VARCHAR length violation.
+func isValueTooLong(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "string_data_right_truncation"
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// SuggestGroups returns group names starting with prefix (case-insensitive) in
+// alphabetical order; only groups with public songs, counting only those, if
+// publicOnly is set. Song counts are only computed when withCounts is set.
+func (r *songRepository) SuggestGroups(ctx context.Context, prefix string, publicOnly bool, limit int, withCounts bool) ([]models.GroupCount, error) {
+	count := "0"
+	if withCounts {
+		count = "COUNT(*)"
+	}
+	query := `
+        SELECT group_name, ` + count + `
+        FROM songs
+        WHERE group_name ILIKE $1 ESCAPE '\' AND deleted_at IS NULL` + groupVisibility(publicOnly) + `
+        GROUP BY group_name
+        ORDER BY ` + r.groupOrder() + `
+        LIMIT $2
+    `
+
+	rows, err := r.queryContext(ctx, query, escapeLike(prefix)+"%", limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to suggest groups")
+	}
+	defer rows.Close()
+
+	var groups []models.GroupCount
+	for rows.Next() {
+		var g models.GroupCount
+		if err := rows.Scan(&g.GroupName, &g.SongCount); err != nil {
+			return nil, errors.Wrap(err, "failed to scan group suggestion")
+		}
+		groups = append(groups, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over group rows")
+	}
+
+	return groups, nil
+}
+
+// ListGroupsPaged returns a page of groups starting with prefix
+// (case-insensitive, alphabetical) with their song counts, plus the total
+// number of matching groups. With publicOnly set only public songs are
+// counted, and groups without any are left out.
+func (r *songRepository) ListGroupsPaged(ctx context.Context, prefix string, publicOnly bool, limit, offset int) ([]models.GroupCount, int64, error) {
+	pattern := escapeLike(prefix) + "%"
+	where := `group_name ILIKE $1 ESCAPE '\' AND deleted_at IS NULL` + groupVisibility(publicOnly)
+
+	var total int64
+	countQuery := `SELECT COUNT(DISTINCT group_name) FROM songs WHERE ` + where
+	if err := r.queryRowContext(ctx, countQuery, pattern).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count groups")
+	}
+
+	query := `
+        SELECT group_name, COUNT(*)
+        FROM songs
+        WHERE ` + where + `
+        GROUP BY group_name
+        ORDER BY ` + r.groupOrder() + `
+        LIMIT $2 OFFSET $3
+    `
+
+	rows, err := r.queryContext(ctx, query, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list groups")
+	}
+	defer rows.Close()
+
+	var groups []models.GroupCount
+	for rows.Next() {
+		var g models.GroupCount
+		if err := rows.Scan(&g.GroupName, &g.SongCount); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to scan group")
+		}
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "error iterating over group rows")
+	}
+
+	return groups, total, nil
+}
+
+// groupVisibility is the condition SuggestGroups and ListGroupsPaged add to
+// consider only public songs.
+func groupVisibility(publicOnly bool) string {
+	if publicOnly {
+		return " AND is_public = TRUE"
+	}
+	return ""
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// extraColumns is a rowScanner for a row selecting songColumns followed by
+// more columns, which it reads into extra.
+type extraColumns struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (e extraColumns) Scan(dest ...interface{}) error {
+	return e.rowScanner.Scan(append(dest, e.extra...)...)
+}
+
+// scanSong reads a single row selected with songColumns.
+func scanSong(row rowScanner) (models.Song, error) {
+	var s models.Song
+	var releaseDate, enrichedAt sql.NullTime
+	err := row.Scan(
+		&s.ID,
+		&s.GroupName,
+		&s.Title,
+		&releaseDate,
+		&s.Link,
+		&s.Text,
+		&s.IsPublic,
+		&enrichedAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	s.ReleaseDate = releaseDate.Time
+	s.EnrichedAt = enrichedAt.Time
+	return s, err
+}
+
+// nullDate stores a zero time (unknown release date, never enriched) as NULL.
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// scanSongs reads every row of a query selecting the full song column list.
+func scanSongs(rows *sql.Rows) ([]models.Song, error) {
+	var songs []models.Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row into Song")
+		}
+		songs = append(songs, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over song rows")
+	}
+
+	return songs, nil
+}
@@ -0,0 +1,1022 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/testutil"
+)
+
+// songColumnNames are the columns of songColumns, for mocked result rows.
+var songColumnNames = []string{
+	"id", "group_name", "title", "release_date", "link", "text",
+	"is_public", "enriched_at", "created_at", "updated_at",
+}
+
+// newMockRepository returns a quiet repository over a sqlmock database whose
+// expectations must all be met by the end of the test.
+func newMockRepository(t *testing.T, opts ...Option) (*songRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	opts = append([]Option{WithLogger(logger.NewStdLogger(logger.LevelError))}, opts...)
+	return NewSongRepository(db, opts...).(*songRepository), mock
+}
+
+// songRows returns mocked result rows for songs in songColumnNames order.
+func songRows(songs ...models.Song) *sqlmock.Rows {
+	rows := sqlmock.NewRows(songColumnNames)
+	for _, s := range songs {
+		rows.AddRow(s.ID, s.GroupName, s.Title, nullTime(s.ReleaseDate), s.Link, s.Text,
+			s.IsPublic, nullTime(s.EnrichedAt), s.CreatedAt, s.UpdatedAt)
+	}
+	return rows
+}
+
+// sqlmockResult is the result of a statement affecting n rows.
+func sqlmockResult(n int64) driver.Result {
+	return sqlmock.NewResult(0, n)
+}
+
+// nullTime is the driver value of a nullable timestamp column.
+func nullTime(t time.Time) driver.Value {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func TestBuildWhereMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    models.SongFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "substring",
+			filter:    models.SongFilter{GroupName: "mu", Title: "up"},
+			wantWhere: ` WHERE deleted_at IS NULL AND group_name ILIKE $1 ESCAPE '\' AND title ILIKE $2 ESCAPE '\'`,
+			wantArgs:  []interface{}{"%mu%", "%up%"},
+		},
+		{
+			name:      "exact",
+			filter:    models.SongFilter{GroupName: "Muse", Title: "Uprising", Match: models.MatchExact},
+			wantWhere: " WHERE deleted_at IS NULL AND group_name = $1 AND title = $2",
+			wantArgs:  []interface{}{"Muse", "Uprising"},
+		},
+		{
+			name:      "exact with an empty group",
+			filter:    models.SongFilter{Title: "Uprising", Match: models.MatchExact},
+			wantWhere: " WHERE deleted_at IS NULL AND title = $1",
+			wantArgs:  []interface{}{"Uprising"},
+		},
+		{
+			name:      "exact with nothing to match",
+			filter:    models.SongFilter{Match: models.MatchExact},
+			wantWhere: " WHERE deleted_at IS NULL",
+			wantArgs:  []interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := buildWhere(tt.filter)
+			if where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestGetAllExactMatch(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	now := time.Now()
+	song := models.Song{ID: 1, GroupName: "Muse", Title: "Uprising", CreatedAt: now, UpdatedAt: now}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE deleted_at IS NULL AND group_name = $1 ORDER BY id DESC LIMIT $2 OFFSET $3")).
+		WithArgs("Muse", 10, 0).
+		WillReturnRows(songRows(song))
+
+	songs, err := repo.GetAll(context.Background(), models.SongFilter{GroupName: "Muse", Match: models.MatchExact}, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 1 || songs[0].Title != "Uprising" || !songs[0].ReleaseDate.IsZero() {
+		t.Errorf("songs = %+v", songs)
+	}
+}
+
+func TestGetIDs(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM songs WHERE deleted_at IS NULL AND group_name ILIKE $1 ESCAPE '\' ORDER BY id DESC LIMIT $2 OFFSET $3`)).
+		WithArgs("%muse%", 2, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(3))
+
+	ids, err := repo.GetIDs(context.Background(), models.SongFilter{GroupName: "muse"}, 2, 4)
+	if err != nil {
+		t.Fatalf("GetIDs: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int64{7, 3}) {
+		t.Errorf("ids = %v, want [7 3]", ids)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"Muse":     "Muse",
+		"100%":     `100\%`,
+		"a_b":      `a\_b`,
+		`back\`:    `back\\`,
+		`%_\`:      `\%\_\\`,
+		"":         "",
+		"AC/DC 5%": `AC/DC 5\%`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWildcardsMatchLiterally(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`title ILIKE $1 ESCAPE '\'`)).
+		WithArgs(`%100\%%`, 10, 0).
+		WillReturnRows(songRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE group_name ILIKE $1 ESCAPE '\'`)).
+		WithArgs(`\_%`, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"group_name", "count"}))
+
+	ctx := context.Background()
+	if _, err := repo.GetAll(ctx, models.SongFilter{Title: "100%"}, 10, 0); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if _, err := repo.SuggestGroups(ctx, "_", false, 5, false); err != nil {
+		t.Fatalf("SuggestGroups: %v", err)
+	}
+}
+
+func TestGetRecent(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(`WHERE deleted_at IS NULL\s+AND is_public = TRUE ORDER BY created_at DESC, id DESC LIMIT \$1`).
+		WithArgs(5).
+		WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Uprising", IsPublic: true}))
+	mock.ExpectQuery(`WHERE deleted_at IS NULL\s+ORDER BY created_at DESC, id DESC LIMIT \$1`).
+		WithArgs(5).
+		WillReturnRows(songRows())
+
+	songs, err := repo.GetRecent(context.Background(), true, 5)
+	if err != nil || len(songs) != 1 || songs[0].ID != 2 {
+		t.Errorf("public: songs = %v, err = %v", songs, err)
+	}
+	if _, err := repo.GetRecent(context.Background(), false, 5); err != nil {
+		t.Errorf("all: %v", err)
+	}
+}
+
+func TestReleaseYears(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(`SELECT DISTINCT EXTRACT\(YEAR FROM release_date\)::int\s+FROM songs\s+WHERE release_date IS NOT NULL AND deleted_at IS NULL\s+ORDER BY 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"year"}).AddRow(2001).AddRow(2009))
+
+	years, err := repo.ReleaseYears(context.Background(), false)
+	if err != nil || !reflect.DeepEqual(years, []int{2001, 2009}) {
+		t.Errorf("years = %v, err = %v; want [2001 2009]", years, err)
+	}
+}
+
+func TestPublicOnlyGroupsAndYears(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	ctx := context.Background()
+	mock.ExpectQuery(`deleted_at IS NULL AND is_public = TRUE\s+GROUP BY group_name`).
+		WithArgs("m%", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"group_name", "count"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(DISTINCT group_name) FROM songs WHERE group_name ILIKE $1 ESCAPE '\' AND deleted_at IS NULL AND is_public = TRUE`)).
+		WithArgs("m%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`deleted_at IS NULL AND is_public = TRUE\s+GROUP BY group_name`).
+		WithArgs("m%", 5, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"group_name", "count"}))
+	mock.ExpectQuery(`deleted_at IS NULL\s+AND is_public = TRUE ORDER BY 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"year"}))
+
+	if _, err := repo.SuggestGroups(ctx, "m", true, 5, true); err != nil {
+		t.Errorf("SuggestGroups: %v", err)
+	}
+	if _, _, err := repo.ListGroupsPaged(ctx, "m", true, 5, 0); err != nil {
+		t.Errorf("ListGroupsPaged: %v", err)
+	}
+	if _, err := repo.ReleaseYears(ctx, true); err != nil {
+		t.Errorf("ReleaseYears: %v", err)
+	}
+}
+
+func TestListGroupsPaged(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(DISTINCT group_name) FROM songs WHERE group_name ILIKE $1`)).
+		WithArgs("m%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`GROUP BY group_name\s+ORDER BY group_name\s+LIMIT \$2 OFFSET \$3`).
+		WithArgs("m%", 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"group_name", "count"}).AddRow("Metallica", 4).AddRow("Muse", 2))
+
+	groups, total, err := repo.ListGroupsPaged(context.Background(), "m", false, 2, 1)
+	if err != nil {
+		t.Fatalf("ListGroupsPaged: %v", err)
+	}
+	want := []models.GroupCount{{GroupName: "Metallica", SongCount: 4}, {GroupName: "Muse", SongCount: 2}}
+	if total != 3 || !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %+v of %d, want %+v of 3", groups, total, want)
+	}
+}
+
+func TestDeleteHistoryBefore(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM song_history WHERE occurred_at < $1`)).
+		WithArgs(cutoff).
+		WillReturnResult(sqlmockResult(3))
+
+	if n, err := repo.DeleteHistoryBefore(context.Background(), cutoff); err != nil || n != 3 {
+		t.Errorf("DeleteHistoryBefore = %d, %v; want 3", n, err)
+	}
+}
+
+func TestGetSameReleaseDate(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	release := time.Date(2009, time.September, 14, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WHERE release_date = \(SELECT release_date FROM songs WHERE id = \$1 AND deleted_at IS NULL\)\s+AND id <> \$1 AND deleted_at IS NULL\s+AND is_public = TRUE ORDER BY id LIMIT \$2 OFFSET \$3`).
+		WithArgs(int64(1), 10, 0).
+		WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Resistance", ReleaseDate: release, IsPublic: true}))
+	mock.ExpectQuery(`AND id <> \$1 AND deleted_at IS NULL\s+ORDER BY id LIMIT \$2 OFFSET \$3`).
+		WithArgs(int64(1), 10, 10).
+		WillReturnRows(songRows())
+
+	songs, err := repo.GetSameReleaseDate(context.Background(), 1, true, 10, 0)
+	if err != nil || len(songs) != 1 || songs[0].ID != 2 || !songs[0].ReleaseDate.Equal(release) {
+		t.Errorf("public: songs = %+v, err = %v", songs, err)
+	}
+	if songs, err := repo.GetSameReleaseDate(context.Background(), 1, false, 10, 10); err != nil || len(songs) != 0 {
+		t.Errorf("all: songs = %+v, err = %v", songs, err)
+	}
+}
+
+func TestFindIDs(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	// One query answers every pair; rows may come back in any order.
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS k(group_name, title, ord)`)).
+		WithArgs(pq.Array([]string{"Muse", "Muse", "Queen"}), pq.Array([]string{"Uprising", "Missing", "Innuendo"}), false).
+		WillReturnRows(sqlmock.NewRows([]string{"ord", "id"}).AddRow(3, 7).AddRow(1, 2).AddRow(2, 0))
+
+	ids, err := repo.FindIDs(context.Background(), []models.SongKey{
+		{GroupName: "Muse", Title: "Uprising"},
+		{GroupName: "Muse", Title: "Missing"},
+		{GroupName: "Queen", Title: "Innuendo"},
+	}, false)
+	if err != nil {
+		t.Fatalf("FindIDs: %v", err)
+	}
+	if want := []int64{2, 0, 7}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+func TestReleaseDateRoundTrip(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	release := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	song := models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: release}
+
+	// The release date is bound as a time.Time, and an unknown one as NULL.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO songs`).
+		WithArgs("Muse", "Uprising", release, "", "", nil).
+		WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising", ReleaseDate: release}))
+	mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO songs`).
+		WithArgs("Muse", "Demo", nil, "", "", nil).
+		WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Demo"}))
+	mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(int64(1)).
+		WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising", ReleaseDate: release}))
+	mock.ExpectQuery(`WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(int64(2)).
+		WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Demo"}))
+
+	ctx := context.Background()
+	if _, err := repo.Create(ctx, &song); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Demo"}); err != nil {
+		t.Fatalf("Create without a release date: %v", err)
+	}
+	if got, err := repo.GetByID(ctx, 1); err != nil || !got.ReleaseDate.Equal(release) {
+		t.Errorf("GetByID = %+v, %v; want released %v", got, err, release)
+	}
+	if got, err := repo.GetByID(ctx, 2); err != nil || !got.ReleaseDate.IsZero() {
+		t.Errorf("GetByID = %+v, %v; want an unknown release date", got, err)
+	}
+}
+
+func TestSortCollation(t *testing.T) {
+	tests := []struct {
+		collation, want string
+	}{
+		{"", "group_name"},
+		{"ru_RU", `group_name COLLATE "ru_RU"`},
+		{`x" ; DROP TABLE songs; --`, `group_name COLLATE "x"" ; DROP TABLE songs; --"`},
+	}
+	for _, tt := range tests {
+		repo, _ := newMockRepository(t, WithSortCollation(tt.collation))
+		if got := repo.groupOrder(); got != tt.want {
+			t.Errorf("collation %q: ORDER BY %s, want %s", tt.collation, got, tt.want)
+		}
+	}
+
+	// Group names are sorted by the database, so the accented "Émilie" sorts
+	// with the other E's under a locale collation; the query must ask for it.
+	repo, mock := newMockRepository(t, WithSortCollation("fr_FR"))
+	mock.ExpectQuery(regexp.QuoteMeta(`ORDER BY group_name COLLATE "fr_FR" ASC, id ASC`)).
+		WillReturnRows(songRows(
+			models.Song{ID: 2, GroupName: "Edith Piaf", Title: "La Vie en rose"},
+			models.Song{ID: 1, GroupName: "Émilie Simon", Title: "Désert"},
+			models.Song{ID: 3, GroupName: "Zaz", Title: "Je veux"},
+		))
+	mock.ExpectQuery(regexp.QuoteMeta(`GROUP BY group_name
+        ORDER BY group_name COLLATE "fr_FR"
+        LIMIT $2`)).
+		WithArgs("%", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"group_name", "count"}).AddRow("Edith Piaf", 0).AddRow("Émilie Simon", 0))
+
+	ctx := context.Background()
+	songs, err := repo.GetAll(ctx, models.SongFilter{SortBy: models.SortByGroupName, SortDir: models.SortAsc}, 10, 0)
+	if err != nil || len(songs) != 3 || songs[1].GroupName != "Émilie Simon" {
+		t.Errorf("GetAll = %+v, %v", songs, err)
+	}
+	if _, err := repo.SuggestGroups(ctx, "", false, 10, false); err != nil {
+		t.Errorf("SuggestGroups: %v", err)
+	}
+}
+
+func TestCountUsesListFilter(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	filter := models.SongFilter{GroupName: "mu", PublicOnly: true}
+	where, args := buildWhere(filter)
+
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM songs" + where)).
+		WithArgs(values...).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM songs" + where)).
+		WithArgs(append(values, 10, 0)...).
+		WillReturnRows(songRows())
+
+	if n, err := repo.Count(context.Background(), filter); err != nil || n != 12 {
+		t.Errorf("Count = %d, %v; want 12", n, err)
+	}
+	if _, err := repo.GetAll(context.Background(), filter, 10, 0); err != nil {
+		t.Errorf("GetAll: %v", err)
+	}
+}
+
+func TestEachSong(t *testing.T) {
+	threeSongs := func() *sqlmock.Rows {
+		return songRows(
+			models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"},
+			models.Song{ID: 2, GroupName: "Muse", Title: "Resistance"},
+			models.Song{ID: 3, GroupName: "Muse", Title: "Starlight"},
+		)
+	}
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name    string
+		limit   int
+		args    []driver.Value
+		stopAt  int64
+		cancel  bool
+		wantIDs []int64
+		wantErr error
+	}{
+		{"every row", 0, []driver.Value{"%mu%"}, 0, false, []int64{1, 2, 3}, nil},
+		{"limited", 3, []driver.Value{"%mu%", 3}, 0, false, []int64{1, 2, 3}, nil},
+		{"callback error", 0, []driver.Value{"%mu%"}, 2, false, []int64{1, 2}, errStop},
+		{"cancelled", 0, []driver.Value{"%mu%"}, 1, true, []int64{1}, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepository(t)
+			query := `FROM songs WHERE deleted_at IS NULL AND group_name ILIKE \$1 ESCAPE '\\' ORDER BY id`
+			if tt.limit > 0 {
+				query += ` LIMIT \$2`
+			}
+			mock.ExpectQuery(query).WithArgs(tt.args...).WillReturnRows(threeSongs()).RowsWillBeClosed()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var ids []int64
+			err := repo.EachSong(ctx, models.SongFilter{GroupName: "mu"}, tt.limit, func(s models.Song) error {
+				ids = append(ids, s.ID)
+				if s.ID == tt.stopAt {
+					if tt.cancel {
+						cancel()
+						return nil
+					}
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("callback saw %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestBuildWhereReleaseRange(t *testing.T) {
+	from := time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2009, time.December, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		filter    models.SongFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "after",
+			filter:    models.SongFilter{ReleasedAfter: from},
+			wantWhere: " WHERE deleted_at IS NULL AND release_date >= $1",
+			wantArgs:  []interface{}{from},
+		},
+		{
+			name:      "before",
+			filter:    models.SongFilter{ReleasedBefore: to},
+			wantWhere: " WHERE deleted_at IS NULL AND release_date <= $1",
+			wantArgs:  []interface{}{to},
+		},
+		{
+			name:      "both, after the name filters",
+			filter:    models.SongFilter{GroupName: "mu", ReleasedAfter: from, ReleasedBefore: to},
+			wantWhere: ` WHERE deleted_at IS NULL AND group_name ILIKE $1 ESCAPE '\' AND release_date >= $2 AND release_date <= $3`,
+			wantArgs:  []interface{}{"%mu%", from, to},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := buildWhere(tt.filter)
+			if where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSearchLyricsOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		opts  []Option
+		want  string
+	}{
+		{models.SearchOrderRelevance, nil, `ORDER BY ts_rank(to_tsvector('english', text), plainto_tsquery('english', $1)) DESC, id DESC LIMIT $2 OFFSET $3`},
+		{models.SearchOrderReleaseDate, nil, `ORDER BY release_date DESC NULLS LAST, id DESC LIMIT $2 OFFSET $3`},
+		{models.SearchOrderGroup, nil, `ORDER BY group_name, title, id LIMIT $2 OFFSET $3`},
+		{models.SearchOrderGroup, []Option{WithSortCollation("en-x-icu")}, `ORDER BY group_name COLLATE "en-x-icu", title, id LIMIT $2 OFFSET $3`},
+	}
+	for _, tt := range tests {
+		repo, mock := newMockRepository(t, tt.opts...)
+		mock.ExpectQuery(regexp.QuoteMeta(tt.want)).
+			WithArgs("pressure", 10, 0).
+			WillReturnRows(songRows())
+		if _, err := repo.SearchLyrics(context.Background(), models.LyricsSearch{Query: "pressure", Order: tt.order}, 10, 0); err != nil {
+			t.Errorf("order %q: %v", tt.order, err)
+		}
+	}
+
+	repo, _ := newMockRepository(t)
+	if _, err := repo.SearchLyrics(context.Background(), models.LyricsSearch{Query: "pressure", Order: "title; DROP TABLE songs"}, 10, 0); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("unknown order: err = %v, want ErrValidation without a query", err)
+	}
+}
+
+func TestIndexLetters(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT ` + indexLetter + ` AS letter FROM songs WHERE deleted_at IS NULL AND is_public = TRUE ORDER BY letter = '#', letter`)).
+		WillReturnRows(sqlmock.NewRows([]string{"letter"}).AddRow("A").AddRow("U").AddRow("#"))
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE `+indexLetter+` = $1 AND deleted_at IS NULL`)+`\s+ORDER BY title, id LIMIT \$2 OFFSET \$3`).
+		WithArgs("#", 20, 0).
+		WillReturnRows(songRows(models.Song{ID: 4, GroupName: "Muse", Title: "1984"}))
+
+	letters, err := repo.IndexLetters(context.Background(), true)
+	if err != nil || !reflect.DeepEqual(letters, []string{"A", "U", "#"}) {
+		t.Errorf("letters = %v, err = %v", letters, err)
+	}
+	songs, err := repo.GetByIndexLetter(context.Background(), models.IndexOther, false, 20, 0)
+	if err != nil || len(songs) != 1 || songs[0].Title != "1984" {
+		t.Errorf("songs = %+v, err = %v", songs, err)
+	}
+}
+
+func TestPagePlaceholders(t *testing.T) {
+	var queries []string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+		queries = append(queries, actual)
+		return sqlmock.QueryMatcherRegexp.Match(expected, actual)
+	})))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewSongRepository(db, WithLogger(logger.NoopLogger{}))
+	ctx := context.Background()
+	filter := models.SongFilter{GroupName: "Muse", PublicOnly: true}
+
+	mock.ExpectQuery(`FROM songs WHERE .* ORDER BY .* LIMIT \$2 OFFSET \$3$`).
+		WithArgs("%Muse%", 25, 50).
+		WillReturnRows(songRows())
+	if _, err := repo.GetAll(ctx, filter, 25, 50); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	mock.ExpectQuery(`SELECT id FROM songs WHERE .* LIMIT \$2 OFFSET \$3$`).
+		WithArgs("%Muse%", 7, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if _, err := repo.GetIDs(ctx, filter, 7, 0); err != nil {
+		t.Fatalf("GetIDs: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	placeholder := regexp.MustCompile(`\$\d+`)
+	for _, q := range queries {
+		if literal := regexp.MustCompile(`\d`).FindString(placeholder.ReplaceAllString(q, "")); literal != "" {
+			t.Errorf("query has a literal integer: %s", strings.Join(strings.Fields(q), " "))
+		}
+	}
+
+	t.Run("out of range", func(t *testing.T) {
+		for _, page := range [][2]int{{0, 0}, {-1, 0}, {10, -1}} {
+			if _, err := repo.GetAll(ctx, filter, page[0], page[1]); !errors.Is(err, models.ErrPageOutOfRange) {
+				t.Errorf("GetAll limit %d offset %d: err = %v, want ErrPageOutOfRange", page[0], page[1], err)
+			}
+			if _, err := repo.GetIDs(ctx, filter, page[0], page[1]); !errors.Is(err, models.ErrPageOutOfRange) {
+				t.Errorf("GetIDs limit %d offset %d: err = %v, want ErrPageOutOfRange", page[0], page[1], err)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	logs := &testutil.RecordingLogger{}
+	repo, mock := newMockRepository(t, WithLogger(logs), WithSlowQueryThreshold(time.Millisecond))
+	mock.ExpectQuery(`SELECT DISTINCT EXTRACT`).
+		WillDelayFor(10 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"year"}))
+	mock.ExpectQuery(`SELECT DISTINCT EXTRACT`).
+		WillReturnRows(sqlmock.NewRows([]string{"year"}))
+
+	if _, err := repo.ReleaseYears(logger.ContextWithTraceID(context.Background(), "trace-1"), false); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := logs.Find(logger.LevelWarn, "slow query")
+	if !ok {
+		t.Fatalf("no slow query warning in %+v", logs.Entries())
+	}
+	if id, _ := entry.Value("trace_id"); id != "trace-1" {
+		t.Errorf("slow query trace_id = %v, want trace-1", id)
+	}
+	if query, _ := entry.Value("query"); !strings.HasPrefix(query.(string), "SELECT DISTINCT EXTRACT(YEAR FROM release_date)::int FROM songs WHERE") {
+		t.Errorf("logged query = %q, want it on one line", query)
+	}
+
+	if _, err := repo.ReleaseYears(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(logs.Entries()); n != 1 {
+		t.Errorf("%d messages logged, want only the slow query", n)
+	}
+
+	t.Run("nil logger", func(t *testing.T) {
+		repo, mock := newMockRepository(t, WithLogger(nil), WithSlowQueryThreshold(time.Nanosecond))
+		mock.ExpectQuery(`SELECT DISTINCT EXTRACT`).
+			WillDelayFor(time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"year"}))
+		if _, err := repo.ReleaseYears(context.Background(), false); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	song := &models.Song{GroupName: "Muse", Title: "Uprising", Text: "v1"}
+	for created, op := range map[bool]string{true: models.HistoryCreate, false: models.HistoryUpdate} {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`ON CONFLICT \(group_name, title\) WHERE deleted_at IS NULL DO UPDATE[\s\S]+RETURNING[\s\S]+updated_at\s*, \(xmax = 0\)`).
+			WithArgs("Muse", "Uprising", nil, "", "v1", nil).
+			WillReturnRows(sqlmock.NewRows(append(songColumnNames, "created")).
+				AddRow(7, "Muse", "Uprising", nil, "", "v1", false, nil, time.Time{}, time.Time{}, created))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(7), op, snapshotOf{7, "Uprising"}).
+			WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+
+		id, gotCreated, err := repo.Upsert(context.Background(), song)
+		if err != nil || id != 7 || gotCreated != created {
+			t.Errorf("Upsert = %d, %v, %v; want 7, %v", id, gotCreated, err, created)
+		}
+	}
+}
+
+func TestGetAllSort(t *testing.T) {
+	tests := []struct {
+		sortBy, sortDir string
+		want            string
+	}{
+		{"", "", "ORDER BY id DESC LIMIT $1 OFFSET $2"},
+		{models.SortByID, models.SortAsc, "ORDER BY id ASC LIMIT $1 OFFSET $2"},
+		{models.SortByID, models.SortDesc, "ORDER BY id DESC LIMIT $1 OFFSET $2"},
+		{models.SortByTitle, models.SortAsc, "ORDER BY title ASC, id ASC LIMIT $1 OFFSET $2"},
+		{models.SortByTitle, models.SortDesc, "ORDER BY title DESC, id DESC LIMIT $1 OFFSET $2"},
+		{models.SortByGroupName, models.SortAsc, "ORDER BY group_name ASC, id ASC LIMIT $1 OFFSET $2"},
+		{models.SortByGroupName, "", "ORDER BY group_name DESC, id DESC LIMIT $1 OFFSET $2"},
+		{models.SortByReleaseDate, models.SortAsc, "ORDER BY release_date ASC NULLS LAST, id ASC LIMIT $1 OFFSET $2"},
+		{models.SortByReleaseDate, models.SortDesc, "ORDER BY release_date DESC NULLS LAST, id DESC LIMIT $1 OFFSET $2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortBy+" "+tt.sortDir, func(t *testing.T) {
+			repo, mock := newMockRepository(t)
+			mock.ExpectQuery(`WHERE deleted_at IS NULL\s+`+regexp.QuoteMeta(tt.want)+`$`).
+				WithArgs(10, 0).
+				WillReturnRows(songRows())
+			if _, err := repo.GetAll(context.Background(), models.SongFilter{SortBy: tt.sortBy, SortDir: tt.sortDir}, 10, 0); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		repo, _ := newMockRepository(t)
+		for _, filter := range []models.SongFilter{
+			{SortBy: "text"},
+			{SortBy: "id; DROP TABLE songs"},
+			{SortBy: models.SortByTitle, SortDir: "sideways"},
+		} {
+			if _, err := repo.GetAll(context.Background(), filter, 10, 0); !errors.Is(err, models.ErrValidation) {
+				t.Errorf("%+v: err = %v, want ErrValidation without a query", filter, err)
+			}
+		}
+	})
+}
+
+func TestMerge(t *testing.T) {
+	release := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	target := &models.Song{ID: 2, ReleaseDate: release, Link: "https://example.com/uprising", Text: "lyrics", IsPublic: true}
+	expectUpdate := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`UPDATE songs\s+SET\s+release_date = \$1,[\s\S]+WHERE id = \$5 AND deleted_at IS NULL\s+RETURNING`).
+			WithArgs(release, "https://example.com/uprising", "lyrics", true, int64(2)).
+			WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Uprising"}))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(2), models.HistoryUpdate, snapshotOf{2, "Uprising"}).
+			WillReturnResult(sqlmockResult(1))
+	}
+	softDelete := regexp.QuoteMeta(`UPDATE songs SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING`)
+
+	repo, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	expectUpdate(mock)
+	mock.ExpectQuery(softDelete).WithArgs(int64(1)).WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising (copy)"}))
+	mock.ExpectExec(`INSERT INTO song_history`).
+		WithArgs(int64(1), models.HistoryDelete, snapshotOf{1, "Uprising (copy)"}).
+		WillReturnResult(sqlmockResult(1))
+	mock.ExpectCommit()
+	if err := repo.Merge(context.Background(), target, 1); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	t.Run("source gone", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		expectUpdate(mock)
+		mock.ExpectQuery(softDelete).WithArgs(int64(1)).WillReturnRows(songRows())
+		mock.ExpectRollback()
+		if err := repo.Merge(context.Background(), target, 1); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("err = %v, want ErrSongNotFound with the update rolled back", err)
+		}
+	})
+}
+
+func TestMarkEnriched(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE songs SET enriched_at = NOW() WHERE id = $1 AND deleted_at IS NULL`)).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmockResult(1))
+	if err := repo.MarkEnriched(context.Background(), 3); err != nil {
+		t.Errorf("MarkEnriched: %v", err)
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	release := time.Date(2009, time.July, 16, 0, 0, 0, 0, time.UTC)
+	items := []models.SongMetadata{
+		{Key: models.SongKey{GroupName: "Muse", Title: "Uprising"}, ReleaseDate: release},
+		{Key: models.SongKey{GroupName: "Muse", Title: "Starlight"}, Link: "https://example.com/starlight"},
+		{Key: models.SongKey{GroupName: "Muse", Title: "Missing"}, Text: "lyrics"},
+	}
+	update := `UPDATE songs\s+SET\s+release_date = COALESCE\(\$3, release_date\)`
+	exists := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM songs WHERE group_name = $1 AND title = $2 AND deleted_at IS NULL)`)
+	uprising := models.Song{ID: 1, GroupName: "Muse", Title: "Uprising", ReleaseDate: release}
+
+	repo, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectPrepare(update)
+	mock.ExpectPrepare(exists)
+	mock.ExpectQuery(update).WithArgs("Muse", "Uprising", release, "", "").WillReturnRows(songRows(uprising))
+	mock.ExpectExec(`INSERT INTO song_history`).
+		WithArgs(int64(1), models.HistoryUpdate, snapshotOf{1, "Uprising"}).
+		WillReturnResult(sqlmockResult(1))
+	mock.ExpectQuery(update).WithArgs("Muse", "Starlight", nil, "https://example.com/starlight", "").WillReturnRows(songRows())
+	mock.ExpectQuery(exists).WithArgs("Muse", "Starlight").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(update).WithArgs("Muse", "Missing", nil, "", "lyrics").WillReturnRows(songRows())
+	mock.ExpectQuery(exists).WithArgs("Muse", "Missing").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectCommit()
+
+	outcomes, err := repo.ApplyMetadata(context.Background(), items)
+	if err != nil {
+		t.Fatalf("ApplyMetadata: %v", err)
+	}
+	want := []string{models.MetadataUpdated, models.MetadataUnchanged, models.MetadataUnmatched}
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("outcomes = %v, want %v", outcomes, want)
+	}
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectPrepare(update)
+		mock.ExpectPrepare(exists)
+		mock.ExpectQuery(update).WithArgs("Muse", "Uprising", release, "", "").WillReturnRows(songRows(uprising))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+		mock.ExpectQuery(update).WithArgs("Muse", "Starlight", nil, "https://example.com/starlight", "").WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+		if _, err := repo.ApplyMetadata(context.Background(), items[:2]); err == nil {
+			t.Error("ApplyMetadata succeeded, want the error with the first update rolled back")
+		}
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	get := `SELECT .+ FROM songs\s+WHERE id = \$1 AND deleted_at IS NULL`
+	checkDeleted := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM songs WHERE id = $1 AND deleted_at IS NOT NULL)`)
+	restore := regexp.QuoteMeta(`UPDATE songs SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL RETURNING`)
+
+	t.Run("live", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectQuery(get).WithArgs(int64(1)).WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}))
+		if song, err := repo.GetByID(ctx, 1); err != nil || song == nil || song.ID != 1 {
+			t.Errorf("GetByID = %v, %v", song, err)
+		}
+	})
+	t.Run("soft-deleted", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectQuery(get).WithArgs(int64(2)).WillReturnRows(songRows())
+		mock.ExpectQuery(checkDeleted).WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		if song, err := repo.GetByID(ctx, 2); !errors.Is(err, models.ErrDeleted) || song != nil {
+			t.Errorf("GetByID = %v, %v; want ErrDeleted", song, err)
+		}
+	})
+	t.Run("hard-deleted", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM songs WHERE id = $1`)).WithArgs(int64(3)).WillReturnResult(sqlmockResult(1))
+		mock.ExpectQuery(get).WithArgs(int64(3)).WillReturnRows(songRows())
+		mock.ExpectQuery(checkDeleted).WithArgs(int64(3)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		if err := repo.HardDelete(ctx, 3); err != nil {
+			t.Fatalf("HardDelete: %v", err)
+		}
+		if song, err := repo.GetByID(ctx, 3); err != nil || song != nil {
+			t.Errorf("GetByID = %v, %v; want nothing", song, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE songs SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING`)).
+			WithArgs(int64(1)).
+			WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+		if err := repo.Delete(ctx, 1); err != nil {
+			t.Errorf("Delete: %v", err)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(restore).WithArgs(int64(2)).WillReturnRows(songRows(models.Song{ID: 2, GroupName: "Muse", Title: "Starlight"}))
+		mock.ExpectExec(`INSERT INTO song_history`).
+			WithArgs(int64(2), models.HistoryUpdate, snapshotOf{2, "Starlight"}).
+			WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(restore).WithArgs(int64(1)).WillReturnRows(songRows())
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(restore).WithArgs(int64(4)).WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+		if err := repo.Restore(ctx, 2); err != nil {
+			t.Errorf("Restore: %v", err)
+		}
+		if err := repo.Restore(ctx, 1); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("restore a live song: err = %v, want ErrSongNotFound", err)
+		}
+		if err := repo.Restore(ctx, 4); !errors.Is(err, models.ErrDuplicateSong) {
+			t.Errorf("restore a taken key: err = %v, want ErrDuplicateSong", err)
+		}
+	})
+}
+
+func TestGetAllAfterID(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM songs WHERE deleted_at IS NULL AND group_name = $1 AND id < $2 ORDER BY id DESC LIMIT $3 OFFSET $4`)).
+		WithArgs("Muse", int64(40), 10, 0).
+		WillReturnRows(songRows(models.Song{ID: 39, GroupName: "Muse", Title: "Uprising"}))
+
+	songs, err := repo.GetAll(context.Background(), models.SongFilter{GroupName: "Muse", Match: models.MatchExact, AfterID: 40}, 10, 0)
+	if err != nil || len(songs) != 1 || songs[0].ID != 39 {
+		t.Errorf("GetAll = %v, %v", songs, err)
+	}
+}
+
+func TestGetAllSearchQuery(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM songs WHERE deleted_at IS NULL AND search_vector @@ plainto_tsquery('english', $1) AND group_name ILIKE $2 ESCAPE '\' `+
+		`ORDER BY ts_rank(search_vector, plainto_tsquery('english', $1)) DESC, id DESC LIMIT $3 OFFSET $4`)).
+		WithArgs("force us", "%muse%", 10, 0).
+		WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}))
+	if _, err := repo.GetAll(context.Background(), models.SongFilter{SearchQuery: "force us", GroupName: "muse"}, 10, 0); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+
+	t.Run("explicit sort", func(t *testing.T) {
+		repo, mock := newMockRepository(t)
+		mock.ExpectQuery(regexp.QuoteMeta(`WHERE deleted_at IS NULL AND search_vector @@ plainto_tsquery('english', $1) ORDER BY title ASC, id ASC LIMIT $2 OFFSET $3`)).
+			WithArgs("force", 10, 0).
+			WillReturnRows(songRows())
+		filter := models.SongFilter{SearchQuery: "force", SortBy: models.SortByTitle, SortDir: models.SortAsc}
+		if _, err := repo.GetAll(context.Background(), filter, 10, 0); err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+	})
+}
+
+// integrationDB returns a connection to a fresh, unmigrated schema of the
+// database named by TEST_DATABASE_DSN, skipping the test without a DSN. The
+// schema is dropped when the test ends.
+func integrationDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if err := EnsureSchema(context.Background(), admin, schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", dsn+" "+SearchPathParam(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	goose.SetBaseFS(nil)
+	return db
+}
+
+// integrationRepository returns a repository over a fully migrated
+// integrationDB.
+func integrationRepository(t *testing.T) *songRepository {
+	t.Helper()
+	db := integrationDB(t)
+	if err := goose.Up(db, "../../../db/migrations"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewSongRepository(db, WithLogger(logger.NewStdLogger(logger.LevelError))).(*songRepository)
+}
+
+// TestSearchQueryIntegration runs the full-text search against a real
+// database; see integrationRepository.
+func TestSearchQueryIntegration(t *testing.T) {
+	repo := integrationRepository(t)
+	ctx := context.Background()
+	for _, s := range []models.Song{
+		{GroupName: "Muse", Title: "Uprising", Text: "They will not force us\nThey will stop degrading us"},
+		{GroupName: "Muse", Title: "Starlight", Text: "Far away, the ship is taking me far away"},
+		{GroupName: "Queen", Title: "Bohemian Rhapsody", Text: "Is this the real life? Is this just fantasy?"},
+		{GroupName: "Forced Entry", Title: "Silence", Text: "quiet, far away"},
+	} {
+		if _, err := repo.Create(ctx, &s); err != nil {
+			t.Fatalf("create %q: %v", s.Title, err)
+		}
+	}
+
+	search := func(q string) string {
+		t.Helper()
+		songs, err := repo.GetAll(ctx, models.SongFilter{SearchQuery: q}, 10, 0)
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		names := make([]string, len(songs))
+		for i, s := range songs {
+			names[i] = s.Title
+		}
+		return strings.Join(names, ",")
+	}
+	// Results are ranked, so only queries with a single match or distinct
+	// ranks have a fixed order.
+	tests := map[string]string{
+		"degrade":      "Uprising",
+		"fantasy life": "Bohemian Rhapsody",
+		"queen":        "Bohemian Rhapsody",
+		"away":         "Starlight,Silence", // twice in Starlight
+		"submarine":    "",
+		"the is this":  "", // only stop words
+	}
+	for q, want := range tests {
+		if got := search(q); got != want {
+			t.Errorf("search %q = %q, want %q", q, got, want)
+		}
+	}
+	if got := strings.Split(search("forcing"), ","); len(got) != 2 {
+		t.Errorf("search \"forcing\" = %v, want the stemmed match in Uprising's lyrics and Forced Entry's name", got)
+	}
+
+	t.Run("updated lyrics", func(t *testing.T) {
+		song, err := repo.GetByGroupAndTitle(ctx, "Muse", "Starlight")
+		if err != nil || song == nil {
+			t.Fatalf("get Starlight: %v", err)
+		}
+		song.Text = "Our hopes and expectations, black holes and revelations"
+		if err := repo.Update(ctx, song); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got := search("revelations"); got != "Starlight" {
+			t.Errorf("after update: %q, want Starlight", got)
+		}
+		if got := search("ship"); got != "" {
+			t.Errorf("old lyrics still match: %q", got)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"song-library-test-task/internal/models"
+)
+
+// queryer is what the repository runs statements on: the pool, or the
+// transaction it was bound to by BeginTx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (r *songRepository) conn() queryer {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// BeginTx starts a transaction and returns a repository whose methods all
+// run in it. While it is open, GetByID locks the row it returns (SELECT ...
+// FOR UPDATE), so a check followed by a mutation cannot race another writer.
+func (r *songRepository) BeginTx(ctx context.Context) (models.SongRepositoryTx, error) {
+	if r.tx != nil {
+		return nil, errors.New("transaction already in progress")
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	bound := *r
+	bound.tx = tx
+	return &songRepositoryTx{songRepository: &bound}, nil
+}
+
+// songRepositoryTx is a songRepository bound to an open transaction.
+type songRepositoryTx struct {
+	*songRepository
+}
+
+func (t *songRepositoryTx) Commit() error { return t.tx.Commit() }
+
+func (t *songRepositoryTx) Rollback() error { return t.tx.Rollback() }
+
+// localTx is the transaction of a single repository call that writes more
+// than one statement. Outside BeginTx it is a transaction of its own; inside,
+// it is a savepoint of the enclosing transaction, so the call still applies
+// all or nothing while the enclosing transaction decides the final outcome.
+type localTx struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint bool
+	done      bool
+}
+
+// in returns a copy of r running its statements in tx, for the calls a
+// multi-statement method makes through the repository itself.
+func (r *songRepository) in(tx *localTx) *songRepository {
+	bound := *r
+	bound.tx = tx.Tx
+	return &bound
+}
+
+func (r *songRepository) beginTx(ctx context.Context) (*localTx, error) {
+	if r.tx == nil {
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &localTx{Tx: tx, ctx: ctx}, nil
+	}
+	if _, err := r.tx.ExecContext(ctx, `SAVEPOINT repository_call`); err != nil {
+		return nil, err
+	}
+	return &localTx{Tx: r.tx, ctx: ctx, savepoint: true}, nil
+}
+
+func (t *localTx) Commit() error {
+	if !t.savepoint {
+		return t.Tx.Commit()
+	}
+	return t.finish(`RELEASE SAVEPOINT repository_call`)
+}
+
+func (t *localTx) Rollback() error {
+	if !t.savepoint {
+		return t.Tx.Rollback()
+	}
+	return t.finish(`ROLLBACK TO SAVEPOINT repository_call`)
+}
+
+func (t *localTx) finish(stmt string) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, stmt)
+	return err
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+// TestServiceTransactions runs the service's check-then-mutate operations
+// against a mocked database and checks their statements share one
+// transaction that is rolled back when the mutation fails.
+func TestServiceTransactions(t *testing.T) {
+	ctx := context.Background()
+	lockSong := `WHERE id = \$1 AND deleted_at IS NULL\s+LIMIT 1\s+FOR UPDATE`
+	savepoint := `^SAVEPOINT repository_call$`
+	rollbackSavepoint := regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT repository_call`)
+	releaseSavepoint := regexp.QuoteMeta(`RELEASE SAVEPOINT repository_call`)
+	song := models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}
+	newService := func(t *testing.T) (*service.SongService, sqlmock.Sqlmock) {
+		repo, mock := newMockRepository(t)
+		return service.NewSongService(repo, testutil.NewFakeExternalClient(), service.WithLogger(logger.NoopLogger{})), mock
+	}
+
+	t.Run("update commits", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(song))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE songs\s+SET`).
+			WithArgs("Muse", "Resistance", nil, "", "", int64(1)).
+			WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Resistance"}))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+		mock.ExpectExec(releaseSavepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		if err := svc.UpdateSong(ctx, models.Song{ID: 1, GroupName: "Muse", Title: "Resistance"}); err != nil {
+			t.Errorf("UpdateSong: %v", err)
+		}
+	})
+
+	t.Run("failed update rolls back", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(song))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE songs\s+SET`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectExec(rollbackSavepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		if err := svc.UpdateSong(ctx, models.Song{ID: 1, GroupName: "Muse", Title: "Resistance"}); err == nil {
+			t.Error("UpdateSong succeeded, want the update failure")
+		}
+	})
+
+	t.Run("update of an unknown song rolls back", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(9)).WillReturnRows(songRows())
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(int64(9)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+		if err := svc.UpdateSong(ctx, models.Song{ID: 9, GroupName: "Muse", Title: "Resistance"}); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("err = %v, want ErrSongNotFound", err)
+		}
+	})
+
+	t.Run("visibility change commits", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(song))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE songs SET is_public = $1`)).WithArgs(true, int64(1)).WillReturnResult(sqlmockResult(1))
+		mock.ExpectCommit()
+		if err := svc.SetSongVisibility(ctx, 1, true); err != nil {
+			t.Errorf("SetSongVisibility: %v", err)
+		}
+	})
+
+	t.Run("failed reorder rolls back", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(models.Song{ID: 1, GroupName: "Muse", Title: "Uprising", Text: "a\n\nb"}))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE songs\s+SET`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectExec(rollbackSavepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		if _, err := svc.ReorderVerses(ctx, 1, []int{1, 0}); err == nil {
+			t.Error("ReorderVerses succeeded, want the update failure")
+		}
+	})
+
+	t.Run("failed delete rolls back", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(song))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE songs SET deleted_at = NOW\(\)`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectExec(rollbackSavepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		if err := svc.DeleteSong(ctx, 1); err == nil {
+			t.Error("DeleteSong succeeded, want the delete failure")
+		}
+	})
+
+	t.Run("failed commit", func(t *testing.T) {
+		svc, mock := newService(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockSong).WithArgs(int64(1)).WillReturnRows(songRows(song))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE songs SET deleted_at = NOW\(\)`).WillReturnRows(songRows(song))
+		mock.ExpectExec(`INSERT INTO song_history`).WillReturnResult(sqlmockResult(1))
+		mock.ExpectExec(releaseSavepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit().WillReturnError(errors.New("serialization failure"))
+		if err := svc.DeleteSong(ctx, 1); err == nil {
+			t.Error("DeleteSong succeeded, want the commit failure")
+		}
+	})
+}
+
+func TestBeginTxNested(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	tx, err := repo.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	if _, err := tx.BeginTx(context.Background()); err == nil {
+		t.Error("nested BeginTx succeeded")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Rollback: %v", err)
+	}
+}
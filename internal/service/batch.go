@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// Per-item outcomes of CreateSongs.
+const (
+	BatchItemCreated          = "created"
+	BatchItemEnrichmentFailed = "enrichment_failed"
+	BatchItemFailed           = "failed"
+)
+
+// NewSong is one song to create in a batch: its key plus the fields the
+// client already knows.
+type NewSong struct {
+	GroupName string
+	Title     string
+	Provided  SongInfo
+}
+
+// BatchItemResult is the outcome of creating a single song of a batch. ID is
+// set when Status is BatchItemCreated or BatchItemEnrichmentFailed; Err
+// explains BatchItemEnrichmentFailed and BatchItemFailed.
+type BatchItemResult struct {
+	ID     int64
+	Status string
+	Err    error
+}
+
+// CreateSongs creates every song of the batch, enriching them with at most
+// enrichConcurrency external calls in flight. Each enrichment runs in its own
+// sub-context bounded by the per-item enrichment timeout, so a slow external
+// call only affects its own item: that song is stored with the client's
+// fields and reported as BatchItemEnrichmentFailed. Results follow the order
+// of songs; one item failing does not stop the others.
+func (uc *SongService) CreateSongs(ctx context.Context, songs []NewSong) ([]BatchItemResult, error) {
+	uc.logFor(ctx).Info("createSongs", "count", len(songs))
+
+	if len(songs) > uc.maxPageSize {
+		return nil, fmt.Errorf("%w: at most %d songs may be created at once", models.ErrValidation, uc.maxPageSize)
+	}
+
+	results := make([]BatchItemResult, len(songs))
+	sem := make(chan struct{}, uc.enrichConcurrency)
+	var wg sync.WaitGroup
+	for i := range songs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = uc.createBatchItem(ctx, songs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func (uc *SongService) createBatchItem(ctx context.Context, s NewSong) BatchItemResult {
+	s.GroupName, s.Title = uc.songKey(s.GroupName, s.Title)
+	if s.GroupName == "" || s.Title == "" {
+		return BatchItemResult{Status: BatchItemFailed, Err: fmt.Errorf("%w: group and song are required", models.ErrValidation)}
+	}
+	if err := validateSongKey(s.GroupName, s.Title); err != nil {
+		return BatchItemResult{Status: BatchItemFailed, Err: err}
+	}
+
+	status := BatchItemCreated
+	itemCtx, cancel := context.WithTimeout(ctx, uc.itemEnrichTimeout)
+	songInfo, enrichErr := uc.fetchSongInfo(itemCtx, s.GroupName, s.Title)
+	cancel()
+	if enrichErr != nil {
+		if ctx.Err() != nil {
+			// The batch itself ran out of time; storing is pointless.
+			return BatchItemResult{Status: BatchItemFailed, Err: ctx.Err()}
+		}
+		status = BatchItemEnrichmentFailed
+		songInfo = &SongInfo{}
+	}
+
+	var enrichedAt time.Time
+	if enrichErr == nil {
+		enrichedAt = time.Now()
+	}
+	info := uc.mergeSongInfo(s.Provided, *songInfo)
+	if err := uc.checkRequiredLyrics(info); err != nil {
+		return BatchItemResult{Status: BatchItemFailed, Err: err}
+	}
+	if err := ctx.Err(); err != nil {
+		return BatchItemResult{Status: BatchItemFailed, Err: err}
+	}
+
+	id, err := uc.repo.Create(ctx, &models.Song{
+		GroupName:   s.GroupName,
+		Title:       s.Title,
+		ReleaseDate: info.ReleaseDate,
+		Link:        info.Link,
+		Text:        uc.storedText(info.Text),
+		EnrichedAt:  enrichedAt,
+	})
+	if err != nil {
+		return BatchItemResult{Status: BatchItemFailed, Err: fmt.Errorf("failed to create new song: %w", err)}
+	}
+	return BatchItemResult{ID: id, Status: status, Err: enrichErr}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// EnrichResult is the outcome of re-enriching a single song.
+type EnrichResult struct {
+	SongID int64
+	Err    error
+}
+
+// EnrichSong re-fetches the external metadata of an existing song and stores
+// every non-empty field it gets back.
+func (uc *SongService) EnrichSong(ctx context.Context, song *models.Song) error {
+	uc.logFor(ctx).Info("enrichSong", "id", song.ID)
+
+	songInfo, err := uc.fetchSongInfo(ctx, song.GroupName, song.Title)
+	if err != nil {
+		return fmt.Errorf("failed to fetch external data: %w", err)
+	}
+
+	if !songInfo.ReleaseDate.IsZero() {
+		song.ReleaseDate = songInfo.ReleaseDate
+	}
+	if songInfo.Link != "" {
+		song.Link = songInfo.Link
+	}
+	if songInfo.Text != "" {
+		song.Text = uc.storedText(songInfo.Text)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := uc.repo.Update(ctx, song); err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := uc.repo.MarkEnriched(ctx, song.ID); err != nil {
+		return fmt.Errorf("failed to mark song enriched: %w", err)
+	}
+	return nil
+}
+
+// EnrichSongByID re-enriches the song with the given ID, typically one
+// stored without enrichment while the external API was unavailable, and
+// returns it as stored afterwards.
+func (uc *SongService) EnrichSongByID(ctx context.Context, id int64) (*models.Song, error) {
+	song, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if song == nil {
+		return nil, models.ErrSongNotFound
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.EnrichSong(ctx, song); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	song, err = uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch enriched song: %w", err)
+	}
+	if song == nil {
+		return nil, models.ErrSongNotFound
+	}
+	return song, nil
+}
+
+// EnrichGroup re-enriches every song of the group that lacks metadata, with
+// at most enrichConcurrency external calls in flight. Results follow the
+// order of the songs found; a failure of one song does not stop the others.
+func (uc *SongService) EnrichGroup(ctx context.Context, groupName string) ([]EnrichResult, error) {
+	uc.logFor(ctx).Info("enrichGroup", "group", groupName)
+
+	if groupName == "" {
+		return nil, fmt.Errorf("%w: group is required", models.ErrValidation)
+	}
+	groupName, _ = uc.songKey(groupName, "")
+
+	songs, err := uc.repo.GetIncompleteByGroup(ctx, groupName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find songs to enrich: %w", err)
+	}
+
+	results := make([]EnrichResult, len(songs))
+	sem := make(chan struct{}, uc.enrichConcurrency)
+	var wg sync.WaitGroup
+	for i := range songs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = EnrichResult{
+				SongID: songs[i].ID,
+				Err:    uc.EnrichSong(ctx, &songs[i]),
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// fetchSongInfo calls the external API within the external time budget and
+// records the outcome in the enrichment counter.
+func (uc *SongService) fetchSongInfo(ctx context.Context, groupName, songTitle string) (*SongInfo, error) {
+	extCtx, cancel := uc.externalContext(ctx)
+	defer cancel()
+
+	songInfo, err := uc.client.FetchSongInfo(extCtx, groupName, songTitle)
+	if err != nil {
+		uc.enrichments.With("outcome", EnrichmentFailure).Add(1)
+		return nil, fmt.Errorf("%w: %w", models.ErrExternalAPI, err)
+	}
+	if songInfo.ReleaseDate.IsZero() && songInfo.Text == "" && songInfo.Link == "" {
+		uc.enrichments.With("outcome", EnrichmentEmpty).Add(1)
+	} else {
+		uc.enrichments.With("outcome", EnrichmentSuccess).Add(1)
+	}
+	return songInfo, nil
+}
+
+// externalContext derives the context for the external call. When ctx has a
+// deadline, the external call only gets externalBudget of the remaining time.
+func (uc *SongService) externalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	remaining := time.Until(deadline)
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*uc.externalBudget))
+}
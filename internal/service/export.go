@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"song-library-test-task/internal/models"
+)
+
+// exportColumns is the header row of ExportCSV; ImportCSV accepts it back.
+var exportColumns = []string{"id", "group", "title", "release_date", "link", "text"}
+
+// ExportCSV validates filter and returns a function streaming the matching
+// songs, in ID order, as CSV with a header row to w. Rows are written as they
+// are read from the database; at most the configured export row limit is
+// written. Validation errors are returned up front, so nothing has been
+// written yet when they occur.
+func (uc *SongService) ExportCSV(ctx context.Context, filter models.SongFilter) (func(w io.Writer) error, error) {
+	uc.logFor(ctx).Info("exportCSV", "filter", filter, "maxRows", uc.exportMaxRows)
+	filter = uc.storedFilter(filter)
+
+	if err := uc.validateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	return func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return err
+		}
+
+		record := make([]string, len(exportColumns))
+		err := uc.repo.EachSong(ctx, filter, uc.exportMaxRows, func(s models.Song) error {
+			record[0] = strconv.FormatInt(s.ID, 10)
+			record[1] = s.GroupName
+			record[2] = s.Title
+			record[3] = ""
+			if !s.ReleaseDate.IsZero() {
+				record[3] = s.ReleaseDate.Format(models.ReleaseDateLayout)
+			}
+			record[4] = s.Link
+			record[5] = s.Text
+			return cw.Write(record)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export songs: %w", err)
+		}
+
+		cw.Flush()
+		return cw.Error()
+	}, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// SongHistory returns a page of the recorded creates, updates and deletes of
+// song id, oldest first, and the total number of entries. The history of a
+// deleted song stays available. limit defaults to 20; a page out of range is
+// models.ErrPageOutOfRange.
+func (uc *SongService) SongHistory(ctx context.Context, id int64, limit, offset int) ([]models.HistoryEntry, int64, error) {
+	uc.logFor(ctx).Debug("songHistory", "id", id, "limit", limit, "offset", offset)
+
+	limit, offset, err := uc.page(limit, offset, 20)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	song, err := uc.repo.GetByID(ctx, id)
+	if err != nil && !errors.Is(err, models.ErrDeleted) {
+		return nil, 0, fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if song == nil && err == nil {
+		return nil, 0, models.ErrSongNotFound
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	entries, total, err := uc.repo.History(ctx, id, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get song history: %w", err)
+	}
+	return entries, total, nil
+}
+
+// PurgeHistory removes the history entries older than the retention set
+// with WithHistoryRetention and returns how many were removed. Without a
+// retention it removes nothing.
+func (uc *SongService) PurgeHistory(ctx context.Context) (int64, error) {
+	if uc.historyRetention <= 0 {
+		return 0, nil
+	}
+	n, err := uc.repo.DeleteHistoryBefore(ctx, time.Now().Add(-uc.historyRetention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge song history: %w", err)
+	}
+	uc.historyPurged.Add(float64(n))
+	if n > 0 {
+		uc.logFor(ctx).Info("purged expired song history", "count", n)
+	}
+	return n, nil
+}
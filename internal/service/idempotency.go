@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+const (
+	// IdempotencyKeyTTL is how long an idempotency key is remembered.
+	IdempotencyKeyTTL = 24 * time.Hour
+	// MaxIdempotencyKeyLength bounds the length of an idempotency key.
+	MaxIdempotencyKeyLength = 255
+)
+
+// CreateSongOnce is CreateSong guarded by a client-supplied idempotency key:
+// the first request with the key creates the song, a retry returns the ID of
+// that song (replayed is true) without calling the external API or storing
+// anything. A retry while the first request is still running fails with
+// models.ErrRequestInProgress. An empty key, or no store configured (see
+// WithIdempotencyStore), is a plain CreateSong.
+func (uc *SongService) CreateSongOnce(ctx context.Context, key, groupName, songTitle string, provided SongInfo) (id int64, warnings []string, replayed bool, err error) {
+	if key == "" || uc.idempotency == nil {
+		id, warnings, err = uc.CreateSong(ctx, groupName, songTitle, provided)
+		return id, warnings, false, err
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		return 0, nil, false, fmt.Errorf("%w: idempotency key exceeds %d characters", models.ErrValidation, MaxIdempotencyKeyLength)
+	}
+
+	existing, err := uc.idempotency.ReserveKey(ctx, key)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if existing != 0 {
+		uc.logFor(ctx).Info("createSong: replaying idempotent request", "id", existing)
+		return existing, nil, true, nil
+	}
+
+	id, warnings, err = uc.CreateSong(ctx, groupName, songTitle, provided)
+
+	// The request context may be the reason the create failed (e.g. the
+	// client timed out), so the key is settled on a context of its own.
+	settleCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err != nil {
+		if relErr := uc.idempotency.ReleaseKey(settleCtx, key); relErr != nil {
+			uc.logFor(ctx).Warn("createSong: failed to release idempotency key", "err", relErr)
+		}
+		return 0, nil, false, err
+	}
+	if compErr := uc.idempotency.CompleteKey(settleCtx, key, id); compErr != nil {
+		uc.logFor(ctx).Warn("createSong: failed to record idempotency key", "id", id, "err", compErr)
+	}
+	return id, warnings, false, nil
+}
+
+// PurgeIdempotencyKeys forgets the idempotency keys older than
+// IdempotencyKeyTTL and returns how many were removed.
+func (uc *SongService) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	if uc.idempotency == nil {
+		return 0, nil
+	}
+	n, err := uc.idempotency.DeleteKeysBefore(ctx, time.Now().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	if n > 0 {
+		uc.logFor(ctx).Info("purged expired idempotency keys", "count", n)
+	}
+	return n, nil
+}
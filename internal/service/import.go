@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"song-library-test-task/internal/models"
+)
+
+// ImportRowError describes why a single imported row was rejected, or, as a
+// warning, what went wrong with a row that was skipped or stored anyway.
+type ImportRowError struct {
+	Line   int
+	Reason string
+}
+
+// ImportSummary is the result of a bulk import.
+type ImportSummary struct {
+	Imported int
+	Skipped  int
+	Failed   int
+	Errors   []ImportRowError
+	Warnings []ImportRowError
+}
+
+// ImportCSV reads songs from a CSV stream and creates them one row at a time.
+// The first record is a header naming the columns: group and title are
+// required, release_date, link and text are optional and unknown columns (such
+// as the id column of ExportCSV) are ignored. Quoted fields may span several
+// lines.
+//
+// Every row is enriched like a CreateSongs item: when the external API fails
+// the song is stored with the row's fields and a warning. Rows whose group and
+// title already exist are skipped with a warning, so importing the same file
+// twice creates nothing new. Invalid rows are reported with the line they
+// start on and do not stop the import; reading stops after the configured
+// maximum number of rows.
+func (uc *SongService) ImportCSV(ctx context.Context, r io.Reader) (*ImportSummary, error) {
+	uc.logFor(ctx).Info("importCSV: start", "maxRows", uc.importMaxRows)
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CSV header: %v", models.ErrValidation, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"group", "title"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must contain a %q column", models.ErrValidation, required)
+		}
+	}
+
+	summary := &ImportSummary{}
+	for rows := 0; ; rows++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if rows == uc.importMaxRows {
+			summary.addError(line, fmt.Sprintf("import is limited to %d rows; this and the following rows were not read", uc.importMaxRows))
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+			}
+			summary.addError(line, err.Error())
+			continue
+		}
+
+		song, err := songFromRecord(record, columns)
+		if err != nil {
+			summary.addError(line, err.Error())
+			continue
+		}
+		uc.importRow(ctx, line, song, summary)
+	}
+
+	uc.logFor(ctx).Info("importCSV: done", "imported", summary.Imported, "skipped", summary.Skipped, "failed", summary.Failed)
+	return summary, nil
+}
+
+// importRow creates song unless a song with its group and title exists.
+func (uc *SongService) importRow(ctx context.Context, line int, song models.Song, summary *ImportSummary) {
+	song.GroupName, song.Title = uc.songKey(song.GroupName, song.Title)
+	existing, err := uc.repo.GetByGroupAndTitle(ctx, song.GroupName, song.Title)
+	if err != nil {
+		summary.addError(line, fmt.Sprintf("failed to check for an existing song: %v", err))
+		return
+	}
+	if existing != nil {
+		uc.logFor(ctx).Warn("importCSV: skipping existing song", "line", line, "id", existing.ID)
+		summary.Skipped++
+		summary.addWarning(line, fmt.Sprintf("song already exists with id %d; skipped", existing.ID))
+		return
+	}
+
+	result := uc.createBatchItem(ctx, NewSong{
+		GroupName: song.GroupName,
+		Title:     song.Title,
+		Provided:  SongInfo{ReleaseDate: song.ReleaseDate, Text: song.Text, Link: song.Link},
+	})
+	switch result.Status {
+	case BatchItemFailed:
+		summary.addError(line, result.Err.Error())
+	case BatchItemEnrichmentFailed:
+		summary.Imported++
+		summary.addWarning(line, "stored without enrichment: "+result.Err.Error())
+	default:
+		summary.Imported++
+	}
+}
+
+func (s *ImportSummary) addError(line int, reason string) {
+	s.Failed++
+	s.Errors = append(s.Errors, ImportRowError{Line: line, Reason: reason})
+}
+
+func (s *ImportSummary) addWarning(line int, reason string) {
+	s.Warnings = append(s.Warnings, ImportRowError{Line: line, Reason: reason})
+}
+
+// songFromRecord builds and validates a song from a CSV record.
+func songFromRecord(record []string, columns map[string]int) (models.Song, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	song := models.Song{
+		GroupName: field("group"),
+		Title:     field("title"),
+		Link:      field("link"),
+		Text:      field("text"),
+	}
+	if song.GroupName == "" || song.Title == "" {
+		return song, fmt.Errorf("%w: group and title are required", models.ErrValidation)
+	}
+	if err := validateSongKey(song.GroupName, song.Title); err != nil {
+		return song, err
+	}
+	// An empty release date is left for the enrichment to fill in.
+	if date := field("release_date"); date != "" {
+		t, ok := models.ParseReleaseDate(date)
+		if !ok {
+			return song, fmt.Errorf("%w: invalid release_date %q", models.ErrValidation, date)
+		}
+		song.ReleaseDate = t
+	}
+	return song, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"song-library-test-task/internal/models"
+)
+
+// VerseSeparator is the canonical separator between verses in stored lyrics.
+const VerseSeparator = "\n\n"
+
+// SplitBlankLine is the verse splitting strategy used for stored lyrics:
+// verses are separated by blank lines.
+const SplitBlankLine = "blankline"
+
+// NormalizeLyrics converts text to the canonical stored form: LF line
+// endings, no trailing whitespace on lines, no leading or trailing blank
+// lines, and verses separated by exactly one blank line (VerseSeparator)
+// however many blank lines the source used.
+func NormalizeLyrics(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// storedText returns text in the form it is stored in: canonical when lyrics
+// normalization is enabled, unchanged otherwise.
+func (uc *SongService) storedText(text string) string {
+	if !uc.normalizeLyrics {
+		return text
+	}
+	return NormalizeLyrics(text)
+}
+
+// PreviewVerses splits text into verses exactly as it would be split had it
+// been stored as a song's lyrics, without storing anything. strategy may be
+// empty or SplitBlankLine, the only strategy supported so far.
+func (uc *SongService) PreviewVerses(text, strategy string) ([]string, error) {
+	if strategy != "" && strategy != SplitBlankLine {
+		return nil, fmt.Errorf("%w: strategy must be %q", models.ErrValidation, SplitBlankLine)
+	}
+	return splitByVerse(uc.storedText(text)), nil
+}
+
+// FormatLyricSheet renders song as a plain-text lyric sheet: a header with
+// "group — title", the release date and the link (each omitted when
+// unknown), a blank line, then the lyrics.
+func FormatLyricSheet(song models.Song) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s — %s\n", song.GroupName, song.Title)
+	if !song.ReleaseDate.IsZero() {
+		fmt.Fprintf(&b, "Released: %s\n", song.ReleaseDate.Format(models.ReleaseDateLayout))
+	}
+	if song.Link != "" {
+		fmt.Fprintf(&b, "Link: %s\n", song.Link)
+	}
+	if text := NormalizeLyrics(song.Text); text != "" {
+		b.WriteString("\n")
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// LyricSheetFilename returns "<group> - <title>.txt" with characters that are
+// unsafe in file names replaced by "_", or "song-<id>.txt" if nothing usable
+// is left.
+func LyricSheetFilename(song models.Song) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, song.GroupName+" - "+song.Title)
+	name = strings.Trim(name, " .")
+	if strings.Trim(name, "_- ") == "" {
+		return fmt.Sprintf("song-%d.txt", song.ID)
+	}
+	return name + ".txt"
+}
+
+// FormatLRC renders text as an LRC skeleton: one "[mm:ss.xx]" tag per
+// non-blank line. With a known duration the tags are spread evenly over it,
+// otherwise every tag is [00:00.00] and left for a timing tool to fill in.
+func FormatLRC(text string, duration time.Duration) string {
+	var lines []string
+	for _, line := range strings.Split(NormalizeLyrics(text), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		var at time.Duration
+		if duration > 0 {
+			at = duration * time.Duration(i) / time.Duration(len(lines))
+		}
+		fmt.Fprintf(&b, "[%s]%s\n", lrcTimestamp(at), line)
+	}
+	return b.String()
+}
+
+// lrcTimestamp formats d as mm:ss.xx (hundredths of a second).
+func lrcTimestamp(d time.Duration) string {
+	hundredths := d.Milliseconds() / 10
+	return fmt.Sprintf("%02d:%02d.%02d", hundredths/6000, hundredths/100%60, hundredths%100)
+}
+
+// Verse is a single verse of a song's lyrics, as returned in detailed mode.
+type Verse struct {
+	// Number is the 1-based position of the verse in the song.
+	Number int
+	Text   string
+	Lines  int
+}
+
+// VersePage is a page of a song's verses.
+type VersePage struct {
+	Verses []Verse
+	// Total is the number of verses in the song.
+	Total int
+	Page  int
+	// PageSize is the page size actually applied, which may be smaller than
+	// requested; use it to compute the following pages.
+	PageSize int
+}
+
+// GetSongVerses returns a page of the song's verses with their metadata.
+// Since each verse carries metadata, pageSize is capped at the configured
+// max page size; page numbering follows the capped size. With publicOnly set,
+// a private song is models.ErrSongNotFound.
+func (uc *SongService) GetSongVerses(ctx context.Context, id int64, publicOnly bool, page, pageSize int) (*VersePage, error) {
+	uc.logFor(ctx).Debug("getSongVerses", "id", id, "page", page, "pageSize", pageSize)
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > uc.maxPageSize {
+		pageSize = uc.maxPageSize
+	}
+
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	texts := splitByVerse(song.Text)
+	result := &VersePage{Verses: []Verse{}, Total: len(texts), Page: page, PageSize: pageSize}
+	start := (page - 1) * pageSize
+	for i := start; i < len(texts) && i < start+pageSize; i++ {
+		result.Verses = append(result.Verses, Verse{
+			Number: i + 1,
+			Text:   texts[i],
+			Lines:  strings.Count(texts[i], "\n") + 1,
+		})
+	}
+	return result, nil
+}
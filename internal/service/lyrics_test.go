@@ -0,0 +1,262 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/service"
+)
+
+func TestNormalizeLyrics(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"canonical", "one\ntwo\n\nthree", "one\ntwo\n\nthree"},
+		{"CRLF", "one\r\ntwo\r\n\r\nthree\r\n", "one\ntwo\n\nthree"},
+		{"CR", "one\r\rtwo", "one\n\ntwo"},
+		{"many blank lines", "one\n\n\n\n\ntwo", "one\n\ntwo"},
+		{"whitespace-only lines", "one\n  \t\n\ntwo", "one\n\ntwo"},
+		{"trailing whitespace", "one  \ntwo\t", "one\ntwo"},
+		{"leading and trailing blank lines", "\n\n one\n\n", " one"},
+		{"empty", "", ""},
+		{"only blank lines", "\n \n\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.NormalizeLyrics(tt.in); got != tt.want {
+				t.Errorf("NormalizeLyrics(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredLyricsNormalization(t *testing.T) {
+	ctx := context.Background()
+	const raw = "one\r\n\r\n\r\ntwo  \r\n"
+
+	svc, repo, _ := newService(t)
+	id, _, err := svc.UpsertSong(ctx, "Muse", "Uprising", service.SongInfo{Text: raw})
+	if err != nil {
+		t.Fatalf("UpsertSong: %v", err)
+	}
+	if song := stored(t, repo, id); song.Text != "one\n\ntwo" {
+		t.Errorf("stored text = %q, want it canonical", song.Text)
+	}
+	if err := svc.PatchSong(ctx, id, service.SongPatch{Text: ptr("a\r\n\r\n\r\nb")}); err != nil {
+		t.Fatalf("PatchSong: %v", err)
+	}
+	if song := stored(t, repo, id); song.Text != "a\n\nb" {
+		t.Errorf("patched text = %q, want it canonical", song.Text)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		svc, repo, _ := newService(t, service.WithLyricsNormalization(false))
+		id, _, err := svc.UpsertSong(ctx, "Muse", "Uprising", service.SongInfo{Text: raw})
+		if err != nil {
+			t.Fatalf("UpsertSong: %v", err)
+		}
+		if song := stored(t, repo, id); song.Text != raw {
+			t.Errorf("stored text = %q, want it as sent", song.Text)
+		}
+		if err := svc.PatchSong(ctx, id, service.SongPatch{Text: ptr("a\r\n\r\nb")}); err != nil {
+			t.Fatalf("PatchSong: %v", err)
+		}
+		if song := stored(t, repo, id); song.Text != "a\r\n\r\nb" {
+			t.Errorf("patched text = %q, want it as sent", song.Text)
+		}
+	})
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestFormatLRC(t *testing.T) {
+	const text = "one\ntwo\n\nthree\nfour"
+
+	if got, want := service.FormatLRC(text, 0), "[00:00.00]one\n[00:00.00]two\n[00:00.00]three\n[00:00.00]four\n"; got != want {
+		t.Errorf("without duration:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := service.FormatLRC(text, 4*time.Minute+2*time.Second), "[00:00.00]one\n[01:00.50]two\n[02:01.00]three\n[03:01.50]four\n"; got != want {
+		t.Errorf("with duration:\n%s\nwant:\n%s", got, want)
+	}
+	if got := service.FormatLRC("", time.Minute); got != "" {
+		t.Errorf("no lyrics = %q, want nothing", got)
+	}
+}
+
+func TestPreviewVersesMatchStoredLyrics(t *testing.T) {
+	ctx := context.Background()
+	texts := []string{
+		"one\ntwo\n\nthree",
+		"one\r\n\r\n\r\ntwo  \r\n",
+		"\n\n one\n \n\ntwo\n\n",
+		"single verse",
+	}
+	for _, normalize := range []bool{true, false} {
+		svc, _, _ := newService(t, service.WithLyricsNormalization(normalize))
+		for i, text := range texts {
+			preview, err := svc.PreviewVerses(text, "")
+			if err != nil {
+				t.Fatalf("PreviewVerses(%q): %v", text, err)
+			}
+			id, _, err := svc.UpsertSong(ctx, "Muse", fmt.Sprintf("Song %d", i), service.SongInfo{Text: text})
+			if err != nil {
+				t.Fatalf("UpsertSong: %v", err)
+			}
+			stored, _, err := svc.GetSongLyrics(ctx, id, false, 1, 100)
+			if err != nil {
+				t.Fatalf("GetSongLyrics: %v", err)
+			}
+			if !reflect.DeepEqual(preview, stored) {
+				t.Errorf("normalize=%v, %q: preview %q, stored song yields %q", normalize, text, preview, stored)
+			}
+		}
+	}
+}
+
+func TestPreviewVersesStrategy(t *testing.T) {
+	svc, _, _ := newService(t)
+	if verses, err := svc.PreviewVerses("one\n\ntwo", service.SplitBlankLine); err != nil || len(verses) != 2 {
+		t.Errorf("blankline: verses = %q, err = %v", verses, err)
+	}
+	if _, err := svc.PreviewVerses("one", "lines"); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("unknown strategy: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestSplitByDoubleNewline(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"only blank lines", "\n\n\r\n\r\n", []string{}},
+		{"single verse", "one\ntwo", []string{"one\ntwo"}},
+		{"multiple verses", "one\ntwo\n\nthree\n\nfour", []string{"one\ntwo", "three", "four"}},
+		{"CRLF", "one\r\ntwo\r\n\r\nthree", []string{"one\ntwo", "three"}},
+		{"mixed line endings", "one\r\n\ntwo\n\r\nthree", []string{"one", "two", "three"}},
+		{"runs of blank lines", "one\n\n\n\n\ntwo", []string{"one", "two"}},
+		{"trailing newlines", "one\n\ntwo\n\n\n", []string{"one", "two"}},
+		{"surrounding whitespace", "  one \n\n\ttwo\t", []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := service.SplitByDoubleNewline(tt.in)
+			if got == nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitByDoubleNewline(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSongLyrics(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one\r\n\r\ntwo\n\n\nthree\n"})
+
+	verses, total, err := svc.GetSongLyrics(ctx, id, false, 2, 2)
+	if err != nil || total != 3 || !reflect.DeepEqual(verses, []string{"three"}) {
+		t.Errorf("page 2 = %q of %d, err = %v; want [three] of 3", verses, total, err)
+	}
+	if verses, total, _ := svc.GetSongLyrics(ctx, id, false, 3, 2); len(verses) != 0 || total != 3 {
+		t.Errorf("past the end = %q of %d, want none of 3", verses, total)
+	}
+	if _, _, err := svc.GetSongLyrics(ctx, 42, false, 1, 2); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+func TestFormatLyricSheet(t *testing.T) {
+	tests := []struct {
+		name string
+		song models.Song
+		want string
+	}{
+		{
+			"full header",
+			models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), Link: "https://example.com", Text: "one\r\n\r\n\r\ntwo"},
+			"Muse — Uprising\nReleased: 2009-07-16\nLink: https://example.com\n\none\n\ntwo\n",
+		},
+		{
+			"unknown date and link",
+			models.Song{GroupName: "Muse", Title: "Uprising", Text: "one"},
+			"Muse — Uprising\n\none\n",
+		},
+		{
+			"no lyrics",
+			models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com"},
+			"Muse — Uprising\nLink: https://example.com\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.FormatLyricSheet(tt.song); got != tt.want {
+				t.Errorf("FormatLyricSheet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLyricSheetFilename(t *testing.T) {
+	tests := []struct {
+		group, title, want string
+	}{
+		{"Muse", "Uprising", "Muse - Uprising.txt"},
+		{"AC/DC", `What's "Next" to the Moon?`, `AC_DC - What's _Next_ to the Moon_.txt`},
+		{"Кино", "Группа крови", "Кино - Группа крови.txt"},
+		{"..", "line\nbreak", "- line_break.txt"},
+		{"/", "?", "song-7.txt"},
+	}
+	for _, tt := range tests {
+		song := models.Song{ID: 7, GroupName: tt.group, Title: tt.title}
+		if got := service.LyricSheetFilename(song); got != tt.want {
+			t.Errorf("LyricSheetFilename(%q, %q) = %q, want %q", tt.group, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestGetSongVersesCap(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(3))
+	verses := make([]string, 7)
+	for i := range verses {
+		verses[i] = fmt.Sprintf("verse %d\nline two", i+1)
+	}
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Exogenesis", Text: strings.Join(verses, "\n\n")})
+
+	page, err := svc.GetSongVerses(ctx, id, false, 1, 100)
+	if err != nil {
+		t.Fatalf("GetSongVerses: %v", err)
+	}
+	if len(page.Verses) != 3 || page.PageSize != 3 || page.Total != 7 {
+		t.Fatalf("page 1 = %d verses of %d with page size %d, want 3 of 7 with size 3", len(page.Verses), page.Total, page.PageSize)
+	}
+	if v := page.Verses[0]; v.Number != 1 || v.Text != "verse 1\nline two" || v.Lines != 2 {
+		t.Errorf("first verse = %+v", v)
+	}
+
+	// Pages follow the capped size, so walking them visits every verse once.
+	var numbers []int
+	for p := 1; p <= (page.Total+page.PageSize-1)/page.PageSize; p++ {
+		page, err := svc.GetSongVerses(ctx, id, false, p, 100)
+		if err != nil {
+			t.Fatalf("page %d: %v", p, err)
+		}
+		for _, v := range page.Verses {
+			numbers = append(numbers, v.Number)
+		}
+	}
+	if !reflect.DeepEqual(numbers, []int{1, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("verses across pages = %v, want 1 to 7", numbers)
+	}
+
+	if page, err := svc.GetSongVerses(ctx, id, false, 2, 2); err != nil || len(page.Verses) != 2 || page.Verses[0].Number != 3 {
+		t.Errorf("page 2 of 2 = %+v, err = %v; want verses 3 and 4", page, err)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"song-library-test-task/internal/models"
+)
+
+// Merge preferences: whose non-empty fields win when both songs have one.
+const (
+	MergePreferTarget = "target"
+	MergePreferSource = "source"
+)
+
+// MergeSongs merges the duplicate song sourceID into targetID and deletes
+// the source, in one transaction. Each field takes the preferred song's value
+// (prefer is MergePreferTarget when empty) unless that is empty, in which
+// case the other song's value is kept; the target keeps its group, title and
+// ID. It returns the merged song.
+func (uc *SongService) MergeSongs(ctx context.Context, sourceID, targetID int64, prefer string) (*models.Song, error) {
+	uc.logFor(ctx).Info("mergeSongs", "source", sourceID, "target", targetID, "prefer", prefer)
+
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: cannot merge a song into itself", models.ErrValidation)
+	}
+	switch prefer {
+	case "", MergePreferTarget, MergePreferSource:
+	default:
+		return nil, fmt.Errorf("%w: prefer must be %q or %q", models.ErrValidation, MergePreferTarget, MergePreferSource)
+	}
+
+	source, err := uc.repo.GetByID(ctx, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch source song: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	target, err := uc.repo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch target song: %w", err)
+	}
+	if source == nil || target == nil {
+		return nil, models.ErrSongNotFound
+	}
+
+	primary, secondary := target, source
+	if prefer == MergePreferSource {
+		primary, secondary = source, target
+	}
+	merged := *target
+	merged.ReleaseDate = firstNonZero(primary.ReleaseDate, secondary.ReleaseDate)
+	merged.Link = firstNonEmpty(primary.Link, secondary.Link)
+	merged.Text = firstNonEmpty(primary.Text, secondary.Text)
+	merged.IsPublic = primary.IsPublic
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.Merge(ctx, &merged, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to merge songs: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	song, err := uc.repo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch merged song: %w", err)
+	}
+	if song == nil {
+		return nil, models.ErrSongNotFound
+	}
+	return song, nil
+}
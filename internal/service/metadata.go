@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"song-library-test-task/internal/models"
+)
+
+// Formats accepted by ApplyMetadataFile.
+const (
+	MetadataFormatCSV  = "csv"
+	MetadataFormatJSON = "json"
+)
+
+// metadataBatchSize is the number of mapping rows applied per transaction.
+const metadataBatchSize = 100
+
+// UnmatchedRow is a mapping row for which no song exists.
+type UnmatchedRow struct {
+	Line int
+	Key  models.SongKey
+}
+
+// MetadataSummary is the result of ApplyMetadataFile. Matched counts the rows
+// that found a song, Updated those of them that changed it.
+type MetadataSummary struct {
+	Matched   int
+	Updated   int
+	Unmatched []UnmatchedRow
+	Errors    []ImportRowError
+}
+
+// metadataJSONRow is one entry of a JSON mapping file, named like the fields
+// of POST /songs.
+type metadataJSONRow struct {
+	GroupName   string `json:"group"`
+	Title       string `json:"song"`
+	ReleaseDate string `json:"releaseDate"`
+	Link        string `json:"link"`
+	Text        string `json:"text"`
+}
+
+type metadataRow struct {
+	line int
+	meta models.SongMetadata
+}
+
+// ApplyMetadataFile applies a curated mapping of group and title to release
+// date, link and lyrics to the existing songs with exactly that group and
+// title. Empty values leave a field unchanged. Rows are applied in batches,
+// each in its own transaction.
+//
+// A CSV mapping has a header row naming its columns, like ImportCSV: group and
+// title are required, release_date, link and text optional. A JSON mapping is
+// an array of {"group", "song", "releaseDate", "link", "text"} objects.
+// Errors are reported by line for CSV and by array position (from 1) for
+// JSON; invalid rows do not stop the others.
+func (uc *SongService) ApplyMetadataFile(ctx context.Context, format string, r io.Reader) (*MetadataSummary, error) {
+	uc.logFor(ctx).Info("applyMetadataFile: start", "format", format)
+
+	var next func() (metadataRow, error)
+	switch format {
+	case MetadataFormatCSV:
+		rows, err := newMetadataCSVReader(r)
+		if err != nil {
+			return nil, err
+		}
+		next = rows
+	case MetadataFormatJSON:
+		rows, err := newMetadataJSONReader(r)
+		if err != nil {
+			return nil, err
+		}
+		next = rows
+	default:
+		return nil, fmt.Errorf("%w: format must be %q or %q", models.ErrValidation, MetadataFormatCSV, MetadataFormatJSON)
+	}
+
+	summary := &MetadataSummary{}
+	batch := make([]metadataRow, 0, metadataBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *metadataRowError
+		if errors.As(err, &rowErr) {
+			summary.Errors = append(summary.Errors, ImportRowError{Line: rowErr.line, Reason: rowErr.err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row.meta.Text = uc.storedText(row.meta.Text)
+		row.meta.Key.GroupName, row.meta.Key.Title = uc.songKey(row.meta.Key.GroupName, row.meta.Key.Title)
+		batch = append(batch, row)
+		if len(batch) == metadataBatchSize {
+			uc.applyMetadataBatch(ctx, batch, summary)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		uc.applyMetadataBatch(ctx, batch, summary)
+	}
+
+	uc.logFor(ctx).Info("applyMetadataFile: done", "matched", summary.Matched, "updated", summary.Updated,
+		"unmatched", len(summary.Unmatched), "failed", len(summary.Errors))
+	return summary, nil
+}
+
+// applyMetadataBatch applies the batch in one transaction; if that fails
+// every row of it is reported as failed.
+func (uc *SongService) applyMetadataBatch(ctx context.Context, batch []metadataRow, summary *MetadataSummary) {
+	items := make([]models.SongMetadata, 0, len(batch))
+	for _, row := range batch {
+		items = append(items, row.meta)
+	}
+
+	outcomes, err := uc.repo.ApplyMetadata(ctx, items)
+	if err != nil {
+		for _, row := range batch {
+			summary.Errors = append(summary.Errors, ImportRowError{Line: row.line, Reason: err.Error()})
+		}
+		return
+	}
+	for i, outcome := range outcomes {
+		switch outcome {
+		case models.MetadataUpdated:
+			summary.Matched++
+			summary.Updated++
+		case models.MetadataUnchanged:
+			summary.Matched++
+		default:
+			summary.Unmatched = append(summary.Unmatched, UnmatchedRow{Line: batch[i].line, Key: batch[i].meta.Key})
+		}
+	}
+}
+
+// metadataRowError rejects a single mapping row.
+type metadataRowError struct {
+	line int
+	err  error
+}
+
+func (e *metadataRowError) Error() string { return fmt.Sprintf("line %d: %v", e.line, e.err) }
+
+// newMetadataCSVReader reads the header and returns a function yielding the
+// following rows, io.EOF at the end.
+func newMetadataCSVReader(r io.Reader) (func() (metadataRow, error), error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CSV header: %v", models.ErrValidation, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"group", "title"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must contain a %q column", models.ErrValidation, required)
+		}
+	}
+
+	return func() (metadataRow, error) {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return metadataRow{}, err
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+			}
+			return metadataRow{}, &metadataRowError{line: line, err: err}
+		}
+
+		song, err := songFromRecord(record, columns)
+		if err == nil {
+			err = checkHasMetadata(song)
+		}
+		if err != nil {
+			return metadataRow{}, &metadataRowError{line: line, err: err}
+		}
+		return metadataRow{line: line, meta: songMetadata(song)}, nil
+	}, nil
+}
+
+// newMetadataJSONReader consumes the opening bracket of the array and returns
+// a function decoding one entry per call, io.EOF after the last one.
+func newMetadataJSONReader(r io.Reader) (func() (metadataRow, error), error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("%w: JSON mapping must be an array", models.ErrValidation)
+	}
+
+	pos, broken := 0, false
+	return func() (metadataRow, error) {
+		if broken || !dec.More() {
+			return metadataRow{}, io.EOF
+		}
+		pos++
+
+		var entry metadataJSONRow
+		if err := dec.Decode(&entry); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return metadataRow{}, &metadataRowError{line: pos, err: fmt.Errorf("%w: %v", models.ErrValidation, err)}
+			}
+			// The decoder cannot resynchronise after a syntax error, so the
+			// rest of the file is dropped with this entry.
+			broken = true
+			return metadataRow{}, &metadataRowError{line: pos, err: fmt.Errorf("%w: %v; the remaining entries were not read", models.ErrValidation, err)}
+		}
+		song, err := songFromJSONRow(entry)
+		if err != nil {
+			return metadataRow{}, &metadataRowError{line: pos, err: err}
+		}
+		return metadataRow{line: pos, meta: songMetadata(song)}, nil
+	}, nil
+}
+
+func songFromJSONRow(entry metadataJSONRow) (models.Song, error) {
+	song := models.Song{
+		GroupName: strings.TrimSpace(entry.GroupName),
+		Title:     strings.TrimSpace(entry.Title),
+		Link:      strings.TrimSpace(entry.Link),
+		Text:      strings.TrimSpace(entry.Text),
+	}
+	if song.GroupName == "" || song.Title == "" {
+		return song, fmt.Errorf("%w: group and song are required", models.ErrValidation)
+	}
+	if date := strings.TrimSpace(entry.ReleaseDate); date != "" {
+		t, ok := models.ParseReleaseDate(date)
+		if !ok {
+			return song, fmt.Errorf("%w: invalid releaseDate %q", models.ErrValidation, date)
+		}
+		song.ReleaseDate = t
+	}
+	return song, checkHasMetadata(song)
+}
+
+// checkHasMetadata rejects rows that would not change anything.
+func checkHasMetadata(song models.Song) error {
+	if song.ReleaseDate.IsZero() && song.Link == "" && song.Text == "" {
+		return fmt.Errorf("%w: no release date, link or text to apply", models.ErrValidation)
+	}
+	return nil
+}
+
+func songMetadata(song models.Song) models.SongMetadata {
+	return models.SongMetadata{
+		Key:         models.SongKey{GroupName: song.GroupName, Title: song.Title},
+		ReleaseDate: song.ReleaseDate,
+		Link:        song.Link,
+		Text:        song.Text,
+	}
+}
@@ -0,0 +1,60 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+// lookupFailingRepo fails every lookup with err.
+type lookupFailingRepo struct {
+	models.SongRepository
+	err error
+}
+
+func (r lookupFailingRepo) GetByID(context.Context, int64) (*models.Song, error) { return nil, r.err }
+
+func (r lookupFailingRepo) BeginTx(context.Context) (models.SongRepositoryTx, error) {
+	return nil, r.err
+}
+
+func TestSongNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewInMemorySongRepository()
+	if _, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising"}); err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewSongService(repo, testutil.NewFakeExternalClient(), service.WithLogger(logger.NoopLogger{}))
+
+	if _, err := svc.GetSong(ctx, 999); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("GetSong: err = %v, want ErrSongNotFound", err)
+	}
+	if err := svc.UpdateSong(ctx, models.Song{ID: 999, GroupName: "Muse", Title: "Uprising"}); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("UpdateSong: err = %v, want ErrSongNotFound", err)
+	}
+	if err := svc.DeleteSong(ctx, 999); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("DeleteSong: err = %v, want ErrSongNotFound", err)
+	}
+
+	t.Run("database failure", func(t *testing.T) {
+		cause := errors.New("connection refused")
+		svc := service.NewSongService(lookupFailingRepo{memory.NewInMemorySongRepository(), cause}, testutil.NewFakeExternalClient(),
+			service.WithLogger(logger.NoopLogger{}))
+		_, getErr := svc.GetSong(ctx, 1)
+		for name, err := range map[string]error{
+			"GetSong":    getErr,
+			"UpdateSong": svc.UpdateSong(ctx, models.Song{ID: 1, GroupName: "Muse", Title: "Uprising"}),
+			"DeleteSong": svc.DeleteSong(ctx, 1),
+		} {
+			if !errors.Is(err, cause) || errors.Is(err, models.ErrSongNotFound) {
+				t.Errorf("%s: err = %v, want the database error, not ErrSongNotFound", name, err)
+			}
+		}
+	})
+}
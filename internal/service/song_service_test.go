@@ -0,0 +1,2007 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+
+	"song-library-test-task/internal/logger"
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/repository/memory"
+	"song-library-test-task/internal/service"
+	"song-library-test-task/internal/testutil"
+)
+
+// newService returns a quiet SongService over an in-memory repository and a
+// fake external client, which tests use to arrange and inspect state.
+func newService(t *testing.T, opts ...service.Option) (*service.SongService, models.SongRepository, *testutil.FakeExternalClient) {
+	t.Helper()
+	repo := memory.NewInMemorySongRepository()
+	client := testutil.NewFakeExternalClient()
+	opts = append([]service.Option{service.WithLogger(logger.NewStdLogger(logger.LevelError))}, opts...)
+	return service.NewSongService(repo, client, opts...), repo, client
+}
+
+// seed stores song directly in repo and returns its ID.
+func seed(t *testing.T, repo models.SongRepository, song models.Song) int64 {
+	t.Helper()
+	id, err := repo.Create(context.Background(), &song)
+	if err != nil {
+		t.Fatalf("seed %q: %v", song.Title, err)
+	}
+	return id
+}
+
+// stored returns the live song id from repo, or nil.
+func stored(t *testing.T, repo models.SongRepository, id int64) *models.Song {
+	t.Helper()
+	song, err := repo.GetByID(context.Background(), id)
+	if err != nil && !errors.Is(err, models.ErrDeleted) {
+		t.Fatalf("get song %d: %v", id, err)
+	}
+	return song
+}
+
+// count returns the number of live songs in repo.
+func count(t *testing.T, repo models.SongRepository) int64 {
+	t.Helper()
+	n, err := repo.Count(context.Background(), models.SongFilter{})
+	if err != nil {
+		t.Fatalf("count songs: %v", err)
+	}
+	return n
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSongKeyLength(t *testing.T) {
+	ctx := context.Background()
+	longest := strings.Repeat("é", models.MaxTitleLength)
+
+	t.Run("at the limit", func(t *testing.T) {
+		svc, repo, _ := newService(t)
+		id, _, err := svc.UpsertSong(ctx, strings.Repeat("ü", models.MaxGroupNameLength), longest, service.SongInfo{})
+		if err != nil {
+			t.Fatalf("UpsertSong: %v", err)
+		}
+		if song := stored(t, repo, id); song.Title != longest {
+			t.Errorf("stored title has %d bytes, want %d", len(song.Title), len(longest))
+		}
+	})
+
+	tests := []struct {
+		name         string
+		group, title string
+	}{
+		{"group too long", strings.Repeat("g", models.MaxGroupNameLength+1), "Uprising"},
+		{"title too long", "Muse", longest + "é"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, client := newService(t)
+			if _, _, err := svc.CreateSong(ctx, tt.group, tt.title, service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+				t.Errorf("CreateSong error = %v, want ErrValidation", err)
+			}
+			if _, _, err := svc.UpsertSong(ctx, tt.group, tt.title, service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+				t.Errorf("UpsertSong error = %v, want ErrValidation", err)
+			}
+			if client.Calls() != 0 {
+				t.Errorf("external API called %d times for an oversized key", client.Calls())
+			}
+			if n := count(t, repo); n != 0 {
+				t.Errorf("%d songs stored, want none", n)
+			}
+		})
+	}
+}
+
+func TestFindSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising (live)"})
+
+	song, err := svc.FindSong(ctx, "Muse", "Uprising")
+	if err != nil {
+		t.Fatalf("FindSong: %v", err)
+	}
+	if song.ID != id {
+		t.Errorf("found song %d, want %d", song.ID, id)
+	}
+
+	tests := []struct {
+		name         string
+		group, title string
+		want         error
+	}{
+		{"partial title", "Muse", "Upris", models.ErrSongNotFound},
+		{"other case", "muse", "uprising", models.ErrSongNotFound},
+		{"missing title", "Muse", "", models.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.FindSong(ctx, tt.group, tt.title); !errors.Is(err, tt.want) {
+				t.Errorf("FindSong error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListSongsMatchMode(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising (live)"})
+	seed(t, repo, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody"})
+
+	tests := []struct {
+		name   string
+		filter models.SongFilter
+		want   int
+	}{
+		{"substring", models.SongFilter{Title: "uprising"}, 2},
+		{"exact", models.SongFilter{Title: "Uprising", Match: models.MatchExact}, 1},
+		{"exact is case-sensitive", models.SongFilter{Title: "uprising", Match: models.MatchExact}, 0},
+		{"exact with an empty group", models.SongFilter{GroupName: "", Title: "Uprising", Match: models.MatchExact}, 1},
+		{"exact with no values", models.SongFilter{Match: models.MatchExact}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, err := svc.ListSongs(ctx, tt.filter, 10, 0)
+			if err != nil {
+				t.Fatalf("ListSongs: %v", err)
+			}
+			if len(songs) != tt.want {
+				t.Errorf("got %d songs, want %d", len(songs), tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		if _, err := svc.ListSongs(ctx, models.SongFilter{Match: "fuzzy"}, 10, 0); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("ListSongs error = %v, want ErrValidation", err)
+		}
+	})
+}
+
+// outcomeCounter is a metrics.Counter totalling what is added per value of
+// the "outcome" label.
+type outcomeCounter struct {
+	mu     sync.Mutex
+	totals map[string]float64
+	// outcome is the label value of a counter returned by With.
+	outcome string
+	parent  *outcomeCounter
+}
+
+func newOutcomeCounter() *outcomeCounter {
+	return &outcomeCounter{totals: make(map[string]float64)}
+}
+
+func (c *outcomeCounter) With(labelValues ...string) metrics.Counter {
+	child := &outcomeCounter{parent: c}
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		if labelValues[i] == "outcome" {
+			child.outcome = labelValues[i+1]
+		}
+	}
+	return child
+}
+
+func (c *outcomeCounter) Add(delta float64) {
+	root := c
+	if c.parent != nil {
+		root = c.parent
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.totals[c.outcome] += delta
+}
+
+func (c *outcomeCounter) total(outcome string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.totals[outcome]
+}
+
+func TestEnrichmentCounter(t *testing.T) {
+	ctx := context.Background()
+	counter := newOutcomeCounter()
+	svc, _, client := newService(t, service.WithEnrichmentCounter(counter))
+	client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+	client.SetSong("Muse", "Resistance", service.SongInfo{})
+
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Resistance", service.SongInfo{}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Unknown", service.SongInfo{}); !errors.Is(err, models.ErrExternalAPI) {
+		t.Fatalf("CreateSong error = %v, want ErrExternalAPI", err)
+	}
+
+	for outcome, want := range map[string]float64{
+		service.EnrichmentSuccess: 1,
+		service.EnrichmentEmpty:   1,
+		service.EnrichmentFailure: 1,
+	} {
+		if got := counter.total(outcome); got != want {
+			t.Errorf("%s enrichments = %v, want %v", outcome, got, want)
+		}
+	}
+}
+
+func TestReorderVerses(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one\n\ntwo\n\nthree"})
+
+	verses, err := svc.ReorderVerses(ctx, id, []int{2, 0, 1})
+	if err != nil {
+		t.Fatalf("ReorderVerses: %v", err)
+	}
+	if got := strings.Join(verses, ","); got != "three,one,two" {
+		t.Errorf("verses = %s, want three,one,two", got)
+	}
+	if song := stored(t, repo, id); song.Text != "three\n\none\n\ntwo" {
+		t.Errorf("stored text = %q", song.Text)
+	}
+
+	tests := []struct {
+		name  string
+		id    int64
+		order []int
+		want  error
+	}{
+		{"too few", id, []int{0, 1}, models.ErrValidation},
+		{"repeated", id, []int{0, 0, 1}, models.ErrValidation},
+		{"out of range", id, []int{0, 1, 3}, models.ErrValidation},
+		{"negative", id, []int{-1, 0, 1}, models.ErrValidation},
+		{"unknown song", 42, []int{0}, models.ErrSongNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.ReorderVerses(ctx, tt.id, tt.order); !errors.Is(err, tt.want) {
+				t.Errorf("ReorderVerses error = %v, want %v", err, tt.want)
+			}
+			if song := stored(t, repo, id); song.Text != "three\n\none\n\ntwo" {
+				t.Errorf("stored text changed to %q", song.Text)
+			}
+		})
+	}
+}
+
+// deadlineClient is an ExternalClient recording how long each call had until
+// its deadline.
+type deadlineClient struct {
+	remaining   time.Duration
+	hasDeadline bool
+}
+
+func (c *deadlineClient) FetchSongInfo(ctx context.Context, _, _ string) (*service.SongInfo, error) {
+	var deadline time.Time
+	deadline, c.hasDeadline = ctx.Deadline()
+	c.remaining = time.Until(deadline)
+	return &service.SongInfo{Link: "https://example.com"}, nil
+}
+
+func TestExternalBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []service.Option
+		budget float64
+	}{
+		{"default", nil, 0.7},
+		{"configured", []service.Option{service.WithExternalBudget(0.25)}, 0.25},
+		{"out of range is ignored", []service.Option{service.WithExternalBudget(1.5)}, 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &deadlineClient{}
+			opts := append([]service.Option{service.WithLogger(logger.NewStdLogger(logger.LevelError))}, tt.opts...)
+			svc := service.NewSongService(memory.NewInMemorySongRepository(), client, opts...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+			if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{}); err != nil {
+				t.Fatalf("CreateSong: %v", err)
+			}
+			want := time.Duration(tt.budget * float64(4*time.Second))
+			if !client.hasDeadline || client.remaining > want || client.remaining < want-200*time.Millisecond {
+				t.Errorf("external call had %v, want about %v", client.remaining, want)
+			}
+		})
+	}
+
+	t.Run("no request deadline", func(t *testing.T) {
+		client := &deadlineClient{}
+		svc := service.NewSongService(memory.NewInMemorySongRepository(), client, service.WithLogger(logger.NewStdLogger(logger.LevelError)))
+		if _, _, err := svc.CreateSong(context.Background(), "Muse", "Uprising", service.SongInfo{}); err != nil {
+			t.Fatalf("CreateSong: %v", err)
+		}
+		if client.hasDeadline {
+			t.Errorf("external call got a deadline the request did not have")
+		}
+	})
+}
+
+// slowClient is an ExternalClient taking a while to answer, recording the
+// most calls it had in flight at once.
+type slowClient struct {
+	inFlight, maxInFlight int32
+}
+
+func (c *slowClient) FetchSongInfo(ctx context.Context, _, songTitle string) (*service.SongInfo, error) {
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if songTitle == "Unknown" {
+		return nil, errors.New("no such song")
+	}
+	return &service.SongInfo{Link: "https://example.com/" + songTitle}, nil
+}
+
+func TestEnrichGroup(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewInMemorySongRepository()
+	client := &slowClient{}
+	svc := service.NewSongService(repo, client,
+		service.WithLogger(logger.NewStdLogger(logger.LevelError)),
+		service.WithEnrichConcurrency(2))
+
+	complete := seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4), Link: "l", Text: "t"})
+	seed(t, repo, models.Song{GroupName: "Queen", Title: "Bohemian Rhapsody"})
+	var ids []int64
+	for _, title := range []string{"A", "B", "Unknown", "C", "D"} {
+		ids = append(ids, seed(t, repo, models.Song{GroupName: "Muse", Title: title}))
+	}
+
+	results, err := svc.EnrichGroup(ctx, "Muse")
+	if err != nil {
+		t.Fatalf("EnrichGroup: %v", err)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("got %d results, want %d", len(results), len(ids))
+	}
+	for i, r := range results {
+		if r.SongID != ids[i] {
+			t.Errorf("result %d is for song %d, want %d", i, r.SongID, ids[i])
+		}
+		if failed := r.Err != nil; failed != (i == 2) {
+			t.Errorf("song %d: error = %v", r.SongID, r.Err)
+		}
+	}
+	if max := atomic.LoadInt32(&client.maxInFlight); max > 2 {
+		t.Errorf("%d external calls in flight, want at most 2", max)
+	}
+	if song := stored(t, repo, ids[0]); song.Link != "https://example.com/A" || song.EnrichedAt.IsZero() {
+		t.Errorf("song A = %+v, want it enriched", song)
+	}
+	if song := stored(t, repo, complete); !song.EnrichedAt.IsZero() {
+		t.Errorf("complete song was enriched again")
+	}
+
+	t.Run("no group", func(t *testing.T) {
+		if _, err := svc.EnrichGroup(ctx, ""); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("EnrichGroup error = %v, want ErrValidation", err)
+		}
+	})
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t, service.WithImportMaxRows(5))
+	client.SetSong("Muse", "Uprising", service.SongInfo{Text: "They will not force us"})
+	existing := seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight"})
+
+	csv := strings.Join([]string{
+		"id,Group,title,release_date,text",
+		"9,Muse,Uprising,2009-07-16,",                       // line 2: enriched
+		`,Muse,Resistance,,"Is our secret` + "\n" + `safe"`, // line 3: spans two lines, not enriched
+		",Muse,Starlight,,",                                 // line 5: exists
+		",,Nameless,,",                                      // line 6: no group
+		",Muse,Undated,someday,",                            // line 7: bad date
+		",Muse,Over the limit,,",                            // line 8: sixth row
+	}, "\n")
+
+	summary, err := svc.ImportCSV(ctx, strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ImportCSV: %v", err)
+	}
+	if summary.Imported != 2 || summary.Skipped != 1 || summary.Failed != 3 {
+		t.Errorf("summary = %+v, want 2 imported, 1 skipped, 3 failed", summary)
+	}
+	var lines []int
+	for _, e := range summary.Errors {
+		lines = append(lines, e.Line)
+	}
+	if len(lines) != 3 || lines[0] != 6 || lines[1] != 7 || lines[2] != 8 {
+		t.Errorf("errors on lines %v, want [6 7 8]", lines)
+	}
+	if len(summary.Warnings) != 2 || summary.Warnings[0].Line != 3 || summary.Warnings[1].Line != 5 {
+		t.Errorf("warnings = %+v, want lines 3 and 5", summary.Warnings)
+	}
+
+	uprising, _ := repo.GetByGroupAndTitle(ctx, "Muse", "Uprising")
+	if uprising == nil || uprising.Text != "They will not force us" || !uprising.ReleaseDate.Equal(day(2009, time.July, 16)) {
+		t.Errorf("Uprising = %+v, want the row's date and the external lyrics", uprising)
+	}
+	if uprising != nil && uprising.ID == 9 {
+		t.Errorf("the id column was used")
+	}
+	resistance, _ := repo.GetByGroupAndTitle(ctx, "Muse", "Resistance")
+	if resistance == nil || resistance.Text != "Is our secret\nsafe" {
+		t.Errorf("Resistance = %+v, want the multi-line lyrics", resistance)
+	}
+	if n := count(t, repo); n != 3 {
+		t.Errorf("%d songs stored, want 3 (existing song %d untouched)", n, existing)
+	}
+
+	t.Run("header without title", func(t *testing.T) {
+		if _, err := svc.ImportCSV(ctx, strings.NewReader("group,song\nMuse,Uprising\n")); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("ImportCSV error = %v, want ErrValidation", err)
+		}
+	})
+	t.Run("empty body", func(t *testing.T) {
+		if _, err := svc.ImportCSV(ctx, strings.NewReader("")); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("ImportCSV error = %v, want ErrValidation", err)
+		}
+	})
+}
+
+func TestRecentSongs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(20))
+	for i := 1; i <= 12; i++ {
+		seed(t, repo, models.Song{GroupName: "G", Title: strings.Repeat("x", i), IsPublic: i%2 == 0})
+	}
+
+	songs, err := svc.RecentSongs(ctx, false, 0)
+	if err != nil {
+		t.Fatalf("RecentSongs: %v", err)
+	}
+	if len(songs) != 10 || songs[0].ID != 12 || songs[9].ID != 3 {
+		t.Errorf("got %d songs from %d, want the default 10 newest from 12", len(songs), songs[0].ID)
+	}
+
+	songs, _ = svc.RecentSongs(ctx, true, 3)
+	if len(songs) != 3 || songs[0].ID != 12 || songs[1].ID != 10 || songs[2].ID != 8 {
+		t.Errorf("public songs = %v, want 12, 10, 8", songs)
+	}
+
+	for _, limit := range []int{-1, 21} {
+		if _, err := svc.RecentSongs(ctx, false, limit); !errors.Is(err, models.ErrPageOutOfRange) {
+			t.Errorf("limit %d: error = %v, want ErrPageOutOfRange", limit, err)
+		}
+	}
+}
+
+func TestListSongsPageRange(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(20))
+	for i := 1; i <= 25; i++ {
+		seed(t, repo, models.Song{GroupName: "G", Title: strings.Repeat("x", i)})
+	}
+
+	if songs, err := svc.ListSongs(ctx, models.SongFilter{}, 0, 0); err != nil || len(songs) != 10 {
+		t.Errorf("default page: %d songs, %v; want 10", len(songs), err)
+	}
+	if songs, err := svc.ListSongs(ctx, models.SongFilter{}, 20, 20); err != nil || len(songs) != 5 {
+		t.Errorf("last page: %d songs, %v; want 5", len(songs), err)
+	}
+	for _, page := range [][2]int{{-1, 0}, {21, 0}, {10, -1}} {
+		if _, err := svc.ListSongs(ctx, models.SongFilter{}, page[0], page[1]); !errors.Is(err, models.ErrPageOutOfRange) {
+			t.Errorf("limit %d offset %d: err = %v, want ErrPageOutOfRange", page[0], page[1], err)
+		}
+	}
+}
+
+func TestFieldPrecedence(t *testing.T) {
+	external := service.SongInfo{ReleaseDate: day(2009, time.July, 16), Link: "https://external.example.com"}
+	provided := service.SongInfo{Link: "https://client.example.com", Text: "client lyrics"}
+
+	tests := []struct {
+		name     string
+		opts     []service.Option
+		wantLink string
+	}{
+		{"client by default", nil, "https://client.example.com"},
+		{"client", []service.Option{service.WithFieldPrecedence(service.PrecedenceClient)}, "https://client.example.com"},
+		{"external", []service.Option{service.WithFieldPrecedence(service.PrecedenceExternal)}, "https://external.example.com"},
+		{"unknown policy is ignored", []service.Option{service.WithFieldPrecedence("newest")}, "https://client.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, client := newService(t, tt.opts...)
+			client.SetSong("Muse", "Uprising", external)
+
+			id, _, err := svc.CreateSong(context.Background(), "Muse", "Uprising", provided)
+			if err != nil {
+				t.Fatalf("CreateSong: %v", err)
+			}
+			song := stored(t, repo, id)
+			if song.Link != tt.wantLink {
+				t.Errorf("link = %q, want %q", song.Link, tt.wantLink)
+			}
+			// Fields only one side supplies are kept whatever the policy.
+			if song.Text != "client lyrics" || !song.ReleaseDate.Equal(external.ReleaseDate) {
+				t.Errorf("song = %+v, want the client's lyrics and the external date", song)
+			}
+		})
+	}
+}
+
+func TestRequireListFilter(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithRequireListFilter(true))
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	for _, filter := range []models.SongFilter{{}, {Match: models.MatchExact, PublicOnly: true}} {
+		if _, err := svc.ListSongs(ctx, filter, 10, 0); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("ListSongs(%+v) error = %v, want ErrValidation", filter, err)
+		}
+		if _, err := svc.ListSongIDs(ctx, filter, 10, 0); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("ListSongIDs(%+v) error = %v, want ErrValidation", filter, err)
+		}
+	}
+	for _, filter := range []models.SongFilter{
+		{GroupName: "muse"},
+		{SearchQuery: "uprising"},
+		{ReleasedBefore: day(2020, time.January, 1)},
+	} {
+		if _, err := svc.ListSongs(ctx, filter, 10, 0); err != nil {
+			t.Errorf("ListSongs(%+v): %v", filter, err)
+		}
+	}
+
+	t.Run("not required by default", func(t *testing.T) {
+		svc, _, _ := newService(t)
+		if _, err := svc.ListSongs(ctx, models.SongFilter{}, 10, 0); err != nil {
+			t.Errorf("ListSongs: %v", err)
+		}
+	})
+}
+
+// purgeRecorder is a repository remembering the cutoff of the last history
+// purge, which it reports as removing removed entries.
+type purgeRecorder struct {
+	models.SongRepository
+	cutoff  time.Time
+	removed int64
+}
+
+func (r *purgeRecorder) DeleteHistoryBefore(_ context.Context, before time.Time) (int64, error) {
+	r.cutoff = before
+	return r.removed, nil
+}
+
+func TestPurgeHistory(t *testing.T) {
+	ctx := context.Background()
+	repo := &purgeRecorder{SongRepository: memory.NewInMemorySongRepository(), removed: 3}
+	purged := newOutcomeCounter()
+
+	svc := service.NewSongService(repo, testutil.NewFakeExternalClient(), service.WithLogger(logger.NewStdLogger(logger.LevelError)))
+	if n, err := svc.PurgeHistory(ctx); err != nil || n != 0 || !repo.cutoff.IsZero() {
+		t.Errorf("without retention: removed %d, err = %v, cutoff = %v; want nothing purged", n, err, repo.cutoff)
+	}
+
+	svc = service.NewSongService(repo, testutil.NewFakeExternalClient(),
+		service.WithLogger(logger.NewStdLogger(logger.LevelError)),
+		service.WithHistoryRetention(24*time.Hour),
+		service.WithHistoryPurgeCounter(purged),
+	)
+	before := time.Now()
+	n, err := svc.PurgeHistory(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("PurgeHistory = %d, %v; want 3", n, err)
+	}
+	if want := before.Add(-24 * time.Hour); repo.cutoff.Before(want) || repo.cutoff.After(time.Now().Add(-24*time.Hour)) {
+		t.Errorf("cutoff = %v, want 24h before the purge", repo.cutoff)
+	}
+	if got := purged.total(""); got != 3 {
+		t.Errorf("purge counter = %v, want 3", got)
+	}
+}
+
+func TestPurgeHistoryKeepsRecentEntries(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithHistoryRetention(time.Hour))
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	if n, err := svc.PurgeHistory(ctx); err != nil || n != 0 {
+		t.Errorf("PurgeHistory = %d, %v; want nothing removed", n, err)
+	}
+	if _, total, _ := svc.SongHistory(ctx, id, 0, 0); total != 1 {
+		t.Errorf("%d history entries left, want the create", total)
+	}
+}
+
+func TestCreateSongAllowPartial(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enrichment fails", func(t *testing.T) {
+		svc, repo, _ := newService(t, service.WithAllowPartialEnrichment(true))
+		id, warnings, err := svc.CreateSong(ctx, "Muse", "Unknown", service.SongInfo{Link: "https://example.com"})
+		if err != nil {
+			t.Fatalf("CreateSong: %v", err)
+		}
+		joined := strings.Join(warnings, "; ")
+		if !strings.Contains(joined, "no info") || !strings.Contains(joined, "release date unknown") || !strings.Contains(joined, "lyrics unknown") {
+			t.Errorf("warnings = %q, want the external failure and the unknown fields", warnings)
+		}
+		if strings.Contains(joined, "link unknown") {
+			t.Errorf("warnings = %q, but the client supplied the link", warnings)
+		}
+		if song := stored(t, repo, id); song == nil || !song.EnrichedAt.IsZero() {
+			t.Errorf("stored song = %+v, want it stored unenriched", song)
+		}
+	})
+
+	t.Run("enrichment incomplete", func(t *testing.T) {
+		svc, _, client := newService(t, service.WithAllowPartialEnrichment(true))
+		client.SetSong("Muse", "Uprising", service.SongInfo{ReleaseDate: day(2009, time.July, 16), Link: "https://example.com"})
+		_, warnings, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{})
+		if err != nil || strings.Join(warnings, "; ") != "lyrics unknown" {
+			t.Errorf("warnings = %q, err = %v; want only lyrics unknown", warnings, err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		svc, repo, _ := newService(t)
+		_, warnings, err := svc.CreateSong(ctx, "Muse", "Unknown", service.SongInfo{})
+		if !errors.Is(err, models.ErrExternalAPI) || warnings != nil {
+			t.Errorf("warnings = %q, err = %v; want the ErrExternalAPI failure", warnings, err)
+		}
+		if n := count(t, repo); n != 0 {
+			t.Errorf("%d songs stored, want 0", n)
+		}
+	})
+}
+
+func TestSameReleaseDateSongs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	release := day(2009, time.September, 14)
+	uprising := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: release, IsPublic: true})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Resistance", ReleaseDate: release, IsPublic: true})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Undisclosed Desires", ReleaseDate: release})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4), IsPublic: true})
+	undated := seed(t, repo, models.Song{GroupName: "Muse", Title: "Demo", IsPublic: true})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Outtake", IsPublic: true})
+
+	names := func(songs []models.Song) string {
+		titles := make([]string, len(songs))
+		for i, s := range songs {
+			titles[i] = s.Title
+		}
+		return strings.Join(titles, ",")
+	}
+
+	tests := []struct {
+		name          string
+		id            int64
+		publicOnly    bool
+		limit, offset int
+		want          string
+	}{
+		{"same date, other songs only", uprising, false, 0, 0, "Resistance,Undisclosed Desires"},
+		{"public only", uprising, true, 0, 0, "Resistance"},
+		{"paginated", uprising, false, 1, 1, "Undisclosed Desires"},
+		{"unknown release date", undated, false, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, err := svc.SameReleaseDateSongs(ctx, tt.id, tt.publicOnly, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("SameReleaseDateSongs: %v", err)
+			}
+			if songs == nil {
+				t.Error("songs = nil, want an empty list at worst")
+			}
+			if got := names(songs); got != tt.want {
+				t.Errorf("songs = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := svc.SameReleaseDateSongs(ctx, 42, false, 0, 0); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+	if _, err := svc.SameReleaseDateSongs(ctx, 3, true, 0, 0); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("private song, public only: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+func TestExistingSongIDs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(3))
+	uprising := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	starlight := seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight"})
+	deleted := seed(t, repo, models.Song{GroupName: "Muse", Title: "Resistance"})
+	if err := repo.Delete(ctx, deleted); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	ids, err := svc.ExistingSongIDs(ctx, []models.SongKey{
+		{GroupName: "Muse", Title: "Starlight"},
+		{GroupName: "Muse", Title: "Resistance"},
+		{GroupName: "Muse", Title: "Uprising"},
+	}, false)
+	if err != nil {
+		t.Fatalf("ExistingSongIDs: %v", err)
+	}
+	if want := []int64{starlight, 0, uprising}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+
+	if ids, err := svc.ExistingSongIDs(ctx, nil, false); err != nil || len(ids) != 0 {
+		t.Errorf("no pairs: ids = %v, err = %v", ids, err)
+	}
+	if _, err := svc.ExistingSongIDs(ctx, make([]models.SongKey, 4), false); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("too many pairs: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestPatchSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	original := models.Song{
+		GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16),
+		Link: "https://example.com", Text: "one\n\ntwo",
+	}
+	id := seed(t, repo, original)
+
+	if err := svc.PatchSong(ctx, id, service.SongPatch{Title: ptr("Resistance"), Link: ptr("")}); err != nil {
+		t.Fatalf("PatchSong: %v", err)
+	}
+	song := stored(t, repo, id)
+	if song.Title != "Resistance" || song.Link != "" {
+		t.Errorf("patched fields: title = %q, link = %q; want Resistance and cleared", song.Title, song.Link)
+	}
+	if song.GroupName != original.GroupName || song.Text != original.Text || !song.ReleaseDate.Equal(original.ReleaseDate) {
+		t.Errorf("stored song = %+v, want the unset fields unchanged", song)
+	}
+
+	tests := []struct {
+		name  string
+		id    int64
+		patch service.SongPatch
+		want  error
+	}{
+		{"no fields", id, service.SongPatch{}, models.ErrValidation},
+		{"empty group", id, service.SongPatch{GroupName: ptr(" ")}, models.ErrValidation},
+		{"unknown ID", 42, service.SongPatch{Link: ptr("x")}, models.ErrSongNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := svc.PatchSong(ctx, tt.id, tt.patch); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if got := stored(t, repo, id); got.GroupName != "Muse" || got.Title != "Resistance" {
+				t.Errorf("stored song = %+v, want it unchanged", got)
+			}
+		})
+	}
+}
+
+// hangingClient answers instantly except for the title hang, whose call
+// blocks until its context is done.
+type hangingClient struct {
+	hang string
+}
+
+func (c hangingClient) FetchSongInfo(ctx context.Context, _, songTitle string) (*service.SongInfo, error) {
+	if songTitle == c.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &service.SongInfo{Link: "https://example.com/" + songTitle}, nil
+}
+
+func TestCreateSongsItemTimeout(t *testing.T) {
+	repo := memory.NewInMemorySongRepository()
+	svc := service.NewSongService(repo, hangingClient{hang: "Resistance"},
+		service.WithLogger(logger.NewStdLogger(logger.LevelError)),
+		service.WithItemEnrichTimeout(20*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	results, err := svc.CreateSongs(ctx, []service.NewSong{
+		{GroupName: "Muse", Title: "Uprising"},
+		{GroupName: "Muse", Title: "Resistance", Provided: service.SongInfo{Text: "one"}},
+		{GroupName: "Muse", Title: "Starlight"},
+		{GroupName: "", Title: "Untitled"},
+	})
+	if err != nil {
+		t.Fatalf("CreateSongs: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("batch took %v, want the hanging item cut off by its own timeout", elapsed)
+	}
+
+	wantStatus := []string{service.BatchItemCreated, service.BatchItemEnrichmentFailed, service.BatchItemCreated, service.BatchItemFailed}
+	for i, r := range results {
+		if r.Status != wantStatus[i] {
+			t.Errorf("item %d: status = %q (%v), want %q", i, r.Status, r.Err, wantStatus[i])
+		}
+	}
+	if !errors.Is(results[1].Err, context.DeadlineExceeded) {
+		t.Errorf("timed out item: err = %v, want DeadlineExceeded", results[1].Err)
+	}
+	if song := stored(t, repo, results[1].ID); song == nil || song.Text != "one" || !song.EnrichedAt.IsZero() {
+		t.Errorf("timed out item stored as %+v, want the client's fields, unenriched", song)
+	}
+	if song := stored(t, repo, results[2].ID); song == nil || song.Link != "https://example.com/Starlight" {
+		t.Errorf("item after the timeout stored as %+v, want it enriched", song)
+	}
+}
+
+func TestParseReleaseRange(t *testing.T) {
+	tests := []struct {
+		name, after, before string
+		wantFrom, wantTo    time.Time
+		wantErr             bool
+	}{
+		{"unbounded", "", "", time.Time{}, time.Time{}, false},
+		{"RFC 3339", "2006-01-01T00:00:00Z", "2009-12-31T23:00:00+03:00", day(2006, time.January, 1), day(2009, time.December, 31), false},
+		{"plain dates", "2006-01-01", "2006-01-01", day(2006, time.January, 1), day(2006, time.January, 1), false},
+		{"invalid after", "yesterday", "", time.Time{}, time.Time{}, true},
+		{"invalid before", "", "2009-13-01", time.Time{}, time.Time{}, true},
+		{"inverted", "2009-01-01", "2006-01-01", time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := service.ParseReleaseRange(tt.after, tt.before)
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrValidation) {
+					t.Errorf("err = %v, want ErrValidation", err)
+				}
+				return
+			}
+			if err != nil || !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("got %v to %v, err = %v; want %v to %v", from, to, err, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestListSongsReleaseRange(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Showbiz", ReleaseDate: day(1999, time.October, 4)})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight", ReleaseDate: day(2006, time.September, 4)})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.September, 7)})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Demo"})
+
+	filter := models.SongFilter{ReleasedAfter: day(2006, time.September, 4), ReleasedBefore: day(2009, time.September, 7), SortBy: models.SortByReleaseDate, SortDir: models.SortAsc}
+	songs, err := svc.ListSongs(ctx, filter, 10, 0)
+	if err != nil {
+		t.Fatalf("ListSongs: %v", err)
+	}
+	var titles []string
+	for _, s := range songs {
+		titles = append(titles, s.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Starlight,Uprising" {
+		t.Errorf("songs = %s, want the bounds included and unknown dates left out", got)
+	}
+
+	inverted := models.SongFilter{ReleasedAfter: day(2009, time.January, 1), ReleasedBefore: day(2006, time.January, 1)}
+	if _, err := svc.ListSongs(ctx, inverted, 10, 0); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("inverted range: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestCreateSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t)
+	client.SetSong("Muse", "Uprising", service.SongInfo{ReleaseDate: day(2009, time.July, 16), Text: "one\r\n\r\ntwo", Link: "https://example.com"})
+
+	id, warnings, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{})
+	if err != nil || warnings != nil {
+		t.Fatalf("CreateSong: warnings = %q, err = %v", warnings, err)
+	}
+	song := stored(t, repo, id)
+	if song == nil || !song.ReleaseDate.Equal(day(2009, time.July, 16)) || song.Text != "one\n\ntwo" || song.EnrichedAt.IsZero() {
+		t.Errorf("stored song = %+v, want it enriched with normalized lyrics", song)
+	}
+
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{}); !errors.Is(err, models.ErrDuplicateSong) {
+		t.Errorf("duplicate: err = %v, want ErrDuplicateSong", err)
+	}
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Unknown", service.SongInfo{}); !errors.Is(err, models.ErrExternalAPI) {
+		t.Errorf("external failure: err = %v, want ErrExternalAPI", err)
+	}
+	if _, _, err := svc.CreateSong(ctx, "Muse", strings.Repeat("x", models.MaxTitleLength+1), service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("title too long: err = %v, want ErrValidation", err)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d songs stored, want only the first", n)
+	}
+}
+
+func TestGetSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	if song, err := svc.GetSong(ctx, id); err != nil || song.Title != "Uprising" {
+		t.Errorf("GetSong = %+v, %v", song, err)
+	}
+	if _, err := svc.GetSong(ctx, 42); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetSong(ctx, id); !errors.Is(err, models.ErrDeleted) {
+		t.Errorf("deleted song: err = %v, want ErrDeleted", err)
+	}
+}
+
+func TestUpdateSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), Link: "https://example.com", Text: "old"})
+
+	if err := svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "Muse", Title: "Uprising", Text: "new  \n"}); err != nil {
+		t.Fatalf("UpdateSong: %v", err)
+	}
+	song := stored(t, repo, id)
+	if song.Text != "new" || song.Link != "" || !song.ReleaseDate.IsZero() {
+		t.Errorf("stored song = %+v, want every field replaced", song)
+	}
+
+	if err := svc.UpdateSong(ctx, models.Song{ID: 42, GroupName: "Muse", Title: "Uprising"}); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+	if err := svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "Muse"}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("missing title: err = %v, want ErrValidation", err)
+	}
+	if song := stored(t, repo, id); song.Title != "Uprising" {
+		t.Errorf("rejected update changed the song to %+v", song)
+	}
+}
+
+func TestDeleteSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Resistance"})
+
+	if err := svc.DeleteSong(ctx, id); err != nil {
+		t.Fatalf("DeleteSong: %v", err)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d songs left, want 1", n)
+	}
+	if err := svc.DeleteSong(ctx, 42); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+	if err := svc.DeleteSong(ctx, id); !errors.Is(err, models.ErrDeleted) {
+		t.Errorf("deleted twice: err = %v, want ErrDeleted", err)
+	}
+}
+
+func TestCountSongs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", IsPublic: true})
+	seed(t, repo, models.Song{GroupName: "MUSE", Title: "Resistance"})
+	seed(t, repo, models.Song{GroupName: "Queen", Title: "Innuendo", IsPublic: true})
+
+	tests := []struct {
+		name   string
+		filter models.SongFilter
+		want   int64
+	}{
+		{"all", models.SongFilter{}, 3},
+		{"substring ignores case", models.SongFilter{GroupName: "mus"}, 2},
+		{"public only", models.SongFilter{GroupName: "mus", PublicOnly: true}, 1},
+	}
+	for _, tt := range tests {
+		if n, err := svc.CountSongs(ctx, tt.filter); err != nil || n != tt.want {
+			t.Errorf("%s: CountSongs = %d, %v; want %d", tt.name, n, err, tt.want)
+		}
+	}
+	if _, err := svc.CountSongs(ctx, models.SongFilter{Match: "fuzzy"}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("unknown match mode: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestEnrichSongByID(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "kept"})
+	client.SetSong("Muse", "Uprising", service.SongInfo{ReleaseDate: day(2009, time.July, 16), Link: "https://example.com"})
+
+	song, err := svc.EnrichSongByID(ctx, id)
+	if err != nil {
+		t.Fatalf("EnrichSongByID: %v", err)
+	}
+	if !song.ReleaseDate.Equal(day(2009, time.July, 16)) || song.Link != "https://example.com" || song.Text != "kept" || song.EnrichedAt.IsZero() {
+		t.Errorf("song = %+v, want the external fields added and the lyrics kept", song)
+	}
+
+	if _, err := svc.EnrichSongByID(ctx, 42); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+	other := seed(t, repo, models.Song{GroupName: "Muse", Title: "Unknown"})
+	if _, err := svc.EnrichSongByID(ctx, other); !errors.Is(err, models.ErrExternalAPI) {
+		t.Errorf("external failure: err = %v, want ErrExternalAPI", err)
+	}
+}
+
+func TestSetSongVisibility(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+	if err := svc.SetSongVisibility(ctx, id, true); err != nil || !stored(t, repo, id).IsPublic {
+		t.Errorf("SetSongVisibility(true): err = %v, public = %v", err, stored(t, repo, id).IsPublic)
+	}
+	if err := svc.SetSongVisibility(ctx, id, false); err != nil || stored(t, repo, id).IsPublic {
+		t.Errorf("SetSongVisibility(false): err = %v, public = %v", err, stored(t, repo, id).IsPublic)
+	}
+	if err := svc.SetSongVisibility(ctx, 42, true); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown ID: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+func TestVerses(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(2))
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "one\ntwo\n\nthree\n\nfour"})
+
+	if n, err := svc.CountVerses(ctx, id, false); err != nil || n != 3 {
+		t.Errorf("CountVerses = %d, %v; want 3", n, err)
+	}
+	if verse, total, err := svc.GetVerse(ctx, id, false, 2); err != nil || verse != "three" || total != 3 {
+		t.Errorf("GetVerse(2) = %q of %d, %v", verse, total, err)
+	}
+	for _, n := range []int{0, 4} {
+		if _, total, err := svc.GetVerse(ctx, id, false, n); !errors.Is(err, models.ErrVerseNotFound) || total != 3 {
+			t.Errorf("GetVerse(%d) of %d: err = %v, want ErrVerseNotFound of 3", n, total, err)
+		}
+	}
+
+	page, err := svc.GetSongVerses(ctx, id, false, 1, 10)
+	if err != nil {
+		t.Fatalf("GetSongVerses: %v", err)
+	}
+	if page.PageSize != 2 || page.Total != 3 || len(page.Verses) != 2 || page.Verses[0] != (service.Verse{Number: 1, Text: "one\ntwo", Lines: 2}) {
+		t.Errorf("page = %+v, want the first 2 of 3 verses, page size capped at 2", page)
+	}
+
+	for name, call := range map[string]func() error{
+		"CountVerses":   func() error { _, err := svc.CountVerses(ctx, 42, false); return err },
+		"GetVerse":      func() error { _, _, err := svc.GetVerse(ctx, 42, false, 1); return err },
+		"GetSongVerses": func() error { _, err := svc.GetSongVerses(ctx, 42, false, 1, 1); return err },
+	} {
+		if err := call(); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("%s of an unknown song: err = %v, want ErrSongNotFound", name, err)
+		}
+	}
+
+	// The song is private, so it is hidden when only public songs may be read.
+	for name, call := range map[string]func() error{
+		"GetSongLyrics":   func() error { _, _, err := svc.GetSongLyrics(ctx, id, true, 1, 1); return err },
+		"GetSongVerses":   func() error { _, err := svc.GetSongVerses(ctx, id, true, 1, 1); return err },
+		"GetVerse":        func() error { _, _, err := svc.GetVerse(ctx, id, true, 1); return err },
+		"CountVerses":     func() error { _, err := svc.CountVerses(ctx, id, true); return err },
+		"LyricsWordStats": func() error { _, _, err := svc.LyricsWordStats(ctx, id, true, 1, ""); return err },
+		"GetSongLRC":      func() error { _, err := svc.GetSongLRC(ctx, id, true, 0); return err },
+		"ExportSongText":  func() error { _, _, err := svc.ExportSongText(ctx, id, true); return err },
+	} {
+		if err := call(); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("%s of a private song, public only: err = %v, want ErrSongNotFound", name, err)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Resistance"})
+	seed(t, repo, models.Song{GroupName: "Metallica", Title: "One"})
+	seed(t, repo, models.Song{GroupName: "Queen", Title: "Innuendo"})
+
+	groups, err := svc.SuggestGroups(ctx, "m", false, 10, true)
+	want := []models.GroupCount{{GroupName: "Metallica", SongCount: 1}, {GroupName: "Muse", SongCount: 2}}
+	if err != nil || !reflect.DeepEqual(groups, want) {
+		t.Errorf("SuggestGroups = %+v, %v; want %+v", groups, err, want)
+	}
+
+	groups, total, err := svc.ListGroups(ctx, "", false, 2, 2)
+	if err != nil || total != 3 || len(groups) != 1 || groups[0].GroupName != "Queen" {
+		t.Errorf("ListGroups = %+v of %d, %v; want Queen of 3", groups, total, err)
+	}
+	if _, _, err := svc.ListGroups(ctx, "", false, -1, 0); !errors.Is(err, models.ErrPageOutOfRange) {
+		t.Errorf("negative limit: err = %v, want ErrPageOutOfRange", err)
+	}
+}
+
+func TestSearchLyricsOrder(t *testing.T) {
+	svc, repo, _ := newService(t)
+	seed(t, repo, models.Song{GroupName: "Queen", Title: "Under Pressure", Text: "pressure pushing down", ReleaseDate: day(1981, time.October, 26)})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "pressure, pressure, pressure"})
+	seed(t, repo, models.Song{GroupName: "Muse", Title: "Hysteria", Text: "pressure and pressure", ReleaseDate: day(2003, time.December, 1)})
+	ctx := context.Background()
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"Uprising", "Hysteria", "Under Pressure"}},
+		{models.SearchOrderRelevance, []string{"Uprising", "Hysteria", "Under Pressure"}},
+		{models.SearchOrderReleaseDate, []string{"Hysteria", "Under Pressure", "Uprising"}},
+		{models.SearchOrderGroup, []string{"Hysteria", "Uprising", "Under Pressure"}},
+	}
+	for _, tt := range tests {
+		songs, err := svc.SearchLyrics(ctx, models.LyricsSearch{Query: "pressure", Order: tt.order}, 0, 0)
+		if err != nil {
+			t.Fatalf("order %q: %v", tt.order, err)
+		}
+		got := make([]string, len(songs))
+		for i, s := range songs {
+			got[i] = s.Title
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("order %q: got %v, want %v", tt.order, got, tt.want)
+		}
+	}
+
+	if _, err := svc.SearchLyrics(ctx, models.LyricsSearch{Query: "pressure", Order: "title"}, 0, 0); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("unknown order: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestRequireLyrics(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t, service.WithRequireLyrics(true))
+	client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+	client.SetSong("Muse", "Resistance", service.SongInfo{Text: "Is our secret safe tonight"})
+	client.SetSong("Muse", "Exogenesis", service.SongInfo{Text: " \n\n "})
+
+	for _, title := range []string{"Uprising", "Exogenesis"} {
+		if _, _, err := svc.CreateSong(ctx, "Muse", title, service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("%s without lyrics: err = %v, want ErrValidation", title, err)
+		}
+	}
+	if _, _, err := svc.UpsertSong(ctx, "Muse", "Starlight", service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("upsert without lyrics: err = %v, want ErrValidation", err)
+	}
+	results, err := svc.CreateSongs(ctx, []service.NewSong{{GroupName: "Muse", Title: "Uprising"}})
+	if err != nil || results[0].Status != service.BatchItemFailed || !errors.Is(results[0].Err, models.ErrValidation) {
+		t.Errorf("batch item without lyrics: results = %+v, err = %v", results, err)
+	}
+	if n := count(t, repo); n != 0 {
+		t.Fatalf("%d songs stored, want none without lyrics", n)
+	}
+
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Resistance", service.SongInfo{}); err != nil {
+		t.Errorf("lyrics found externally: %v", err)
+	}
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{Text: "Paranoia is in bloom"}); err != nil {
+		t.Errorf("lyrics provided: %v", err)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		svc, _, client := newService(t)
+		client.SetSong("Muse", "Uprising", service.SongInfo{Link: "https://example.com/uprising"})
+		if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{}); err != nil {
+			t.Errorf("CreateSong: %v", err)
+		}
+	})
+}
+
+func TestServiceLogging(t *testing.T) {
+	ctx := context.Background()
+	logs := &testutil.RecordingLogger{}
+	svc, _, client := newService(t, service.WithLogger(logs))
+	client.SetSong("Muse", "Uprising", service.SongInfo{Text: "Paranoia is in bloom"})
+
+	if _, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	entry, ok := logs.Find(logger.LevelInfo, "createSong")
+	if !ok {
+		t.Fatalf("no createSong message in %+v", logs.Entries())
+	}
+	if title, _ := entry.Value("title"); title != "Uprising" {
+		t.Errorf("createSong title = %v, want Uprising", title)
+	}
+	if _, ok := entry.Value("trace_id"); ok {
+		t.Errorf("createSong outside a request logged a trace_id")
+	}
+
+	t.Run("trace ID", func(t *testing.T) {
+		logs := &testutil.RecordingLogger{}
+		svc, repo, _ := newService(t, service.WithLogger(logs))
+		id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+		if _, err := svc.GetSong(logger.ContextWithTraceID(ctx, "trace-1"), id); err != nil {
+			t.Fatal(err)
+		}
+		entries := logs.Entries()
+		if len(entries) == 0 {
+			t.Fatal("nothing logged")
+		}
+		for _, e := range entries {
+			if id, _ := e.Value("trace_id"); id != "trace-1" {
+				t.Errorf("%q logged trace_id %v, want trace-1", e.Msg, id)
+			}
+		}
+	})
+
+	t.Run("nil logger", func(t *testing.T) {
+		svc, _, _ := newService(t, service.WithLogger(nil))
+		if _, _, err := svc.CreateSong(ctx, "Muse", "Unknown", service.SongInfo{}); err == nil {
+			t.Error("want the external failure")
+		}
+	})
+
+	t.Run("noop logger with nil fields", func(t *testing.T) {
+		svc, repo, _ := newService(t, service.WithLogger(logger.NoopLogger{}))
+		id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+		if _, err := svc.ListSongs(ctx, models.SongFilter{}, 0, 0); err != nil {
+			t.Errorf("ListSongs: %v", err)
+		}
+		if err := svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "Muse", Title: "Uprising"}); err != nil {
+			t.Errorf("UpdateSong: %v", err)
+		}
+	})
+}
+
+func TestMergeSongs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t)
+	source := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising (live)", ReleaseDate: day(2009, time.July, 16), Text: "source lyrics", Link: "https://example.com/live", IsPublic: true})
+	target := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "target lyrics"})
+
+	merged, err := svc.MergeSongs(ctx, source, target, "")
+	if err != nil {
+		t.Fatalf("MergeSongs: %v", err)
+	}
+	want := models.Song{GroupName: "Muse", Title: "Uprising", ReleaseDate: day(2009, time.July, 16), Link: "https://example.com/live", Text: "target lyrics"}
+	if merged.ID != target || merged.GroupName != want.GroupName || merged.Title != want.Title ||
+		!merged.ReleaseDate.Equal(want.ReleaseDate) || merged.Link != want.Link || merged.Text != want.Text || merged.IsPublic {
+		t.Errorf("merged = %+v, want the target's fields with the source's filling the gaps", merged)
+	}
+	if _, err := repo.GetByID(ctx, source); !errors.Is(err, models.ErrDeleted) {
+		t.Errorf("source: err = %v, want it soft-deleted", err)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d live songs, want 1", n)
+	}
+
+	t.Run("prefer source", func(t *testing.T) {
+		svc, repo, _ := newService(t)
+		source := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising (live)", Text: "source lyrics", IsPublic: true})
+		target := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "target lyrics", Link: "https://example.com/uprising"})
+		merged, err := svc.MergeSongs(ctx, source, target, service.MergePreferSource)
+		if err != nil {
+			t.Fatalf("MergeSongs: %v", err)
+		}
+		if merged.Title != "Uprising" || merged.Text != "source lyrics" || merged.Link != "https://example.com/uprising" || !merged.IsPublic {
+			t.Errorf("merged = %+v, want the source's fields over the target's", merged)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		svc, repo, _ := newService(t)
+		a := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+		b := seed(t, repo, models.Song{GroupName: "Muse", Title: "Resistance"})
+		if _, err := svc.MergeSongs(ctx, a, a, ""); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("into itself: err = %v, want ErrValidation", err)
+		}
+		if _, err := svc.MergeSongs(ctx, a, b, "newest"); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("unknown preference: err = %v, want ErrValidation", err)
+		}
+		if _, err := svc.MergeSongs(ctx, a, 42, ""); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("unknown target: err = %v, want ErrSongNotFound", err)
+		}
+		if n := count(t, repo); n != 2 {
+			t.Errorf("%d live songs, want both kept", n)
+		}
+	})
+}
+
+// metadataRecorder is a repository remembering the size of every metadata
+// batch it applies.
+type metadataRecorder struct {
+	models.SongRepository
+	batches []int
+}
+
+func (r *metadataRecorder) ApplyMetadata(ctx context.Context, items []models.SongMetadata) ([]string, error) {
+	r.batches = append(r.batches, len(items))
+	return r.SongRepository.ApplyMetadata(ctx, items)
+}
+
+func TestApplyMetadataFile(t *testing.T) {
+	ctx := context.Background()
+	repo := &metadataRecorder{SongRepository: memory.NewInMemorySongRepository()}
+	svc := service.NewSongService(repo, testutil.NewFakeExternalClient(), service.WithLogger(logger.NewStdLogger(logger.LevelError)))
+	uprising := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+	starlight := seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight", Link: "https://example.com/starlight"})
+
+	csv := strings.Join([]string{
+		"group,title,release_date,link",
+		"Muse,Uprising,2009-07-16,",                     // line 2: updated
+		"Muse,Starlight,,https://example.com/starlight", // line 3: already has the link
+		"Muse,Missing,2001-01-01,",                      // line 4: unmatched
+		"Muse,Undated,,",                                // line 5: nothing to apply
+	}, "\n")
+	summary, err := svc.ApplyMetadataFile(ctx, service.MetadataFormatCSV, strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ApplyMetadataFile: %v", err)
+	}
+	if summary.Matched != 2 || summary.Updated != 1 {
+		t.Errorf("summary = %+v, want 2 matched, 1 updated", summary)
+	}
+	if len(summary.Unmatched) != 1 || summary.Unmatched[0].Line != 4 || summary.Unmatched[0].Key.Title != "Missing" {
+		t.Errorf("unmatched = %+v, want Missing on line 4", summary.Unmatched)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Line != 5 {
+		t.Errorf("errors = %+v, want line 5", summary.Errors)
+	}
+	if song := stored(t, repo, uprising); !song.ReleaseDate.Equal(day(2009, time.July, 16)) {
+		t.Errorf("Uprising released %v, want 2009-07-16", song.ReleaseDate)
+	}
+	if song := stored(t, repo, starlight); song.Link != "https://example.com/starlight" {
+		t.Errorf("Starlight link = %q", song.Link)
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		repo.batches = nil
+		var rows []string
+		for i := 0; i < 250; i++ {
+			rows = append(rows, fmt.Sprintf(`{"group":"Muse","song":"Song %d","link":"https://example.com/%d"}`, i, i))
+		}
+		summary, err := svc.ApplyMetadataFile(ctx, service.MetadataFormatJSON, strings.NewReader("["+strings.Join(rows, ",")+"]"))
+		if err != nil {
+			t.Fatalf("ApplyMetadataFile: %v", err)
+		}
+		if len(summary.Unmatched) != 250 || summary.Unmatched[249].Line != 250 {
+			t.Errorf("%d unmatched rows, want 250 numbered by position", len(summary.Unmatched))
+		}
+		if !reflect.DeepEqual(repo.batches, []int{100, 100, 50}) {
+			t.Errorf("batches = %v, want [100 100 50]", repo.batches)
+		}
+	})
+	t.Run("not an array", func(t *testing.T) {
+		if _, err := svc.ApplyMetadataFile(ctx, service.MetadataFormatJSON, strings.NewReader(`{}`)); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("err = %v, want ErrValidation", err)
+		}
+	})
+}
+
+func TestUpsertSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t)
+	client.SetSong("Muse", "Uprising", service.SongInfo{Text: "external lyrics"})
+
+	id, created, err := svc.UpsertSong(ctx, "Muse", "Uprising", service.SongInfo{Text: "first", Link: "https://example.com/1"})
+	if err != nil || !created {
+		t.Fatalf("first UpsertSong = %d, %v, %v; want created", id, created, err)
+	}
+	again, created, err := svc.UpsertSong(ctx, "Muse", "Uprising", service.SongInfo{Text: "second", ReleaseDate: day(2009, time.July, 16)})
+	if err != nil || created || again != id {
+		t.Fatalf("second UpsertSong = %d, %v, %v; want song %d updated", again, created, err, id)
+	}
+
+	song := stored(t, repo, id)
+	if song.Text != "second" || song.Link != "" || !song.ReleaseDate.Equal(day(2009, time.July, 16)) {
+		t.Errorf("stored %+v, want the second call's fields", song)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+	if n := client.Calls(); n != 0 {
+		t.Errorf("external API called %d times, want none", n)
+	}
+}
+
+// gatedClient blocks every call until release is closed, announcing it on
+// started first.
+type gatedClient struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *gatedClient) FetchSongInfo(ctx context.Context, _, _ string) (*service.SongInfo, error) {
+	c.started <- struct{}{}
+	select {
+	case <-c.release:
+		return &service.SongInfo{Text: "lyrics"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestCreateSongOnce(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t, service.WithIdempotencyStore(memory.NewIdempotencyStore()))
+	for _, title := range []string{"Uprising", "Starlight"} {
+		client.SetSong("Muse", title, service.SongInfo{Text: "lyrics"})
+	}
+	client.SetSong("Queen", "One Vision", service.SongInfo{Text: "lyrics"})
+
+	id, _, replayed, err := svc.CreateSongOnce(ctx, "key-1", "Muse", "Uprising", service.SongInfo{})
+	if err != nil || replayed {
+		t.Fatalf("first CreateSongOnce = %d, replayed %v, %v", id, replayed, err)
+	}
+	again, _, replayed, err := svc.CreateSongOnce(ctx, "key-1", "Muse", "Uprising", service.SongInfo{})
+	if err != nil || !replayed || again != id {
+		t.Errorf("retry = %d, replayed %v, %v; want song %d replayed", again, replayed, err, id)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+	if n := client.Calls(); n != 1 {
+		t.Errorf("external API called %d times, want once", n)
+	}
+
+	t.Run("failed create releases the key", func(t *testing.T) {
+		client.SetError(models.ErrExternalAPI)
+		if _, _, _, err := svc.CreateSongOnce(ctx, "key-2", "Muse", "Starlight", service.SongInfo{}); err == nil {
+			t.Fatal("CreateSongOnce succeeded despite the failing external API")
+		}
+		client.SetError(nil)
+		if _, _, replayed, err := svc.CreateSongOnce(ctx, "key-2", "Muse", "Starlight", service.SongInfo{}); err != nil || replayed {
+			t.Errorf("retry after a failure: replayed %v, %v; want a fresh create", replayed, err)
+		}
+	})
+	t.Run("key too long", func(t *testing.T) {
+		key := strings.Repeat("k", service.MaxIdempotencyKeyLength+1)
+		if _, _, _, err := svc.CreateSongOnce(ctx, key, "Muse", "Resistance", service.SongInfo{}); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("err = %v, want ErrValidation", err)
+		}
+	})
+	t.Run("without a key", func(t *testing.T) {
+		first, _, _, err := svc.CreateSongOnce(ctx, "", "Queen", "One Vision", service.SongInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := svc.CreateSongOnce(ctx, "", "Queen", "One Vision", service.SongInfo{}); !errors.Is(err, models.ErrDuplicateSong) {
+			t.Errorf("second create of song %d: err = %v, want ErrDuplicateSong", first, err)
+		}
+	})
+}
+
+func TestCreateSongOnceConcurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewInMemorySongRepository()
+	client := &gatedClient{started: make(chan struct{}, 1), release: make(chan struct{})}
+	svc := service.NewSongService(repo, client,
+		service.WithLogger(logger.NewStdLogger(logger.LevelError)),
+		service.WithIdempotencyStore(memory.NewIdempotencyStore()),
+	)
+
+	type result struct {
+		id  int64
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		id, _, _, err := svc.CreateSongOnce(ctx, "key", "Muse", "Uprising", service.SongInfo{})
+		done <- result{id, err}
+	}()
+	<-client.started
+
+	if _, _, _, err := svc.CreateSongOnce(ctx, "key", "Muse", "Uprising", service.SongInfo{}); !errors.Is(err, models.ErrRequestInProgress) {
+		t.Errorf("concurrent retry: err = %v, want ErrRequestInProgress", err)
+	}
+	close(client.release)
+	first := <-done
+	if first.err != nil {
+		t.Fatalf("first request: %v", first.err)
+	}
+	if id, _, replayed, err := svc.CreateSongOnce(ctx, "key", "Muse", "Uprising", service.SongInfo{}); err != nil || !replayed || id != first.id {
+		t.Errorf("retry after completion = %d, replayed %v, %v; want song %d", id, replayed, err, first.id)
+	}
+	if n := count(t, repo); n != 1 {
+		t.Errorf("%d songs stored, want 1", n)
+	}
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newService(t)
+	if n, err := svc.PurgeIdempotencyKeys(ctx); err != nil || n != 0 {
+		t.Errorf("without a store: %d, %v", n, err)
+	}
+
+	svc, _, client := newService(t, service.WithIdempotencyStore(memory.NewIdempotencyStore()))
+	client.SetSong("Muse", "Uprising", service.SongInfo{Text: "lyrics"})
+	if _, _, _, err := svc.CreateSongOnce(ctx, "fresh", "Muse", "Uprising", service.SongInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := svc.PurgeIdempotencyKeys(ctx); err != nil || n != 0 {
+		t.Errorf("PurgeIdempotencyKeys = %d, %v; want the fresh key kept", n, err)
+	}
+}
+
+// staleLookupRepo misses the first lookup by group and title, as if the
+// song were created concurrently right after it.
+type staleLookupRepo struct {
+	models.SongRepository
+	missed bool
+}
+
+func (r *staleLookupRepo) GetByGroupAndTitle(ctx context.Context, groupName, title string) (*models.Song, error) {
+	if !r.missed {
+		r.missed = true
+		return nil, nil
+	}
+	return r.SongRepository.GetByGroupAndTitle(ctx, groupName, title)
+}
+
+func TestFindOrCreateSong(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t)
+	client.SetSong("Muse", "Starlight", service.SongInfo{Text: "lyrics"})
+	existingID := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Link: "https://example.com/uprising"})
+
+	id, existing, _, err := svc.FindOrCreateSong(ctx, "", "Muse", "Uprising", service.SongInfo{Link: "https://example.com/other"})
+	if err != nil || id != existingID || existing == nil || existing.Link != "https://example.com/uprising" {
+		t.Fatalf("existing song: FindOrCreateSong = %d, %+v, %v; want song %d unchanged", id, existing, err, existingID)
+	}
+	if n := client.Calls(); n != 0 {
+		t.Errorf("external API called %d times for an existing song", n)
+	}
+
+	id, existing, _, err = svc.FindOrCreateSong(ctx, "", "Muse", "Starlight", service.SongInfo{})
+	if err != nil || existing != nil || id == existingID {
+		t.Fatalf("new song: FindOrCreateSong = %d, %+v, %v; want a new song", id, existing, err)
+	}
+	if song := stored(t, repo, id); song == nil || song.Text != "lyrics" {
+		t.Errorf("stored %+v, want the enriched new song", song)
+	}
+
+	t.Run("created concurrently", func(t *testing.T) {
+		repo := &staleLookupRepo{SongRepository: memory.NewInMemorySongRepository()}
+		client := testutil.NewFakeExternalClient()
+		client.SetSong("Muse", "Uprising", service.SongInfo{})
+		svc := service.NewSongService(repo, client, service.WithLogger(logger.NewStdLogger(logger.LevelError)))
+		want := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising"})
+
+		id, existing, _, err := svc.FindOrCreateSong(ctx, "", "Muse", "Uprising", service.SongInfo{})
+		if err != nil || existing == nil || id != want {
+			t.Errorf("FindOrCreateSong = %d, %+v, %v; want the conflicting song %d", id, existing, err, want)
+		}
+	})
+}
+
+func TestCountWords(t *testing.T) {
+	lyrics := "Paranoia is in bloom,\nThe P.R. transmissions will resume\n\nThey'll try to push drugs that keep us all dumbed down\n" +
+		"And hope that we will never see the truth around\n\n(So come on!) Another promise, another seed\nThey’ll resume, they'll RESUME"
+
+	stats, total := service.CountWords(lyrics, 4, nil)
+	want := []service.WordCount{{"resume", 3}, {"they'll", 3}, {"another", 2}, {"that", 2}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("top 4 = %v, want %v", stats, want)
+	}
+	if total != 42 {
+		t.Errorf("total = %d, want 42", total)
+	}
+
+	stats, total = service.CountWords(lyrics, 3, map[string]bool{"resume": true, "they'll": true})
+	if want := []service.WordCount{{"another", 2}, {"that", 2}, {"the", 2}}; !reflect.DeepEqual(stats, want) {
+		t.Errorf("without stopwords: %v, want %v", stats, want)
+	}
+	if total != 36 {
+		t.Errorf("total without stopwords = %d, want 36", total)
+	}
+
+	if stats, total := service.CountWords("", 0, nil); len(stats) != 0 || total != 0 {
+		t.Errorf("empty lyrics: %v, %d", stats, total)
+	}
+	if stats, _ := service.CountWords("b a c a", 0, nil); len(stats) != 3 || stats[0].Word != "a" || stats[1].Word != "b" {
+		t.Errorf("top 0 = %v, want every word, ties alphabetical", stats)
+	}
+}
+
+func TestLyricsWordStats(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithMaxPageSize(5))
+	id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "They will not force us\nThey will stop degrading us\n\nAnd we will be victorious"})
+
+	stats, total, err := svc.LyricsWordStats(ctx, id, false, 2, service.StopwordsEnglish)
+	if err != nil {
+		t.Fatalf("LyricsWordStats: %v", err)
+	}
+	if want := []service.WordCount{{"degrading", 1}, {"force", 1}}; !reflect.DeepEqual(stats, want) || total != 4 {
+		t.Errorf("stats = %v of %d, want %v of 4", stats, total, want)
+	}
+	if stats, total, _ := svc.LyricsWordStats(ctx, id, false, 5, ""); total != 15 || len(stats) != 5 || stats[0] != (service.WordCount{Word: "will", Count: 3}) {
+		t.Errorf("all words: %v of %d, want will×3 first of 15", stats, total)
+	}
+
+	// The default top of 20 exceeds the max page size of 5.
+	for _, top := range []int{-1, 0, 6} {
+		if _, _, err := svc.LyricsWordStats(ctx, id, false, top, ""); !errors.Is(err, models.ErrPageOutOfRange) {
+			t.Errorf("top %d: err = %v, want ErrPageOutOfRange", top, err)
+		}
+	}
+	if _, _, err := svc.LyricsWordStats(ctx, id, false, 1, "de"); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("stopwords=de: err = %v, want ErrValidation", err)
+	}
+	if _, _, err := svc.LyricsWordStats(ctx, 42, false, 1, ""); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown song: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	tests := map[string]string{
+		"the rolling stones":   "The Rolling Stones",
+		"PAINT IT BLACK":       "Paint It Black",
+		"ABBA":                 "ABBA",
+		"AC/DC live":           "AC/DC Live",
+		"paul McCartney":       "Paul McCartney",
+		"don't stop me now":    "Don't Stop Me Now",
+		"(i can't get no) sat": "(I Can't Get No) Sat",
+		"ДДТ осень":            "ДДТ Осень",
+		"кино":                 "Кино",
+		"  double  spaces ":    "  Double  Spaces ",
+		"1999":                 "1999",
+		"":                     "",
+	}
+	for in, want := range tests {
+		if got := service.TitleCase(in); got != want {
+			t.Errorf("TitleCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTitleCaseNames(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, client := newService(t, service.WithTitleCase(true))
+	client.SetSong("The Rolling Stones", "Paint It Black", service.SongInfo{Text: "lyrics"})
+
+	id, _, err := svc.CreateSong(ctx, "the rolling stones", "PAINT IT BLACK", service.SongInfo{})
+	if err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if song := stored(t, repo, id); song.GroupName != "The Rolling Stones" || song.Title != "Paint It Black" || song.Text != "lyrics" {
+		t.Errorf("stored %q - %q (%q), want the title-cased names enriched", song.GroupName, song.Title, song.Text)
+	}
+	if _, _, err := svc.CreateSong(ctx, "The Rolling stones", "paint it black", service.SongInfo{}); !errors.Is(err, models.ErrDuplicateSong) {
+		t.Errorf("differently cased duplicate: err = %v, want ErrDuplicateSong", err)
+	}
+
+	if song, err := svc.FindSong(ctx, "THE ROLLING STONES", "paint it black"); err != nil || song.ID != id {
+		t.Errorf("FindSong = %v, %v; want song %d", song, err, id)
+	}
+	songs, err := svc.ListSongs(ctx, models.SongFilter{GroupName: "the rolling stones", Match: models.MatchExact}, 10, 0)
+	if err != nil || len(songs) != 1 {
+		t.Errorf("exact filter: %d songs, %v; want the song", len(songs), err)
+	}
+
+	if err := svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "ABBA", Title: "dancing queen"}); err != nil {
+		t.Fatalf("UpdateSong: %v", err)
+	}
+	if song := stored(t, repo, id); song.GroupName != "ABBA" || song.Title != "Dancing Queen" {
+		t.Errorf("updated to %q - %q, want ABBA - Dancing Queen", song.GroupName, song.Title)
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		svc, repo, client := newService(t)
+		client.SetSong("the rolling stones", "PAINT IT BLACK", service.SongInfo{})
+		id, _, err := svc.CreateSong(ctx, "the rolling stones", "PAINT IT BLACK", service.SongInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if song := stored(t, repo, id); song.GroupName != "the rolling stones" || song.Title != "PAINT IT BLACK" {
+			t.Errorf("stored %q - %q, want the names as given", song.GroupName, song.Title)
+		}
+	})
+}
+
+// updateFailingRepo fails every Update with err.
+type updateFailingRepo struct {
+	models.SongRepository
+	err error
+}
+
+func (r updateFailingRepo) Update(context.Context, *models.Song) error { return r.err }
+
+func TestReprocess(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newService(t, service.WithLyricsNormalization(true), service.WithTitleCase(true))
+	messy := seed(t, repo, models.Song{GroupName: " the white stripes ", Title: "seven nation army\t", Link: " https://example.com ", Text: "I'm gonna fight 'em off  \r\n\r\n\r\nA seven nation army\r\n"})
+	clean := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "Paranoia is in bloom"})
+	collides := seed(t, repo, models.Song{GroupName: "muse", Title: "Uprising"})
+	for i := 0; i < 250; i++ {
+		seed(t, repo, models.Song{GroupName: "queen", Title: fmt.Sprintf("Song %d", i)})
+	}
+
+	result, err := svc.Reprocess(ctx)
+	if err != nil {
+		t.Fatalf("Reprocess: %v", err)
+	}
+	if want := (service.ReprocessResult{Scanned: 253, Changed: 251, Rejected: 1}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	song := stored(t, repo, messy)
+	if song.GroupName != "The White Stripes" || song.Title != "Seven Nation Army" || song.Link != "https://example.com" {
+		t.Errorf("names and link = %q, %q, %q; want them trimmed and title cased", song.GroupName, song.Title, song.Link)
+	}
+	if want := "I'm gonna fight 'em off\n\nA seven nation army"; song.Text != want {
+		t.Errorf("text = %q, want %q", song.Text, want)
+	}
+	if song := stored(t, repo, clean); song.GroupName != "Muse" || song.Text != "Paranoia is in bloom" {
+		t.Errorf("clean song changed to %+v", song)
+	}
+	if song := stored(t, repo, collides); song.GroupName != "muse" {
+		t.Errorf("colliding song stored as %q, want it left alone", song.GroupName)
+	}
+
+	if again, err := svc.Reprocess(ctx); err != nil || again.Changed != 0 {
+		t.Errorf("second run = %+v, %v; want nothing left to change", again, err)
+	}
+
+	t.Run("update fails", func(t *testing.T) {
+		repo := memory.NewInMemorySongRepository()
+		seed(t, repo, models.Song{GroupName: " Muse ", Title: "Uprising"})
+		svc := service.NewSongService(updateFailingRepo{repo, errors.New("connection reset")}, testutil.NewFakeExternalClient(),
+			service.WithLogger(logger.NoopLogger{}))
+		if _, err := svc.Reprocess(ctx); err == nil || !strings.Contains(err.Error(), "connection reset") {
+			t.Errorf("err = %v, want the update failure", err)
+		}
+	})
+}
+
+func TestSongHistory(t *testing.T) {
+	ctx := context.Background()
+	svc, _, client := newService(t)
+	client.SetSong("Muse", "Uprising", service.SongInfo{Text: "Paranoia is in bloom"})
+
+	id, _, err := svc.CreateSong(ctx, "Muse", "Uprising", service.SongInfo{})
+	if err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if err := svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "Muse", Title: "Resistance", Text: "Love is our resistance"}); err != nil {
+		t.Fatalf("UpdateSong: %v", err)
+	}
+	if err := svc.DeleteSong(ctx, id); err != nil {
+		t.Fatalf("DeleteSong: %v", err)
+	}
+
+	entries, total, err := svc.SongHistory(ctx, id, 0, 0)
+	if err != nil {
+		t.Fatalf("SongHistory of a deleted song: %v", err)
+	}
+	if total != 3 || len(entries) != 3 {
+		t.Fatalf("got %d of %d entries, want 3", len(entries), total)
+	}
+	want := []struct{ op, title, text string }{
+		{models.HistoryCreate, "Uprising", "Paranoia is in bloom"},
+		{models.HistoryUpdate, "Resistance", "Love is our resistance"},
+		{models.HistoryDelete, "Resistance", "Love is our resistance"},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Operation != w.op || e.Snapshot.ID != id || e.Snapshot.Title != w.title || e.Snapshot.Text != w.text {
+			t.Errorf("entry %d = %s %q %q, want %s %q %q", i, e.Operation, e.Snapshot.Title, e.Snapshot.Text, w.op, w.title, w.text)
+		}
+		if e.OccurredAt.IsZero() || (i > 0 && e.OccurredAt.Before(entries[i-1].OccurredAt)) {
+			t.Errorf("entry %d occurred at %v, want it recorded in order", i, e.OccurredAt)
+		}
+	}
+
+	page, total, _ := svc.SongHistory(ctx, id, 1, 2)
+	if total != 3 || len(page) != 1 || page[0].Operation != models.HistoryDelete {
+		t.Errorf("page 3 = %+v of %d, want the delete", page, total)
+	}
+	if _, _, err := svc.SongHistory(ctx, 999, 0, 0); !errors.Is(err, models.ErrSongNotFound) {
+		t.Errorf("unknown song: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+// callRecorder records the repository calls made through it and its
+// transactions. Like the memory repository underneath, it ignores the
+// context, so it shows which queries the service itself chose to issue.
+type callRecorder struct {
+	models.SongRepository
+	calls *[]string
+}
+
+func (r callRecorder) record(name string) { *r.calls = append(*r.calls, name) }
+
+func (r callRecorder) BeginTx(ctx context.Context) (models.SongRepositoryTx, error) {
+	r.record("BeginTx")
+	tx, err := r.SongRepository.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return txRecorder{tx, r}, nil
+}
+
+func (r callRecorder) GetByID(ctx context.Context, id int64) (*models.Song, error) {
+	r.record("GetByID")
+	return r.SongRepository.GetByID(ctx, id)
+}
+
+func (r callRecorder) Create(ctx context.Context, song *models.Song) (int64, error) {
+	r.record("Create")
+	return r.SongRepository.Create(ctx, song)
+}
+
+func (r callRecorder) HardDelete(ctx context.Context, id int64) error {
+	r.record("HardDelete")
+	return r.SongRepository.HardDelete(ctx, id)
+}
+
+func (r callRecorder) History(ctx context.Context, id int64, limit, offset int) ([]models.HistoryEntry, int64, error) {
+	r.record("History")
+	return r.SongRepository.History(ctx, id, limit, offset)
+}
+
+type txRecorder struct {
+	models.SongRepositoryTx
+	r callRecorder
+}
+
+func (tx txRecorder) GetByID(ctx context.Context, id int64) (*models.Song, error) {
+	tx.r.record("tx.GetByID")
+	return tx.SongRepositoryTx.GetByID(ctx, id)
+}
+
+func (tx txRecorder) Update(ctx context.Context, song *models.Song) error {
+	tx.r.record("tx.Update")
+	return tx.SongRepositoryTx.Update(ctx, song)
+}
+
+func (tx txRecorder) Delete(ctx context.Context, id int64) error {
+	tx.r.record("tx.Delete")
+	return tx.SongRepositoryTx.Delete(ctx, id)
+}
+
+func (tx txRecorder) SetVisibility(ctx context.Context, id int64, public bool) error {
+	tx.r.record("tx.SetVisibility")
+	return tx.SongRepositoryTx.SetVisibility(ctx, id, public)
+}
+
+func (tx txRecorder) Commit() error {
+	tx.r.record("tx.Commit")
+	return tx.SongRepositoryTx.Commit()
+}
+
+func TestLockedWrites(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		call  func(svc *service.SongService, id int64) error
+		calls []string
+		check func(song models.Song) bool
+	}{
+		{"ReorderVerses", func(svc *service.SongService, id int64) error {
+			_, err := svc.ReorderVerses(ctx, id, []int{1, 0})
+			return err
+		}, []string{"BeginTx", "tx.GetByID", "tx.Update", "tx.Commit"}, func(song models.Song) bool {
+			return song.Text == "b\n\na"
+		}},
+		{"ReorderVerses invalid order", func(svc *service.SongService, id int64) error {
+			if _, err := svc.ReorderVerses(ctx, id, []int{0, 0}); !errors.Is(err, models.ErrValidation) {
+				return fmt.Errorf("err = %v, want ErrValidation", err)
+			}
+			return nil
+		}, []string{"BeginTx", "tx.GetByID"}, func(song models.Song) bool {
+			return song.Text == "a\n\nb"
+		}},
+		{"SetSongVisibility", func(svc *service.SongService, id int64) error {
+			return svc.SetSongVisibility(ctx, id, true)
+		}, []string{"BeginTx", "tx.GetByID", "tx.SetVisibility", "tx.Commit"}, func(song models.Song) bool {
+			return song.IsPublic
+		}},
+		{"SetSongVisibility unknown song", func(svc *service.SongService, _ int64) error {
+			if err := svc.SetSongVisibility(ctx, 999, true); !errors.Is(err, models.ErrSongNotFound) {
+				return fmt.Errorf("err = %v, want ErrSongNotFound", err)
+			}
+			return nil
+		}, []string{"BeginTx", "tx.GetByID"}, func(song models.Song) bool {
+			return !song.IsPublic
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memory.NewInMemorySongRepository()
+			id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "a\n\nb"})
+			var calls []string
+			svc := service.NewSongService(callRecorder{repo, &calls}, testutil.NewFakeExternalClient(), service.WithLogger(logger.NoopLogger{}))
+
+			if err := tt.call(svc, id); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("repository calls = %q, want %q", calls, tt.calls)
+			}
+			if song := stored(t, repo, id); !tt.check(*song) {
+				t.Errorf("stored song = %+v", song)
+			}
+		})
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		call func(svc *service.SongService, id int64) error
+		// calls are the repository calls made before the service notices
+		// the cancellation; none of them writes.
+		calls []string
+	}{
+		{"CreateSong", func(svc *service.SongService, _ int64) error {
+			_, _, err := svc.CreateSong(ctx, "Queen", "Bohemian Rhapsody", service.SongInfo{})
+			return err
+		}, nil},
+		{"UpdateSong", func(svc *service.SongService, id int64) error {
+			return svc.UpdateSong(ctx, models.Song{ID: id, GroupName: "Muse", Title: "Resistance"})
+		}, []string{"BeginTx", "tx.GetByID"}},
+		{"DeleteSong", func(svc *service.SongService, id int64) error {
+			return svc.DeleteSong(ctx, id)
+		}, []string{"BeginTx", "tx.GetByID"}},
+		{"PurgeSong", func(svc *service.SongService, id int64) error {
+			return svc.PurgeSong(ctx, id)
+		}, []string{"GetByID"}},
+		{"GetSongLyrics", func(svc *service.SongService, id int64) error {
+			_, _, err := svc.GetSongLyrics(ctx, id, false, 1, 10)
+			return err
+		}, []string{"GetByID"}},
+		{"SongHistory", func(svc *service.SongService, id int64) error {
+			_, _, err := svc.SongHistory(ctx, id, 0, 0)
+			return err
+		}, []string{"GetByID"}},
+		{"MergeSongs", func(svc *service.SongService, id int64) error {
+			_, err := svc.MergeSongs(ctx, id, id+1, "")
+			return err
+		}, []string{"GetByID"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memory.NewInMemorySongRepository()
+			id := seed(t, repo, models.Song{GroupName: "Muse", Title: "Uprising", Text: "a\n\nb"})
+			seed(t, repo, models.Song{GroupName: "Muse", Title: "Starlight"})
+			client := testutil.NewFakeExternalClient()
+			client.SetSong("Queen", "Bohemian Rhapsody", service.SongInfo{})
+			var calls []string
+			svc := service.NewSongService(callRecorder{repo, &calls}, client, service.WithLogger(logger.NoopLogger{}))
+
+			if err := tt.call(svc, id); !errors.Is(err, context.Canceled) {
+				t.Errorf("err = %v, want context.Canceled", err)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("repository calls = %q, want %q", calls, tt.calls)
+			}
+			if song := stored(t, repo, id); song.Title != "Uprising" {
+				t.Errorf("song changed to %+v", song)
+			}
+			if n := count(t, repo); n != 2 {
+				t.Errorf("%d songs stored, want 2", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"song-library-test-task/internal/models"
+)
+
+// TitleCase capitalises the first letter of every word of name and lowercases
+// the rest. Words written in upper case (such as "ABBA" or "AC/DC") are kept
+// as acronyms unless every word of a multi-word name is upper case, which is
+// taken as shouting; words in mixed case (such as "McCartney") are kept as
+// they are.
+func TitleCase(name string) string {
+	words := strings.Split(name, " ")
+	shouting := len(strings.Fields(name)) > 1 && isUpper(name)
+	for i, w := range words {
+		if w == "" || (!shouting && isUpper(w)) || (!isLower(w) && !isUpper(w)) {
+			continue
+		}
+		words[i] = capitalize(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalize uppercases the first letter of word and lowercases the rest.
+func capitalize(word string) string {
+	lower := strings.ToLower(word)
+	for i, r := range lower {
+		if unicode.IsLetter(r) {
+			return lower[:i] + string(unicode.ToUpper(r)) + lower[i+utf8.RuneLen(r):]
+		}
+	}
+	return lower
+}
+
+// isUpper reports whether s has letters and none of them is lower case.
+func isUpper(s string) bool {
+	return hasLetter(s) && strings.ToUpper(s) == s
+}
+
+// isLower reports whether s has letters and none of them is upper case.
+func isLower(s string) bool {
+	return hasLetter(s) && strings.ToLower(s) == s
+}
+
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+// songKey returns group and title in the form they are stored in: title
+// cased when WithTitleCase is enabled, unchanged otherwise.
+func (uc *SongService) songKey(groupName, songTitle string) (string, string) {
+	if !uc.titleCase {
+		return groupName, songTitle
+	}
+	return TitleCase(groupName), TitleCase(songTitle)
+}
+
+// storedFilter applies songKey to the group and title of an exact-match
+// filter, so it matches the stored names; substring matching ignores case.
+func (uc *SongService) storedFilter(filter models.SongFilter) models.SongFilter {
+	if filter.Match == models.MatchExact {
+		filter.GroupName, filter.Title = uc.songKey(filter.GroupName, filter.Title)
+	}
+	return filter
+}
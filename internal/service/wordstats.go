@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"song-library-test-task/internal/models"
+)
+
+// StopwordsEnglish selects the English stopword list in LyricsWordStats.
+const StopwordsEnglish = "en"
+
+// englishStopwords are common English words too frequent in any lyrics to
+// say anything about a song.
+var englishStopwords = wordSet(`a about all am an and any are as at be been but by can could did do
+does don't for from had has have he her him his how i i'm if in into is it it's its just me
+my no not now of oh on or our out she so than that the their them then there these they this
+to too up us was we were what when where which who why will with would yeah you you're your`)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// WordCount is a word of the lyrics and the number of times it occurs.
+type WordCount struct {
+	Word  string
+	Count int
+}
+
+// CountWords returns the top most frequent words of text, lowercased, with
+// their counts, most frequent first and ties in alphabetical order, together
+// with the number of words counted. Words are runs of letters, digits and
+// apostrophes; words in stopwords are skipped. top <= 0 returns every word.
+func CountWords(text string, top int, stopwords map[string]bool) ([]WordCount, int) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’'
+	})
+
+	counts := make(map[string]int)
+	total := 0
+	for _, w := range words {
+		w = strings.Trim(strings.ReplaceAll(w, "’", "'"), "'")
+		if w == "" || stopwords[w] {
+			continue
+		}
+		counts[w]++
+		total++
+	}
+
+	stats := make([]WordCount, 0, len(counts))
+	for w, n := range counts {
+		stats = append(stats, WordCount{Word: w, Count: n})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Word < stats[j].Word
+	})
+	if top > 0 && len(stats) > top {
+		stats = stats[:top]
+	}
+	return stats, total
+}
+
+// LyricsWordStats returns the top most frequent words of the song's lyrics
+// (see CountWords) and the number of words counted. top defaults to 20; a top
+// outside 1 to the configured max page size is models.ErrPageOutOfRange.
+// stopwords is empty to count every word or StopwordsEnglish to skip common
+// English words. With publicOnly set, a private song is
+// models.ErrSongNotFound.
+func (uc *SongService) LyricsWordStats(ctx context.Context, id int64, publicOnly bool, top int, stopwords string) ([]WordCount, int, error) {
+	uc.logFor(ctx).Debug("lyricsWordStats", "id", id, "top", top, "stopwords", stopwords)
+
+	var skip map[string]bool
+	switch stopwords {
+	case "":
+	case StopwordsEnglish:
+		skip = englishStopwords
+	default:
+		return nil, 0, fmt.Errorf("%w: stopwords must be empty or %q", models.ErrValidation, StopwordsEnglish)
+	}
+	if top == 0 {
+		top = 20
+	}
+	if top < 1 || top > uc.maxPageSize {
+		return nil, 0, fmt.Errorf("%w: top must be between 1 and %d", models.ErrPageOutOfRange, uc.maxPageSize)
+	}
+
+	song, err := uc.visibleSong(ctx, id, publicOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stats, total := CountWords(song.Text, top, skip)
+	return stats, total, nil
+}
@@ -0,0 +1,76 @@
+// Package testutil provides test doubles for wiring the service and HTTP
+// layers without external dependencies.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"song-library-test-task/internal/models"
+	"song-library-test-task/internal/service"
+)
+
+// FakeExternalClient is a service.ExternalClient answering from songs set
+// with SetSong. Songs it does not know fail like a 404 from the music API,
+// with models.ErrExternalAPI. It is safe for concurrent use.
+type FakeExternalClient struct {
+	mu    sync.Mutex
+	songs map[models.SongKey]service.SongInfo
+	err   error
+	calls int
+}
+
+var _ service.ExternalClient = (*FakeExternalClient)(nil)
+
+// NewFakeExternalClient returns a fake that knows no songs.
+func NewFakeExternalClient() *FakeExternalClient {
+	return &FakeExternalClient{songs: make(map[models.SongKey]service.SongInfo)}
+}
+
+// SetSong makes FetchSongInfo return info for groupName and songTitle.
+func (f *FakeExternalClient) SetSong(groupName, songTitle string, info service.SongInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.songs[models.SongKey{GroupName: groupName, Title: songTitle}] = info
+}
+
+// SetError makes every FetchSongInfo call fail with err; nil restores the
+// configured songs.
+func (f *FakeExternalClient) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// SetCircuitOpen makes every FetchSongInfo call fail as if the client's
+// circuit breaker were open (models.ErrCircuitOpen).
+func (f *FakeExternalClient) SetCircuitOpen() {
+	f.SetError(fmt.Errorf("fake external client: %w", models.ErrCircuitOpen))
+}
+
+// Calls returns the number of FetchSongInfo calls so far.
+func (f *FakeExternalClient) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// FetchSongInfo implements service.ExternalClient.
+func (f *FakeExternalClient) FetchSongInfo(ctx context.Context, groupName, songTitle string) (*service.SongInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	info, ok := f.songs[models.SongKey{GroupName: groupName, Title: songTitle}]
+	if !ok {
+		return nil, fmt.Errorf("%w: no info for %q by %q", models.ErrExternalAPI, songTitle, groupName)
+	}
+	return &info, nil
+}
@@ -0,0 +1,69 @@
+package testutil
+
+import (
+	"sync"
+
+	"song-library-test-task/internal/logger"
+)
+
+// LogEntry is a message logged through a RecordingLogger.
+type LogEntry struct {
+	Level   logger.Level
+	Msg     string
+	Keyvals []interface{}
+}
+
+// RecordingLogger is a logger.Logger keeping every message, so tests can
+// assert on what was logged. It is safe for concurrent use.
+type RecordingLogger struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+var _ logger.Logger = (*RecordingLogger)(nil)
+
+func (l *RecordingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.record(logger.LevelDebug, msg, keyvals)
+}
+func (l *RecordingLogger) Info(msg string, keyvals ...interface{}) {
+	l.record(logger.LevelInfo, msg, keyvals)
+}
+func (l *RecordingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.record(logger.LevelWarn, msg, keyvals)
+}
+func (l *RecordingLogger) Error(msg string, keyvals ...interface{}) {
+	l.record(logger.LevelError, msg, keyvals)
+}
+
+func (l *RecordingLogger) record(level logger.Level, msg string, keyvals []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, LogEntry{Level: level, Msg: msg, Keyvals: keyvals})
+}
+
+// Entries returns the messages logged so far, oldest first.
+func (l *RecordingLogger) Entries() []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]LogEntry(nil), l.entries...)
+}
+
+// Find returns the first message logged with msg at level, if any.
+func (l *RecordingLogger) Find(level logger.Level, msg string) (LogEntry, bool) {
+	for _, e := range l.Entries() {
+		if e.Level == level && e.Msg == msg {
+			return e, true
+		}
+	}
+	return LogEntry{}, false
+}
+
+// Value returns the value logged for key in e, if any.
+func (e LogEntry) Value(key string) (interface{}, bool) {
+	for i := 0; i+1 < len(e.Keyvals); i += 2 {
+		if e.Keyvals[i] == key {
+			return e.Keyvals[i+1], true
+		}
+	}
+	return nil, false
+}